@@ -11,6 +11,8 @@ import (
 
 var (
 	dbInstance *gorm.DB
+	// error de la conexión o de las migraciones, se devuelve en todas las llamadas
+	dbErr      error
 	once       sync.Once
 )
 
@@ -35,20 +37,20 @@ func getDsn() string {
 }
 
 // GetDB devuelve una instancia única de la conexión a la base de datos.
+// Las migraciones corren una sola vez, con la primera llamada.
 func GetDB() (*gorm.DB, error) {
-	var err error
 	once.Do(func() {
 		dsn := getDsn()
-		dbInstance, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	})
-	if err != nil {
-		return nil, err
-	}
+		dbInstance, dbErr = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+		if dbErr != nil {
+			return
+		}
 
-	// Migra las tablas a la base de datos.
-	err = migrations(dbInstance)
-	if err != nil {
-		return nil, err
+		// Migra las tablas a la base de datos.
+		dbErr = migrations(dbInstance)
+	})
+	if dbErr != nil {
+		return nil, dbErr
 	}
 	return dbInstance, nil
 }
@@ -64,5 +66,123 @@ func migrations(db *gorm.DB) error {
 		return err
 	}
 
+	err = migrateVideoDuration(db)
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.LoginThrottle{}, &models.LoginAudit{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.UserIdentity{}, &models.OIDCLoginState{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.DataExport{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.PlaybackSession{}, &models.ViewEvent{}, &models.ViewerLastView{})
+	if err != nil {
+		return err
+	}
+
+	// las vistas se deduplicaban con una llave por ventana fija, ahora con ViewerLastView
+	if db.Migrator().HasColumn(&models.ViewEvent{}, "dedup_key") {
+		err = db.Migrator().DropColumn(&models.ViewEvent{}, "dedup_key")
+		if err != nil {
+			return err
+		}
+	}
+
+	err = db.AutoMigrate(&models.PlaybackHeartbeat{}, &models.VideoWatchStats{}, &models.VideoRetentionBucket{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.VideoStatsHourly{}, &models.VideoViewersHourly{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.WatchProgress{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.VideoReaction{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.Comment{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.Subscription{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.NotificationEvent{}, &models.Notification{}, &models.NotificationDelivery{}, &models.NotificationSettings{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.VideoTag{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.Report{}, &models.Strike{}, &models.ModerationAction{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.StreamKey{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.ChatMessage{}, &models.ChatTimeout{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.ProcessingJob{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.VideoMetadata{})
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
+
+// migrateVideoDuration pasa la duración vieja, guardada como texto para mostrar ("45s" o "3:7"),
+// a duration_seconds y borra la columna. Lo que no tenga alguno de esos formatos queda en 0
+func migrateVideoDuration(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&models.VideoModel{}, "duration") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`UPDATE videos SET duration_seconds = CASE
+			WHEN duration ~ '^[0-9]+s$' THEN rtrim(duration, 's')::float8
+			WHEN duration ~ '^[0-9]+:[0-9]+$' THEN split_part(duration, ':', 1)::float8 * 60 + split_part(duration, ':', 2)::float8
+			ELSE 0 END`).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Migrator().DropColumn(&models.VideoModel{}, "duration")
+	})
+}
@@ -1,10 +1,13 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -26,6 +29,144 @@ type Config struct {
 	PostgresUser	 string
 	PostgresPassword string
 	PostgresDBName	 string
+
+	// Protección contra fuerza bruta en el login
+	LoginMaxAccountFailures int
+	LoginMaxIPFailures      int
+	LoginFailureWindow      time.Duration
+	LoginLockoutDuration    time.Duration
+	LoginBaseDelay          time.Duration
+	LoginMaxDelay           time.Duration
+
+	// Proveedores externos de identidad (OpenID Connect), indexados por nombre
+	OIDCProviders map[string]OIDCProviderConfig
+	OIDCStateTTL  time.Duration
+
+	// Tiempo que se puede deshacer el borrado de una cuenta antes de eliminarla por completo
+	AccountDeletionGracePeriod time.Duration
+	AccountPurgeInterval       time.Duration
+
+	// Exportación de datos personales
+	ExportLinkTTL       time.Duration
+	ExportPollInterval  time.Duration
+
+	// Conteo de vistas
+	ViewDedupWindow        time.Duration
+	ViewMinWatchSeconds    float64
+	ViewMaxPerIPPerVideo   int
+	ViewFlushInterval      time.Duration
+	// llave del HMAC con el que se anonimizan la IP y la huella del espectador
+	ViewerHashSecret       string
+
+	// Sesiones de reproducción y estadísticas de tiempo visto
+	PlaybackSessionTimeout     time.Duration
+	PlaybackHeartbeatMaxGap    time.Duration
+	PlaybackAggregateInterval  time.Duration
+	RetentionBucketSeconds     int
+
+	// Estadísticas por hora para los creadores
+	AnalyticsFlushInterval time.Duration
+	AnalyticsMaxPoints     int
+
+	// Moderación de comentarios: palabras que retienen el comentario para revisión,
+	// o retener todos hasta que el dueño del video los apruebe
+	CommentBlocklist     []string
+	CommentHoldForReview bool
+
+	// Notificaciones: cada cuánto revisan los workers, reintentos de los envíos y tamaño
+	// de los lotes al repartir a los suscriptores
+	NotificationPollInterval    time.Duration
+	NotificationMaxAttempts     int
+	NotificationRetryBaseDelay  time.Duration
+	NotificationFanOutBatchSize int
+	// permite webhooks a direcciones de la red local, solo para desarrollo
+	WebhookAllowPrivateNetworks bool
+
+	// Servidor SMTP para los emails, si no hay host los emails solo se escriben en el log
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+
+	// Tendencias: cada cuánto se recalcula el puntaje, cuántas horas de estadísticas se usan,
+	// en cuántas horas pierde la mitad de su peso la actividad y el peso de cada señal
+	TrendingRefreshInterval   time.Duration
+	TrendingWindow            time.Duration
+	TrendingHalfLife          time.Duration
+	TrendingViewWeight        float64
+	TrendingLikeWeight        float64
+	TrendingWatchMinuteWeight float64
+
+	// Moderación: usuarios que son admin al iniciar, faltas dentro de la ventana que
+	// suspenden la cuenta y por cuánto tiempo se suspende por defecto
+	AdminUsernames         []string
+	StrikeSuspendThreshold int
+	StrikeWindow           time.Duration
+	SuspendDuration        time.Duration
+
+	// Transmisiones en vivo: dirección del servidor RTMP, la URL que se le da a los
+	// encoders y el tamaño de los segmentos y de la ventana del playlist HLS
+	RTMPEnabled           bool
+	RTMPAddr              string
+	RTMPPublicURL         string
+	LiveHLSSegmentSeconds int
+	LiveHLSListSize       int
+	// cuánto se puede retroceder en una transmisión y si se graba para dejarla como video
+	LiveDVRWindow        time.Duration
+	LiveRecordingEnabled bool
+	// perfil de baja latencia (LL-HLS): duración de los segmentos parciales y el preset de
+	// x264 con el que se recodifica para poner un keyframe al inicio de cada parte
+	LiveLLPartDuration time.Duration
+	LiveLLPreset       string
+
+	// Chat de las transmisiones: mensajes por usuario en la ventana, modo lento inicial
+	// (0 = desactivado) y palabras que se tapan con asteriscos
+	ChatRateLimit  int
+	ChatRateWindow time.Duration
+	ChatSlowMode   time.Duration
+	ChatBlocklist  []string
+
+	// Perfiles de codificación de los videos subidos y el que se usa si no se elige uno
+	EncodingProfiles       map[string]EncodingProfileConfig
+	DefaultEncodingProfile string
+
+	// Tiempo máximo de cada etapa del procesamiento de un video subido (0 = sin límite),
+	// al pasarlo se mata ffmpeg y el video queda fallido
+	ProcessingProbeTimeout     time.Duration
+	ProcessingTranscodeTimeout time.Duration
+	ProcessingThumbnailTimeout time.Duration
+	ProcessingUploadTimeout    time.Duration
+	// Tiempo máximo para generar los tamaños de un avatar subido
+	ProcessingAvatarTimeout time.Duration
+}
+
+// OIDCProviderConfig es la configuración de un proveedor OpenID Connect.
+// Se define con OIDC_PROVIDERS=google,keycloak y las variables OIDC_<NOMBRE>_*
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// EncodingProfileConfig es la configuración de un perfil de codificación, ver loadEncodingProfiles.
+// Los servicios lo pasan a models.EncodingProfile
+type EncodingProfileConfig struct {
+	Name           string
+	VideoCodec     string
+	CRF            int
+	VideoBitrate   string
+	Preset         string
+	GOP            int
+	Height         int
+	SegmentSeconds int
+	AudioCodec     string
+	AudioBitrate   string
+	AudioChannels  int
+	Roles          []string
 }
 
 
@@ -63,15 +204,97 @@ func GetConfig() *Config {
 			PostgresUser: getEnv("POSTGRES_USER", "postgres"),
 			PostgresPassword: getEnv("POSTGRES_PASSWORD", "postgres"),
 			PostgresDBName: getEnv("POSTGRES_DBNAME", "golang"),
+
+			LoginMaxAccountFailures: getEnvAsInt("LOGIN_MAX_ACCOUNT_FAILURES", 5),
+			LoginMaxIPFailures: getEnvAsInt("LOGIN_MAX_IP_FAILURES", 20),
+			LoginFailureWindow: getEnvAsDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+			LoginLockoutDuration: getEnvAsDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+			LoginBaseDelay: getEnvAsDuration("LOGIN_BASE_DELAY", time.Second),
+			LoginMaxDelay: getEnvAsDuration("LOGIN_MAX_DELAY", 30*time.Second),
+
+			OIDCProviders: loadOIDCProviders(),
+			OIDCStateTTL: getEnvAsDuration("OIDC_STATE_TTL", 10*time.Minute),
+
+			AccountDeletionGracePeriod: getEnvAsDuration("ACCOUNT_DELETION_GRACE_PERIOD", 30*24*time.Hour),
+			AccountPurgeInterval: getEnvAsDuration("ACCOUNT_PURGE_INTERVAL", time.Hour),
+
+			ExportLinkTTL: getEnvAsDuration("EXPORT_LINK_TTL", 72*time.Hour),
+			ExportPollInterval: getEnvAsDuration("EXPORT_POLL_INTERVAL", time.Minute),
+
+			ViewDedupWindow: getEnvAsDuration("VIEW_DEDUP_WINDOW", 6*time.Hour),
+			ViewMinWatchSeconds: getEnvAsFloat("VIEW_MIN_WATCH_SECONDS", 30),
+			ViewMaxPerIPPerVideo: getEnvAsInt("VIEW_MAX_PER_IP_PER_VIDEO", 10),
+			ViewFlushInterval: getEnvAsDuration("VIEW_FLUSH_INTERVAL", 10*time.Second),
+			ViewerHashSecret: getEnv("VIEWER_HASH_SECRET", ""),
+
+			PlaybackSessionTimeout: getEnvAsDuration("PLAYBACK_SESSION_TIMEOUT", 5*time.Minute),
+			PlaybackHeartbeatMaxGap: getEnvAsDuration("PLAYBACK_HEARTBEAT_MAX_GAP", 30*time.Second),
+			PlaybackAggregateInterval: getEnvAsDuration("PLAYBACK_AGGREGATE_INTERVAL", time.Minute),
+			RetentionBucketSeconds: getEnvAsInt("RETENTION_BUCKET_SECONDS", 5),
+
+			AnalyticsFlushInterval: getEnvAsDuration("ANALYTICS_FLUSH_INTERVAL", 30*time.Second),
+			AnalyticsMaxPoints: getEnvAsInt("ANALYTICS_MAX_POINTS", 2000),
+
+			CommentBlocklist: getEnvAsList("COMMENT_BLOCKLIST"),
+			CommentHoldForReview: getEnvAsBool("COMMENT_HOLD_FOR_REVIEW", false),
+
+			NotificationPollInterval: getEnvAsDuration("NOTIFICATION_POLL_INTERVAL", 5*time.Second),
+			NotificationMaxAttempts: getEnvAsInt("NOTIFICATION_MAX_ATTEMPTS", 5),
+			NotificationRetryBaseDelay: getEnvAsDuration("NOTIFICATION_RETRY_BASE_DELAY", 30*time.Second),
+			NotificationFanOutBatchSize: getEnvAsInt("NOTIFICATION_FANOUT_BATCH_SIZE", 500),
+			WebhookAllowPrivateNetworks: getEnvAsBool("WEBHOOK_ALLOW_PRIVATE_NETWORKS", false),
+
+			SMTPHost: getEnv("SMTP_HOST", ""),
+			SMTPPort: getEnv("SMTP_PORT", "587"),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			SMTPFrom: getEnv("SMTP_FROM", ""),
+
+			TrendingRefreshInterval: getEnvAsDuration("TRENDING_REFRESH_INTERVAL", 15*time.Minute),
+			TrendingWindow: getEnvAsDuration("TRENDING_WINDOW", 72*time.Hour),
+			TrendingHalfLife: getEnvAsDuration("TRENDING_HALF_LIFE", 24*time.Hour),
+			TrendingViewWeight: getEnvAsFloat("TRENDING_VIEW_WEIGHT", 1),
+			TrendingLikeWeight: getEnvAsFloat("TRENDING_LIKE_WEIGHT", 5),
+			TrendingWatchMinuteWeight: getEnvAsFloat("TRENDING_WATCH_MINUTE_WEIGHT", 0.5),
+
+			AdminUsernames: getEnvAsList("ADMIN_USERNAMES"),
+			StrikeSuspendThreshold: getEnvAsInt("STRIKE_SUSPEND_THRESHOLD", 3),
+			StrikeWindow: getEnvAsDuration("STRIKE_WINDOW", 90*24*time.Hour),
+			SuspendDuration: getEnvAsDuration("SUSPEND_DURATION", 7*24*time.Hour),
+
+			RTMPEnabled: getEnvAsBool("RTMP_ENABLED", true),
+			RTMPAddr: getEnv("RTMP_ADDR", ":1935"),
+			RTMPPublicURL: getEnv("RTMP_PUBLIC_URL", "rtmp://localhost:1935/live"),
+			LiveHLSSegmentSeconds: getEnvAsInt("LIVE_HLS_SEGMENT_SECONDS", 2),
+			LiveHLSListSize: getEnvAsInt("LIVE_HLS_LIST_SIZE", 6),
+			LiveDVRWindow: getEnvAsDuration("LIVE_DVR_WINDOW", 30*time.Minute),
+			LiveRecordingEnabled: getEnvAsBool("LIVE_RECORDING_ENABLED", true),
+			LiveLLPartDuration: getEnvAsDuration("LIVE_LL_PART_DURATION", 500*time.Millisecond),
+			LiveLLPreset: getEnv("LIVE_LL_PRESET", "veryfast"),
+
+			ChatRateLimit: getEnvAsInt("CHAT_RATE_LIMIT", 5),
+			ChatRateWindow: getEnvAsDuration("CHAT_RATE_WINDOW", 10*time.Second),
+			ChatSlowMode: getEnvAsDuration("CHAT_SLOW_MODE", 0),
+			ChatBlocklist: getEnvAsList("CHAT_BLOCKLIST"),
+
+			EncodingProfiles: loadEncodingProfiles(),
+			DefaultEncodingProfile: strings.ToLower(getEnv("ENCODING_DEFAULT_PROFILE", "default")),
+
+			ProcessingProbeTimeout: getEnvAsDuration("PROCESSING_PROBE_TIMEOUT", time.Minute),
+			ProcessingTranscodeTimeout: getEnvAsDuration("PROCESSING_TRANSCODE_TIMEOUT", 2*time.Hour),
+			ProcessingThumbnailTimeout: getEnvAsDuration("PROCESSING_THUMBNAIL_TIMEOUT", time.Minute),
+			ProcessingUploadTimeout: getEnvAsDuration("PROCESSING_UPLOAD_TIMEOUT", 30*time.Minute),
+			ProcessingAvatarTimeout: getEnvAsDuration("PROCESSING_AVATAR_TIMEOUT", 30*time.Second),
 		}
 	})
 
 	return config
 }
 
+// loadEnv carga el .env si existe, sin él se usan las variables de entorno (docker, tests)
 func loadEnv() error {
 	err := godotenv.Load()
-	if err != nil {
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return fmt.Errorf("error loading .env: %v", err)
 	}
 
@@ -79,6 +302,82 @@ func loadEnv() error {
 
 }
 
+// loadOIDCProviders lee la lista de proveedores de OIDC_PROVIDERS y la configuración de cada uno,
+// ejm: OIDC_GOOGLE_ISSUER, OIDC_GOOGLE_CLIENT_ID, OIDC_GOOGLE_CLIENT_SECRET, OIDC_GOOGLE_REDIRECT_URL, OIDC_GOOGLE_SCOPES
+func loadOIDCProviders() map[string]OIDCProviderConfig {
+	providers := make(map[string]OIDCProviderConfig)
+
+	for _, name := range getEnvAsList("OIDC_PROVIDERS") {
+		name = strings.ToLower(name)
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		scopes := getEnvAsList(prefix + "SCOPES")
+		if len(scopes) == 0 {
+			scopes = []string{"openid", "email", "profile"}
+		}
+
+		providers[name] = OIDCProviderConfig{
+			Name:         name,
+			Issuer:       strings.TrimSuffix(getEnv(prefix+"ISSUER", ""), "/"),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", ""),
+			Scopes:       scopes,
+		}
+	}
+
+	return providers
+}
+
+// loadEncodingProfiles lee los perfiles de ENCODING_PROFILES y la configuración de cada uno, ejm:
+// ENCODING_PROFILE_HD_VIDEO_CODEC, _CRF, _VIDEO_BITRATE, _PRESET, _GOP, _HEIGHT, _SEGMENT_SECONDS,
+// _AUDIO_CODEC, _AUDIO_BITRATE, _AUDIO_CHANNELS y _ROLES. Siempre está el perfil "default", que
+// copia el audio y el video sin recodificar, salvo que se defina otro con ese nombre.
+func loadEncodingProfiles() map[string]EncodingProfileConfig {
+	profiles := map[string]EncodingProfileConfig{
+		"default": {Name: "default", VideoCodec: "copy", AudioCodec: "copy", SegmentSeconds: 10},
+	}
+
+	for _, name := range getEnvAsList("ENCODING_PROFILES") {
+		name = strings.ToLower(name)
+		prefix := "ENCODING_PROFILE_" + strings.ToUpper(name) + "_"
+
+		profile := EncodingProfileConfig{
+			Name:           name,
+			VideoCodec:     getEnv(prefix+"VIDEO_CODEC", "libx264"),
+			CRF:            getEnvAsInt(prefix+"CRF", 23),
+			VideoBitrate:   getEnv(prefix+"VIDEO_BITRATE", ""),
+			Preset:         getEnv(prefix+"PRESET", "medium"),
+			GOP:            getEnvAsInt(prefix+"GOP", 0),
+			Height:         getEnvAsInt(prefix+"HEIGHT", 0),
+			SegmentSeconds: getEnvAsInt(prefix+"SEGMENT_SECONDS", 10),
+			AudioCodec:     getEnv(prefix+"AUDIO_CODEC", "aac"),
+			AudioBitrate:   getEnv(prefix+"AUDIO_BITRATE", "128k"),
+			AudioChannels:  getEnvAsInt(prefix+"AUDIO_CHANNELS", 0),
+			Roles:          getEnvAsList(prefix + "ROLES"),
+		}
+
+		if profile.SegmentSeconds <= 0 {
+			profile.SegmentSeconds = 10
+		}
+
+		profiles[name] = profile
+	}
+
+	return profiles
+}
+
+// getEnvAsList obtiene una variable de entorno separada por comas como lista, ignorando los vacíos.
+func getEnvAsList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, ""), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 // getEnvAsBool obtiene una variable de entorno como booleano o retorna un valor por defecto.
 func getEnvAsBool(key string, defaultValue bool) bool {
 	valStr := getEnv(key, "")
@@ -88,6 +387,34 @@ func getEnvAsBool(key string, defaultValue bool) bool {
 	return defaultValue
 }
 
+// getEnvAsInt obtiene una variable de entorno como entero o retorna un valor por defecto.
+func getEnvAsInt(key string, defaultValue int) int {
+	valStr := getEnv(key, "")
+	if val, err := strconv.Atoi(valStr); err == nil {
+		return val
+	}
+	return defaultValue
+}
+
+// getEnvAsFloat obtiene una variable de entorno como número decimal o retorna un valor por defecto.
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	valStr := getEnv(key, "")
+	if val, err := strconv.ParseFloat(valStr, 64); err == nil {
+		return val
+	}
+	return defaultValue
+}
+
+// getEnvAsDuration obtiene una variable de entorno como duración (ej: "15m", "1h30m")
+// o retorna un valor por defecto.
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	valStr := getEnv(key, "")
+	if val, err := time.ParseDuration(valStr); err == nil {
+		return val
+	}
+	return defaultValue
+}
+
 func getEnv(key, defaultValue string) string {
 	value, exists := os.LookupEnv(key)
 	if !exists {
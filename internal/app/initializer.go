@@ -1,27 +1,120 @@
 package app
 
 import (
+	"context"
+	"log"
+
+	"github.com/unbot2313/go-streaming-service/config"
 	"github.com/unbot2313/go-streaming-service/internal/controllers"
+	"github.com/unbot2313/go-streaming-service/internal/rtmp"
 	"github.com/unbot2313/go-streaming-service/internal/services"
 )
 
 // InitializeComponents crea las instancias de los servicios y controladores
-func InitializeComponents() (controllers.UserController, controllers.AuthController, controllers.VideoController) {
+func InitializeComponents() controllers.Controllers {
 	// Inicializa los servicios
 	userService := services.NewUserService()
 	authService := services.NewAuthService()
+	oidcService := services.NewOIDCService(authService, userService)
+
+	// Inicializa los servicios de videos
+	S3configuration := services.GetS3Configuration()
+	filesService := services.NewFilesService()
+	transcoder := services.NewFFmpegTranscoder()
+	videoService := services.NewVideoService(S3configuration, filesService, transcoder, services.NewFFprobeProber())
+	avatarService := services.NewAvatarService(videoService, userService, transcoder)
+	dataExportService := services.NewDataExportService(videoService)
+
+	// Inicializa el servicio de notificaciones, también avisa cuando termina una exportación
+	notificationService := services.NewNotificationService(services.NewMailer())
+	dataExportService.SetNotifier(notificationService)
+	notificationController := controllers.NewNotificationController(notificationService)
 
 	// Inicializa los controladores
-	userController := controllers.NewUserController(userService)
-	authController := controllers.NewAuthController(authService)
+	userController := controllers.NewUserController(userService, avatarService, dataExportService)
+	authController := controllers.NewAuthController(authService, oidcService)
 
 	// Inicializa el controlador de videos
-	S3configuration := services.GetS3Configuration()
-	filesService := services.NewFilesService()
-	videoService := services.NewVideoService(S3configuration, filesService)
 	databaseVideoService := services.NewDatabaseVideoService()
-	videoController := controllers.NewVideoController(videoService, databaseVideoService)
+	analyticsService := services.NewAnalyticsService()
+	viewService := services.NewViewService(databaseVideoService, analyticsService)
+	watchHistoryService := services.NewWatchHistoryService(databaseVideoService)
+	reactionService := services.NewReactionService(databaseVideoService, analyticsService)
+	recommendationService := services.NewRecommendationService(databaseVideoService)
+	// los videos subidos se procesan en segundo plano
+	processingService := services.NewProcessingService(videoService, databaseVideoService, notificationService)
+	if err := processingService.RecoverJobs(); err != nil {
+		log.Println("error al recuperar los videos que se estaban procesando: ", err)
+	}
+	videoController := controllers.NewVideoController(videoService, databaseVideoService, viewService, watchHistoryService, reactionService, recommendationService, processingService)
+	historyController := controllers.NewHistoryController(watchHistoryService)
+	reactionController := controllers.NewReactionController(reactionService)
+	recommendationController := controllers.NewRecommendationController(recommendationService)
+
+	// Inicializa el controlador de comentarios
+	commentService := services.NewCommentService(databaseVideoService, notificationService)
+	commentController := controllers.NewCommentController(commentService)
+
+	// Inicializa el controlador de suscripciones
+	subscriptionService := services.NewSubscriptionService(userService)
+	subscriptionController := controllers.NewSubscriptionController(subscriptionService)
+
+	// Inicializa el controlador de moderación
+	moderationService := services.NewModerationService(databaseVideoService, userService)
+	if err := moderationService.EnsureAdmins(config.GetConfig().AdminUsernames); err != nil {
+		log.Println("error al asignar los usuarios admin: ", err)
+	}
+	moderationController := controllers.NewModerationController(moderationService)
+
+	// Inicializa las transmisiones en vivo, el servidor RTMP recibe los streams de los encoders
+	// el chat se cierra cuando termina la transmisión
+	chatService := services.NewChatService(databaseVideoService)
+	liveService := services.NewLiveService(userService, videoService, databaseVideoService, notificationService, chatService, transcoder)
+	liveController := controllers.NewLiveController(liveService, userService)
+	chatController := controllers.NewChatController(chatService, authService)
+	if err := liveService.RecoverBroadcasts(); err != nil {
+		log.Println("error al terminar las transmisiones anteriores: ", err)
+	}
+	if config.GetConfig().RTMPEnabled {
+		rtmpServer := rtmp.NewServer(config.GetConfig().RTMPAddr, liveService)
+		go func() {
+			if err := rtmpServer.ListenAndServe(context.Background()); err != nil {
+				log.Println("error en el servidor RTMP: ", err)
+			}
+		}()
+	}
+
+	// Inicializa el controlador de reproducción
+	playbackService := services.NewPlaybackService(viewService, watchHistoryService)
+	playbackController := controllers.NewPlaybackController(playbackService, databaseVideoService)
+
+	// Inicializa el controlador de estadísticas para creadores
+	studioController := controllers.NewStudioController(analyticsService, databaseVideoService)
 
+	// Inicia los procesos en segundo plano
+	accountPurgeService := services.NewAccountPurgeService(videoService)
+	go accountPurgeService.Run(context.Background())
+	go dataExportService.Run(context.Background())
+	go viewService.Run(context.Background())
+	go playbackService.Run(context.Background())
+	go analyticsService.Run(context.Background())
+	go notificationService.Run(context.Background())
+	go recommendationService.Run(context.Background())
 
-	return userController, authController, videoController
+	return controllers.Controllers{
+		User:           userController,
+		Auth:           authController,
+		Video:          videoController,
+		Playback:       playbackController,
+		Studio:         studioController,
+		History:        historyController,
+		Reaction:       reactionController,
+		Comment:        commentController,
+		Subscription:   subscriptionController,
+		Notification:   notificationController,
+		Recommendation: recommendationController,
+		Moderation:     moderationController,
+		Live:           liveController,
+		Chat:           chatController,
+	}
 }
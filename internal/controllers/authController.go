@@ -1,7 +1,11 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/unbot2313/go-streaming-service/internal/models"
@@ -11,16 +15,23 @@ import (
 type AuthController interface {
 	Login(c *gin.Context)
 	Register(c *gin.Context)
+	RestoreAccount(c *gin.Context)
+	OIDCLogin(c *gin.Context)
+	OIDCCallback(c *gin.Context)
 }
 
 // GetUserByUserName		godoc
 // @Summary 				Log in user
+// @Description 			Failed attempts are throttled per account and per IP, and always get the same response
 // @Tags 					Auth
 // @Produce 				json
 // @Accept 					json
 // @Param 					user body models.UserLogin{} true "User object containing all user details"
 // @Success 				200 {object} map[string]string
-// @Failure 				404 {object} map[string]string
+// @Failure 				400 {object} map[string]string
+// @Failure 				401 {object} map[string]string
+// @Failure 				403 {object} map[string]string
+// @Failure 				429 {object} map[string]string
 // @Failure 				500 {object} map[string]string
 // @Router 					/auth/login [post]
 func (controller *AuthControllerImp) Login(c *gin.Context) {
@@ -33,10 +44,10 @@ func (controller *AuthControllerImp) Login(c *gin.Context) {
 		return
 	}
 
-	token, err := controller.authService.Login(userLogin.Username, userLogin.Password)
+	token, err := controller.authService.Login(userLogin.Username, userLogin.Password, c.ClientIP())
 
 	if err != nil {
-		c.JSON(404, gin.H{"error": err.Error()})
+		respondCredentialsError(c, err)
 		return
 	}
 
@@ -46,17 +57,167 @@ func (controller *AuthControllerImp) Login(c *gin.Context) {
 	})
 }
 
+// RestoreAccount		godoc
+// @Summary 			Undo the deletion of an account
+// @Description 		Restores an account (and the videos deleted with it) during the grace period, returns a new token
+// @Tags 				Auth
+// @Produce 			json
+// @Accept 				json
+// @Param 				user body models.UserLogin{} true "Credentials of the deleted account"
+// @Success 			200 {object} map[string]string
+// @Failure 			400 {object} map[string]string
+// @Failure 			401 {object} map[string]string
+// @Failure 			403 {object} map[string]string
+// @Failure 			429 {object} map[string]string
+// @Failure 			500 {object} map[string]string
+// @Router 				/auth/restore [post]
+func (controller *AuthControllerImp) RestoreAccount(c *gin.Context) {
+
+	var userLogin models.UserLogin
+
+	if err := c.ShouldBindJSON(&userLogin); err != nil {
+		err = fmt.Errorf("se requiere de un usuario y contraseña")
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := controller.authService.RestoreAccount(userLogin.Username, userLogin.Password, c.ClientIP())
+
+	if err != nil {
+		respondCredentialsError(c, err)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Account restored",
+		"token": token,
+		"user": userLogin.Username,
+	})
+}
+
+// respondCredentialsError responde igual sin importar si falló el usuario o la contraseña
+func respondCredentialsError(c *gin.Context, err error) {
+	var lockedErr *services.LoginLockedError
+
+	if errors.As(err, &lockedErr) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(lockedErr.RetryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
+
+	if errors.Is(err, services.ErrInvalidCredentials) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var suspendedErr *services.AccountSuspendedError
+
+	if errors.As(err, &suspendedErr) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "suspended_until": suspendedErr.Until})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
 // Register es el controlador para el endpoint de registro
 func (controller *AuthControllerImp) Register(c *gin.Context) {
 	// Implementar
 }
 
 
+// OIDCLogin		godoc
+// @Summary 		Start login with an external identity provider
+// @Description 	Redirects to the OpenID Connect provider (authorization code + PKCE)
+// @Tags 			Auth
+// @Param 			provider path string true "Provider name, as configured in OIDC_PROVIDERS"
+// @Success 		302
+// @Failure 		404 {object} map[string]string
+// @Failure 		502 {object} map[string]string
+// @Router 			/auth/oidc/{provider}/login [get]
+func (controller *AuthControllerImp) OIDCLogin(c *gin.Context) {
+	authURL, err := controller.oidcService.AuthorizationURL(c.Param("provider"))
+
+	if errors.Is(err, services.ErrUnknownOIDCProvider) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback		godoc
+// @Summary 		Finish login with an external identity provider
+// @Description 	Links the external identity to a user (creating it on first login) and returns the service JWT
+// @Tags 			Auth
+// @Produce 		json
+// @Param 			provider path string true "Provider name"
+// @Param 			code query string true "Authorization code"
+// @Param 			state query string true "State returned by the provider"
+// @Success 		200 {object} map[string]string
+// @Failure 		400 {object} map[string]string
+// @Failure 		403 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		502 {object} map[string]string
+// @Router 			/auth/oidc/{provider}/callback [get]
+func (controller *AuthControllerImp) OIDCCallback(c *gin.Context) {
+
+	// el proveedor devuelve el error en la query si el usuario canceló el login
+	if providerErr := c.Query("error"); providerErr != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": providerErr, "description": c.Query("error_description")})
+		return
+	}
+
+	code := c.Query("code")
+	state := c.Query("state")
+
+	if code == "" || state == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "se requiere code y state"})
+		return
+	}
+
+	token, user, err := controller.oidcService.HandleCallback(c.Param("provider"), state, code)
+
+	if errors.Is(err, services.ErrUnknownOIDCProvider) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if errors.Is(err, services.ErrInvalidOIDCState) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var suspendedErr *services.AccountSuspendedError
+
+	if errors.As(err, &suspendedErr) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "suspended_until": suspendedErr.Until})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"token": token,
+		"user": user.Username,
+	})
+}
+
+
 type AuthControllerImp struct {
 	authService services.AuthService
+	oidcService services.OIDCService
 }
 
 // NewAuthController crea una nueva instancia del controlador de autenticación
-func NewAuthController(authService services.AuthService) AuthController {
-	return &AuthControllerImp{authService}
+func NewAuthController(authService services.AuthService, oidcService services.OIDCService) AuthController {
+	return &AuthControllerImp{authService, oidcService}
 }
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"github.com/unbot2313/go-streaming-service/internal/services"
+	"golang.org/x/net/websocket"
+)
+
+// tamaño máximo de lo que manda el cliente por el websocket
+const maxChatFrameBytes = 4096
+
+type ChatController interface {
+	Connect(c *gin.Context)
+	ListMessages(c *gin.Context)
+}
+
+// Connect			godoc
+// @Summary 		Join the chat of a live broadcast
+// @Description 	Opens a WebSocket to the chat of a video that is live. Everyone receives the events as JSON (message, delete, timeout, slow_mode, error, closed). Logged in users send {"type":"message","body":"..."}; the channel owner and moderators can also send delete (message_id), timeout (user_id, seconds) and slow_mode (seconds, 0 turns it off). Browsers can pass the token as access_token since they can not set headers. The chat is closed when the broadcast ends
+// @Tags 			live
+// @Param 			videoid path string true "Video ID"
+// @Param 			access_token query string false "JWT, for clients that can not send the Authorization header"
+// @Success 		101
+// @Failure 		404 {object} map[string]string
+// @Failure 		409 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/streaming/id/{videoid}/chat/ws [get]
+func (cc *ChatControllerImp) Connect(c *gin.Context) {
+	videoId := c.Param("videoid")
+
+	// los anónimos pueden leer el chat pero no escribir
+	var user *models.User
+	if value, exists := c.Get("user"); exists {
+		user, _ = value.(*models.User)
+	}
+
+	subscription, err := cc.chatService.Join(videoId)
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+	defer cc.chatService.Leave(subscription)
+
+	server := websocket.Server{
+		// el chat es público, no se revisa el Origin
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			ws.MaxPayloadBytes = maxChatFrameBytes
+
+			// los eventos se escriben en otra goroutine, cuando se cierra el chat se corta la conexión
+			go func() {
+				for event := range subscription.Events {
+					if err := websocket.JSON.Send(ws, event); err != nil {
+						break
+					}
+				}
+				ws.Close()
+			}()
+
+			for {
+				var command models.ChatCommand
+				if err := websocket.JSON.Receive(ws, &command); err != nil {
+					return
+				}
+
+				// la conexión puede durar toda la transmisión, así que la cuenta se vuelve a revisar
+				// en cada comando para que una suspensión o un cambio de rol apliquen de inmediato
+				if user != nil {
+					account, err := cc.authService.CheckAccount(user.Id)
+
+					var suspendedErr *services.AccountSuspendedError
+					if errors.As(err, &suspendedErr) || errors.Is(err, services.ErrUserNotFound) {
+						websocket.JSON.Send(ws, models.ChatEvent{Type: models.ChatEventError, Error: err.Error()})
+						return
+					}
+
+					if err != nil {
+						websocket.JSON.Send(ws, models.ChatEvent{Type: models.ChatEventError, Error: err.Error()})
+						continue
+					}
+
+					user.Role = account.Role
+				}
+
+				if err := cc.handleCommand(videoId, user, &command); err != nil {
+					websocket.JSON.Send(ws, models.ChatEvent{Type: models.ChatEventError, Error: err.Error()})
+				}
+			}
+		},
+	}
+
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+func (cc *ChatControllerImp) handleCommand(videoId string, user *models.User, command *models.ChatCommand) error {
+	// se acota antes de convertir para que un número enorme no dé la vuelta
+	if command.Seconds < 0 || command.Seconds > math.MaxInt32 {
+		return fmt.Errorf("%w: invalid seconds", services.ErrInvalidChatMessage)
+	}
+	duration := time.Duration(command.Seconds) * time.Second
+
+	switch command.Type {
+	case models.ChatEventMessage:
+		_, err := cc.chatService.Send(videoId, user, command.Body)
+		return err
+	case models.ChatEventDelete:
+		return cc.chatService.DeleteMessage(videoId, user, command.MessageID)
+	case models.ChatEventTimeout:
+		_, err := cc.chatService.TimeoutUser(videoId, user, command.UserID, duration)
+		return err
+	case models.ChatEventSlowMode:
+		return cc.chatService.SetSlowMode(videoId, user, duration)
+	default:
+		return errors.New("unknown command type " + strconv.Quote(command.Type))
+	}
+}
+
+// ListMessages		godoc
+// @Summary 		Get the chat replay
+// @Description 	The chat of a broadcast in the order it was sent, to replay it with the video. For a recording it returns the chat of the broadcast it came from. offset is the second of the broadcast the message was sent at, use from to start at a second of the video. Use next_cursor to get the next page
+// @Tags 			live
+// @Produce 		json
+// @Param 			videoid path string true "Video ID"
+// @Param 			from query number false "Second of the broadcast to start from"
+// @Param 			cursor query string false "Cursor returned by the previous page"
+// @Param 			limit query int false "Page size (max 100)" default(20)
+// @Success 		200 {object} models.ChatMessagePage{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/streaming/id/{videoid}/chat [get]
+func (cc *ChatControllerImp) ListMessages(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	from, _ := strconv.ParseFloat(c.Query("from"), 64)
+
+	page, err := cc.chatService.ListMessages(c.Param("videoid"), from, c.Query("cursor"), limit)
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func respondChatError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidCursor):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrVideoNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrChatClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+type ChatControllerImp struct {
+	chatService services.ChatService
+	authService services.AuthService
+}
+
+func NewChatController(chatService services.ChatService, authService services.AuthService) ChatController {
+	return &ChatControllerImp{chatService: chatService, authService: authService}
+}
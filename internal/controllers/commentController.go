@@ -0,0 +1,301 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"github.com/unbot2313/go-streaming-service/internal/services"
+)
+
+type CommentController interface {
+	CreateComment(c *gin.Context)
+	ListComments(c *gin.Context)
+	UpdateComment(c *gin.Context)
+	DeleteComment(c *gin.Context)
+	PinComment(c *gin.Context)
+	UnpinComment(c *gin.Context)
+	ListHeldComments(c *gin.Context)
+	ApproveComment(c *gin.Context)
+	RejectComment(c *gin.Context)
+}
+
+// CreateComment	godoc
+// @Summary 		Comment on a video
+// @Description 	Creates a comment, or a reply when parent_id is sent (only one level of replies). Depending on moderation the comment is published or held for review by the owner of the video
+// @Tags 			comments
+// @Accept 			json
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			videoid path string true "Video ID"
+// @Param 			comment body models.CommentRequest{} true "Comment"
+// @Success 		201 {object} models.Comment{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/streaming/id/{videoid}/comments [post]
+func (cc *CommentControllerImp) CreateComment(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	var request models.CommentRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	comment, err := cc.commentService.CreateComment(user.Id, c.Param("videoid"), &request)
+	if err != nil {
+		respondCommentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, comment)
+}
+
+// ListComments		godoc
+// @Summary 		List the comments of a video
+// @Description 	Visible top level comments of a video, or the replies of parent_id. The pinned comment comes apart in the first page. Use next_cursor to get the next page
+// @Tags 			comments
+// @Produce 		json
+// @Param 			videoid path string true "Video ID"
+// @Param 			parent_id query string false "List the replies of this comment"
+// @Param 			sort query string false "newest or top" default(newest)
+// @Param 			cursor query string false "Cursor returned by the previous page"
+// @Param 			limit query int false "Page size (max 100)" default(20)
+// @Success 		200 {object} models.CommentPage{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/streaming/id/{videoid}/comments [get]
+func (cc *CommentControllerImp) ListComments(c *gin.Context) {
+	sort := c.DefaultQuery("sort", models.CommentSortNewest)
+	if sort != models.CommentSortNewest && sort != models.CommentSortTop {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort debe ser newest o top"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	page, err := cc.commentService.ListComments(c.Param("videoid"), c.Query("parent_id"), sort, c.Query("cursor"), limit)
+	if err != nil {
+		respondCommentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// UpdateComment	godoc
+// @Summary 		Edit a comment
+// @Description 	Only the author can edit a comment. The new text goes through moderation again
+// @Tags 			comments
+// @Accept 			json
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			commentid path string true "Comment ID"
+// @Param 			comment body models.CommentUpdateRequest{} true "New text"
+// @Success 		200 {object} models.Comment{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		403 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/streaming/comments/{commentid} [patch]
+func (cc *CommentControllerImp) UpdateComment(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	var request models.CommentUpdateRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	comment, err := cc.commentService.UpdateComment(user.Id, c.Param("commentid"), request.Body)
+	if err != nil {
+		respondCommentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, comment)
+}
+
+// DeleteComment	godoc
+// @Summary 		Delete a comment
+// @Description 	The author or the owner of the video can delete a comment. Deleting a top level comment also deletes its replies
+// @Tags 			comments
+// @Security 		BearerAuth
+// @Param 			commentid path string true "Comment ID"
+// @Success 		204
+// @Failure 		403 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/streaming/comments/{commentid} [delete]
+func (cc *CommentControllerImp) DeleteComment(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	if err := cc.commentService.DeleteComment(user.Id, c.Param("commentid")); err != nil {
+		respondCommentError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// PinComment		godoc
+// @Summary 		Pin a comment
+// @Description 	The owner of the video can pin one visible top level comment, pinning another one replaces it
+// @Tags 			comments
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			commentid path string true "Comment ID"
+// @Success 		200 {object} models.Comment{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		403 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/streaming/comments/{commentid}/pin [put]
+func (cc *CommentControllerImp) PinComment(c *gin.Context) {
+	cc.setPinned(c, true)
+}
+
+// UnpinComment		godoc
+// @Summary 		Unpin a comment
+// @Description 	The owner of the video can unpin its pinned comment
+// @Tags 			comments
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			commentid path string true "Comment ID"
+// @Success 		200 {object} models.Comment{}
+// @Failure 		403 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/streaming/comments/{commentid}/pin [delete]
+func (cc *CommentControllerImp) UnpinComment(c *gin.Context) {
+	cc.setPinned(c, false)
+}
+
+func (cc *CommentControllerImp) setPinned(c *gin.Context, pinned bool) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	comment, err := cc.commentService.SetPinned(user.Id, c.Param("commentid"), pinned)
+	if err != nil {
+		respondCommentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, comment)
+}
+
+// ListHeldComments	godoc
+// @Summary 		List the comments held for review
+// @Description 	Comments of a video held by moderation. Only the owner of the video can see them
+// @Tags 			comments
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			videoid path string true "Video ID"
+// @Param 			cursor query string false "Cursor returned by the previous page"
+// @Param 			limit query int false "Page size (max 100)" default(20)
+// @Success 		200 {object} models.CommentPage{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		403 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/streaming/id/{videoid}/comments/held [get]
+func (cc *CommentControllerImp) ListHeldComments(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	page, err := cc.commentService.ListHeldComments(user.Id, c.Param("videoid"), c.Query("cursor"), limit)
+	if err != nil {
+		respondCommentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// ApproveComment	godoc
+// @Summary 		Approve a held comment
+// @Description 	Publishes a comment held for review. Only the owner of the video can do it
+// @Tags 			comments
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			commentid path string true "Comment ID"
+// @Success 		200 {object} models.Comment{}
+// @Failure 		403 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/streaming/comments/{commentid}/approve [post]
+func (cc *CommentControllerImp) ApproveComment(c *gin.Context) {
+	cc.review(c, true)
+}
+
+// RejectComment	godoc
+// @Summary 		Reject a comment
+// @Description 	Hides a comment from the video. Only the owner of the video can do it
+// @Tags 			comments
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			commentid path string true "Comment ID"
+// @Success 		200 {object} models.Comment{}
+// @Failure 		403 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/streaming/comments/{commentid}/reject [post]
+func (cc *CommentControllerImp) RejectComment(c *gin.Context) {
+	cc.review(c, false)
+}
+
+func (cc *CommentControllerImp) review(c *gin.Context, approve bool) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	comment, err := cc.commentService.ReviewComment(user.Id, c.Param("commentid"), approve)
+	if err != nil {
+		respondCommentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, comment)
+}
+
+func respondCommentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidCommentParent), errors.Is(err, services.ErrInvalidCursor):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrCommentForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrCommentNotFound), errors.Is(err, services.ErrVideoNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+type CommentControllerImp struct {
+	commentService services.CommentService
+}
+
+func NewCommentController(commentService services.CommentService) CommentController {
+	return &CommentControllerImp{commentService: commentService}
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"github.com/unbot2313/go-streaming-service/internal/services"
+)
+
+// authenticatedUser recupera el usuario que guardó el AuthMiddleware en el contexto,
+// si no está responde con error y devuelve false
+func authenticatedUser(c *gin.Context) (*models.User, bool) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(500, gin.H{"error": "User not found in context"})
+		return nil, false
+	}
+
+	authenticatedUser, ok := user.(*models.User)
+	if !ok {
+		c.JSON(500, gin.H{"error": "Failed to parse user data"})
+		return nil, false
+	}
+
+	return authenticatedUser, true
+}
+
+// currentViewer identifica a quien reproduce el video: el usuario si hay token,
+// o una huella anónima de la IP y el navegador
+func currentViewer(c *gin.Context) models.Viewer {
+	ipHash := services.HashViewerValue(c.ClientIP())
+
+	viewer := models.Viewer{
+		Fingerprint: services.HashViewerValue(c.ClientIP(), c.GetHeader("User-Agent")),
+		IPHash:      ipHash,
+	}
+
+	if user, exists := c.Get("user"); exists {
+		if authenticatedUser, ok := user.(*models.User); ok {
+			viewer.UserID = authenticatedUser.Id
+		}
+	}
+
+	return viewer
+}
+
+// ownedVideo busca el video y verifica que sea del usuario autenticado,
+// si no lo es responde con error y devuelve false
+func ownedVideo(c *gin.Context, databaseVideoService services.DatabaseVideoService, user *models.User, videoId string) (*models.VideoModel, bool) {
+	video, err := databaseVideoService.FindVideoByID(videoId)
+
+	if errors.Is(err, services.ErrVideoNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	if video.UserID != user.Id {
+		c.JSON(http.StatusForbidden, gin.H{"error": "El video no pertenece al usuario"})
+		return nil, false
+	}
+
+	return video, true
+}
@@ -0,0 +1,19 @@
+package controllers
+
+// Controllers agrupa los controladores que usan las rutas
+type Controllers struct {
+	User           UserController
+	Auth           AuthController
+	Video          VideoController
+	Playback       PlaybackController
+	Studio         StudioController
+	History        HistoryController
+	Reaction       ReactionController
+	Comment        CommentController
+	Subscription   SubscriptionController
+	Notification   NotificationController
+	Recommendation RecommendationController
+	Moderation     ModerationController
+	Live           LiveController
+	Chat           ChatController
+}
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unbot2313/go-streaming-service/internal/services"
+)
+
+type HistoryController interface {
+	GetHistory(c *gin.Context)
+	ClearHistory(c *gin.Context)
+	RemoveFromHistory(c *gin.Context)
+	GetContinueWatching(c *gin.Context)
+}
+
+// GetHistory		godoc
+// @Summary 		Get the watch history
+// @Description 	Videos watched by the authenticated user, most recent first, with the position where playback stopped. Use next_cursor to get the next page
+// @Tags 			history
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			cursor query string false "Cursor returned by the previous page"
+// @Param 			limit query int false "Page size (max 100)" default(20)
+// @Success 		200 {object} models.HistoryPage{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/users/me/history [get]
+func (hc *HistoryControllerImp) GetHistory(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	page, err := hc.watchHistoryService.ListHistory(user.Id, c.Query("cursor"), limit)
+
+	if errors.Is(err, services.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, newHistoryPageJSON(page))
+}
+
+// ClearHistory		godoc
+// @Summary 		Clear the watch history
+// @Description 	Removes every video from the watch history of the authenticated user, including the saved playback positions
+// @Tags 			history
+// @Security 		BearerAuth
+// @Success 		204
+// @Failure 		500 {object} map[string]string
+// @Router 			/users/me/history [delete]
+func (hc *HistoryControllerImp) ClearHistory(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	if err := hc.watchHistoryService.ClearHistory(user.Id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RemoveFromHistory	godoc
+// @Summary 		Remove a video from the watch history
+// @Description 	Removes one video from the watch history of the authenticated user, including its saved playback position
+// @Tags 			history
+// @Security 		BearerAuth
+// @Param 			videoid path string true "Video ID"
+// @Success 		204
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/users/me/history/{videoid} [delete]
+func (hc *HistoryControllerImp) RemoveFromHistory(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	err := hc.watchHistoryService.RemoveFromHistory(user.Id, c.Param("videoid"))
+
+	if errors.Is(err, services.ErrHistoryItemNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetContinueWatching	godoc
+// @Summary 		Get the videos to continue watching
+// @Description 	Videos the authenticated user started and did not finish, most recent first
+// @Tags 			history
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			limit query int false "Number of videos (max 100)" default(20)
+// @Success 		200 {array} models.HistoryItem{}
+// @Failure 		500 {object} map[string]string
+// @Router 			/users/me/continue-watching [get]
+func (hc *HistoryControllerImp) GetContinueWatching(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	items, err := hc.watchHistoryService.ListContinueWatching(user.Id, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, newHistoryListJSON(items))
+}
+
+type HistoryControllerImp struct {
+	watchHistoryService services.WatchHistoryService
+}
+
+func NewHistoryController(watchHistoryService services.WatchHistoryService) HistoryController {
+	return &HistoryControllerImp{watchHistoryService: watchHistoryService}
+}
@@ -0,0 +1,274 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"github.com/unbot2313/go-streaming-service/internal/services"
+)
+
+type LiveController interface {
+	ListStreamKeys(c *gin.Context)
+	CreateStreamKey(c *gin.Context)
+	UpdateStreamKey(c *gin.Context)
+	RotateStreamKey(c *gin.Context)
+	RevokeStreamKey(c *gin.Context)
+	ListLive(c *gin.Context)
+	GetLowLatencyFile(c *gin.Context)
+}
+
+// ListStreamKeys	godoc
+// @Summary 		List my stream keys
+// @Description 	The stream keys of the authenticated user with their settings. The keys themselves are never shown again, only their prefix
+// @Tags 			live
+// @Produce 		json
+// @Security 		BearerAuth
+// @Success 		200 {array} models.StreamKey{}
+// @Failure 		500 {object} map[string]string
+// @Router 			/live/stream-keys [get]
+func (lc *LiveControllerImp) ListStreamKeys(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	streamKeys, err := lc.userService.ListStreamKeys(user.Id)
+	if err != nil {
+		respondLiveError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, streamKeys)
+}
+
+// CreateStreamKey	godoc
+// @Summary 		Create a stream key
+// @Description 	Creates a key to go live from an encoder (OBS, ffmpeg) at ingest_url. Settings: record keeps the broadcast as a video when it ends, max_bitrate_kbps stops broadcasts above it (0 = no limit), title_template names the broadcast ({username}, {display_name}, {date}) and low_latency serves it as LL-HLS with a few seconds of delay. The key is only shown in this response
+// @Tags 			live
+// @Accept 			json
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			streamKey body models.StreamKeyRequest{} false "Name and settings"
+// @Success 		201 {object} models.StreamKeyResponse{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		409 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/live/stream-keys [post]
+func (lc *LiveControllerImp) CreateStreamKey(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	var request models.StreamKeyRequest
+
+	if !bindOptionalJSON(c, &request) {
+		return
+	}
+
+	streamKey, err := lc.userService.CreateStreamKey(user.Id, &request)
+	if err != nil {
+		respondLiveError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, streamKey)
+}
+
+// UpdateStreamKey	godoc
+// @Summary 		Update a stream key
+// @Description 	Changes the name or the settings of a stream key, only the fields sent are changed. The key stays the same
+// @Tags 			live
+// @Accept 			json
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			keyid path string true "Stream key ID"
+// @Param 			streamKey body models.StreamKeyRequest{} true "Fields to change"
+// @Success 		200 {object} models.StreamKey{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/live/stream-keys/{keyid} [patch]
+func (lc *LiveControllerImp) UpdateStreamKey(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	var request models.StreamKeyRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	streamKey, err := lc.userService.UpdateStreamKey(user.Id, c.Param("keyid"), &request)
+	if err != nil {
+		respondLiveError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, streamKey)
+}
+
+// RotateStreamKey	godoc
+// @Summary 		Rotate a stream key
+// @Description 	Replaces the key with a new one and keeps its settings, the old key stops working for new broadcasts. The new key is only shown in this response
+// @Tags 			live
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			keyid path string true "Stream key ID"
+// @Success 		200 {object} models.StreamKeyResponse{}
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/live/stream-keys/{keyid}/rotate [post]
+func (lc *LiveControllerImp) RotateStreamKey(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	streamKey, err := lc.userService.RotateStreamKey(user.Id, c.Param("keyid"))
+	if err != nil {
+		respondLiveError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, streamKey)
+}
+
+// RevokeStreamKey	godoc
+// @Summary 		Revoke a stream key
+// @Description 	Deletes the stream key, it can not be used for new broadcasts. A broadcast already running with it is not stopped
+// @Tags 			live
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			keyid path string true "Stream key ID"
+// @Success 		204
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/live/stream-keys/{keyid} [delete]
+func (lc *LiveControllerImp) RevokeStreamKey(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	if err := lc.userService.RevokeStreamKey(user.Id, c.Param("keyid")); err != nil {
+		respondLiveError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListLive			godoc
+// @Summary 		Get the live broadcasts
+// @Description 	Broadcasts that are live right now, newest first. The video field is the live HLS playlist. Use next_cursor to get the next page
+// @Tags 			live
+// @Produce 		json
+// @Param 			cursor query string false "Cursor returned by the previous page"
+// @Param 			limit query int false "Page size (max 100)" default(20)
+// @Success 		200 {object} models.VideoPage{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/streaming/live [get]
+func (lc *LiveControllerImp) ListLive(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	page, err := lc.liveService.ListLive(c.Query("cursor"), limit)
+	if err != nil {
+		respondLiveError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newVideoPageJSON(page))
+}
+
+// GetLowLatencyFile	godoc
+// @Summary 		Get the low-latency playlist of a broadcast
+// @Description 	LL-HLS playlist (index.m3u8), init (init.mp4), parts (part<n>.m4s) and segments (seg<n>.m4s) of a broadcast from a low_latency stream key. With _HLS_msn (and optionally _HLS_part) the playlist request blocks until that segment or part is available, and the part of the preload hint blocks until it is written
+// @Tags 			live
+// @Produce 		application/vnd.apple.mpegurl
+// @Param 			videoid path string true "Video ID"
+// @Param 			file path string true "index.m3u8, init.mp4, part<n>.m4s or seg<n>.m4s"
+// @Param 			_HLS_msn query int false "Media sequence number to wait for"
+// @Param 			_HLS_part query int false "Part of the segment to wait for, needs _HLS_msn"
+// @Success 		200 {string} string
+// @Failure 		400 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		503 {object} map[string]string
+// @Router 			/streaming/id/{videoid}/live/{file} [get]
+func (lc *LiveControllerImp) GetLowLatencyFile(c *gin.Context) {
+	videoId := c.Param("videoid")
+	file := c.Param("file")
+
+	if file != "index.m3u8" {
+		data, err := lc.liveService.LowLatencyFile(c.Request.Context(), videoId, file)
+		if err != nil {
+			respondLiveError(c, err)
+			return
+		}
+
+		c.Data(http.StatusOK, "video/mp4", data)
+		return
+	}
+
+	msn, part := -1, -1
+
+	if value := c.Query("_HLS_msn"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid _HLS_msn"})
+			return
+		}
+		msn = parsed
+	}
+
+	if value := c.Query("_HLS_part"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 || msn < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid _HLS_part"})
+			return
+		}
+		part = parsed
+	}
+
+	playlist, err := lc.liveService.LowLatencyPlaylist(c.Request.Context(), videoId, msn, part)
+	if err != nil {
+		respondLiveError(c, err)
+		return
+	}
+
+	// el playlist cambia con cada parte nueva
+	c.Header("Cache-Control", "no-cache")
+	c.Data(http.StatusOK, "application/vnd.apple.mpegurl", []byte(playlist))
+}
+
+func respondLiveError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidCursor), errors.Is(err, services.ErrLiveRequestTooFar):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrStreamKeyNotFound), errors.Is(err, services.ErrLiveNotFound),
+		errors.Is(err, services.ErrLiveSegmentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrLiveNotReady):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrTooManyStreamKeys):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+type LiveControllerImp struct {
+	liveService services.LiveService
+	userService services.UserService
+}
+
+func NewLiveController(liveService services.LiveService, userService services.UserService) LiveController {
+	return &LiveControllerImp{liveService: liveService, userService: userService}
+}
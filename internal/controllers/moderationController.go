@@ -0,0 +1,402 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"github.com/unbot2313/go-streaming-service/internal/services"
+)
+
+type ModerationController interface {
+	ReportVideo(c *gin.Context)
+	ReportComment(c *gin.Context)
+	ListReports(c *gin.Context)
+	DismissReport(c *gin.Context)
+	ActionReport(c *gin.Context)
+	RestoreVideo(c *gin.Context)
+	GetUserStatus(c *gin.Context)
+	LiftSuspension(c *gin.Context)
+	SetRole(c *gin.Context)
+	ListAuditLog(c *gin.Context)
+}
+
+// ReportVideo		godoc
+// @Summary 		Report a video
+// @Description 	Reports a video to the moderators with a reason. Reporting the same video again returns the existing report
+// @Tags 			moderation
+// @Accept 			json
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			videoid path string true "Video ID"
+// @Param 			report body models.ReportRequest true "Reason of the report"
+// @Success 		200 {object} models.Report{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/streaming/id/{videoid}/report [post]
+func (mc *ModerationControllerImp) ReportVideo(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	var request models.ReportRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := mc.moderationService.ReportVideo(user.Id, c.Param("videoid"), &request)
+	if err != nil {
+		respondModerationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// ReportComment	godoc
+// @Summary 		Report a comment
+// @Description 	Reports a comment to the moderators with a reason. Reporting the same comment again returns the existing report
+// @Tags 			moderation
+// @Accept 			json
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			commentid path string true "Comment ID"
+// @Param 			report body models.ReportRequest true "Reason of the report"
+// @Success 		200 {object} models.Report{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/streaming/comments/{commentid}/report [post]
+func (mc *ModerationControllerImp) ReportComment(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	var request models.ReportRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := mc.moderationService.ReportComment(user.Id, c.Param("commentid"), &request)
+	if err != nil {
+		respondModerationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// ListReports		godoc
+// @Summary 		Get the moderation queue
+// @Description 	Reports with the given status. Open reports are listed oldest first, reviewed ones newest first. Use next_cursor to get the next page. Moderators only
+// @Tags 			moderation
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			status query string false "Report status" Enums(open, dismissed, actioned) default(open)
+// @Param 			target_type query string false "Reported content" Enums(video, comment)
+// @Param 			cursor query string false "Cursor returned by the previous page"
+// @Param 			limit query int false "Page size (max 100)" default(20)
+// @Success 		200 {object} models.ReportPage{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		403 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/moderation/reports [get]
+func (mc *ModerationControllerImp) ListReports(c *gin.Context) {
+	status := c.Query("status")
+	if status != "" && status != models.ReportStatusOpen && status != models.ReportStatusDismissed && status != models.ReportStatusActioned {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status debe ser open, dismissed o actioned"})
+		return
+	}
+
+	targetType := c.Query("target_type")
+	if targetType != "" && targetType != models.ReportTargetVideo && targetType != models.ReportTargetComment {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "target_type debe ser video o comment"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	page, err := mc.moderationService.ListReports(status, targetType, c.Query("cursor"), limit)
+	if err != nil {
+		respondModerationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// DismissReport	godoc
+// @Summary 		Dismiss a report
+// @Description 	Closes without action the report and the other open reports of the same content. Moderators only
+// @Tags 			moderation
+// @Accept 			json
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			reportid path string true "Report ID"
+// @Param 			decision body models.ModerationNote false "Note for the audit trail"
+// @Success 		200 {object} models.Report{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		403 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		409 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/moderation/reports/{reportid}/dismiss [post]
+func (mc *ModerationControllerImp) DismissReport(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	var request models.ModerationNote
+	if !bindOptionalJSON(c, &request) {
+		return
+	}
+
+	report, err := mc.moderationService.DismissReport(user.Id, c.Param("reportid"), request.Note)
+	if err != nil {
+		respondModerationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// ActionReport		godoc
+// @Summary 		Take action on a report
+// @Description 	Applies the actions to the reported content and closes the other open reports of the same content. hide hides the video or comment, strike adds a strike to the owner (reaching the strike limit suspends the account) and suspend suspends the owner account for suspend_days. Moderators only
+// @Tags 			moderation
+// @Accept 			json
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			reportid path string true "Report ID"
+// @Param 			decision body models.ReportDecision true "Actions to apply"
+// @Success 		200 {object} models.Report{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		403 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		409 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/moderation/reports/{reportid}/action [post]
+func (mc *ModerationControllerImp) ActionReport(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	var request models.ReportDecision
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := mc.moderationService.ActionReport(user.Id, c.Param("reportid"), &request)
+	if err != nil {
+		respondModerationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// RestoreVideo		godoc
+// @Summary 		Restore a hidden video
+// @Description 	Publishes again a video hidden by a moderator. Moderators only
+// @Tags 			moderation
+// @Accept 			json
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			videoid path string true "Video ID"
+// @Param 			decision body models.ModerationNote false "Note for the audit trail"
+// @Success 		200 {object} models.VideoSwagger{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		403 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/moderation/videos/{videoid}/restore [post]
+func (mc *ModerationControllerImp) RestoreVideo(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	var request models.ModerationNote
+	if !bindOptionalJSON(c, &request) {
+		return
+	}
+
+	video, err := mc.moderationService.RestoreVideo(user.Id, c.Param("videoid"), request.Note)
+	if err != nil {
+		respondModerationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newVideoJSON(*video))
+}
+
+// GetUserStatus	godoc
+// @Summary 		Get the moderation status of a user
+// @Description 	Role, strikes within the strike window and suspension of a user. Moderators only
+// @Tags 			moderation
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			id path string true "User ID"
+// @Success 		200 {object} models.ModerationStatus{}
+// @Failure 		403 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/moderation/users/{id} [get]
+func (mc *ModerationControllerImp) GetUserStatus(c *gin.Context) {
+	status, err := mc.moderationService.GetStatus(c.Param("id"))
+	if err != nil {
+		respondModerationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// LiftSuspension	godoc
+// @Summary 		Lift the suspension of a user
+// @Description 	Ends the suspension of the account before it expires. Moderators only
+// @Tags 			moderation
+// @Accept 			json
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			id path string true "User ID"
+// @Param 			decision body models.ModerationNote false "Note for the audit trail"
+// @Success 		200 {object} models.ModerationStatus{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		403 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/moderation/users/{id}/suspension [delete]
+func (mc *ModerationControllerImp) LiftSuspension(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	var request models.ModerationNote
+	if !bindOptionalJSON(c, &request) {
+		return
+	}
+
+	status, err := mc.moderationService.LiftSuspension(user.Id, c.Param("id"), request.Note)
+	if err != nil {
+		respondModerationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// SetRole			godoc
+// @Summary 		Change the role of a user
+// @Description 	Sets the role (user, moderator or admin) of a user. Admins only
+// @Tags 			moderation
+// @Accept 			json
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			id path string true "User ID"
+// @Param 			role body models.RoleRequest true "New role"
+// @Success 		200 {object} models.ModerationStatus{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		403 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/moderation/users/{id}/role [put]
+func (mc *ModerationControllerImp) SetRole(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	var request models.RoleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Param("id") == user.Id {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No puede cambiar su propio rol"})
+		return
+	}
+
+	status, err := mc.moderationService.SetRole(user.Id, c.Param("id"), request.Role)
+	if err != nil {
+		respondModerationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// ListAuditLog		godoc
+// @Summary 		Get the moderation audit trail
+// @Description 	Every moderation decision, newest first. Can be filtered by content or by affected user. Use next_cursor to get the next page. Moderators only
+// @Tags 			moderation
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			target_id query string false "Video or comment ID"
+// @Param 			user_id query string false "Affected user ID"
+// @Param 			cursor query string false "Cursor returned by the previous page"
+// @Param 			limit query int false "Page size (max 100)" default(20)
+// @Success 		200 {object} models.ModerationActionPage{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		403 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/moderation/audit [get]
+func (mc *ModerationControllerImp) ListAuditLog(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	page, err := mc.moderationService.ListAuditLog(c.Query("target_id"), c.Query("user_id"), c.Query("cursor"), limit)
+	if err != nil {
+		respondModerationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// bindOptionalJSON lee el body solo si se envió uno
+func bindOptionalJSON(c *gin.Context, request interface{}) bool {
+	if c.Request.ContentLength == 0 {
+		return true
+	}
+
+	if err := c.ShouldBindJSON(request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	return true
+}
+
+func respondModerationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidReport), errors.Is(err, services.ErrInvalidCursor):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrReportNotFound), errors.Is(err, services.ErrVideoNotFound),
+		errors.Is(err, services.ErrCommentNotFound), errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrReportClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+type ModerationControllerImp struct {
+	moderationService services.ModerationService
+}
+
+func NewModerationController(moderationService services.ModerationService) ModerationController {
+	return &ModerationControllerImp{moderationService: moderationService}
+}
@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"github.com/unbot2313/go-streaming-service/internal/services"
+)
+
+type NotificationController interface {
+	GetNotifications(c *gin.Context)
+	GetUnreadCount(c *gin.Context)
+	MarkRead(c *gin.Context)
+	MarkAllRead(c *gin.Context)
+	GetPreferences(c *gin.Context)
+	UpdatePreferences(c *gin.Context)
+}
+
+// GetNotifications	godoc
+// @Summary 		Get the notifications inbox
+// @Description 	Notifications of the authenticated user, newest first, with the number of unread ones. Use next_cursor to get the next page
+// @Tags 			notifications
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			unread query bool false "Only unread notifications"
+// @Param 			cursor query string false "Cursor returned by the previous page"
+// @Param 			limit query int false "Page size (max 100)" default(20)
+// @Success 		200 {object} models.NotificationPage{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/notifications [get]
+func (nc *NotificationControllerImp) GetNotifications(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	unreadOnly, _ := strconv.ParseBool(c.Query("unread"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	page, err := nc.notificationService.ListNotifications(user.Id, unreadOnly, c.Query("cursor"), limit)
+	if err != nil {
+		respondNotificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// GetUnreadCount	godoc
+// @Summary 		Get the unread notifications count
+// @Description 	Number of unread notifications of the authenticated user, for the inbox badge
+// @Tags 			notifications
+// @Produce 		json
+// @Security 		BearerAuth
+// @Success 		200 {object} map[string]int64
+// @Failure 		500 {object} map[string]string
+// @Router 			/notifications/unread-count [get]
+func (nc *NotificationControllerImp) GetUnreadCount(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	count, err := nc.notificationService.CountUnread(user.Id)
+	if err != nil {
+		respondNotificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"unread_count": count})
+}
+
+// MarkRead			godoc
+// @Summary 		Mark a notification as read
+// @Description 	Marks one notification of the authenticated user as read
+// @Tags 			notifications
+// @Security 		BearerAuth
+// @Param 			notificationid path string true "Notification ID"
+// @Success 		204
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/notifications/{notificationid}/read [post]
+func (nc *NotificationControllerImp) MarkRead(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	if err := nc.notificationService.MarkRead(user.Id, c.Param("notificationid")); err != nil {
+		respondNotificationError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// MarkAllRead		godoc
+// @Summary 		Mark all notifications as read
+// @Description 	Marks every notification of the authenticated user as read
+// @Tags 			notifications
+// @Security 		BearerAuth
+// @Success 		204
+// @Failure 		500 {object} map[string]string
+// @Router 			/notifications/read-all [post]
+func (nc *NotificationControllerImp) MarkAllRead(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	if err := nc.notificationService.MarkAllRead(user.Id); err != nil {
+		respondNotificationError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetPreferences	godoc
+// @Summary 		Get the notification preferences
+// @Description 	Channels (in_app, email, webhook) enabled for each notification type and the webhook url. The webhook secret is never returned here
+// @Tags 			notifications
+// @Produce 		json
+// @Security 		BearerAuth
+// @Success 		200 {object} models.NotificationSettings{}
+// @Failure 		500 {object} map[string]string
+// @Router 			/notifications/preferences [get]
+func (nc *NotificationControllerImp) GetPreferences(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	settings, err := nc.notificationService.GetSettings(user.Id)
+	if err != nil {
+		respondNotificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdatePreferences	godoc
+// @Summary 		Update the notification preferences
+// @Description 	Changes the channels of the notification types sent, the others keep their value. An empty webhook_url removes the webhook. When a new webhook url is set, the secret used to sign its requests (X-Webhook-Signature, HMAC-SHA256) is returned only in this response
+// @Tags 			notifications
+// @Accept 			json
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			preferences body models.NotificationSettingsUpdate true "Notification preferences"
+// @Success 		200 {object} models.NotificationSettings{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/notifications/preferences [put]
+func (nc *NotificationControllerImp) UpdatePreferences(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	var request models.NotificationSettingsUpdate
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	settings, err := nc.notificationService.UpdateSettings(user.Id, &request)
+	if err != nil {
+		respondNotificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+func respondNotificationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidNotificationSettings), errors.Is(err, services.ErrInvalidCursor):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNotificationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+type NotificationControllerImp struct {
+	notificationService services.NotificationService
+}
+
+func NewNotificationController(notificationService services.NotificationService) NotificationController {
+	return &NotificationControllerImp{notificationService: notificationService}
+}
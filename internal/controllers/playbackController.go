@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"github.com/unbot2313/go-streaming-service/internal/services"
+)
+
+type PlaybackController interface {
+	StartSession(c *gin.Context)
+	Heartbeat(c *gin.Context)
+	GetVideoAnalytics(c *gin.Context)
+}
+
+// StartSession		godoc
+// @Summary 		Start a playback session
+// @Description 	Opens a playback session for a video. The player must send heartbeats with the returned session id while the video plays
+// @Tags 			playback
+// @Accept 			json
+// @Produce 		json
+// @Param 			session body models.PlaybackStartRequest{} true "Video to play"
+// @Success 		201 {object} models.PlaybackSession{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/playback/sessions [post]
+func (pc *PlaybackControllerImp) StartSession(c *gin.Context) {
+	var request models.PlaybackStartRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := pc.playbackService.StartSession(request.VideoID, currentViewer(c))
+
+	if errors.Is(err, services.ErrVideoNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, session)
+}
+
+// Heartbeat		godoc
+// @Summary 		Send a playback heartbeat
+// @Description 	Reports the current position, bitrate, play/pause state and buffering events since the last heartbeat. Watch time is computed on the server from the time between heartbeats
+// @Tags 			playback
+// @Accept 			json
+// @Produce 		json
+// @Param 			sessionid path string true "Playback session ID"
+// @Param 			heartbeat body models.HeartbeatRequest{} true "Player state"
+// @Success 		200 {object} models.PlaybackSession{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		409 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/playback/sessions/{sessionid}/heartbeat [post]
+func (pc *PlaybackControllerImp) Heartbeat(c *gin.Context) {
+	var request models.HeartbeatRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := pc.playbackService.Heartbeat(c.Param("sessionid"), currentViewer(c), &request)
+
+	if errors.Is(err, services.ErrPlaybackSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if errors.Is(err, services.ErrPlaybackSessionEnded) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// GetVideoAnalytics	godoc
+// @Summary 		Get watch analytics of a video
+// @Description 	Total watch time, average view duration, average bitrate, buffering and retention curve of a video. Only the owner of the video can see them
+// @Tags 			playback
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			videoid path string true "Video ID"
+// @Success 		200 {object} models.VideoWatchAnalytics{}
+// @Failure 		401 {object} map[string]string
+// @Failure 		403 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/playback/videos/{videoid}/analytics [get]
+func (pc *PlaybackControllerImp) GetVideoAnalytics(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	video, ok := ownedVideo(c, pc.databaseVideoService, user, c.Param("videoid"))
+	if !ok {
+		return
+	}
+
+	analytics, err := pc.playbackService.GetVideoAnalytics(video.Id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, analytics)
+}
+
+type PlaybackControllerImp struct {
+	playbackService      services.PlaybackService
+	databaseVideoService services.DatabaseVideoService
+}
+
+func NewPlaybackController(playbackService services.PlaybackService, databaseVideoService services.DatabaseVideoService) PlaybackController {
+	return &PlaybackControllerImp{
+		playbackService:      playbackService,
+		databaseVideoService: databaseVideoService,
+	}
+}
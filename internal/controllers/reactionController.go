@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"github.com/unbot2313/go-streaming-service/internal/services"
+)
+
+type ReactionController interface {
+	React(c *gin.Context)
+	RemoveReaction(c *gin.Context)
+	GetLikedVideos(c *gin.Context)
+}
+
+// React			godoc
+// @Summary 		Like or dislike a video
+// @Description 	Sets the reaction of the authenticated user to a video. Sending the same reaction again changes nothing, and sending the other one replaces it
+// @Tags 			reactions
+// @Accept 			json
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			videoid path string true "Video ID"
+// @Param 			reaction body models.ReactionRequest{} true "like or dislike"
+// @Success 		200 {object} models.ReactionResult{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/streaming/id/{videoid}/reaction [put]
+func (rc *ReactionControllerImp) React(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	var request models.ReactionRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := rc.reactionService.SetReaction(user.Id, c.Param("videoid"), request.Reaction)
+
+	if errors.Is(err, services.ErrVideoNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// RemoveReaction	godoc
+// @Summary 		Remove the reaction to a video
+// @Description 	Removes the like or dislike of the authenticated user. It does nothing if there was no reaction
+// @Tags 			reactions
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			videoid path string true "Video ID"
+// @Success 		200 {object} models.ReactionResult{}
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/streaming/id/{videoid}/reaction [delete]
+func (rc *ReactionControllerImp) RemoveReaction(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	result, err := rc.reactionService.RemoveReaction(user.Id, c.Param("videoid"))
+
+	if errors.Is(err, services.ErrVideoNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetLikedVideos	godoc
+// @Summary 		Get the liked videos
+// @Description 	Videos liked by the authenticated user, most recent like first. Use next_cursor to get the next page
+// @Tags 			reactions
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			cursor query string false "Cursor returned by the previous page"
+// @Param 			limit query int false "Page size (max 100)" default(20)
+// @Success 		200 {object} models.VideoPage{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/users/me/liked-videos [get]
+func (rc *ReactionControllerImp) GetLikedVideos(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	page, err := rc.reactionService.ListLikedVideos(user.Id, c.Query("cursor"), limit)
+
+	if errors.Is(err, services.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, newVideoPageJSON(page))
+}
+
+type ReactionControllerImp struct {
+	reactionService services.ReactionService
+}
+
+func NewReactionController(reactionService services.ReactionService) ReactionController {
+	return &ReactionControllerImp{reactionService: reactionService}
+}
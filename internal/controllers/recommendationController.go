@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unbot2313/go-streaming-service/internal/services"
+)
+
+type RecommendationController interface {
+	GetTrending(c *gin.Context)
+	GetRelated(c *gin.Context)
+}
+
+// GetTrending		godoc
+// @Summary 		Get the trending videos
+// @Description 	Public videos with recent activity, ranked by a score of views, likes and watch time where older activity weighs less. The score is refreshed periodically. Use next_cursor to get the next page
+// @Tags 			streaming
+// @Produce 		json
+// @Param 			cursor query string false "Cursor returned by the previous page"
+// @Param 			limit query int false "Page size (max 100)" default(20)
+// @Success 		200 {object} models.VideoPage{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/streaming/trending [get]
+func (rc *RecommendationControllerImp) GetTrending(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	page, err := rc.recommendationService.GetTrending(c.Query("cursor"), limit)
+	if err != nil {
+		respondRecommendationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newVideoPageJSON(page))
+}
+
+// GetRelated		godoc
+// @Summary 		Get the related videos
+// @Description 	Videos related to a video by shared tags, same uploader and viewers who watched both, most related first. When there are not enough, trending videos fill the list
+// @Tags 			streaming
+// @Produce 		json
+// @Param 			videoid path string true "Video ID"
+// @Param 			limit query int false "Number of videos (max 50)" default(20)
+// @Success 		200 {object} models.VideoPage{}
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/streaming/id/{videoid}/related [get]
+func (rc *RecommendationControllerImp) GetRelated(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	page, err := rc.recommendationService.GetRelated(c.Param("videoid"), limit)
+	if err != nil {
+		respondRecommendationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newVideoPageJSON(page))
+}
+
+func respondRecommendationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidCursor), errors.Is(err, services.ErrInvalidHomeSort):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrVideoNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+type RecommendationControllerImp struct {
+	recommendationService services.RecommendationService
+}
+
+func NewRecommendationController(recommendationService services.RecommendationService) RecommendationController {
+	return &RecommendationControllerImp{recommendationService: recommendationService}
+}
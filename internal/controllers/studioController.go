@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"github.com/unbot2313/go-streaming-service/internal/services"
+)
+
+type StudioController interface {
+	GetVideoAnalytics(c *gin.Context)
+	GetChannelAnalytics(c *gin.Context)
+}
+
+// GetVideoAnalytics	godoc
+// @Summary 		Get the analytics time series of a video
+// @Description 	Views, unique viewers, watch time and likes of a video grouped by hour or day. Only the owner of the video can see them
+// @Tags 			studio
+// @Produce 		json
+// @Produce 		text/csv
+// @Security 		BearerAuth
+// @Param 			videoid path string true "Video ID"
+// @Param 			from query string false "Start of the range (RFC3339 or YYYY-MM-DD), defaults to 30 days (48 hours for hour) before to"
+// @Param 			to query string false "End of the range (RFC3339 or YYYY-MM-DD, inclusive), defaults to now"
+// @Param 			granularity query string false "hour or day" default(day)
+// @Param 			tz query string false "IANA timezone used to group the periods" default(UTC)
+// @Param 			format query string false "json or csv" default(json)
+// @Success 		200 {object} models.AnalyticsSeries{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		401 {object} map[string]string
+// @Failure 		403 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/studio/analytics/videos/{videoid} [get]
+func (sc *StudioControllerImp) GetVideoAnalytics(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	query, err := parseAnalyticsQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	video, ok := ownedVideo(c, sc.databaseVideoService, user, c.Param("videoid"))
+	if !ok {
+		return
+	}
+
+	series, err := sc.analyticsService.GetVideoSeries(video.Id, query)
+	respondAnalytics(c, series, err, "video_"+video.Id)
+}
+
+// GetChannelAnalytics	godoc
+// @Summary 		Get the analytics time series of the channel
+// @Description 	Views, unique viewers, watch time and likes of all the videos of the authenticated user grouped by hour or day
+// @Tags 			studio
+// @Produce 		json
+// @Produce 		text/csv
+// @Security 		BearerAuth
+// @Param 			from query string false "Start of the range (RFC3339 or YYYY-MM-DD), defaults to 30 days (48 hours for hour) before to"
+// @Param 			to query string false "End of the range (RFC3339 or YYYY-MM-DD, inclusive), defaults to now"
+// @Param 			granularity query string false "hour or day" default(day)
+// @Param 			tz query string false "IANA timezone used to group the periods" default(UTC)
+// @Param 			format query string false "json or csv" default(json)
+// @Success 		200 {object} models.AnalyticsSeries{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		401 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/studio/analytics/channel [get]
+func (sc *StudioControllerImp) GetChannelAnalytics(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	query, err := parseAnalyticsQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	series, err := sc.analyticsService.GetChannelSeries(user.Id, query)
+	respondAnalytics(c, series, err, "channel_"+user.Id)
+}
+
+// parseAnalyticsQuery lee el rango, la granularidad y la zona horaria de la url
+func parseAnalyticsQuery(c *gin.Context) (*models.AnalyticsQuery, error) {
+	location, err := time.LoadLocation(c.DefaultQuery("tz", "UTC"))
+	if err != nil || location.String() == "Local" {
+		return nil, errors.New("tz no es una zona horaria válida")
+	}
+
+	query := &models.AnalyticsQuery{
+		Granularity: c.DefaultQuery("granularity", models.AnalyticsGranularityDay),
+		Location:    location,
+		To:          time.Now(),
+	}
+
+	if value := c.Query("to"); value != "" {
+		to, dateOnly, err := parseAnalyticsTime(value, location)
+		if err != nil {
+			return nil, errors.New("to no es una fecha válida")
+		}
+		// una fecha sin hora incluye todo ese día
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		query.To = to
+	}
+
+	if query.Granularity == models.AnalyticsGranularityHour {
+		query.From = query.To.Add(-48 * time.Hour)
+	} else {
+		query.From = query.To.AddDate(0, 0, -30)
+	}
+
+	if value := c.Query("from"); value != "" {
+		from, _, err := parseAnalyticsTime(value, location)
+		if err != nil {
+			return nil, errors.New("from no es una fecha válida")
+		}
+		query.From = from
+	}
+
+	return query, nil
+}
+
+func parseAnalyticsTime(value string, location *time.Location) (time.Time, bool, error) {
+	if date, err := time.ParseInLocation("2006-01-02", value, location); err == nil {
+		return date, true, nil
+	}
+
+	date, err := time.Parse(time.RFC3339, value)
+	return date, false, err
+}
+
+// respondAnalytics responde la serie en json, o en csv si se pidió format=csv
+func respondAnalytics(c *gin.Context, series *models.AnalyticsSeries, err error, fileName string) {
+	if errors.Is(err, services.ErrInvalidAnalyticsQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("format") != "csv" {
+		c.JSON(http.StatusOK, series)
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName+".csv"))
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write([]string{"period", "views", "unique_viewers", "watch_seconds", "likes"})
+
+	for _, point := range series.Points {
+		writer.Write([]string{
+			point.Period.Format(time.RFC3339),
+			strconv.FormatInt(point.Views, 10),
+			strconv.FormatInt(point.UniqueViewers, 10),
+			strconv.FormatFloat(point.WatchSeconds, 'f', 1, 64),
+			strconv.FormatInt(point.Likes, 10),
+		})
+	}
+
+	writer.Flush()
+}
+
+type StudioControllerImp struct {
+	analyticsService     services.AnalyticsService
+	databaseVideoService services.DatabaseVideoService
+}
+
+func NewStudioController(analyticsService services.AnalyticsService, databaseVideoService services.DatabaseVideoService) StudioController {
+	return &StudioControllerImp{
+		analyticsService:     analyticsService,
+		databaseVideoService: databaseVideoService,
+	}
+}
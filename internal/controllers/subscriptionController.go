@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unbot2313/go-streaming-service/internal/services"
+)
+
+type SubscriptionController interface {
+	Subscribe(c *gin.Context)
+	Unsubscribe(c *gin.Context)
+	GetMySubscriptions(c *gin.Context)
+	GetFeed(c *gin.Context)
+}
+
+// Subscribe		godoc
+// @Summary 		Subscribe to a channel
+// @Description 	The authenticated user follows the channel of another user. Subscribing again changes nothing
+// @Tags 			subscriptions
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			id path string true "Channel (user) ID"
+// @Success 		200 {object} models.SubscriptionResult{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/users/id/{id}/subscription [put]
+func (sc *SubscriptionControllerImp) Subscribe(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	result, err := sc.subscriptionService.Subscribe(user.Id, c.Param("id"))
+	if err != nil {
+		respondSubscriptionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Unsubscribe		godoc
+// @Summary 		Unsubscribe from a channel
+// @Description 	The authenticated user stops following the channel. It does nothing if it was not subscribed
+// @Tags 			subscriptions
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			id path string true "Channel (user) ID"
+// @Success 		200 {object} models.SubscriptionResult{}
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/users/id/{id}/subscription [delete]
+func (sc *SubscriptionControllerImp) Unsubscribe(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	result, err := sc.subscriptionService.Unsubscribe(user.Id, c.Param("id"))
+	if err != nil {
+		respondSubscriptionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetMySubscriptions	godoc
+// @Summary 		Get the followed channels
+// @Description 	Channels followed by the authenticated user, most recent subscription first. Use next_cursor to get the next page
+// @Tags 			subscriptions
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			cursor query string false "Cursor returned by the previous page"
+// @Param 			limit query int false "Page size (max 100)" default(20)
+// @Success 		200 {object} models.ChannelPage{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/users/me/subscriptions [get]
+func (sc *SubscriptionControllerImp) GetMySubscriptions(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	page, err := sc.subscriptionService.ListSubscriptions(user.Id, c.Query("cursor"), limit)
+	if err != nil {
+		respondSubscriptionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// GetFeed			godoc
+// @Summary 		Get the subscriptions feed
+// @Description 	Newest public videos of the channels followed by the authenticated user. Use next_cursor to get the next page
+// @Tags 			subscriptions
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			cursor query string false "Cursor returned by the previous page"
+// @Param 			limit query int false "Page size (max 100)" default(20)
+// @Success 		200 {object} models.VideoPage{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/feed/subscriptions [get]
+func (sc *SubscriptionControllerImp) GetFeed(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	page, err := sc.subscriptionService.GetFeed(user.Id, c.Query("cursor"), limit)
+	if err != nil {
+		respondSubscriptionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newVideoPageJSON(page))
+}
+
+func respondSubscriptionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrSelfSubscription), errors.Is(err, services.ErrInvalidCursor):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+type SubscriptionControllerImp struct {
+	subscriptionService services.SubscriptionService
+}
+
+func NewSubscriptionController(subscriptionService services.SubscriptionService) SubscriptionController {
+	return &SubscriptionControllerImp{subscriptionService: subscriptionService}
+}
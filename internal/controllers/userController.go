@@ -1,22 +1,32 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/unbot2313/go-streaming-service/config"
 	"github.com/unbot2313/go-streaming-service/internal/models"
 	"github.com/unbot2313/go-streaming-service/internal/services"
 )
 
 type UserControllerImp struct {
 	service	 services.UserService
+	avatarService services.AvatarService
+	dataExportService services.DataExportService
 }
 
 type UserController interface {
 	CreateUser(c *gin.Context)
 	GetUserByID(c *gin.Context)
 	GetUserByUserName(c *gin.Context)
+	DeleteMe(c *gin.Context)
 	DeleteUserByID(c *gin.Context)
+	UpdateMe(c *gin.Context)
+	UpdateMyAvatar(c *gin.Context)
+	RequestExport(c *gin.Context)
+	GetExport(c *gin.Context)
 }
 
 
@@ -37,7 +47,7 @@ func (controller *UserControllerImp) GetUserByID(c *gin.Context) {
 		c.JSON(404, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(200, users)
+	c.JSON(200, newUserJSON(publicUser(users)))
 }
 
 // GetUserByUserName		godoc
@@ -57,7 +67,7 @@ func (controller *UserControllerImp) GetUserByUserName(c *gin.Context) {
 		c.JSON(404, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(200, users)
+	c.JSON(200, newUserJSON(publicUser(users)))
 }
 
 // CreateUser		godoc
@@ -65,54 +75,264 @@ func (controller *UserControllerImp) GetUserByUserName(c *gin.Context) {
 // @Description 	Save user in Db
 // @Tags 			users
 // @Accept 			json
-// @Param 			user body models.UserLogin{} true "User object containing all user details"
+// @Param 			user body models.UserCreate{} true "User object containing all user details"
 // @Produce 		json
 // @Success 		200 {object} models.UserSwagger{}
 // @Failure 		400 {object} map[string]string
 // @Failure 		500 {object} map[string]string
 // @Router 			/users/ [post]
 func (controller *UserControllerImp) CreateUser(c *gin.Context) {
-	var user models.User
+	var userCreate models.UserCreate
 
-	if err := c.ShouldBindJSON(&user); err != nil {
+	if err := c.ShouldBindJSON(&userCreate); err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
+	// solo se copian los datos del registro, el rol y los contadores no se pueden elegir
+	user := models.User{
+		Username: userCreate.Username,
+		Password: userCreate.Password,
+		Email:    userCreate.Email,
+		Role:     models.RoleUser,
+	}
+
 	newUser, err := controller.service.CreateUser(&user)
 	if err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(200, gin.H{"message": "User created", "user": newUser})
+	c.JSON(200, gin.H{"message": "User created", "user": publicUser(newUser)})
 }
 
-// GetUserByID		godoc
-// @Summary 		Delete user by ID
-// @Description 	Delete user by ID ni Db
+// DeleteMe		godoc
+// @Summary 		Delete the authenticated user's account
+// @Description 	The account and its videos are hidden immediately and permanently deleted (with their files) after the grace period. It can be undone with /auth/restore
 // @Tags 			users
-// @Param 			Id path string true "User ID"
 // @Produce 		json
-// @Success 		200 {object} models.UserSwagger{}
+// @Security 		BearerAuth
+// @Success 		200 {object} map[string]string
 // @Failure 		404 {object} map[string]string
 // @Failure 		500 {object} map[string]string
-// @Router 			/users/{UserId} [delete]
+// @Router 			/users/me [delete]
+func (controller *UserControllerImp) DeleteMe(c *gin.Context) {
+	authenticatedUser, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	err := controller.service.DeleteUserByID(authenticatedUser.Id)
+
+	if errors.Is(err, services.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "User deleted",
+		"purge_after": time.Now().Add(config.GetConfig().AccountDeletionGracePeriod),
+	})
+}
+
+// DeleteUserByID	godoc
+// @Summary 		Delete a user's account (admin)
+// @Description 	Same as /users/me for another account: the account and its videos are hidden immediately and permanently deleted after the grace period. Only admins can use it
+// @Tags 			users
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			id path string true "User ID"
+// @Success 		200 {object} map[string]string
+// @Failure 		403 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/users/{id} [delete]
 func (controller *UserControllerImp) DeleteUserByID(c *gin.Context) {
+	err := controller.service.DeleteUserByID(c.Param("id"))
 
-	id := c.Param("id")
+	if errors.Is(err, services.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 
-	err := controller.service.DeleteUserByID(id)
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "User deleted",
+		"purge_after": time.Now().Add(config.GetConfig().AccountDeletionGracePeriod),
+	})
+}
+
+// UpdateMe		godoc
+// @Summary 		Update the authenticated user's profile
+// @Description 	Change email, display name, bio and password. Changing the email or the password requires current_password
+// @Tags 			users
+// @Accept 			json
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			user body models.UserUpdate{} true "Fields to change"
+// @Success 		200 {object} models.UserSwagger{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		403 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/users/me [patch]
+func (controller *UserControllerImp) UpdateMe(c *gin.Context) {
+	authenticatedUser, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	var update models.UserUpdate
+
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := controller.service.UpdateProfile(authenticatedUser.Id, &update)
+
+	if errors.Is(err, services.ErrInvalidCurrentPassword) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	if errors.Is(err, services.ErrUserNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(200, gin.H{"message": "User deleted"})
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "User updated", "user": publicUser(user)})
+}
+
+// UpdateMyAvatar		godoc
+// @Summary 			Upload the authenticated user's avatar
+// @Description 		The image is resized to the standard sizes (64, 128 and 256 px) and stored like the video thumbnails
+// @Tags 				users
+// @Accept 				multipart/form-data
+// @Produce 			json
+// @Security 			BearerAuth
+// @Param 				avatar formData file true "Image file (jpg, png, webp, gif, bmp), max 5 MB"
+// @Success 			200 {object} models.UserSwagger{}
+// @Failure 			400 {object} map[string]string
+// @Failure 			500 {object} map[string]string
+// @Router 				/users/me/avatar [put]
+func (controller *UserControllerImp) UpdateMyAvatar(c *gin.Context) {
+	authenticatedUser, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	if !controller.avatarService.IsValidImageExtension(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El archivo no es una imagen válida o excede los 5 MB."})
+		return
+	}
+
+	user, err := controller.avatarService.SaveAvatar(c, authenticatedUser.Id)
+
+	if errors.Is(err, services.ErrInvalidImage) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El archivo no es una imagen válida o excede los 5 MB."})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Avatar updated", "user": publicUser(user)})
+}
+
+// RequestExport		godoc
+// @Summary 			Request a copy of all the user's data
+// @Description 		Starts a background job that builds a ZIP with the profile, video metadata, view and watch history, reactions, comments, subscriptions, notifications, reports filed and strikes, stream key names and settings, live chat messages, and optionally the original file of each uploaded video (live recordings have none)
+// @Tags 				users
+// @Accept 				json
+// @Produce 			json
+// @Security 			BearerAuth
+// @Param 				export body models.ExportRequest{} false "Export options"
+// @Success 			202 {object} models.DataExport{}
+// @Failure 			400 {object} map[string]string
+// @Failure 			500 {object} map[string]string
+// @Router 				/users/me/export [post]
+func (controller *UserControllerImp) RequestExport(c *gin.Context) {
+	authenticatedUser, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	var request models.ExportRequest
+
+	// el body es opcional
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	export, err := controller.dataExportService.RequestExport(authenticatedUser.Id, request.IncludeUploads)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, export)
 }
 
+// GetExport		godoc
+// @Summary 		Get the status of a data export
+// @Description 	When the export is ready the response includes a temporary download link
+// @Tags 			users
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			exportid path string true "Export ID"
+// @Success 		200 {object} models.DataExport{}
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/users/me/export/{exportid} [get]
+func (controller *UserControllerImp) GetExport(c *gin.Context) {
+	authenticatedUser, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
 
+	export, err := controller.dataExportService.GetExport(authenticatedUser.Id, c.Param("exportid"))
+
+	if errors.Is(err, services.ErrExportNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, export)
+}
+
+// publicUser quita los datos sensibles antes de devolver el usuario
+func publicUser(user *models.User) *models.User {
+	user.Password = ""
+	user.RefreshToken = ""
+	return user
+}
 
 
-func NewUserController(service services.UserService) *UserControllerImp {
-	return &UserControllerImp{service: service}
+func NewUserController(service services.UserService, avatarService services.AvatarService, dataExportService services.DataExportService) *UserControllerImp {
+	return &UserControllerImp{service: service, avatarService: avatarService, dataExportService: dataExportService}
 }
\ No newline at end of file
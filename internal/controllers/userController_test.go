@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"github.com/unbot2313/go-streaming-service/internal/services"
+)
+
+// fakeUserService guarda en memoria el usuario que se crea
+type fakeUserService struct {
+	services.UserService
+	created *models.User
+}
+
+func (fake *fakeUserService) CreateUser(user *models.User) (*models.User, error) {
+	user.Id = "user-1"
+	user.Password = "hashed"
+	fake.created = user
+	return user, nil
+}
+
+func TestCreateUserIgnoresRoleAndCounters(t *testing.T) {
+	service := &fakeUserService{}
+	controller := NewUserController(service, nil, nil)
+
+	r := gin.New()
+	r.POST("/users/", controller.CreateUser)
+
+	body := `{"username":"jane","password":"secret-password","email":"jane@example.com","role":"admin","subscriber_count":1000}`
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/users/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body)
+	}
+
+	if service.created == nil {
+		t.Fatal("the user was not created")
+	}
+
+	if service.created.Role != models.RoleUser || service.created.SubscriberCount != 0 {
+		t.Errorf("stored role = %q, subscriber_count = %d, want user and 0", service.created.Role, service.created.SubscriberCount)
+	}
+
+	if service.created.Username != "jane" || service.created.Email != "jane@example.com" {
+		t.Errorf("stored user = %+v", service.created)
+	}
+
+	var response struct {
+		User map[string]any `json:"user"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.User["password"] != "" {
+		t.Errorf("response password = %v, want it removed", response.User["password"])
+	}
+}
@@ -1,7 +1,12 @@
 package controllers
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/unbot2313/go-streaming-service/internal/models"
@@ -10,40 +15,90 @@ import (
 
 type VideoController interface {
 	GetLatestVideos(c *gin.Context)
+	GetHomeVideos(c *gin.Context)
 	CreateVideo(c *gin.Context)
 	GetVideoByID(c *gin.Context)
 	IncrementViews(c *gin.Context)
+	UpdateTags(c *gin.Context)
+	GetEncodingProfiles(c *gin.Context)
+	GetProcessingProgress(c *gin.Context)
+	CancelProcessing(c *gin.Context)
 }
 
-// SaveVideo		godoc
-// @Summary 		Save a video
-// @Description 	Upload a video file along with metadata (title and description) and save it to the AWS bucket.
+// cada cuánto se manda un comentario por el stream del avance si no hay cambios
+const progressHeartbeatInterval = 15 * time.Second
+
+// GetHomeVideos	godoc
+// @Summary 		Get the home page videos
+// @Description 	Public videos ranked by trending score, videos without recent activity follow newest first. With sort=newest they are listed newest first. Use next_cursor to get the next page
 // @Tags 			streaming
 // @Produce 		json
-// @Success 		200 {object} models.VideoSwagger{}
+// @Param 			sort query string false "Order" Enums(trending, newest) default(trending)
+// @Param 			cursor query string false "Cursor returned by the previous page"
+// @Param 			limit query int false "Page size (max 100)" default(20)
+// @Success 		200 {object} models.VideoPage{}
 // @Failure 		400 {object} map[string]string
 // @Failure 		500 {object} map[string]string
-// @Router 			/streaming/ [get]
+// @Router 			/streaming/home [get]
+func (vc *VideoControllerImpl) GetHomeVideos(c *gin.Context) {
+	page, ok := vc.homeVideos(c, c.Query("cursor"))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, newVideoPageJSON(page))
+}
+
+// GetLatestVideos	godoc
+// @Summary 		Get the latest videos
+// @Description 	Deprecated, use /streaming/home. Returns the first page of the home videos as a plain array, in the same order as /streaming/home
+// @Tags 			streaming
+// @Produce 		json
+// @Param 			sort query string false "Order" Enums(trending, newest) default(trending)
+// @Param 			limit query int false "Number of videos (max 100)" default(20)
+// @Success 		200 {array} models.VideoSwagger{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Deprecated
+// @Router 			/streaming/latest [get]
 func (vc *VideoControllerImpl) GetLatestVideos(c *gin.Context) {
-	videos, err := vc.databaseVideoService.FindLatestVideos()
+	// los clientes viejos esperan un arreglo, no una página
+	page, ok := vc.homeVideos(c, "")
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, newVideoListJSON(page.Items))
+}
+
+// homeVideos responde el error si lo hay y devuelve false
+func (vc *VideoControllerImpl) homeVideos(c *gin.Context, cursor string) (*models.VideoPage, bool) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	page, err := vc.recommendationService.GetHomeVideos(c.Query("sort"), cursor, limit)
+
+	if errors.Is(err, services.ErrInvalidCursor) || errors.Is(err, services.ErrInvalidHomeSort) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		return nil, false
 	}
 
-	c.JSON(http.StatusOK, videos)
+	return page, true
 }
 
-
 // GetVideoByID		godoc
 // @Summary 		Get a video by ID
-// @Description 	Get a video by its ID
+// @Description 	Get a video by its ID. When the request has a token the response includes resume_position, where the user stopped watching, and my_reaction. Uploaded videos include the metadata read by ffprobe (resolution, frame rate, codecs, bitrates, rotation, HDR)
 // @Tags 			streaming
 // @Produce 		json
 // @Param 			videoid path string true "Video ID"
-// @Success 		200 {object} models.VideoSwagger{}
+// @Success 		200 {object} models.VideoResponse{}
 // @Failure 		400 {object} map[string]string
+// @Failure 		404 {object} map[string]string
 // @Failure 		500 {object} map[string]string
 // @Router 			/streaming/id/{videoid} [get]
 func (vc *VideoControllerImpl) GetVideoByID(c *gin.Context) {
@@ -51,49 +106,169 @@ func (vc *VideoControllerImpl) GetVideoByID(c *gin.Context) {
 
 	video, err := vc.databaseVideoService.FindVideoByID(videoId)
 
+	if errors.Is(err, services.ErrVideoNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// un video oculto por moderación, o que todavía no se puede reproducir, solo lo ven su dueño y los moderadores
+	if video.HiddenAt != nil || video.State == models.VideoStateProcessing || video.State == models.VideoStateFailed || video.State == models.VideoStateCancelled {
+		viewer, _ := c.Get("user")
+		user, _ := viewer.(*models.User)
+
+		if user == nil || (user.Id != video.UserID && user.Role != models.RoleModerator && user.Role != models.RoleAdmin) {
+			c.JSON(http.StatusNotFound, gin.H{"error": services.ErrVideoNotFound.Error()})
+			return
+		}
+	}
+
+	response := models.VideoResponse{VideoModel: *video}
+
+	response.Tags, err = vc.databaseVideoService.FindVideoTags(video.Id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, video)
+	response.Metadata, err = vc.databaseVideoService.FindVideoMetadata(video.Id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// con sesión iniciada se devuelve dónde retomar (un video terminado empieza de nuevo) y su reacción
+	if viewer := currentViewer(c); viewer.UserID != "" {
+		progress, err := vc.watchHistoryService.GetProgress(viewer.UserID, video.Id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if progress != nil {
+			resumePosition := progress.Position
+			if progress.Completed {
+				resumePosition = 0
+			}
+			response.ResumePosition = &resumePosition
+		}
+
+		response.MyReaction, err = vc.reactionService.GetReaction(viewer.UserID, video.Id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, newVideoResponseJSON(response))
 }
 
 // IncrementViews		godoc
-// @Summary 		Increment the views of a video
-// @Description 	Increment the views of a video by 1
+// @Summary 		Report playback to count a view
+// @Description 	Without session_id a playback session is opened. The player then reports the seconds watched with the session_id, and the view is counted once the minimum watch time is reached, once per viewer within the dedup window
 // @Tags 			streaming
+// @Accept 			json
 // @Produce 		json
 // @Param 			videoid path string true "Video ID"
-// @Success 		200 {object} models.VideoSwagger{}	
+// @Param 			view body models.ViewRequest{} false "Playback session and seconds watched"
+// @Success 		200 {object} models.ViewResult{}
 // @Failure 		400 {object} map[string]string
+// @Failure 		404 {object} map[string]string
 // @Failure 		500 {object} map[string]string
 // @Router 			/streaming/views/{videoid} [patch]
 func (vc *VideoControllerImpl) IncrementViews(c *gin.Context) {
 	videoId := c.Param("videoid")
 
-	video, err := vc.databaseVideoService.IncrementViews(videoId)
+	var request models.ViewRequest
+
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	result, err := vc.viewService.RecordView(videoId, currentViewer(c), &request)
+
+	if errors.Is(err, services.ErrPlaybackSessionNotFound) || errors.Is(err, services.ErrVideoNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, video)
+	c.JSON(http.StatusOK, result)
 	
 }
 
+// UpdateTags		godoc
+// @Summary 		Replace the tags of a video
+// @Description 	Replaces all the tags of a video of the authenticated user. Tags are stored lowercase and are used to find related videos
+// @Tags 			streaming
+// @Accept 			json
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			videoid path string true "Video ID"
+// @Param 			tags body models.TagsRequest true "Tags (max 10, 30 characters each)"
+// @Success 		200 {object} models.TagsRequest{}
+// @Failure 		400 {object} map[string]string
+// @Failure 		403 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/streaming/id/{videoid}/tags [put]
+func (vc *VideoControllerImpl) UpdateTags(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	var request models.TagsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	video, ok := ownedVideo(c, vc.databaseVideoService, user, c.Param("videoid"))
+	if !ok {
+		return
+	}
+
+	tags, err := vc.databaseVideoService.SetVideoTags(video.Id, request.Tags)
+
+	if errors.Is(err, services.ErrInvalidTags) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TagsRequest{Tags: tags})
+}
+
 // SaveVideo		godoc
 // @Summary 		Save a video
-// @Description 	Upload a video file along with metadata (title and description) and save to the AWS bucket.
+// @Description 	Upload a video file along with metadata (title and description). The video is saved in the processing state and converted and uploaded to the AWS bucket in the background, follow it with /streaming/id/{videoid}/progress. It becomes ready, failed if it could not be processed or took too long, or cancelled with /streaming/id/{videoid}/cancel.
 // @Tags 			streaming
 // @Accept 			multipart/form-data
 // @Produce 		json
 // @Param 			title formData string true "Video Title"
 // @Param 			description formData string false "Video Description"
+// @Param 			tags formData string false "Comma separated tags (max 10, 30 characters each)"
+// @Param 			profile formData string false "Encoding profile (see /streaming/profiles), the default one if empty"
 // @Param 			video formData file true "Video File"
-// @Success 		200 {object} models.VideoSwagger{}
+// @Success 		202 {object} models.VideoSwagger{}
 // @Failure 		400 {object} map[string]string
+// @Failure 		403 {object} map[string]string
 // @Failure 		500 {object} map[string]string
 // @Router 			/streaming/upload [post]
 func (vc *VideoControllerImpl) CreateVideo(c *gin.Context) {
@@ -125,69 +300,197 @@ func (vc *VideoControllerImpl) CreateVideo(c *gin.Context) {
 		return
 	}
 
-	// guardar archivo en local
-	videoData, err := vc.videoService.SaveVideo(c)
+	// etiquetas separadas por comas, se validan antes de procesar el video
+	tags, err := services.NormalizeTags(strings.Split(c.PostForm("tags"), ","))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// borrar el archivo original
-	defer vc.videoService.GetFilesService().RemoveFile(videoData.LocalPath)
+	// perfil de codificación, algunos solo los pueden usar ciertos roles
+	profile, err := services.EncodingProfileFor(c.PostForm("profile"), authenticatedUser.Role)
+	if errors.Is(err, services.ErrEncodingProfileNotAllowed) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 
-	// comprimir el video
-	// pendiente
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	//pasar a archivos .ts y .m3u8 con ffmpeg y guardarlo en local
-	filesPath, err := vc.videoService.FormatVideo(videoData.UniqueName)
+	// guardar archivo en local
+	videoData, err := vc.videoService.SaveVideo(c)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// borrar archivos locales .ts y .m3u8
-	defer vc.videoService.GetFilesService().RemoveFolder(filesPath)
+	videoData.Tags = tags
+	videoData.EncodingProfile = profile
 
-	// generar miniatura del segundo 1 del video
-	_, err = services.SaveThumbnail(videoData.LocalPath, filesPath)
+	// el video se convierte y se sube en segundo plano, el avance se sigue en /progress
+	Video, err := vc.processingService.Start(videoData, authenticatedUser.Id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		// borrar el archivo original
+		vc.videoService.GetFilesService().RemoveFile(videoData.LocalPath)
+
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, newVideoJSON(*Video))
+}
+
+// GetProcessingProgress	godoc
+// @Summary 		Follow the processing of an uploaded video
+// @Description 	Server-Sent Events stream of the processing job of a video of the authenticated user. A progress event is sent with the current state and on every change, with the stage, the percent converted and the estimated seconds left. The stream ends after the event with status ready, failed or cancelled. Since EventSource can't send headers, the token can also go in ?access_token=
+// @Tags 			streaming
+// @Produce 		text/event-stream
+// @Security 		BearerAuth
+// @Param 			videoid path string true "Video ID"
+// @Success 		200 {object} models.ProcessingJob{}
+// @Failure 		403 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/streaming/id/{videoid}/progress [get]
+func (vc *VideoControllerImpl) GetProcessingProgress(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	video, ok := ownedVideo(c, vc.databaseVideoService, user, c.Param("videoid"))
+	if !ok {
+		return
+	}
+
+	updates, stop, err := vc.processingService.Watch(video.Id)
+
+	if errors.Is(err, services.ErrProcessingJobNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
 
-	// subir el video a s3
-	savedDataInS3, baseFolder, err := vc.videoService.UploadFilesFromFolderToS3(filesPath)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	videoData.M3u8FileURL = savedDataInS3.M3u8FileURL
-	videoData.ThumbnailURL = savedDataInS3.ThumbnailURL
-	
-	// finalmente, guardar la url del video en la base de datos
-	Video, err := vc.databaseVideoService.CreateVideo(videoData, authenticatedUser.Id)
+	defer stop()
+
+	// sin esto un proxy puede guardar los eventos hasta que termine la respuesta
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	heartbeat := time.NewTicker(progressHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case job, open := <-updates:
+			if !open {
+				return
+			}
+
+			c.SSEvent("progress", job)
+			c.Writer.Flush()
+
+			if job.Finished() {
+				return
+			}
+
+		case <-heartbeat.C:
+			// un comentario para que no se corte la conexión mientras ffmpeg no reporta
+			io.WriteString(c.Writer, ": ping\n\n")
+			c.Writer.Flush()
+
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// CancelProcessing	godoc
+// @Summary 		Cancel the processing of an uploaded video
+// @Description 	Stops the conversion or the upload of a video of the authenticated user and removes what was generated, locally and in the bucket. Responds once it is stopped, with the job and the video in the cancelled state
+// @Tags 			streaming
+// @Produce 		json
+// @Security 		BearerAuth
+// @Param 			videoid path string true "Video ID"
+// @Success 		200 {object} models.ProcessingJob{}
+// @Failure 		403 {object} map[string]string
+// @Failure 		404 {object} map[string]string
+// @Failure 		409 {object} map[string]string
+// @Failure 		500 {object} map[string]string
+// @Router 			/streaming/id/{videoid}/cancel [post]
+func (vc *VideoControllerImpl) CancelProcessing(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
+		return
+	}
+
+	video, ok := ownedVideo(c, vc.databaseVideoService, user, c.Param("videoid"))
+	if !ok {
+		return
+	}
+
+	job, err := vc.processingService.Cancel(video.Id)
+
+	if errors.Is(err, services.ErrProcessingJobNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if errors.Is(err, services.ErrProcessingJobFinished) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-		// como el video no se guardó en la base de datos, se debe borrar de s3
-		// como folder/
-		defer vc.videoService.DeleteS3Folder(baseFolder + "/")
+	c.JSON(http.StatusOK, job)
+}
 
-		c.JSON(400, gin.H{"error": err.Error()})
+// GetEncodingProfiles	godoc
+// @Summary 		Get the encoding profiles
+// @Description 	The encoding profiles the authenticated user can choose when uploading a video, the default one is used if none is chosen
+// @Tags 			streaming
+// @Produce 		json
+// @Security 		BearerAuth
+// @Success 		200 {array} models.EncodingProfile{}
+// @Failure 		500 {object} map[string]string
+// @Router 			/streaming/profiles [get]
+func (vc *VideoControllerImpl) GetEncodingProfiles(c *gin.Context) {
+	user, ok := authenticatedUser(c)
+	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, Video)
+	c.JSON(http.StatusOK, services.AvailableEncodingProfiles(user.Role))
 }
 
 type VideoControllerImpl struct {
 	videoService services.VideoService;
 	databaseVideoService services.DatabaseVideoService
+	viewService services.ViewService
+	watchHistoryService services.WatchHistoryService
+	reactionService services.ReactionService
+	recommendationService services.RecommendationService
+	processingService services.ProcessingService
 }
 
-func NewVideoController(videoService services.VideoService, databaseVideoService services.DatabaseVideoService) VideoController {
+func NewVideoController(videoService services.VideoService, databaseVideoService services.DatabaseVideoService, viewService services.ViewService, watchHistoryService services.WatchHistoryService, reactionService services.ReactionService, recommendationService services.RecommendationService, processingService services.ProcessingService) VideoController {
 	return &VideoControllerImpl{
 		videoService: videoService,
 		databaseVideoService: databaseVideoService,
+		viewService: viewService,
+		watchHistoryService: watchHistoryService,
+		reactionService: reactionService,
+		recommendationService: recommendationService,
+		processingService: processingService,
 	}
 }
\ No newline at end of file
@@ -0,0 +1,639 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gin-gonic/gin"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"github.com/unbot2313/go-streaming-service/internal/services"
+	"github.com/unbot2313/go-streaming-service/internal/services/servicestest"
+)
+
+const testBucket = "test-bucket"
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+
+	// la configuración se lee una sola vez, tiene que estar antes de cualquier test
+	os.Setenv("LOCAL_STORAGE_PATH", "static/videos")
+	os.Setenv("AWS_BUCKET_NAME", testBucket)
+	os.Setenv("ENCODING_PROFILES", "hd")
+	os.Setenv("ENCODING_PROFILE_HD_SEGMENT_SECONDS", "4")
+	os.Setenv("ENCODING_PROFILE_HD_ROLES", "admin")
+	os.Setenv("PROCESSING_TRANSCODE_TIMEOUT", "500ms")
+
+	os.Exit(m.Run())
+}
+
+// fakeS3 es un bucket en memoria con lo que usa el servicio: PutObject, ListObjectsV2 y DeleteObjects
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (fake *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/"+testBucket), "/")
+
+	switch {
+	case r.Method == http.MethodPut && key != "":
+		body, _ := io.ReadAll(r.Body)
+		fake.objects[key] = body
+		w.Header().Set("ETag", `"etag"`)
+
+	case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		type content struct{ Key string }
+		result := struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Name     string
+			Prefix   string
+			KeyCount int
+			Contents []content
+		}{Name: testBucket, Prefix: r.URL.Query().Get("prefix")}
+
+		for objectKey := range fake.objects {
+			if strings.HasPrefix(objectKey, result.Prefix) {
+				result.Contents = append(result.Contents, content{Key: objectKey})
+			}
+		}
+		result.KeyCount = len(result.Contents)
+
+		w.Header().Set("Content-Type", "application/xml")
+		xml.NewEncoder(w).Encode(result)
+
+	case r.Method == http.MethodPost && r.URL.Query().Has("delete"):
+		var request struct {
+			Objects []struct{ Key string } `xml:"Object"`
+		}
+		xml.NewDecoder(r.Body).Decode(&request)
+
+		for _, object := range request.Objects {
+			delete(fake.objects, object.Key)
+		}
+
+		w.Header().Set("Content-Type", "application/xml")
+		io.WriteString(w, `<DeleteResult></DeleteResult>`)
+
+	default:
+		http.Error(w, "unsupported", http.StatusNotImplemented)
+	}
+}
+
+func (fake *fakeS3) keys() []string {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	keys := make([]string, 0, len(fake.objects))
+	for key := range fake.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// fakeVideoDB guarda en memoria los videos que crea el controlador y el avance de su procesamiento
+type fakeVideoDB struct {
+	services.DatabaseVideoService
+	err error
+
+	mu     sync.Mutex
+	videos []*models.Video
+	models map[string]*models.VideoModel
+	jobs   map[string]models.ProcessingJob
+}
+
+func (fake *fakeVideoDB) CreateVideo(videoData *models.Video, userId string) (*models.VideoModel, error) {
+	if fake.err != nil {
+		return nil, fake.err
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.videos = append(fake.videos, videoData)
+
+	video := &models.VideoModel{
+		Id:              videoData.Id,
+		Title:           videoData.Title,
+		Description:     videoData.Description,
+		UserID:          userId,
+		VideoUrl:        videoData.M3u8FileURL,
+		DurationSeconds: videoData.DurationSeconds,
+		ThumbnailURL:    videoData.ThumbnailURL,
+		State:           videoData.State,
+	}
+	fake.models[video.Id] = video
+
+	saved := *video
+	return &saved, nil
+}
+
+func (fake *fakeVideoDB) FinishVideoProcessing(videoData *models.Video) (*models.VideoModel, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	video, ok := fake.models[videoData.Id]
+	if !ok {
+		return nil, services.ErrVideoNotFound
+	}
+
+	video.State = videoData.State
+	video.VideoUrl = videoData.M3u8FileURL
+	video.ThumbnailURL = videoData.ThumbnailURL
+
+	saved := *video
+	return &saved, nil
+}
+
+func (fake *fakeVideoDB) FindVideoByID(videoId string) (*models.VideoModel, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	video, ok := fake.models[videoId]
+	if !ok {
+		return nil, services.ErrVideoNotFound
+	}
+
+	saved := *video
+	return &saved, nil
+}
+
+func (fake *fakeVideoDB) SaveProcessingJob(job *models.ProcessingJob) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.jobs[job.VideoID] = *job
+	return nil
+}
+
+func (fake *fakeVideoDB) FindProcessingJob(videoId string) (*models.ProcessingJob, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	job, ok := fake.jobs[videoId]
+	if !ok {
+		return nil, services.ErrProcessingJobNotFound
+	}
+
+	return &job, nil
+}
+
+func (fake *fakeVideoDB) state(videoId string) string {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	return fake.models[videoId].State
+}
+
+type fakeNotifications struct {
+	services.NotificationService
+	published []string
+}
+
+func (fake *fakeNotifications) NotifyVideoPublished(video *models.VideoModel) error {
+	fake.published = append(fake.published, video.Id)
+	return nil
+}
+
+type uploadTest struct {
+	transcoder    *servicestest.FakeTranscoder
+	s3            *fakeS3
+	db            *fakeVideoDB
+	notifications *fakeNotifications
+	processing    services.ProcessingService
+	router        *gin.Engine
+}
+
+// newUploadTest arma el controlador con ffmpeg y la base de datos falsos y un s3 en memoria,
+// en una carpeta vacía porque las rutas de los videos son relativas al directorio actual
+func newUploadTest(t *testing.T, role string) *uploadTest {
+	t.Helper()
+
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(previous) })
+
+	test := &uploadTest{
+		transcoder:    &servicestest.FakeTranscoder{DurationSeconds: 65},
+		s3:            &fakeS3{objects: make(map[string][]byte)},
+		db:            &fakeVideoDB{models: make(map[string]*models.VideoModel), jobs: make(map[string]models.ProcessingJob)},
+		notifications: &fakeNotifications{},
+	}
+
+	server := httptest.NewServer(test.s3)
+	t.Cleanup(server.Close)
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+	})
+
+	videoService := services.NewVideoService(services.S3Configuration{
+		BucketName: testBucket,
+		Client:     client,
+		Uploader:   manager.NewUploader(client),
+	}, services.NewFilesService(), test.transcoder, test.transcoder)
+
+	test.processing = services.NewProcessingService(videoService, test.db, test.notifications)
+	controller := NewVideoController(videoService, test.db, nil, nil, nil, nil, test.processing)
+
+	test.router = gin.New()
+	test.router.Use(func(c *gin.Context) {
+		c.Set("user", &models.User{Id: "user-1", Username: "tester", Role: role})
+	})
+	test.router.POST("/upload", controller.CreateVideo)
+	test.router.GET("/id/:videoid/progress", controller.GetProcessingProgress)
+	test.router.POST("/id/:videoid/cancel", controller.CancelProcessing)
+
+	return test
+}
+
+// wait espera a que termine el procesamiento del video y devuelve cómo quedó el trabajo
+func (test *uploadTest) wait(t *testing.T, videoId string) models.ProcessingJob {
+	t.Helper()
+
+	updates, stop, err := test.processing.Watch(videoId)
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	defer stop()
+
+	var job models.ProcessingJob
+	timeout := time.After(5 * time.Second)
+
+	for {
+		select {
+		case update, open := <-updates:
+			if !open {
+				return job
+			}
+			job = update
+
+		case <-timeout:
+			t.Fatalf("processing did not finish, last update %+v", job)
+		}
+	}
+}
+
+// uploadAndWait sube el video, verifica que se aceptó y espera a que se procese
+func (test *uploadTest) uploadAndWait(t *testing.T, fileName string, fields map[string]string) (models.VideoModel, models.ProcessingJob) {
+	t.Helper()
+
+	recorder := test.upload(t, fileName, fields)
+
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, body = %s", recorder.Code, recorder.Body)
+	}
+
+	var response models.VideoModel
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	return response, test.wait(t, response.Id)
+}
+
+func (test *uploadTest) upload(t *testing.T, fileName string, fields map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	for name, value := range fields {
+		writer.WriteField(name, value)
+	}
+
+	file, err := writer.CreateFormFile("video", fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte("not really a video"))
+	writer.Close()
+
+	request := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+
+	recorder := httptest.NewRecorder()
+	test.router.ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+// assertNoLocalFiles verifica que no quedó el original ni la carpeta con el HLS
+func assertNoLocalFiles(t *testing.T) {
+	t.Helper()
+
+	for _, folder := range []string{"static/videos", "static/temp"} {
+		entries, err := os.ReadDir(folder)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			t.Fatal(err)
+		}
+
+		if len(entries) > 0 {
+			t.Errorf("%s was not cleaned up: %d entries left", folder, len(entries))
+		}
+	}
+}
+
+func TestCreateVideoUploadsHLSAndSavesVideo(t *testing.T) {
+	test := newUploadTest(t, models.RoleUser)
+
+	response, job := test.uploadAndWait(t, "clip.mp4", map[string]string{
+		"title":       "My clip",
+		"description": "A test upload",
+		"tags":        "Go, testing",
+	})
+
+	if response.State != models.VideoStateProcessing {
+		t.Errorf("state in the response = %q, want processing", response.State)
+	}
+
+	if job.Status != models.VideoStateReady || job.Percent != 100 || job.CompletedAt == nil {
+		t.Errorf("job = %+v, want ready at 100%%", job)
+	}
+
+	if len(test.db.videos) != 1 {
+		t.Fatalf("videos saved = %d, want 1", len(test.db.videos))
+	}
+	video := test.db.videos[0]
+
+	if video.Title != "My clip" || video.Description != "A test upload" {
+		t.Errorf("video = %+v", video)
+	}
+	if video.DurationSeconds != 65 {
+		t.Errorf("duration = %v, want 65", video.DurationSeconds)
+	}
+	if video.Metadata == nil || video.Metadata.Height != 720 || video.Metadata.VideoCodec != "h264" || len(video.Metadata.Streams) != 2 {
+		t.Errorf("metadata = %+v, want the one read by ffprobe", video.Metadata)
+	}
+	if strings.Join(video.Tags, ",") != "go,testing" {
+		t.Errorf("tags = %v", video.Tags)
+	}
+	if video.EncodingProfile == nil || video.EncodingProfile.Name != "default" {
+		t.Errorf("encoding profile = %+v, want default", video.EncodingProfile)
+	}
+
+	// 65 segundos en segmentos de 10 del perfil por defecto
+	folder := video.Id + "_clip"
+	want := []string{path.Join(folder, "output.m3u8")}
+	for i := 0; i < 7; i++ {
+		want = append(want, path.Join(folder, fmt.Sprintf("output%d.ts", i)))
+	}
+	want = append(want, path.Join(folder, "thumbnail.webp"), path.Join(folder, "original", "clip.mp4"))
+	sort.Strings(want)
+
+	if got := test.s3.keys(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("s3 objects = %v, want %v", got, want)
+	}
+
+	if !strings.HasSuffix(video.M3u8FileURL, "/"+testBucket+"/"+folder+"/output.m3u8") {
+		t.Errorf("m3u8 url = %q", video.M3u8FileURL)
+	}
+	if !strings.HasSuffix(video.ThumbnailURL, "/"+folder+"/thumbnail.webp") {
+		t.Errorf("thumbnail url = %q", video.ThumbnailURL)
+	}
+
+	if response.Id != video.Id {
+		t.Errorf("response = %+v", response)
+	}
+	if state := test.db.state(video.Id); state != models.VideoStateReady {
+		t.Errorf("video state = %q, want ready", state)
+	}
+
+	if len(test.notifications.published) != 1 || test.notifications.published[0] != video.Id {
+		t.Errorf("notified = %v, want [%s]", test.notifications.published, video.Id)
+	}
+
+	assertNoLocalFiles(t)
+}
+
+func TestCreateVideoUsesChosenProfile(t *testing.T) {
+	test := newUploadTest(t, models.RoleAdmin)
+
+	test.uploadAndWait(t, "clip.mp4", map[string]string{"title": "HD clip", "profile": "hd"})
+
+	profiles := test.transcoder.Profiles()
+	if len(profiles) != 1 || profiles[0].Name != "hd" {
+		t.Fatalf("profiles = %v, want [hd]", profiles)
+	}
+
+	// 65 segundos en segmentos de 4: 17 segmentos, el playlist, la miniatura y el original
+	if got := len(test.s3.keys()); got != 20 {
+		t.Errorf("s3 objects = %d, want 20", got)
+	}
+
+	if video := test.db.videos[0]; video.EncodingProfile == nil || video.EncodingProfile.SegmentSeconds != 4 {
+		t.Errorf("encoding profile = %+v, want hd", video.EncodingProfile)
+	}
+}
+
+func TestCreateVideoRejectsProfileForRole(t *testing.T) {
+	test := newUploadTest(t, models.RoleUser)
+
+	if recorder := test.upload(t, "clip.mp4", map[string]string{"title": "clip", "profile": "hd"}); recorder.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", recorder.Code)
+	}
+
+	if recorder := test.upload(t, "clip.mp4", map[string]string{"title": "clip", "profile": "4k"}); recorder.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", recorder.Code)
+	}
+
+	if len(test.transcoder.Profiles()) != 0 || len(test.s3.keys()) != 0 {
+		t.Error("nothing should be processed with an invalid profile")
+	}
+
+	assertNoLocalFiles(t)
+}
+
+func TestCreateVideoRejectsInvalidExtension(t *testing.T) {
+	test := newUploadTest(t, models.RoleUser)
+
+	recorder := test.upload(t, "notes.txt", map[string]string{"title": "notes"})
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", recorder.Code)
+	}
+
+	if len(test.db.videos) != 0 {
+		t.Error("no video should be saved")
+	}
+}
+
+func TestCreateVideoProbeFailure(t *testing.T) {
+	test := newUploadTest(t, models.RoleUser)
+	test.transcoder.Err = errors.New("ffprobe failed")
+
+	recorder := test.upload(t, "clip.mp4", map[string]string{"title": "clip"})
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", recorder.Code)
+	}
+
+	if len(test.s3.keys()) != 0 || len(test.db.videos) != 0 {
+		t.Error("nothing should be uploaded or saved")
+	}
+
+	assertNoLocalFiles(t)
+}
+
+func TestCreateVideoSegmentFailureMarksVideoFailed(t *testing.T) {
+	test := newUploadTest(t, models.RoleUser)
+	test.transcoder.SegmentErr = errors.New("ffmpeg failed")
+
+	response, job := test.uploadAndWait(t, "clip.mp4", map[string]string{"title": "clip"})
+
+	if job.Status != models.VideoStateFailed || job.Error != "transcoding failed" {
+		t.Errorf("job = %+v, want failed while transcoding", job)
+	}
+
+	if state := test.db.state(response.Id); state != models.VideoStateFailed {
+		t.Errorf("video state = %q, want failed", state)
+	}
+
+	if len(test.s3.keys()) != 0 || len(test.notifications.published) != 0 {
+		t.Error("nothing should be uploaded or notified")
+	}
+
+	assertNoLocalFiles(t)
+}
+
+func TestGetProcessingProgressStreamsJob(t *testing.T) {
+	test := newUploadTest(t, models.RoleUser)
+
+	response, _ := test.uploadAndWait(t, "clip.mp4", map[string]string{"title": "clip"})
+
+	request := httptest.NewRequest(http.MethodGet, "/id/"+response.Id+"/progress", nil)
+	recorder := httptest.NewRecorder()
+	test.router.ServeHTTP(recorder, request)
+
+	if got := recorder.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("content type = %q", got)
+	}
+
+	body := recorder.Body.String()
+	if !strings.HasPrefix(body, "event:progress\ndata:") || !strings.Contains(body, `"status":"ready"`) {
+		t.Errorf("body = %q, want a progress event with the finished job", body)
+	}
+
+	request = httptest.NewRequest(http.MethodGet, "/id/unknown/progress", nil)
+	recorder = httptest.NewRecorder()
+	test.router.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("unknown video: status = %d, want 404", recorder.Code)
+	}
+}
+
+func TestCreateVideoDatabaseFailureRemovesUpload(t *testing.T) {
+	test := newUploadTest(t, models.RoleUser)
+	test.db.err = errors.New("database down")
+
+	recorder := test.upload(t, "clip.mp4", map[string]string{"title": "clip"})
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", recorder.Code)
+	}
+
+	if keys := test.s3.keys(); len(keys) != 0 {
+		t.Errorf("s3 objects left = %v, want none", keys)
+	}
+
+	if len(test.notifications.published) != 0 {
+		t.Error("no notification should be sent")
+	}
+
+	assertNoLocalFiles(t)
+}
+
+func TestCancelProcessing(t *testing.T) {
+	test := newUploadTest(t, models.RoleUser)
+	test.transcoder.SegmentDelay = time.Minute
+
+	recorder := test.upload(t, "clip.mp4", map[string]string{"title": "clip"})
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, body = %s", recorder.Code, recorder.Body)
+	}
+
+	var video models.VideoModel
+	if err := json.Unmarshal(recorder.Body.Bytes(), &video); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		test.router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/id/"+video.Id+"/cancel", nil))
+		return recorder
+	}
+
+	recorder = cancel()
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", recorder.Code, recorder.Body)
+	}
+
+	var job models.ProcessingJob
+	if err := json.Unmarshal(recorder.Body.Bytes(), &job); err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != models.VideoStateCancelled || job.Stage != models.ProcessingStageTranscoding {
+		t.Errorf("job = %+v, want cancelled while transcoding", job)
+	}
+
+	if state := test.db.state(video.Id); state != models.VideoStateCancelled {
+		t.Errorf("video state = %q, want cancelled", state)
+	}
+
+	if len(test.s3.keys()) != 0 || len(test.notifications.published) != 0 {
+		t.Error("nothing should be uploaded or notified")
+	}
+
+	assertNoLocalFiles(t)
+
+	if recorder := cancel(); recorder.Code != http.StatusConflict {
+		t.Errorf("second cancel: status = %d, want 409", recorder.Code)
+	}
+}
+
+func TestProcessingStageTimeoutMarksVideoFailed(t *testing.T) {
+	test := newUploadTest(t, models.RoleUser)
+	test.transcoder.SegmentDelay = time.Minute
+
+	response, job := test.uploadAndWait(t, "clip.mp4", map[string]string{"title": "clip"})
+
+	if job.Status != models.VideoStateFailed || job.Error != "transcoding timed out" {
+		t.Errorf("job = %+v, want failed with a timeout", job)
+	}
+
+	if state := test.db.state(response.Id); state != models.VideoStateFailed {
+		t.Errorf("video state = %q, want failed", state)
+	}
+
+	assertNoLocalFiles(t)
+}
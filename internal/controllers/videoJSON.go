@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/unbot2313/go-streaming-service/internal/models"
+)
+
+// videoJSON es un video como lo responde la API: los campos del modelo y la duración para mostrar
+type videoJSON struct {
+	models.VideoModel
+	Duration string `json:"duration"`
+}
+
+type videoPageJSON struct {
+	Items      []videoJSON `json:"items"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// videoResponseJSON agrega la duración formateada a un models.VideoResponse
+type videoResponseJSON struct {
+	models.VideoResponse
+	Duration string `json:"duration"`
+}
+
+// historyItemJSON reemplaza el video del modelo por el de la API
+type historyItemJSON struct {
+	models.HistoryItem
+	Video videoJSON `json:"video"`
+}
+
+type historyPageJSON struct {
+	Items      []historyItemJSON `json:"items"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+// userJSON reemplaza los videos del usuario por los de la API
+type userJSON struct {
+	*models.User
+	Videos []videoJSON `json:"videos"`
+}
+
+// formatDuration arma la duración para mostrar: m:ss, o h:mm:ss desde una hora
+func formatDuration(seconds float64) string {
+	total := int64(math.Round(max(seconds, 0)))
+	hours, minutes, secs := total/3600, total/60%60, total%60
+
+	if hours > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", hours, minutes, secs)
+	}
+
+	return fmt.Sprintf("%d:%02d", minutes, secs)
+}
+
+func newVideoJSON(video models.VideoModel) videoJSON {
+	return videoJSON{VideoModel: video, Duration: formatDuration(video.DurationSeconds)}
+}
+
+func newVideoListJSON(videos []models.VideoModel) []videoJSON {
+	items := make([]videoJSON, 0, len(videos))
+	for _, video := range videos {
+		items = append(items, newVideoJSON(video))
+	}
+	return items
+}
+
+func newVideoPageJSON(page *models.VideoPage) videoPageJSON {
+	return videoPageJSON{Items: newVideoListJSON(page.Items), NextCursor: page.NextCursor}
+}
+
+func newVideoResponseJSON(response models.VideoResponse) videoResponseJSON {
+	return videoResponseJSON{VideoResponse: response, Duration: formatDuration(response.DurationSeconds)}
+}
+
+func newHistoryListJSON(items []models.HistoryItem) []historyItemJSON {
+	list := make([]historyItemJSON, 0, len(items))
+	for _, item := range items {
+		list = append(list, historyItemJSON{HistoryItem: item, Video: newVideoJSON(item.Video)})
+	}
+	return list
+}
+
+func newHistoryPageJSON(page *models.HistoryPage) historyPageJSON {
+	return historyPageJSON{Items: newHistoryListJSON(page.Items), NextCursor: page.NextCursor}
+}
+
+func newUserJSON(user *models.User) userJSON {
+	return userJSON{User: user, Videos: newVideoListJSON(user.Videos)}
+}
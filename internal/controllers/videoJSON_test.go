@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/unbot2313/go-streaming-service/internal/models"
+)
+
+func TestFormatDuration(t *testing.T) {
+	cases := map[float64]string{
+		0:      "0:00",
+		45:     "0:45",
+		65:     "1:05",
+		187.6:  "3:08",
+		599.6:  "10:00",
+		3723.2: "1:02:03",
+	}
+
+	for seconds, want := range cases {
+		if got := formatDuration(seconds); got != want {
+			t.Errorf("formatDuration(%v) = %q, want %q", seconds, got, want)
+		}
+	}
+}
+
+func TestVideoJSONIncludesFormattedDuration(t *testing.T) {
+	video := models.VideoModel{Id: "video-1", DurationSeconds: 187}
+	position := 12.0
+
+	values := map[string]any{
+		"video": newVideoJSON(video),
+		"response": newVideoResponseJSON(models.VideoResponse{
+			VideoModel:     video,
+			ResumePosition: &position,
+			Tags:           []string{"go"},
+			Metadata:       &models.VideoMetadata{Width: 1280, Height: 720},
+		}),
+		"history": newHistoryListJSON([]models.HistoryItem{{Video: video, Duration: 187}})[0].Video,
+		"user":    newUserJSON(&models.User{Id: "user-1", Videos: []models.VideoModel{video}}).Videos[0],
+	}
+
+	for name, value := range values {
+		data, err := json.Marshal(value)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		var fields map[string]any
+		if err := json.Unmarshal(data, &fields); err != nil {
+			t.Fatal(err)
+		}
+
+		if fields["id"] != "video-1" || fields["duration"] != "3:07" || fields["duration_seconds"] != 187.0 {
+			t.Errorf("%s json = %s", name, data)
+		}
+	}
+
+	data, _ := json.Marshal(values["response"])
+
+	var fields map[string]any
+	json.Unmarshal(data, &fields)
+
+	if fields["resume_position"] != 12.0 || fields["tags"] == nil || fields["metadata"] == nil {
+		t.Errorf("response json = %s", data)
+	}
+
+	// los modelos se serializan tal cual, sin la duración formateada
+	data, _ = json.Marshal(video)
+	fields = nil
+	json.Unmarshal(data, &fields)
+
+	if _, ok := fields["duration"]; ok {
+		t.Errorf("model json = %s", data)
+	}
+}
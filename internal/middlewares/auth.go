@@ -1,9 +1,12 @@
 package middlewares
 
 import (
+	"errors"
+	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/unbot2313/go-streaming-service/internal/models"
 	"github.com/unbot2313/go-streaming-service/internal/services"
 )
 
@@ -11,8 +14,7 @@ var authService = services.NewAuthService()
 
 func AuthMiddleware(c *gin.Context) {
 
-	Rawtoken := c.GetHeader("Authorization")
-	token := strings.Split(Rawtoken, "Bearer ")[1]
+	token := bearerToken(c)
 
 	if token == "" {
 		c.JSON(401, gin.H{"error": "Authorization token not provided"})
@@ -28,9 +30,88 @@ func AuthMiddleware(c *gin.Context) {
 		return
 	}
 
+	// una cuenta suspendida no puede usar la API aunque su token siga vigente
+	account, err := authService.CheckAccount(user.Id)
+
+	var suspendedErr *services.AccountSuspendedError
+
+	if errors.As(err, &suspendedErr) {
+		c.JSON(403, gin.H{"error": err.Error(), "suspended_until": suspendedErr.Until})
+		c.Abort()
+		return
+	}
+
+	if errors.Is(err, services.ErrUserNotFound) {
+		c.JSON(401, gin.H{"error": err.Error()})
+		c.Abort()
+		return
+	}
+
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		c.Abort()
+		return
+	}
+
+	user.Role = account.Role
+
 	// Guardar el usuario autenticado en el contexto de Gin
 	c.Set("user", user)
 
 
 	c.Next()
-}
\ No newline at end of file
+}
+
+// OptionalAuthMiddleware guarda el usuario en el contexto si el token es válido,
+// pero deja pasar el request sin usuario si no hay token o no es válido
+func OptionalAuthMiddleware(c *gin.Context) {
+
+	if token := bearerToken(c); token != "" {
+		if user, err := authService.ValidateToken(token); err == nil {
+			if account, err := authService.CheckAccount(user.Id); err == nil {
+				user.Role = account.Role
+				c.Set("user", user)
+			}
+		}
+	}
+
+	c.Next()
+}
+
+// RequireRole deja pasar solo a los usuarios con alguno de los roles, va después de AuthMiddleware
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := c.Get("user")
+		authenticatedUser, isUser := user.(*models.User)
+
+		if !ok || !isUser {
+			c.JSON(401, gin.H{"error": "Authorization token not provided"})
+			c.Abort()
+			return
+		}
+
+		if !slices.Contains(roles, authenticatedUser.Role) {
+			c.JSON(403, gin.H{"error": "No tiene permisos para esta acción"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// bearerToken lee el token del header Authorization. Los navegadores no pueden mandar
+// headers al abrir un websocket ni un EventSource, así que en esos casos también se acepta ?access_token=
+func bearerToken(c *gin.Context) string {
+	rawToken := c.GetHeader("Authorization")
+
+	if !strings.HasPrefix(rawToken, "Bearer ") {
+		if strings.EqualFold(c.GetHeader("Upgrade"), "websocket") || strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+			return c.Query("access_token")
+		}
+
+		return ""
+	}
+
+	return strings.TrimSpace(strings.TrimPrefix(rawToken, "Bearer "))
+}
@@ -0,0 +1,18 @@
+package middlewares
+
+import "testing"
+
+func TestRedactQuery(t *testing.T) {
+	cases := map[string]string{
+		"/api/v1/streaming/live":                                   "/api/v1/streaming/live",
+		"/api/v1/streaming/id/1/chat/ws?access_token=eyJhbGciOi":   "/api/v1/streaming/id/1/chat/ws?access_token=REDACTED",
+		"/api/v1/streaming/id/1/progress?a=1&access_token=eyJ&b=2": "/api/v1/streaming/id/1/progress?a=1&access_token=REDACTED&b=2",
+		"/api/v1/streaming/home?sort=newest":                       "/api/v1/streaming/home?sort=newest",
+	}
+
+	for path, want := range cases {
+		if got := redactQuery(path); got != want {
+			t.Errorf("redactQuery(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package models
+
+import "time"
+
+// Granularidades de las series de estadísticas
+const (
+	AnalyticsGranularityHour = "hour"
+	AnalyticsGranularityDay  = "day"
+)
+
+// VideoStatsHourly acumula por video y por slot de 15 minutos las vistas, el tiempo visto y los likes.
+// Hour es el inicio del slot en UTC; los slots más finos que una hora permiten agrupar por las horas
+// de zonas como Asia/Kolkata, que no coinciden con las de UTC
+type VideoStatsHourly struct {
+	VideoID      string    `gorm:"primaryKey;type:varchar(100)"`
+	Hour         time.Time `gorm:"primaryKey;index"`
+	Views        int64     `gorm:"not null;default:0"`
+	WatchSeconds float64   `gorm:"not null;default:0"`
+	Likes        int64     `gorm:"not null;default:0"`
+}
+
+func (VideoStatsHourly) TableName() string {
+	return "video_stats_hourly"
+}
+
+// VideoViewersHourly guarda qué espectadores vieron cada video en cada slot de 15 minutos, para poder
+// contar espectadores únicos en cualquier rango sin sumar dos veces al mismo
+type VideoViewersHourly struct {
+	VideoID   string    `gorm:"primaryKey;type:varchar(100)"`
+	Hour      time.Time `gorm:"primaryKey;index"`
+	ViewerKey string    `gorm:"primaryKey;type:varchar(100)"`
+}
+
+func (VideoViewersHourly) TableName() string {
+	return "video_viewers_hourly"
+}
+
+// AnalyticsQuery es el rango y la granularidad de una serie. Los periodos se cortan
+// en la zona horaria Location.
+type AnalyticsQuery struct {
+	From        time.Time
+	To          time.Time
+	Granularity string
+	Location    *time.Location
+}
+
+// AnalyticsPoint son los valores de un periodo de la serie
+type AnalyticsPoint struct {
+	Period        time.Time `json:"period"`
+	Views         int64     `json:"views"`
+	UniqueViewers int64     `json:"unique_viewers"`
+	WatchSeconds  float64   `json:"watch_seconds"`
+	Likes         int64     `json:"likes"`
+}
+
+// AnalyticsTotals son los valores de todo el rango, los espectadores únicos
+// se cuentan sobre el rango completo y no como suma de los periodos
+type AnalyticsTotals struct {
+	Views         int64   `json:"views"`
+	UniqueViewers int64   `json:"unique_viewers"`
+	WatchSeconds  float64 `json:"watch_seconds"`
+	Likes         int64   `json:"likes"`
+}
+
+// AnalyticsSeries es la respuesta de las estadísticas de un video o de un canal
+type AnalyticsSeries struct {
+	VideoID     string           `json:"video_id,omitempty"`
+	UserID      string           `json:"user_id,omitempty"`
+	From        time.Time        `json:"from"`
+	To          time.Time        `json:"to"`
+	Granularity string           `json:"granularity"`
+	Timezone    string           `json:"timezone"`
+	Totals      AnalyticsTotals  `json:"totals"`
+	Points      []AnalyticsPoint `json:"points"`
+}
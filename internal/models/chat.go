@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Tipos de los mensajes del websocket del chat, los mismos sirven para lo que manda el
+// cliente y para los eventos que reparte el servidor
+const (
+	ChatEventMessage  = "message"
+	ChatEventDelete   = "delete"
+	ChatEventTimeout  = "timeout"
+	ChatEventSlowMode = "slow_mode"
+	ChatEventError    = "error"
+	ChatEventClosed   = "closed"
+)
+
+// ChatMessage es un mensaje del chat de una transmisión. Offset son los segundos desde que
+// empezó la transmisión, para repetir el chat junto con la grabación.
+type ChatMessage struct {
+	Id        string         `json:"id" gorm:"primaryKey;not null"`
+	VideoID   string         `json:"video_id" gorm:"not null;index:idx_chat_messages_video,priority:1"`
+	UserID    string         `json:"user_id" gorm:"not null;index"`
+	Username  string         `json:"username" gorm:"not null"`
+	Body      string         `json:"body" gorm:"type:varchar(500);not null"`
+	Offset    float64        `json:"offset" gorm:"not null"`
+	CreatedAt time.Time      `json:"created_at" gorm:"index:idx_chat_messages_video,priority:2"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index" swaggerignore:"true"`
+}
+
+// ChatTimeout impide que un usuario escriba en el chat de un canal hasta Until
+type ChatTimeout struct {
+	ChannelID string    `json:"channel_id" gorm:"primaryKey"`
+	UserID    string    `json:"user_id" gorm:"primaryKey"`
+	Until     time.Time `json:"until"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ChatCommand es lo que manda el cliente por el websocket: message con body, delete con
+// message_id, timeout con user_id y seconds, slow_mode con seconds (0 lo desactiva)
+type ChatCommand struct {
+	Type      string `json:"type"`
+	Body      string `json:"body,omitempty"`
+	MessageID string `json:"message_id,omitempty"`
+	UserID    string `json:"user_id,omitempty"`
+	Seconds   int    `json:"seconds,omitempty"`
+}
+
+// ChatEvent es lo que reparte el servidor a los que están en el chat
+type ChatEvent struct {
+	Type      string       `json:"type"`
+	Message   *ChatMessage `json:"message,omitempty"`
+	MessageID string       `json:"message_id,omitempty"`
+	UserID    string       `json:"user_id,omitempty"`
+	Until     *time.Time   `json:"until,omitempty"`
+	Seconds   *int         `json:"seconds,omitempty"`
+	Error     string       `json:"error,omitempty"`
+}
+
+// ChatMessagePage es una página del chat en orden de llegada, NextCursor va vacío en la última
+type ChatMessagePage struct {
+	Items      []ChatMessage `json:"items"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
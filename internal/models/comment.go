@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Estados de un comentario, solo los visibles aparecen en el video
+const (
+	CommentStatusVisible  = "visible"
+	CommentStatusHeld     = "held"
+	CommentStatusRejected = "rejected"
+)
+
+// Órdenes de los comentarios
+const (
+	CommentSortNewest = "newest"
+	CommentSortTop    = "top"
+)
+
+// Comment es un comentario de un video. Las respuestas tienen ParentID y solo hay un nivel.
+type Comment struct {
+	Id         string         `json:"id" gorm:"primaryKey;not null"`
+	VideoID    string         `json:"video_id" gorm:"not null;index"`
+	UserID     string         `json:"user_id" gorm:"not null;index"`
+	ParentID   *string        `json:"parent_id,omitempty" gorm:"index"`
+	Body       string         `json:"body" gorm:"type:text;not null"`
+	Status     string         `json:"status" gorm:"type:varchar(20);not null;index"`
+	Pinned     bool           `json:"pinned"`
+	ReplyCount int            `json:"reply_count" gorm:"not null;default:0"`
+	EditedAt   *time.Time     `json:"edited_at,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index" swaggerignore:"true"`
+}
+
+// CommentRequest es lo que recibe POST /streaming/id/:videoid/comments
+type CommentRequest struct {
+	Body     string `json:"body" binding:"required,max=2000"`
+	ParentID string `json:"parent_id"`
+}
+
+// CommentUpdateRequest es lo que recibe PATCH /streaming/comments/:commentid
+type CommentUpdateRequest struct {
+	Body string `json:"body" binding:"required,max=2000"`
+}
+
+// CommentPage es una página de comentarios. El comentario fijado solo viene
+// en la primera página de los comentarios principales.
+type CommentPage struct {
+	Pinned     *Comment  `json:"pinned,omitempty"`
+	Items      []Comment `json:"items"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,23 @@
+package models
+
+// EncodingProfile es un perfil de codificación para los videos subidos, se definen en la
+// configuración (ENCODING_PROFILES). Con VideoCodec "copy" no se recodifica y los campos
+// de video se ignoran.
+type EncodingProfile struct {
+	Name       string `json:"name"`
+	VideoCodec string `json:"video_codec"`
+	// calidad constante, se usa si no hay VideoBitrate
+	CRF          int    `json:"crf,omitempty"`
+	VideoBitrate string `json:"video_bitrate,omitempty"`
+	Preset       string `json:"preset,omitempty"`
+	// frames entre keyframes, 0 = lo que decida el encoder
+	GOP int `json:"gop,omitempty"`
+	// alto del video, 0 = el del original
+	Height         int    `json:"height,omitempty"`
+	SegmentSeconds int    `json:"segment_seconds"`
+	AudioCodec     string `json:"audio_codec"`
+	AudioBitrate   string `json:"audio_bitrate,omitempty"`
+	AudioChannels  int    `json:"audio_channels,omitempty"`
+	// roles que pueden usarlo, vacío = todos
+	Roles []string `json:"roles,omitempty"`
+}
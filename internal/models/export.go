@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Estados de una exportación de datos personales
+const (
+	ExportStatusPending    = "pending"
+	ExportStatusProcessing = "processing"
+	ExportStatusReady      = "ready"
+	ExportStatusFailed     = "failed"
+	ExportStatusExpired    = "expired"
+)
+
+// ExportRequest es lo que recibe POST /users/me/export
+type ExportRequest struct {
+	// agrega el archivo original de cada video subido, tal cual lo subió el usuario
+	IncludeUploads bool `json:"include_uploads"`
+}
+
+// DataExport es un trabajo que arma un ZIP con todos los datos de un usuario
+type DataExport struct {
+	Id             string     `json:"id" gorm:"primaryKey;not null"`
+	UserID         string     `json:"user_id" gorm:"not null;index"`
+	IncludeUploads bool       `json:"include_uploads"`
+	Status         string     `json:"status" gorm:"type:varchar(20);not null;index"`
+	ObjectKey      string     `json:"-"`
+	SizeBytes      int64      `json:"size_bytes"`
+	Error          string     `json:"error,omitempty"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	// link temporal de descarga, se genera al consultar la exportación
+	DownloadURL string `json:"download_url,omitempty" gorm:"-"`
+}
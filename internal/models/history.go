@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// WatchProgress es hasta dónde vio un usuario cada video, se actualiza con los heartbeats
+// del reproductor y es también su historial de reproducción
+type WatchProgress struct {
+	UserID    string    `json:"-" gorm:"primaryKey;type:varchar(100)"`
+	VideoID   string    `json:"video_id" gorm:"primaryKey;type:varchar(100)"`
+	Position  float64   `json:"position"`
+	Duration  float64   `json:"duration"`
+	Completed bool      `json:"completed"`
+	UpdatedAt time.Time `json:"watched_at" gorm:"index"`
+}
+
+func (WatchProgress) TableName() string {
+	return "watch_progress"
+}
+
+// HistoryItem es un video del historial con el punto donde se quedó el usuario
+type HistoryItem struct {
+	Video     VideoModel `json:"video"`
+	Position  float64    `json:"position"`
+	Duration  float64    `json:"duration"`
+	Completed bool       `json:"completed"`
+	WatchedAt time.Time  `json:"watched_at"`
+}
+
+// HistoryPage es una página del historial, NextCursor va vacío en la última
+type HistoryPage struct {
+	Items      []HistoryItem `json:"items"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// UserIdentity enlaza un usuario con su cuenta en un proveedor externo (OpenID Connect)
+type UserIdentity struct {
+	Id        string `json:"id" gorm:"primaryKey;not null"`
+	UserID    string `json:"user_id" gorm:"not null;index"`
+	Provider  string `json:"provider" gorm:"type:varchar(50);not null;uniqueIndex:idx_identity_provider_subject"`
+	Subject   string `json:"subject" gorm:"not null;uniqueIndex:idx_identity_provider_subject"`
+	Email     string `json:"email" gorm:"type:varchar(100)"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// OIDCLoginState guarda lo necesario para terminar un login iniciado con un proveedor,
+// se borra al usarse en el callback
+type OIDCLoginState struct {
+	State        string `gorm:"primaryKey;not null"`
+	Provider     string `gorm:"type:varchar(50);not null"`
+	Nonce        string `gorm:"not null"`
+	CodeVerifier string `gorm:"not null"`
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+}
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// Estados de un video: los subidos están en processing mientras se convierten y quedan
+// ready, failed o cancelled, las transmisiones en vivo pasan de live a ended cuando el encoder
+// deja de publicar
+const (
+	VideoStateProcessing = "processing"
+	VideoStateReady      = "ready"
+	VideoStateFailed     = "failed"
+	VideoStateCancelled  = "cancelled"
+	VideoStateLive       = "live"
+	VideoStateEnded      = "ended"
+)
+
+// StreamKey es una clave con la que un usuario publica por RTMP, solo se guarda su hash.
+// Cada clave tiene su configuración: si se graba, el bitrate máximo, el título de la transmisión
+// y si sale en baja latencia.
+type StreamKey struct {
+	Id      string `json:"id" gorm:"primaryKey;not null"`
+	UserID  string `json:"-" gorm:"not null;index"`
+	KeyHash string `json:"-" gorm:"not null;uniqueIndex"`
+	Name    string `json:"name" gorm:"type:varchar(50);not null;default:default"`
+	// primeros caracteres de la clave, para reconocerla sin mostrarla
+	Prefix         string `json:"prefix" gorm:"type:varchar(20)"`
+	Record         bool   `json:"record" gorm:"not null;default:true"`
+	MaxBitrateKbps int    `json:"max_bitrate_kbps" gorm:"not null;default:0"`
+	// título de las transmisiones, acepta {username}, {display_name} y {date}
+	TitleTemplate string `json:"title_template" gorm:"type:varchar(100)"`
+	// LL-HLS con segmentos parciales, baja el retraso a pocos segundos pero recodifica el video
+	LowLatency bool       `json:"low_latency" gorm:"not null;default:false"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// StreamKeyRequest es lo que reciben los endpoints para crear o cambiar una clave, al crear
+// los campos que no vienen usan los valores por defecto
+type StreamKeyRequest struct {
+	Name           *string `json:"name" binding:"omitempty,min=1,max=50"`
+	Record         *bool   `json:"record"`
+	MaxBitrateKbps *int    `json:"max_bitrate_kbps" binding:"omitempty,min=0,max=100000"`
+	TitleTemplate  *string `json:"title_template" binding:"omitempty,max=100"`
+	LowLatency     *bool   `json:"low_latency"`
+}
+
+// StreamKeyResponse es la clave recién creada o rotada, es la única vez que se muestra en claro
+type StreamKeyResponse struct {
+	StreamKey
+	Key       string `json:"stream_key"`
+	IngestURL string `json:"ingest_url"`
+}
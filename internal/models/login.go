@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Tipos de llave usados para limitar los intentos de login
+const (
+	LoginThrottleAccount = "account"
+	LoginThrottleIP      = "ip"
+)
+
+// LoginThrottle guarda los intentos fallidos recientes de una cuenta o de una IP,
+// y hasta cuándo se debe esperar antes de aceptar otro intento.
+type LoginThrottle struct {
+	Kind          string    `gorm:"primaryKey;type:varchar(20)"`
+	Key           string    `gorm:"primaryKey;type:varchar(255)"`
+	FailedCount   int       `gorm:"not null;default:0"`
+	LastFailedAt  time.Time
+	NextAttemptAt time.Time
+	LockedUntil   time.Time
+}
+
+// LoginAudit es el registro de auditoría de cada intento de login fallido
+type LoginAudit struct {
+	Id        string `gorm:"primaryKey;not null"`
+	Username  string `gorm:"type:varchar(100);index"`
+	UserID    string `gorm:"index"`
+	IP        string `gorm:"type:varchar(64);index"`
+	Reason    string `gorm:"type:varchar(50)"`
+	CreatedAt time.Time
+}
@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// VideoMetadata es lo que leyó ffprobe del archivo subido. Los datos del primer stream de video
+// y del primero de audio van en columnas para poder filtrar, Streams tiene todos los streams
+type VideoMetadata struct {
+	VideoID string `json:"-" gorm:"primaryKey;not null"`
+	// formato del contenedor como lo nombra ffprobe, ejm: mov,mp4,m4a,3gp,3g2,mj2
+	Container       string  `json:"container" gorm:"type:varchar(100)"`
+	DurationSeconds float64 `json:"duration_seconds" gorm:"not null;default:0"`
+	SizeBytes       int64   `json:"size_bytes"`
+	// bitrate total del archivo en bits por segundo
+	Bitrate int64 `json:"bitrate"`
+
+	Width        int     `json:"width" gorm:"index"`
+	Height       int     `json:"height" gorm:"index"`
+	FrameRate    float64 `json:"frame_rate"`
+	VideoCodec   string  `json:"video_codec" gorm:"type:varchar(30);index"`
+	VideoProfile string  `json:"video_profile,omitempty" gorm:"type:varchar(50)"`
+	VideoBitrate int64   `json:"video_bitrate"`
+	PixelFormat  string  `json:"pixel_format,omitempty" gorm:"type:varchar(30)"`
+	// grados en sentido horario con los que hay que girar el video para mostrarlo: 0, 90, 180 o 270
+	Rotation       int    `json:"rotation"`
+	ColorTransfer  string `json:"color_transfer,omitempty" gorm:"type:varchar(30)"`
+	ColorPrimaries string `json:"color_primaries,omitempty" gorm:"type:varchar(30)"`
+	ColorSpace     string `json:"color_space,omitempty" gorm:"type:varchar(30)"`
+	// HDR10 o HLG según la curva de transferencia, o Dolby Vision
+	HDR         bool `json:"hdr" gorm:"not null;default:false;index"`
+	DolbyVision bool `json:"dolby_vision" gorm:"not null;default:false"`
+
+	AudioCodec      string `json:"audio_codec,omitempty" gorm:"type:varchar(30)"`
+	AudioBitrate    int64  `json:"audio_bitrate"`
+	AudioChannels   int    `json:"audio_channels"`
+	AudioSampleRate int    `json:"audio_sample_rate"`
+
+	Streams   []MediaStream `json:"streams" gorm:"serializer:json"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// MediaStream es un stream del archivo: video, audio, subtítulos o datos
+type MediaStream struct {
+	Index          int     `json:"index"`
+	Type           string  `json:"type"`
+	Codec          string  `json:"codec"`
+	Profile        string  `json:"profile,omitempty"`
+	Bitrate        int64   `json:"bitrate,omitempty"`
+	Language       string  `json:"language,omitempty"`
+	Width          int     `json:"width,omitempty"`
+	Height         int     `json:"height,omitempty"`
+	FrameRate      float64 `json:"frame_rate,omitempty"`
+	PixelFormat    string  `json:"pixel_format,omitempty"`
+	Rotation       int     `json:"rotation,omitempty"`
+	ColorTransfer  string  `json:"color_transfer,omitempty"`
+	ColorPrimaries string  `json:"color_primaries,omitempty"`
+	ColorSpace     string  `json:"color_space,omitempty"`
+	DolbyVision    bool    `json:"dolby_vision,omitempty"`
+	Channels       int     `json:"channels,omitempty"`
+	ChannelLayout  string  `json:"channel_layout,omitempty"`
+	SampleRate     int     `json:"sample_rate,omitempty"`
+}
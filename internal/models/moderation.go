@@ -0,0 +1,125 @@
+package models
+
+import "time"
+
+// Roles de los usuarios
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Tipos de contenido que se pueden reportar
+const (
+	ReportTargetVideo   = "video"
+	ReportTargetComment = "comment"
+)
+
+// Estados de un reporte
+const (
+	ReportStatusOpen      = "open"
+	ReportStatusDismissed = "dismissed"
+	ReportStatusActioned  = "actioned"
+)
+
+// Acciones que puede tomar un moderador sobre un reporte
+const (
+	ModerationHide    = "hide"
+	ModerationStrike  = "strike"
+	ModerationSuspend = "suspend"
+)
+
+// Acciones que quedan en el registro de moderación
+const (
+	AuditDismissReport  = "dismiss_report"
+	AuditHideVideo      = "hide_video"
+	AuditHideComment    = "hide_comment"
+	AuditStrike         = "strike"
+	AuditSuspend        = "suspend"
+	AuditLiftSuspension = "lift_suspension"
+	AuditRestoreVideo   = "restore_video"
+	AuditSetRole        = "set_role"
+)
+
+// Report es un reporte de un usuario sobre un video o un comentario. Cuando un moderador
+// decide, la decisión se aplica a todos los reportes abiertos del mismo contenido.
+type Report struct {
+	Id            string     `json:"id" gorm:"primaryKey;not null"`
+	ReporterID    string     `json:"reporter_id" gorm:"not null;uniqueIndex:idx_reports_reporter_target,priority:1"`
+	TargetType    string     `json:"target_type" gorm:"type:varchar(20);not null;uniqueIndex:idx_reports_reporter_target,priority:2;index:idx_reports_target,priority:1"`
+	TargetID      string     `json:"target_id" gorm:"not null;uniqueIndex:idx_reports_reporter_target,priority:3;index:idx_reports_target,priority:2"`
+	TargetOwnerID string     `json:"target_owner_id" gorm:"not null;index"`
+	Reason        string     `json:"reason" gorm:"type:varchar(30);not null"`
+	Details       string     `json:"details,omitempty" gorm:"type:varchar(1000)"`
+	Status        string     `json:"status" gorm:"type:varchar(20);not null;index"`
+	ReviewedBy    string     `json:"reviewed_by,omitempty"`
+	ReviewedAt    *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// ReportRequest es lo que recibe el endpoint para reportar un video o un comentario
+type ReportRequest struct {
+	Reason  string `json:"reason" binding:"required,oneof=spam harassment hate violence sexual copyright misinformation other"`
+	Details string `json:"details" binding:"max=1000"`
+}
+
+// ReportPage es una página de la cola de moderación, NextCursor va vacío en la última
+type ReportPage struct {
+	Items      []Report `json:"items"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// ReportDecision es lo que recibe el moderador al tomar acción sobre un reporte.
+// hide oculta el contenido, strike suma una falta al dueño y suspend suspende su cuenta.
+type ReportDecision struct {
+	Actions     []string `json:"actions" binding:"required,min=1,dive,oneof=hide strike suspend"`
+	Note        string   `json:"note" binding:"max=1000"`
+	SuspendDays int      `json:"suspend_days" binding:"omitempty,min=1,max=3650"`
+}
+
+// ModerationNote es lo que reciben las decisiones que solo llevan una nota
+type ModerationNote struct {
+	Note string `json:"note" binding:"max=1000"`
+}
+
+// RoleRequest es lo que recibe el endpoint para cambiar el rol de un usuario
+type RoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=user moderator admin"`
+}
+
+// Strike es una falta de un usuario, al juntar varias dentro de la ventana se suspende la cuenta
+type Strike struct {
+	Id        string    `json:"id" gorm:"primaryKey;not null"`
+	UserID    string    `json:"-" gorm:"not null;index"`
+	ReportID  string    `json:"report_id"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ModerationAction es una entrada del registro de moderación, no se modifica ni se borra
+type ModerationAction struct {
+	Id          string            `json:"id" gorm:"primaryKey;not null"`
+	ModeratorID string            `json:"moderator_id" gorm:"not null;index"`
+	Action      string            `json:"action" gorm:"type:varchar(30);not null"`
+	ReportID    string            `json:"report_id,omitempty" gorm:"index"`
+	TargetType  string            `json:"target_type,omitempty"`
+	TargetID    string            `json:"target_id,omitempty" gorm:"index"`
+	UserID      string            `json:"user_id,omitempty" gorm:"index"`
+	Note        string            `json:"note,omitempty" gorm:"type:varchar(1000)"`
+	Details     map[string]string `json:"details,omitempty" gorm:"serializer:json"`
+	CreatedAt   time.Time         `json:"created_at" gorm:"index"`
+}
+
+// ModerationActionPage es una página del registro de moderación
+type ModerationActionPage struct {
+	Items      []ModerationAction `json:"items"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+// ModerationStatus es el estado de moderación de una cuenta
+type ModerationStatus struct {
+	UserID         string     `json:"user_id"`
+	Role           string     `json:"role"`
+	ActiveStrikes  int64      `json:"active_strikes"`
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+}
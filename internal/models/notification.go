@@ -0,0 +1,104 @@
+package models
+
+import "time"
+
+// Tipos de notificación
+const (
+	NotificationNewVideo     = "new_video"
+	NotificationCommentReply = "comment_reply"
+	NotificationVideoReady   = "video_ready"
+	NotificationExportReady  = "export_ready"
+)
+
+// NotificationTypes son los tipos que se pueden configurar en las preferencias
+var NotificationTypes = []string{
+	NotificationNewVideo,
+	NotificationCommentReply,
+	NotificationVideoReady,
+	NotificationExportReady,
+}
+
+// Canales por los que se entrega una notificación
+const (
+	NotificationChannelInApp   = "in_app"
+	NotificationChannelEmail   = "email"
+	NotificationChannelWebhook = "webhook"
+)
+
+// Estados de los eventos y de las entregas
+const (
+	NotificationStatusPending = "pending"
+	NotificationStatusDone    = "done"
+	NotificationStatusFailed  = "failed"
+)
+
+// NotificationEvent es algo que pasó y que se debe notificar. Los workers lo reparten
+// a RecipientID, o a todos los suscriptores de ChannelID.
+type NotificationEvent struct {
+	Id          string `gorm:"primaryKey;not null"`
+	Type        string `gorm:"type:varchar(50);not null"`
+	ActorID     string `gorm:"index"`
+	RecipientID string `gorm:"index"`
+	ChannelID   string `gorm:"index"`
+	Title       string `gorm:"not null"`
+	Body        string `gorm:"type:text"`
+	Link        string
+	Data        map[string]string `gorm:"serializer:json"`
+	Status      string            `gorm:"type:varchar(20);not null;index"`
+	// último suscriptor al que ya se repartió, para seguir por lotes
+	FanOutCursor string
+	CreatedAt    time.Time
+}
+
+// Notification es una notificación de un usuario. InApp indica si aparece en su bandeja.
+type Notification struct {
+	Id        string            `json:"id" gorm:"primaryKey;not null"`
+	UserID    string            `json:"-" gorm:"not null;index:idx_notifications_user_created,priority:1"`
+	EventID   string            `json:"-" gorm:"index"`
+	Type      string            `json:"type" gorm:"type:varchar(50);not null"`
+	Title     string            `json:"title" gorm:"not null"`
+	Body      string            `json:"body" gorm:"type:text"`
+	Link      string            `json:"link,omitempty"`
+	Data      map[string]string `json:"data,omitempty" gorm:"serializer:json"`
+	InApp     bool              `json:"-" gorm:"not null;default:true"`
+	ReadAt    *time.Time        `json:"read_at,omitempty"`
+	CreatedAt time.Time         `json:"created_at" gorm:"index:idx_notifications_user_created,priority:2"`
+}
+
+// NotificationDelivery es el envío de una notificación por un canal externo (email, webhook),
+// se reintenta con espera creciente hasta el máximo de intentos
+type NotificationDelivery struct {
+	Id             string `gorm:"primaryKey;not null"`
+	NotificationID string `gorm:"not null;index"`
+	UserID         string `gorm:"not null;index"`
+	Channel        string `gorm:"type:varchar(20);not null"`
+	Status         string `gorm:"type:varchar(20);not null;index"`
+	Attempts       int    `gorm:"not null;default:0"`
+	NextAttemptAt  time.Time
+	LastError      string
+	CreatedAt      time.Time
+}
+
+// NotificationSettings son las preferencias de un usuario: por cada tipo, los canales
+// por los que quiere recibirla. Los tipos que no están usan los canales por defecto.
+type NotificationSettings struct {
+	UserID     string `json:"-" gorm:"primaryKey;type:varchar(100)"`
+	WebhookURL string `json:"webhook_url"`
+	// se usa para firmar los webhooks, solo se muestra al configurarlo
+	WebhookSecret string              `json:"webhook_secret,omitempty"`
+	Channels      map[string][]string `json:"channels" gorm:"serializer:json"`
+	UpdatedAt     time.Time           `json:"updated_at"`
+}
+
+// NotificationSettingsUpdate es lo que recibe PUT /notifications/preferences
+type NotificationSettingsUpdate struct {
+	WebhookURL *string             `json:"webhook_url" binding:"omitempty,max=500"`
+	Channels   map[string][]string `json:"channels"`
+}
+
+// NotificationPage es una página de la bandeja, NextCursor va vacío en la última
+type NotificationPage struct {
+	Items       []Notification `json:"items"`
+	UnreadCount int64          `json:"unread_count"`
+	NextCursor  string         `json:"next_cursor,omitempty"`
+}
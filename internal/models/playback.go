@@ -0,0 +1,74 @@
+package models
+
+import "time"
+
+// PlaybackStartRequest es lo que recibe POST /playback/sessions
+type PlaybackStartRequest struct {
+	VideoID string `json:"video_id" binding:"required"`
+}
+
+// BufferingEvent es una interrupción de la reproducción para cargar el video
+type BufferingEvent struct {
+	DurationMs int64 `json:"duration_ms" binding:"min=0"`
+}
+
+// HeartbeatRequest es lo que envía el reproductor periódicamente mientras reproduce
+type HeartbeatRequest struct {
+	Position        float64          `json:"position" binding:"min=0"`
+	Duration        float64          `json:"duration" binding:"min=0"`
+	Bitrate         int              `json:"bitrate" binding:"min=0"`
+	Playing         bool             `json:"playing"`
+	Ended           bool             `json:"ended"`
+	BufferingEvents []BufferingEvent `json:"buffering_events" binding:"dive"`
+}
+
+// PlaybackHeartbeat guarda cada heartbeat hasta que la sesión se suma a las estadísticas
+type PlaybackHeartbeat struct {
+	Id             uint   `gorm:"primaryKey;autoIncrement"`
+	SessionID      string `gorm:"not null;index"`
+	VideoID        string `gorm:"not null"`
+	Position       float64
+	Bitrate        int
+	Playing        bool
+	BufferingCount int
+	BufferingMs    int64
+	CreatedAt      time.Time `gorm:"index"`
+}
+
+// VideoWatchStats son los totales de reproducción de un video, ya agregados
+type VideoWatchStats struct {
+	VideoID           string    `json:"video_id" gorm:"primaryKey;not null"`
+	Sessions          int64     `json:"sessions"`
+	TotalWatchSeconds float64   `json:"total_watch_seconds"`
+	BufferingCount    int64     `json:"buffering_count"`
+	BufferingMs       int64     `json:"buffering_ms"`
+	BitrateSum        int64     `json:"-"`
+	BitrateSamples    int64     `json:"-"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// VideoRetentionBucket cuenta cuántas sesiones vieron cada tramo del video
+type VideoRetentionBucket struct {
+	VideoID  string `gorm:"primaryKey;not null"`
+	Position int    `gorm:"primaryKey;not null"` // inicio del tramo en segundos
+	Viewers  int64
+}
+
+// RetentionPoint es un punto de la curva de retención
+type RetentionPoint struct {
+	Position int     `json:"position"`
+	Viewers  int64   `json:"viewers"`
+	Ratio    float64 `json:"ratio"`
+}
+
+// VideoWatchAnalytics es la respuesta de las estadísticas de reproducción de un video
+type VideoWatchAnalytics struct {
+	VideoID             string           `json:"video_id"`
+	Sessions            int64            `json:"sessions"`
+	TotalWatchSeconds   float64          `json:"total_watch_seconds"`
+	AverageViewDuration float64          `json:"average_view_duration"`
+	AverageBitrate      float64          `json:"average_bitrate"`
+	BufferingCount      int64            `json:"buffering_count"`
+	BufferingMs         int64            `json:"buffering_ms"`
+	Retention           []RetentionPoint `json:"retention"`
+}
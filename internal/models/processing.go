@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Etapas del procesamiento de un video subido, en orden
+const (
+	ProcessingStageTranscoding = "transcoding"
+	ProcessingStageThumbnail   = "thumbnail"
+	ProcessingStageUploading   = "uploading"
+)
+
+// ProcessingJob es el avance del procesamiento de un video subido. Status toma los mismos
+// valores que el estado del video: processing mientras se procesa, y ready, failed o cancelled
+// al terminar.
+type ProcessingJob struct {
+	VideoID string `json:"video_id" gorm:"primaryKey;not null"`
+	UserID  string `json:"-" gorm:"not null;index"`
+	Status  string `json:"status" gorm:"type:varchar(20);not null;index"`
+	Stage   string `json:"stage" gorm:"type:varchar(20)"`
+	// porcentaje del video que ya convirtió ffmpeg, según la duración que leyó ffprobe
+	Percent float64 `json:"percent" gorm:"not null;default:0"`
+	// segundos que faltan para terminar la conversión, nil hasta que ffmpeg reporta avance
+	EtaSeconds  *float64   `json:"eta_seconds,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// Finished indica si el trabajo ya no va a cambiar
+func (job ProcessingJob) Finished() bool {
+	return job.Status != VideoStateProcessing
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Tipos de reacción a un video
+const (
+	ReactionLike    = "like"
+	ReactionDislike = "dislike"
+)
+
+// VideoReaction es el like o dislike de un usuario a un video, solo puede haber uno por usuario
+type VideoReaction struct {
+	UserID    string    `json:"-" gorm:"primaryKey;type:varchar(100)"`
+	VideoID   string    `json:"video_id" gorm:"primaryKey;type:varchar(100);index"`
+	Kind      string    `json:"reaction" gorm:"type:varchar(10);not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"index"`
+}
+
+// ReactionRequest es lo que recibe PUT /streaming/id/:videoid/reaction
+type ReactionRequest struct {
+	Reaction string `json:"reaction" binding:"required,oneof=like dislike"`
+}
+
+// ReactionResult son los contadores del video después de reaccionar
+type ReactionResult struct {
+	VideoID    string `json:"video_id"`
+	MyReaction string `json:"my_reaction,omitempty"`
+	Likes      uint   `json:"likes"`
+	Dislikes   uint   `json:"dislikes"`
+}
@@ -0,0 +1,18 @@
+package models
+
+// VideoTag es una etiqueta de un video, se guardan en minúsculas
+type VideoTag struct {
+	VideoID string `gorm:"primaryKey;type:varchar(100)"`
+	Tag     string `gorm:"primaryKey;type:varchar(30);index"`
+}
+
+// TagsRequest es lo que recibe PUT /streaming/id/{videoid}/tags, reemplaza todas las etiquetas
+type TagsRequest struct {
+	Tags []string `json:"tags" binding:"max=10,dive,max=30"`
+}
+
+// Órdenes de la página de inicio
+const (
+	HomeSortTrending = "trending"
+	HomeSortNewest   = "newest"
+)
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Subscription es un usuario que sigue el canal de otro
+type Subscription struct {
+	SubscriberID string    `json:"-" gorm:"primaryKey;type:varchar(100)"`
+	ChannelID    string    `json:"channel_id" gorm:"primaryKey;type:varchar(100);index"`
+	CreatedAt    time.Time `json:"created_at" gorm:"index"`
+}
+
+// SubscriptionResult es el estado de la suscripción después de suscribirse o desuscribirse
+type SubscriptionResult struct {
+	ChannelID       string `json:"channel_id"`
+	Subscribed      bool   `json:"subscribed"`
+	SubscriberCount int    `json:"subscriber_count"`
+}
+
+// ChannelPage es una página de los canales a los que sigue el usuario
+type ChannelPage struct {
+	Items      []ChannelSummary `json:"items"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+// ChannelSummary son los datos públicos de un canal en los listados
+type ChannelSummary struct {
+	Id              string            `json:"id"`
+	Username        string            `json:"username"`
+	DisplayName     string            `json:"display_name"`
+	Avatars         map[string]string `json:"avatars"`
+	SubscriberCount int               `json:"subscriber_count"`
+	SubscribedAt    time.Time         `json:"subscribed_at"`
+}
@@ -15,6 +15,16 @@ type UserCreate struct {
 	Email      string `json:"email"`
 }
 
+// UserUpdate es lo que recibe PATCH /users/me, solo se cambian los campos enviados.
+// Para cambiar la contraseña se debe confirmar la actual.
+type UserUpdate struct {
+	Email           *string `json:"email" binding:"omitempty,email,max=100"`
+	DisplayName     *string `json:"display_name" binding:"omitempty,max=100"`
+	Bio             *string `json:"bio" binding:"omitempty,max=500"`
+	NewPassword     *string `json:"new_password" binding:"omitempty,min=8,max=72"`
+	CurrentPassword string  `json:"current_password"`
+}
+
 type UserLogin struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
@@ -27,7 +37,12 @@ type UserSwagger struct {
 	Username     string    `json:"username" gorm:"type:varchar(100);not null;uniqueIndex"`
 	Password     string    `json:"password" gorm:"not null"`
 	Email        string    `json:"email" gorm:"type:varchar(100)"`
+	DisplayName  string    `json:"display_name" gorm:"type:varchar(100)"`
+	Bio          string    `json:"bio" gorm:"type:varchar(500)"`
+	Avatars      map[string]string `json:"avatars" gorm:"serializer:json"`
 	RefreshToken string    `json:"refresh_token"`
+	SubscriberCount int    `json:"subscriber_count"`
+	Role         string    `json:"role"`
 	Videos []VideoSwagger 	`json:"videos" gorm:"foreignKey:UserID"`
 }
 
@@ -37,9 +52,22 @@ type User struct {
 	Username     string    `json:"username" gorm:"type:varchar(100);not null;uniqueIndex"`
 	Password     string    `json:"password" gorm:"not null"`
 	Email        string    `json:"email" gorm:"type:varchar(100)"`
+	DisplayName  string    `json:"display_name" gorm:"type:varchar(100)"`
+	Bio          string    `json:"bio" gorm:"type:varchar(500)"`
+	// url de cada tamaño del avatar, ejm: {"64": "...", "128": "...", "256": "..."}
+	Avatars      map[string]string `json:"avatars" gorm:"serializer:json"`
+	// carpeta en s3 del avatar actual, para borrarla cuando se reemplaza
+	AvatarFolder string    `json:"-"`
 	RefreshToken string    `json:"refresh_token"`
+	SubscriberCount int    `json:"subscriber_count" gorm:"not null;default:0"`
+	// user, moderator o admin
+	Role         string    `json:"role" gorm:"type:varchar(20);not null;default:user"`
+	// mientras no pase esta fecha la cuenta no puede iniciar sesión ni usar la API
+	SuspendedUntil *time.Time `json:"-"`
 	Videos 		 []VideoModel 	`json:"videos" gorm:"foreignKey:UserID"`
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
 	DeletedAt    gorm.DeletedAt `gorm:"index"`
+	// cuando se borra la cuenta, fecha a partir de la cual se elimina definitivamente
+	PurgeAfter   *time.Time `json:"-" gorm:"index"`
 }
\ No newline at end of file
@@ -14,8 +14,18 @@ type Video struct {
 	LocalPath       string
 	UniqueName  	string
 	M3u8FileURL  	string
-	Duration   		string	
+	// duración en segundos que leyó ffprobe, también sirve para calcular el avance de la conversión
+	DurationSeconds	float64
+	// lo demás que leyó ffprobe, nil en las grabaciones de transmisiones
+	Metadata		*VideoMetadata
 	ThumbnailURL 	string
+	Tags			[]string
+	// transmisión en vivo de la que sale el video, vacío en los subidos
+	SourceVideoID	string
+	// perfil con el que se codificó, nil en las grabaciones de transmisiones
+	EncodingProfile	*EncodingProfile
+	// estado con el que se guarda, vacío es ready
+	State			string
 }
 
 
@@ -28,8 +38,11 @@ type VideoSwagger struct {
 	Description 	string    	`json:"description"`
 	UserID			string		`json:"user_id" gorm:"not null"`
 	Duration   		string	 	`json:"duration"`
+	DurationSeconds	float64		`json:"duration_seconds"`
 	ThumbnailURL 	string   	`json:"thumbnail"`
 	Views 			uint		`json:"views" gorm:"default:0"`
+	Likes 			uint		`json:"likes"`
+	Dislikes 		uint		`json:"dislikes"`
 
 }
 
@@ -40,15 +53,46 @@ type VideoModel struct {
 	Title			string			`json:"title" gorm:"type:varchar(100);not null"`
 	Description		string			`json:"description"`
 	UserID			string			`json:"user_id" gorm:"not null"`
-	Duration   		string	 		`json:"duration"`
+	// en segundos, los controladores agregan duration con la duración formateada para mostrar
+	DurationSeconds	float64			`json:"duration_seconds" gorm:"not null;default:0"`
 	ThumbnailURL 	string   		`json:"thumbnail"`
 	Views 			uint			`json:"views" gorm:"default:0"`
+	Likes 			uint			`json:"likes" gorm:"not null;default:0"`
+	Dislikes 		uint			`json:"dislikes" gorm:"not null;default:0"`
+	// puntaje de tendencia multiplicado por 1000 para guardarlo entero, lo recalcula un worker
+	TrendingScore	int64			`json:"-" gorm:"not null;default:0;index"`
+	// fecha en que un moderador lo ocultó, un video oculto no aparece en la API pública
+	HiddenAt		*time.Time		`json:"hidden_at,omitempty" gorm:"index"`
+	// processing, ready, failed o cancelled para los videos subidos, live o ended para las transmisiones en vivo
+	State			string			`json:"state" gorm:"type:varchar(10);not null;default:ready;index"`
+	// en las grabaciones de una transmisión, el id del video en vivo
+	SourceVideoID	string			`json:"source_video_id,omitempty" gorm:"index"`
+	// perfil de codificación y la configuración que tenía al subirlo, para poder repetirlo
+	EncodingProfile	string			`json:"encoding_profile,omitempty"`
+	EncodingSettings *EncodingProfile `json:"-" gorm:"serializer:json"`
 	CreatedAt 		time.Time
 	UpdatedAt		time.Time
-	DeletedAt 		gorm.DeletedAt 	`gorm:"index"`
+	DeletedAt 		gorm.DeletedAt 	`gorm:"index" swaggerignore:"true"`
 }
 
 // nombre de la tabla de videomodel
 func (VideoModel) TableName() string {
     return "videos"
 }
+
+// VideoResponse es el video con los datos del usuario que lo consulta,
+// ejm: hasta dónde lo vio
+type VideoResponse struct {
+	VideoModel
+	ResumePosition	*float64		`json:"resume_position,omitempty"`
+	MyReaction		string			`json:"my_reaction,omitempty"`
+	Tags			[]string		`json:"tags"`
+	// lo que leyó ffprobe del archivo subido
+	Metadata		*VideoMetadata	`json:"metadata,omitempty"`
+}
+
+// VideoPage es una página de videos, NextCursor va vacío en la última
+type VideoPage struct {
+	Items			[]VideoModel	`json:"items"`
+	NextCursor		string			`json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// PlaybackSession es una reproducción de un video por un espectador, identificado por su
+// usuario o por una huella anónima. Las vistas se cuentan por sesión y no por request.
+type PlaybackSession struct {
+	Id             string    `json:"id" gorm:"primaryKey;not null"`
+	VideoID        string    `json:"video_id" gorm:"not null;index"`
+	UserID         string    `json:"user_id,omitempty" gorm:"index"`
+	ViewerKey      string    `json:"-" gorm:"type:varchar(100);not null;index"`
+	IPHash         string    `json:"-" gorm:"type:varchar(64)"`
+	WatchedSeconds float64   `json:"watched_seconds"`
+	Counted        bool      `json:"counted"`
+	StartedAt      time.Time `json:"started_at"`
+	LastSeenAt     time.Time `json:"last_seen_at"`
+
+	// datos que llegan con los heartbeats del reproductor
+	LastPosition   float64    `json:"last_position"`
+	Playing        bool       `json:"playing"`
+	BufferingCount int        `json:"buffering_count"`
+	BufferingMs    int64      `json:"buffering_ms"`
+	EndedAt        *time.Time `json:"ended_at,omitempty"`
+	// ya se sumó a las estadísticas del video
+	Aggregated bool `json:"-" gorm:"index"`
+}
+
+// ViewEvent es una vista contada
+type ViewEvent struct {
+	Id        string    `json:"id" gorm:"primaryKey;not null"`
+	VideoID   string    `json:"video_id" gorm:"not null;index"`
+	SessionID string    `json:"session_id" gorm:"not null"`
+	UserID    string    `json:"user_id,omitempty" gorm:"index"`
+	ViewerKey string    `json:"-" gorm:"type:varchar(100);not null"`
+	IPHash    string    `json:"-" gorm:"type:varchar(64);index"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ViewerLastView es cuándo se contó la última vista de un espectador en un video. Una vista
+// nueva cuenta recién cuando pasó la ventana de dedup desde esa, no por ventanas fijas, así
+// una vista repetida justo en el cambio de ventana no cuenta dos veces
+type ViewerLastView struct {
+	VideoID   string    `gorm:"primaryKey;type:varchar(100)"`
+	ViewerKey string    `gorm:"primaryKey;type:varchar(100)"`
+	CountedAt time.Time `gorm:"not null"`
+}
+
+// ViewRequest es lo que envía el reproductor a PATCH /streaming/views/:videoid,
+// sin session_id se abre una sesión nueva
+type ViewRequest struct {
+	SessionID      string  `json:"session_id"`
+	WatchedSeconds float64 `json:"watched_seconds" binding:"min=0"`
+}
+
+// ViewResult indica si la sesión ya sumó una vista al video
+type ViewResult struct {
+	SessionID      string  `json:"session_id"`
+	WatchedSeconds float64 `json:"watched_seconds"`
+	Counted        bool    `json:"counted"`
+}
+
+// Viewer identifica a quien reproduce un video
+type Viewer struct {
+	UserID      string
+	Fingerprint string
+	IPHash      string
+}
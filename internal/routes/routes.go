@@ -4,17 +4,50 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/unbot2313/go-streaming-service/internal/controllers"
 	"github.com/unbot2313/go-streaming-service/internal/middlewares"
+	"github.com/unbot2313/go-streaming-service/internal/models"
 )
 
 // SetupRoutes configura todas las rutas
-func SetupRoutes(router *gin.RouterGroup, userController controllers.UserController, authController controllers.AuthController, videoController controllers.VideoController) {
+func SetupRoutes(router *gin.RouterGroup, appControllers controllers.Controllers) {
+	userController := appControllers.User
+	authController := appControllers.Auth
+	videoController := appControllers.Video
+	playbackController := appControllers.Playback
+	studioController := appControllers.Studio
+	historyController := appControllers.History
+	reactionController := appControllers.Reaction
+	commentController := appControllers.Comment
+	subscriptionController := appControllers.Subscription
+	notificationController := appControllers.Notification
+	recommendationController := appControllers.Recommendation
+	moderationController := appControllers.Moderation
+	liveController := appControllers.Live
+	chatController := appControllers.Chat
+
 	// Rutas de usuarios
 	userRoutes := router.Group("/users")
 	{
 		userRoutes.GET("/id/:id", userController.GetUserByID)
 		userRoutes.GET("/username/:username", userController.GetUserByUserName)
 		userRoutes.POST("/", userController.CreateUser)
-		userRoutes.DELETE("/:id", userController.DeleteUserByID)
+		userRoutes.DELETE("/:id", middlewares.AuthMiddleware, middlewares.RequireRole(models.RoleAdmin), userController.DeleteUserByID)
+		userRoutes.PUT("/id/:id/subscription", middlewares.AuthMiddleware, subscriptionController.Subscribe)
+		userRoutes.DELETE("/id/:id/subscription", middlewares.AuthMiddleware, subscriptionController.Unsubscribe)
+
+		// Rutas del usuario autenticado
+		meRoutes := userRoutes.Group("/me")
+		meRoutes.Use(middlewares.AuthMiddleware)
+		meRoutes.PATCH("", userController.UpdateMe)
+		meRoutes.DELETE("", userController.DeleteMe)
+		meRoutes.PUT("/avatar", userController.UpdateMyAvatar)
+		meRoutes.POST("/export", userController.RequestExport)
+		meRoutes.GET("/export/:exportid", userController.GetExport)
+		meRoutes.GET("/history", historyController.GetHistory)
+		meRoutes.DELETE("/history", historyController.ClearHistory)
+		meRoutes.DELETE("/history/:videoid", historyController.RemoveFromHistory)
+		meRoutes.GET("/continue-watching", historyController.GetContinueWatching)
+		meRoutes.GET("/liked-videos", reactionController.GetLikedVideos)
+		meRoutes.GET("/subscriptions", subscriptionController.GetMySubscriptions)
 	}
 
 	// Rutas de autenticación
@@ -22,6 +55,11 @@ func SetupRoutes(router *gin.RouterGroup, userController controllers.UserControl
 	{
 		authRoutes.POST("/login", authController.Login)
 		authRoutes.POST("/register", authController.Register)
+		authRoutes.POST("/restore", authController.RestoreAccount)
+
+		// Login con proveedores externos (OpenID Connect)
+		authRoutes.GET("/oidc/:provider/login", authController.OIDCLogin)
+		authRoutes.GET("/oidc/:provider/callback", authController.OIDCCallback)
 	}
 
     VideoRoutes := router.Group("/streaming")
@@ -31,11 +69,103 @@ func SetupRoutes(router *gin.RouterGroup, userController controllers.UserControl
 
 		// Rutas públicas
         VideoRoutes.GET("/latest", videoController.GetLatestVideos)
-		VideoRoutes.GET("/id/:videoid", videoController.GetVideoByID)
-		VideoRoutes.PATCH("/views/:videoid", videoController.IncrementViews)
+		VideoRoutes.GET("/home", videoController.GetHomeVideos)
+		VideoRoutes.GET("/id/:videoid", middlewares.OptionalAuthMiddleware, videoController.GetVideoByID)
+		VideoRoutes.PATCH("/views/:videoid", middlewares.OptionalAuthMiddleware, videoController.IncrementViews)
 
 		// Ruta protegida
         ProtectedRoute.POST("/upload", videoController.CreateVideo)
+		ProtectedRoute.GET("/profiles", videoController.GetEncodingProfiles)
+		ProtectedRoute.GET("/id/:videoid/progress", videoController.GetProcessingProgress)
+		ProtectedRoute.POST("/id/:videoid/cancel", videoController.CancelProcessing)
+		ProtectedRoute.PUT("/id/:videoid/reaction", reactionController.React)
+		ProtectedRoute.DELETE("/id/:videoid/reaction", reactionController.RemoveReaction)
+		ProtectedRoute.PUT("/id/:videoid/tags", videoController.UpdateTags)
+
+		// Recomendaciones
+		VideoRoutes.GET("/trending", recommendationController.GetTrending)
+		VideoRoutes.GET("/id/:videoid/related", recommendationController.GetRelated)
+
+		// Transmisiones en vivo
+		VideoRoutes.GET("/live", liveController.ListLive)
+		VideoRoutes.GET("/id/:videoid/live/:file", liveController.GetLowLatencyFile)
+		VideoRoutes.GET("/id/:videoid/chat/ws", middlewares.OptionalAuthMiddleware, chatController.Connect)
+		VideoRoutes.GET("/id/:videoid/chat", chatController.ListMessages)
+
+		// Comentarios
+		VideoRoutes.GET("/id/:videoid/comments", commentController.ListComments)
+		ProtectedRoute.POST("/id/:videoid/comments", commentController.CreateComment)
+		ProtectedRoute.GET("/id/:videoid/comments/held", commentController.ListHeldComments)
+		ProtectedRoute.PATCH("/comments/:commentid", commentController.UpdateComment)
+		ProtectedRoute.DELETE("/comments/:commentid", commentController.DeleteComment)
+		ProtectedRoute.PUT("/comments/:commentid/pin", commentController.PinComment)
+		ProtectedRoute.DELETE("/comments/:commentid/pin", commentController.UnpinComment)
+		ProtectedRoute.POST("/comments/:commentid/approve", commentController.ApproveComment)
+		ProtectedRoute.POST("/comments/:commentid/reject", commentController.RejectComment)
+
+		// Reportes
+		ProtectedRoute.POST("/id/:videoid/report", moderationController.ReportVideo)
+		ProtectedRoute.POST("/comments/:commentid/report", moderationController.ReportComment)
     }
+
+	// Feed personalizado
+	feedRoutes := router.Group("/feed")
+	feedRoutes.Use(middlewares.AuthMiddleware)
+	{
+		feedRoutes.GET("/subscriptions", subscriptionController.GetFeed)
+	}
+
+	// Rutas de las transmisiones en vivo
+	liveRoutes := router.Group("/live")
+	liveRoutes.Use(middlewares.AuthMiddleware)
+	{
+		liveRoutes.GET("/stream-keys", liveController.ListStreamKeys)
+		liveRoutes.POST("/stream-keys", liveController.CreateStreamKey)
+		liveRoutes.PATCH("/stream-keys/:keyid", liveController.UpdateStreamKey)
+		liveRoutes.POST("/stream-keys/:keyid/rotate", liveController.RotateStreamKey)
+		liveRoutes.DELETE("/stream-keys/:keyid", liveController.RevokeStreamKey)
+	}
+
+	// Rutas de moderación
+	moderationRoutes := router.Group("/moderation")
+	moderationRoutes.Use(middlewares.AuthMiddleware, middlewares.RequireRole(models.RoleModerator, models.RoleAdmin))
+	{
+		moderationRoutes.GET("/reports", moderationController.ListReports)
+		moderationRoutes.POST("/reports/:reportid/dismiss", moderationController.DismissReport)
+		moderationRoutes.POST("/reports/:reportid/action", moderationController.ActionReport)
+		moderationRoutes.POST("/videos/:videoid/restore", moderationController.RestoreVideo)
+		moderationRoutes.GET("/users/:id", moderationController.GetUserStatus)
+		moderationRoutes.DELETE("/users/:id/suspension", moderationController.LiftSuspension)
+		moderationRoutes.PUT("/users/:id/role", middlewares.RequireRole(models.RoleAdmin), moderationController.SetRole)
+		moderationRoutes.GET("/audit", moderationController.ListAuditLog)
+	}
+
+	// Rutas de notificaciones
+	notificationRoutes := router.Group("/notifications")
+	notificationRoutes.Use(middlewares.AuthMiddleware)
+	{
+		notificationRoutes.GET("", notificationController.GetNotifications)
+		notificationRoutes.GET("/unread-count", notificationController.GetUnreadCount)
+		notificationRoutes.POST("/read-all", notificationController.MarkAllRead)
+		notificationRoutes.POST("/:notificationid/read", notificationController.MarkRead)
+		notificationRoutes.GET("/preferences", notificationController.GetPreferences)
+		notificationRoutes.PUT("/preferences", notificationController.UpdatePreferences)
+	}
+
+	// Rutas del reproductor
+	playbackRoutes := router.Group("/playback")
+	{
+		playbackRoutes.POST("/sessions", middlewares.OptionalAuthMiddleware, playbackController.StartSession)
+		playbackRoutes.POST("/sessions/:sessionid/heartbeat", middlewares.OptionalAuthMiddleware, playbackController.Heartbeat)
+		playbackRoutes.GET("/videos/:videoid/analytics", middlewares.AuthMiddleware, playbackController.GetVideoAnalytics)
+	}
+
+	// Rutas de estadísticas para creadores
+	studioRoutes := router.Group("/studio")
+	studioRoutes.Use(middlewares.AuthMiddleware)
+	{
+		studioRoutes.GET("/analytics/videos/:videoid", studioController.GetVideoAnalytics)
+		studioRoutes.GET("/analytics/channel", studioController.GetChannelAnalytics)
+	}
 	
 }
@@ -0,0 +1,217 @@
+package rtmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// Marcadores de tipo de AMF0, solo los que usan los comandos de publicación
+const (
+	amfNumber      = 0x00
+	amfBoolean     = 0x01
+	amfString      = 0x02
+	amfObject      = 0x03
+	amfNull        = 0x05
+	amfUndefined   = 0x06
+	amfECMAArray   = 0x08
+	amfObjectEnd   = 0x09
+	amfStrictArray = 0x0a
+	amfDate        = 0x0b
+	amfLongString  = 0x0c
+)
+
+var errUnsupportedAMF = errors.New("unsupported amf0 type")
+
+// amfObj es un objeto AMF0, al codificarlo las claves van en orden alfabético
+type amfObj map[string]interface{}
+
+// decodeAMF lee todos los valores AMF0 de un mensaje de comando o de datos
+func decodeAMF(payload []byte) ([]interface{}, error) {
+	reader := bytes.NewReader(payload)
+	var values []interface{}
+
+	for reader.Len() > 0 {
+		value, err := readAMFValue(reader)
+		if err != nil {
+			return values, err
+		}
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+func readAMFValue(reader *bytes.Reader) (interface{}, error) {
+	marker, err := reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch marker {
+	case amfNumber:
+		var bits uint64
+		if err := binary.Read(reader, binary.BigEndian, &bits); err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(bits), nil
+	case amfBoolean:
+		value, err := reader.ReadByte()
+		return value != 0, err
+	case amfString:
+		return readAMFString(reader)
+	case amfLongString:
+		var length uint32
+		if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+			return nil, err
+		}
+		return readAMFBytes(reader, int(length))
+	case amfObject:
+		return readAMFProperties(reader)
+	case amfECMAArray:
+		// el conteo es solo una pista, el arreglo termina igual que un objeto
+		if _, err := reader.Seek(4, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+		return readAMFProperties(reader)
+	case amfStrictArray:
+		var count uint32
+		if err := binary.Read(reader, binary.BigEndian, &count); err != nil {
+			return nil, err
+		}
+		if int(count) > reader.Len() {
+			return nil, io.ErrUnexpectedEOF
+		}
+		values := make([]interface{}, 0, count)
+		for i := uint32(0); i < count; i++ {
+			value, err := readAMFValue(reader)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	case amfDate:
+		// milisegundos (float64) y zona horaria (int16, no se usa)
+		var millis uint64
+		if err := binary.Read(reader, binary.BigEndian, &millis); err != nil {
+			return nil, err
+		}
+		if _, err := reader.Seek(2, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(millis), nil
+	case amfNull, amfUndefined:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("%w: 0x%02x", errUnsupportedAMF, marker)
+	}
+}
+
+func readAMFString(reader *bytes.Reader) (string, error) {
+	var length uint16
+	if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+		return "", err
+	}
+	return readAMFBytes(reader, int(length))
+}
+
+func readAMFBytes(reader *bytes.Reader, length int) (string, error) {
+	if length > reader.Len() {
+		return "", io.ErrUnexpectedEOF
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func readAMFProperties(reader *bytes.Reader) (amfObj, error) {
+	object := amfObj{}
+
+	for {
+		key, err := readAMFString(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		if key == "" {
+			marker, err := reader.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if marker == amfObjectEnd {
+				return object, nil
+			}
+			if err := reader.UnreadByte(); err != nil {
+				return nil, err
+			}
+		}
+
+		value, err := readAMFValue(reader)
+		if err != nil {
+			return nil, err
+		}
+		object[key] = value
+	}
+}
+
+// encodeAMF codifica los valores de una respuesta, acepta float64, int, bool, string, amfObj y nil
+func encodeAMF(values ...interface{}) []byte {
+	var buf bytes.Buffer
+
+	for _, value := range values {
+		writeAMFValue(&buf, value)
+	}
+
+	return buf.Bytes()
+}
+
+func writeAMFValue(buf *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteByte(amfNull)
+	case float64:
+		buf.WriteByte(amfNumber)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case int:
+		writeAMFValue(buf, float64(v))
+	case bool:
+		buf.WriteByte(amfBoolean)
+		if v {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	case string:
+		buf.WriteByte(amfString)
+		writeAMFKey(buf, v)
+	case amfObj:
+		buf.WriteByte(amfObject)
+
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			writeAMFKey(buf, key)
+			writeAMFValue(buf, v[key])
+		}
+
+		buf.Write([]byte{0, 0, amfObjectEnd})
+	default:
+		buf.WriteByte(amfUndefined)
+	}
+}
+
+func writeAMFKey(buf *bytes.Buffer, key string) {
+	binary.Write(buf, binary.BigEndian, uint16(len(key)))
+	buf.WriteString(key)
+}
@@ -0,0 +1,302 @@
+package rtmp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// Tipos de mensaje de RTMP
+const (
+	msgSetChunkSize     = 1
+	msgAbort            = 2
+	msgAcknowledgement  = 3
+	msgUserControl      = 4
+	msgWindowAckSize    = 5
+	msgSetPeerBandwidth = 6
+	msgAudio            = 8
+	msgVideo            = 9
+	msgDataAMF0         = 18
+	msgCommandAMF0      = 20
+)
+
+const (
+	defaultChunkSize = 128
+	maxChunkSize     = 1 << 24
+	// un mensaje más grande que esto se considera un cliente roto o malicioso
+	maxMessageSize = 16 << 20
+	// límites por conexión de los mensajes a medio armar, para que un cliente que todavía
+	// no se autenticó no pueda reservar memoria abriendo muchos chunk streams
+	maxChunkStreams  = 64
+	maxBufferedBytes = 32 << 20
+	// de a cuánto se lee un chunk grande
+	readStep = 64 << 10
+)
+
+var (
+	errMessageTooLarge = errors.New("rtmp message too large")
+	errTooManyStreams  = errors.New("rtmp too many chunk streams")
+	errTooMuchBuffered = errors.New("rtmp too much data buffered")
+)
+
+// message es un mensaje de RTMP ya armado con todos sus chunks
+type message struct {
+	TypeID    uint8
+	StreamID  uint32
+	Timestamp uint32
+	Payload   []byte
+}
+
+// chunkStream guarda el estado de cada chunk stream id, los headers comprimidos
+// (fmt 1, 2 y 3) repiten los valores del chunk anterior del mismo id
+type chunkStream struct {
+	timestamp      uint32
+	timestampDelta uint32
+	extended       bool
+	length         uint32
+	typeID         uint8
+	streamID       uint32
+	payload        []byte
+}
+
+// chunkReader arma los mensajes que llegan partidos en chunks
+type chunkReader struct {
+	reader    *bufio.Reader
+	chunkSize uint32
+	streams   map[uint32]*chunkStream
+	// bytes de los mensajes que todavía no están completos, sumando todos los streams
+	buffered int
+	// bytes leídos, para los acknowledgement
+	bytesRead uint64
+}
+
+func newChunkReader(reader *bufio.Reader) *chunkReader {
+	return &chunkReader{
+		reader:    reader,
+		chunkSize: defaultChunkSize,
+		streams:   make(map[uint32]*chunkStream),
+	}
+}
+
+func (cr *chunkReader) readFull(buf []byte) error {
+	n, err := io.ReadFull(cr.reader, buf)
+	cr.bytesRead += uint64(n)
+	return err
+}
+
+func (cr *chunkReader) readByte() (byte, error) {
+	b, err := cr.reader.ReadByte()
+	if err == nil {
+		cr.bytesRead++
+	}
+	return b, err
+}
+
+// readMessage lee chunks hasta completar un mensaje
+func (cr *chunkReader) readMessage() (*message, error) {
+	for {
+		msg, err := cr.readChunk()
+		if err != nil || msg != nil {
+			return msg, err
+		}
+	}
+}
+
+// readChunk lee un chunk, devuelve el mensaje si con él quedó completo
+func (cr *chunkReader) readChunk() (*message, error) {
+	first, err := cr.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	format := first >> 6
+	csid := uint32(first & 0x3f)
+
+	switch csid {
+	case 0:
+		b, err := cr.readByte()
+		if err != nil {
+			return nil, err
+		}
+		csid = uint32(b) + 64
+	case 1:
+		var b [2]byte
+		if err := cr.readFull(b[:]); err != nil {
+			return nil, err
+		}
+		csid = uint32(b[1])*256 + uint32(b[0]) + 64
+	}
+
+	stream, ok := cr.streams[csid]
+	if !ok {
+		if format != 0 {
+			return nil, fmt.Errorf("rtmp: first chunk of stream %d is not type 0", csid)
+		}
+		if len(cr.streams) >= maxChunkStreams {
+			return nil, errTooManyStreams
+		}
+		stream = &chunkStream{}
+		cr.streams[csid] = stream
+	}
+
+	var header [11]byte
+	headerSize := [4]int{11, 7, 3, 0}[format]
+
+	if err := cr.readFull(header[:headerSize]); err != nil {
+		return nil, err
+	}
+
+	// los chunks tipo 0, 1 y 2 siempre empiezan un mensaje, uno tipo 3 también si el
+	// anterior ya estaba completo, y en ese caso repite el delta de tiempo
+	startsMessage := format < 3 || len(stream.payload) == 0
+
+	if format < 3 {
+		timestamp := uint32(header[0])<<16 | uint32(header[1])<<8 | uint32(header[2])
+		stream.extended = timestamp == 0xffffff
+
+		if format < 2 {
+			stream.length = uint32(header[3])<<16 | uint32(header[4])<<8 | uint32(header[5])
+			stream.typeID = header[6]
+		}
+		if format == 0 {
+			stream.streamID = binary.LittleEndian.Uint32(header[7:11])
+		}
+
+		if stream.extended {
+			var ext [4]byte
+			if err := cr.readFull(ext[:]); err != nil {
+				return nil, err
+			}
+			timestamp = binary.BigEndian.Uint32(ext[:])
+		}
+
+		if format == 0 {
+			stream.timestamp = timestamp
+			stream.timestampDelta = 0
+		} else {
+			stream.timestampDelta = timestamp
+			stream.timestamp += timestamp
+		}
+	} else {
+		if stream.extended {
+			var ext [4]byte
+			if err := cr.readFull(ext[:]); err != nil {
+				return nil, err
+			}
+		}
+		if startsMessage {
+			stream.timestamp += stream.timestampDelta
+		}
+	}
+
+	if stream.length > maxMessageSize {
+		return nil, errMessageTooLarge
+	}
+
+	if startsMessage {
+		cr.discard(stream)
+	}
+
+	remaining := stream.length - uint32(len(stream.payload))
+	size := int(min(remaining, cr.chunkSize))
+
+	if cr.buffered+size > maxBufferedBytes {
+		return nil, errTooMuchBuffered
+	}
+
+	// el payload crece con lo que va llegando, no con el largo que anuncian los headers
+	for read := 0; read < size; {
+		step := min(size-read, readStep)
+		start := len(stream.payload)
+		stream.payload = slices.Grow(stream.payload, step)[:start+step]
+
+		if err := cr.readFull(stream.payload[start:]); err != nil {
+			return nil, err
+		}
+		cr.buffered += step
+		read += step
+	}
+
+	if uint32(len(stream.payload)) < stream.length {
+		return nil, nil
+	}
+
+	msg := &message{
+		TypeID:    stream.typeID,
+		StreamID:  stream.streamID,
+		Timestamp: stream.timestamp,
+		Payload:   stream.payload,
+	}
+	cr.discard(stream)
+
+	return msg, nil
+}
+
+// discard suelta el mensaje a medio armar del stream
+func (cr *chunkReader) discard(stream *chunkStream) {
+	cr.buffered -= len(stream.payload)
+	stream.payload = nil
+}
+
+// chunkWriter parte los mensajes en chunks, siempre con header tipo 0 y luego tipo 3
+type chunkWriter struct {
+	writer    *bufio.Writer
+	chunkSize uint32
+}
+
+func (cw *chunkWriter) writeMessage(csid uint32, msg *message) error {
+	var header [12]byte
+	header[0] = byte(csid & 0x3f)
+
+	timestamp := msg.Timestamp
+	if timestamp >= 0xffffff {
+		timestamp = 0xffffff
+	}
+	header[1], header[2], header[3] = byte(timestamp>>16), byte(timestamp>>8), byte(timestamp)
+
+	length := len(msg.Payload)
+	header[4], header[5], header[6] = byte(length>>16), byte(length>>8), byte(length)
+	header[7] = msg.TypeID
+	binary.LittleEndian.PutUint32(header[8:], msg.StreamID)
+
+	if _, err := cw.writer.Write(header[:]); err != nil {
+		return err
+	}
+
+	var ext [4]byte
+	extended := timestamp == 0xffffff
+	binary.BigEndian.PutUint32(ext[:], msg.Timestamp)
+
+	if extended {
+		if _, err := cw.writer.Write(ext[:]); err != nil {
+			return err
+		}
+	}
+
+	payload := msg.Payload
+	for {
+		size := min(len(payload), int(cw.chunkSize))
+		if _, err := cw.writer.Write(payload[:size]); err != nil {
+			return err
+		}
+		payload = payload[size:]
+
+		if len(payload) == 0 {
+			break
+		}
+
+		if err := cw.writer.WriteByte(0xc0 | byte(csid&0x3f)); err != nil {
+			return err
+		}
+		if extended {
+			if _, err := cw.writer.Write(ext[:]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return cw.writer.Flush()
+}
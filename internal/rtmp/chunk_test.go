@@ -0,0 +1,92 @@
+package rtmp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// chunkType0 arma un chunk con header tipo 0 para un csid de un byte
+func chunkType0(csid byte, length int, typeID byte, payload []byte) []byte {
+	chunk := []byte{csid & 0x3f, 0, 0, 0, byte(length >> 16), byte(length >> 8), byte(length), typeID, 1, 0, 0, 0}
+	return append(chunk, payload...)
+}
+
+func newTestChunkReader(data []byte) *chunkReader {
+	return newChunkReader(bufio.NewReader(bytes.NewReader(data)))
+}
+
+func TestReadMessageJoinsChunks(t *testing.T) {
+	payload := bytes.Repeat([]byte{7}, 200)
+
+	data := chunkType0(4, len(payload), msgVideo, payload[:defaultChunkSize])
+	data = append(data, 0xc0|4)
+	data = append(data, payload[defaultChunkSize:]...)
+
+	reader := newTestChunkReader(data)
+
+	msg, err := reader.readMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.TypeID != msgVideo || !bytes.Equal(msg.Payload, payload) {
+		t.Fatalf("got type %d with %d bytes", msg.TypeID, len(msg.Payload))
+	}
+	if reader.buffered != 0 {
+		t.Errorf("buffered = %d after a complete message", reader.buffered)
+	}
+}
+
+func TestReadChunkDoesNotTrustAnnouncedLength(t *testing.T) {
+	reader := newTestChunkReader(chunkType0(4, 15<<20, msgVideo, make([]byte, defaultChunkSize)))
+
+	if _, err := reader.readChunk(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := cap(reader.streams[4].payload); got > 4*defaultChunkSize {
+		t.Errorf("payload capacity = %d after one chunk", got)
+	}
+}
+
+func TestReadChunkLimitsChunkStreams(t *testing.T) {
+	var data []byte
+	for csid := 0; csid <= maxChunkStreams; csid++ {
+		// csid de dos bytes (fmt 0, id 0) para no repetir ids
+		data = append(data, 0, byte(csid))
+		data = append(data, chunkType0(0, 1024, msgVideo, make([]byte, defaultChunkSize))[1:]...)
+	}
+
+	reader := newTestChunkReader(data)
+
+	var err error
+	for err == nil {
+		_, err = reader.readChunk()
+	}
+
+	if !errors.Is(err, errTooManyStreams) {
+		t.Fatalf("err = %v, want %v", err, errTooManyStreams)
+	}
+}
+
+func TestReadChunkLimitsBufferedBytes(t *testing.T) {
+	const chunkSize = 12 << 20
+
+	var data []byte
+	for csid := byte(4); csid < 7; csid++ {
+		data = append(data, chunkType0(csid, 15<<20, msgVideo, make([]byte, chunkSize))...)
+	}
+
+	reader := newTestChunkReader(data)
+	reader.chunkSize = chunkSize
+
+	var err error
+	for err == nil {
+		_, err = reader.readChunk()
+	}
+
+	if !errors.Is(err, errTooMuchBuffered) {
+		t.Fatalf("err = %v, want %v", err, errTooMuchBuffered)
+	}
+}
@@ -0,0 +1,74 @@
+package rtmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// flvWriter escribe los mensajes de audio, video y metadata como un archivo FLV,
+// que es lo que ffmpeg recibe por stdin
+type flvWriter struct {
+	writer        io.Writer
+	headerWritten bool
+}
+
+func newFLVWriter(writer io.Writer) *flvWriter {
+	return &flvWriter{writer: writer}
+}
+
+// writeHeader escribe la cabecera con audio y video, seguida del PreviousTagSize0
+func (fw *flvWriter) writeHeader() error {
+	fw.headerWritten = true
+	_, err := fw.writer.Write([]byte{'F', 'L', 'V', 0x01, 0x05, 0, 0, 0, 0x09, 0, 0, 0, 0})
+	return err
+}
+
+// writeMessage escribe un mensaje como tag FLV, el resto de los mensajes se ignoran
+func (fw *flvWriter) writeMessage(msg *message) error {
+	payload := msg.Payload
+
+	switch msg.TypeID {
+	case msgAudio, msgVideo:
+	case msgDataAMF0:
+		// el encoder manda la metadata como "@setDataFrame", "onMetaData", {...};
+		// en el archivo solo va la parte de onMetaData
+		payload = stripSetDataFrame(payload)
+	default:
+		return nil
+	}
+
+	if !fw.headerWritten {
+		if err := fw.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	var header [11]byte
+	size := len(payload)
+	header[0] = msg.TypeID
+	header[1], header[2], header[3] = byte(size>>16), byte(size>>8), byte(size)
+	header[4], header[5], header[6] = byte(msg.Timestamp>>16), byte(msg.Timestamp>>8), byte(msg.Timestamp)
+	header[7] = byte(msg.Timestamp >> 24)
+	// los tres bytes del stream id van siempre en cero
+
+	if _, err := fw.writer.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := fw.writer.Write(payload); err != nil {
+		return err
+	}
+
+	var previous [4]byte
+	binary.BigEndian.PutUint32(previous[:], uint32(len(header)+size))
+	_, err := fw.writer.Write(previous[:])
+	return err
+}
+
+func stripSetDataFrame(payload []byte) []byte {
+	prefix := encodeAMF("@setDataFrame")
+	if bytes.HasPrefix(payload, prefix) {
+		return payload[len(prefix):]
+	}
+	return payload
+}
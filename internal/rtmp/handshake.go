@@ -0,0 +1,58 @@
+package rtmp
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	rtmpVersion   = 3
+	handshakeSize = 1536
+)
+
+// handshake hace el handshake simple de RTMP (sin el digest de Flash Player), es el
+// que aceptan OBS, ffmpeg y la mayoría de los encoders
+func handshake(reader *bufio.Reader, writer *bufio.Writer) error {
+	version, err := reader.ReadByte()
+	if err != nil {
+		return err
+	}
+	if version != rtmpVersion {
+		return fmt.Errorf("rtmp: unsupported version %d", version)
+	}
+
+	c1 := make([]byte, handshakeSize)
+	if _, err := io.ReadFull(reader, c1); err != nil {
+		return err
+	}
+
+	// S1: tiempo, cuatro ceros y bytes aleatorios
+	s1 := make([]byte, handshakeSize)
+	binary.BigEndian.PutUint32(s1[0:4], uint32(time.Now().Unix()))
+	if _, err := rand.Read(s1[8:]); err != nil {
+		return err
+	}
+
+	if err := writer.WriteByte(rtmpVersion); err != nil {
+		return err
+	}
+	if _, err := writer.Write(s1); err != nil {
+		return err
+	}
+	// S2 es el eco de C1
+	if _, err := writer.Write(c1); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	// C2 debería ser el eco de S1, los encoders no siempre lo respetan así que no se valida
+	c2 := make([]byte, handshakeSize)
+	_, err = io.ReadFull(reader, c2)
+	return err
+}
@@ -0,0 +1,352 @@
+package rtmp
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// chunk stream ids que usa el servidor para responder
+	csidControl = 2
+	csidCommand = 3
+	csidStatus  = 5
+
+	// stream id que se le entrega al encoder en createStream
+	publishStreamID = 1
+
+	serverWindowAckSize = 2500000
+	serverChunkSize     = 4096
+
+	handshakeTimeout = 10 * time.Second
+	// tiempo que tiene el encoder desde que se conecta para empezar a publicar
+	publishTimeout = 30 * time.Second
+	// si el encoder no manda nada en este tiempo se corta la conexión
+	idleTimeout = 30 * time.Second
+)
+
+// Eventos de user control
+const (
+	eventStreamBegin  = 0
+	eventPingRequest  = 6
+	eventPingResponse = 7
+)
+
+// PublishHandler decide qué hacer con una publicación. Publish recibe la aplicación y la
+// clave del stream (sin query string) y devuelve dónde escribir el stream en formato FLV;
+// Close se llama una sola vez cuando el encoder deja de publicar o se corta la conexión.
+// Si devuelve un error el encoder recibe NetStream.Publish.BadName y se cierra la conexión.
+type PublishHandler interface {
+	Publish(app, streamKey string) (io.WriteCloser, error)
+}
+
+// Server es un servidor de ingesta RTMP, solo acepta publicaciones (no reproduce)
+type Server struct {
+	addr    string
+	handler PublishHandler
+}
+
+func NewServer(addr string, handler PublishHandler) *Server {
+	return &Server{addr: addr, handler: handler}
+}
+
+// ListenAndServe escucha en la dirección del servidor hasta que se cancele el contexto
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	log.Printf("RTMP ingest listening on %s", s.addr)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return err
+		}
+
+		go func() {
+			if err := s.serveConn(conn); err != nil && !errors.Is(err, io.EOF) {
+				log.Printf("rtmp: %s: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// session es el estado de una conexión
+type session struct {
+	conn   net.Conn
+	reader *chunkReader
+	writer *chunkWriter
+
+	handler PublishHandler
+	app     string
+
+	// ventana de acknowledgement que pidió el encoder
+	ackWindow uint32
+	lastAck   uint64
+
+	output io.WriteCloser
+	flv    *flvWriter
+
+	// hasta cuándo puede seguir conectado sin haber publicado
+	publishDeadline time.Time
+}
+
+func (s *Server) serveConn(conn net.Conn) error {
+	defer conn.Close()
+
+	bufReader := bufio.NewReaderSize(conn, 64*1024)
+	bufWriter := bufio.NewWriter(conn)
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err := handshake(bufReader, bufWriter); err != nil {
+		return fmt.Errorf("handshake: %w", err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	sess := &session{
+		conn:    conn,
+		reader:  newChunkReader(bufReader),
+		writer:  &chunkWriter{writer: bufWriter, chunkSize: defaultChunkSize},
+		handler: s.handler,
+
+		publishDeadline: time.Now().Add(publishTimeout),
+	}
+	defer sess.closeOutput()
+
+	return sess.run()
+}
+
+func (sess *session) run() error {
+	for {
+		deadline := time.Now().Add(idleTimeout)
+		if sess.output == nil && sess.publishDeadline.Before(deadline) {
+			deadline = sess.publishDeadline
+		}
+		sess.conn.SetReadDeadline(deadline)
+
+		msg, err := sess.reader.readMessage()
+		if err != nil {
+			return err
+		}
+
+		if err := sess.acknowledge(); err != nil {
+			return err
+		}
+
+		done, err := sess.handleMessage(msg)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// acknowledge avisa al encoder cuántos bytes se recibieron cada vez que se llena su ventana
+func (sess *session) acknowledge() error {
+	if sess.ackWindow == 0 || sess.reader.bytesRead-sess.lastAck < uint64(sess.ackWindow) {
+		return nil
+	}
+	sess.lastAck = sess.reader.bytesRead
+	return sess.writeControl(msgAcknowledgement, uint32Payload(uint32(sess.reader.bytesRead)))
+}
+
+// handleMessage procesa un mensaje, devuelve true cuando la sesión terminó
+func (sess *session) handleMessage(msg *message) (bool, error) {
+	switch msg.TypeID {
+	case msgSetChunkSize:
+		if len(msg.Payload) < 4 {
+			return false, errors.New("short set chunk size")
+		}
+		size := binary.BigEndian.Uint32(msg.Payload) & 0x7fffffff
+		if size == 0 || size > maxChunkSize {
+			return false, fmt.Errorf("invalid chunk size %d", size)
+		}
+		sess.reader.chunkSize = size
+	case msgAbort:
+		if len(msg.Payload) >= 4 {
+			if stream, ok := sess.reader.streams[binary.BigEndian.Uint32(msg.Payload)]; ok {
+				sess.reader.discard(stream)
+			}
+		}
+	case msgWindowAckSize:
+		if len(msg.Payload) >= 4 {
+			sess.ackWindow = binary.BigEndian.Uint32(msg.Payload)
+		}
+	case msgUserControl:
+		if len(msg.Payload) >= 6 && binary.BigEndian.Uint16(msg.Payload) == eventPingRequest {
+			response := make([]byte, 6)
+			binary.BigEndian.PutUint16(response, eventPingResponse)
+			copy(response[2:], msg.Payload[2:6])
+			return false, sess.writeControl(msgUserControl, response)
+		}
+	case msgCommandAMF0:
+		return sess.handleCommand(msg)
+	case msgAudio, msgVideo, msgDataAMF0:
+		if sess.flv == nil {
+			return false, nil
+		}
+		if err := sess.flv.writeMessage(msg); err != nil {
+			return true, fmt.Errorf("write stream: %w", err)
+		}
+	}
+
+	return false, nil
+}
+
+func (sess *session) handleCommand(msg *message) (bool, error) {
+	values, err := decodeAMF(msg.Payload)
+	if err != nil {
+		return false, fmt.Errorf("decode command: %w", err)
+	}
+	if len(values) < 2 {
+		return false, nil
+	}
+
+	name, _ := values[0].(string)
+	transactionID, _ := values[1].(float64)
+
+	switch name {
+	case "connect":
+		return false, sess.handleConnect(transactionID, values)
+	case "releaseStream", "FCPublish":
+		return false, sess.writeCommand(0, "_result", transactionID, nil, nil)
+	case "createStream":
+		return false, sess.writeCommand(0, "_result", transactionID, nil, publishStreamID)
+	case "publish":
+		return sess.handlePublish(values)
+	case "FCUnpublish", "deleteStream", "closeStream":
+		// el encoder terminó de publicar
+		return sess.output != nil, nil
+	}
+
+	return false, nil
+}
+
+func (sess *session) handleConnect(transactionID float64, values []interface{}) error {
+	if len(values) > 2 {
+		if object, ok := values[2].(amfObj); ok {
+			sess.app, _ = object["app"].(string)
+			sess.app = strings.Trim(sess.app, "/")
+		}
+	}
+
+	if err := sess.writeControl(msgWindowAckSize, uint32Payload(serverWindowAckSize)); err != nil {
+		return err
+	}
+	// ancho de banda con límite dinámico (2)
+	if err := sess.writeControl(msgSetPeerBandwidth, append(uint32Payload(serverWindowAckSize), 2)); err != nil {
+		return err
+	}
+	if err := sess.writeControl(msgSetChunkSize, uint32Payload(serverChunkSize)); err != nil {
+		return err
+	}
+	sess.writer.chunkSize = serverChunkSize
+
+	properties := amfObj{
+		"fmsVer":       "FMS/3,0,1,123",
+		"capabilities": 31,
+	}
+	information := amfObj{
+		"level":          "status",
+		"code":           "NetConnection.Connect.Success",
+		"description":    "Connection succeeded.",
+		"objectEncoding": 0,
+	}
+
+	return sess.writeCommand(0, "_result", transactionID, properties, information)
+}
+
+func (sess *session) handlePublish(values []interface{}) (bool, error) {
+	if sess.output != nil {
+		return false, nil
+	}
+
+	var streamKey string
+	if len(values) > 3 {
+		streamKey, _ = values[3].(string)
+	}
+	// algunos encoders agregan parámetros después de la clave
+	streamKey, _, _ = strings.Cut(streamKey, "?")
+
+	output, err := sess.handler.Publish(sess.app, streamKey)
+	if err != nil {
+		sess.writeStatus("error", "NetStream.Publish.BadName", "Publishing rejected.")
+		return true, fmt.Errorf("publish rejected: %w", err)
+	}
+
+	sess.output = output
+	sess.flv = newFLVWriter(output)
+
+	begin := make([]byte, 6)
+	binary.BigEndian.PutUint16(begin, eventStreamBegin)
+	binary.BigEndian.PutUint32(begin[2:], publishStreamID)
+	if err := sess.writeControl(msgUserControl, begin); err != nil {
+		return true, err
+	}
+
+	return false, sess.writeStatus("status", "NetStream.Publish.Start", "Publishing started.")
+}
+
+func (sess *session) closeOutput() {
+	if sess.output == nil {
+		return
+	}
+	if err := sess.output.Close(); err != nil {
+		log.Printf("rtmp: %s: close stream: %v", sess.conn.RemoteAddr(), err)
+	}
+	sess.output = nil
+	sess.flv = nil
+}
+
+func (sess *session) writeControl(typeID uint8, payload []byte) error {
+	sess.conn.SetWriteDeadline(time.Now().Add(idleTimeout))
+	return sess.writer.writeMessage(csidControl, &message{TypeID: typeID, Payload: payload})
+}
+
+func (sess *session) writeCommand(streamID uint32, values ...interface{}) error {
+	sess.conn.SetWriteDeadline(time.Now().Add(idleTimeout))
+	return sess.writer.writeMessage(csidCommand, &message{
+		TypeID:   msgCommandAMF0,
+		StreamID: streamID,
+		Payload:  encodeAMF(values...),
+	})
+}
+
+func (sess *session) writeStatus(level, code, description string) error {
+	sess.conn.SetWriteDeadline(time.Now().Add(idleTimeout))
+	return sess.writer.writeMessage(csidStatus, &message{
+		TypeID:   msgCommandAMF0,
+		StreamID: publishStreamID,
+		Payload: encodeAMF("onStatus", 0, nil, amfObj{
+			"level":       level,
+			"code":        code,
+			"description": description,
+		}),
+	})
+}
+
+func uint32Payload(value uint32) []byte {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, value)
+	return payload
+}
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"context"
+	"log"
+	"path"
+	"time"
+
+	"github.com/unbot2313/go-streaming-service/config"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"gorm.io/gorm"
+)
+
+type accountPurgeService struct {
+	videoService        VideoService
+	loginAttemptService LoginAttemptService
+}
+
+// AccountPurgeService elimina definitivamente las cuentas borradas cuyo periodo de gracia ya pasó,
+// junto con sus videos y sus archivos en s3
+type AccountPurgeService interface {
+	Run(ctx context.Context)
+	PurgeExpiredAccounts() error
+}
+
+func NewAccountPurgeService(videoService VideoService) AccountPurgeService {
+	return &accountPurgeService{videoService: videoService, loginAttemptService: NewLoginAttemptService()}
+}
+
+// Run revisa periódicamente las cuentas pendientes hasta que se cancele el contexto
+func (service *accountPurgeService) Run(ctx context.Context) {
+	ticker := time.NewTicker(config.GetConfig().AccountPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := service.PurgeExpiredAccounts(); err != nil {
+			log.Println("error al eliminar las cuentas borradas: ", err)
+		}
+
+		if err := service.loginAttemptService.PruneExpired(); err != nil {
+			log.Println("error al limpiar los intentos de login: ", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (service *accountPurgeService) PurgeExpiredAccounts() error {
+	db, err := config.GetDB()
+	if err != nil {
+		return err
+	}
+
+	var users []models.User
+
+	err = db.Unscoped().
+		Where("deleted_at IS NOT NULL AND purge_after <= ?", time.Now()).
+		Find(&users).Error
+
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if err := service.purgeAccount(db, &user); err != nil {
+			// se reintenta en la siguiente vuelta
+			log.Printf("error al eliminar la cuenta %s: %v\n", user.Id, err)
+		}
+	}
+
+	return nil
+}
+
+func (service *accountPurgeService) purgeAccount(db *gorm.DB, user *models.User) error {
+	var videos []models.VideoModel
+
+	if err := db.Unscoped().Where("user_id = ?", user.Id).Find(&videos).Error; err != nil {
+		return err
+	}
+
+	// primero los archivos, si falla alguno la cuenta se queda para el siguiente intento
+	for _, video := range videos {
+		if err := service.videoService.DeleteS3Folder(VideoS3Prefix(video.Id)); err != nil {
+			return err
+		}
+	}
+
+	if err := service.videoService.DeleteS3Folder(path.Join("avatars", user.Id) + "/"); err != nil {
+		return err
+	}
+
+	if err := service.videoService.DeleteS3Folder(path.Join("exports", user.Id) + "/"); err != nil {
+		return err
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		videoIds := tx.Unscoped().Model(&models.VideoModel{}).Select("id").Where("user_id = ?", user.Id)
+
+		// las sesiones y vistas de sus videos, y las que hizo como espectador
+		if err := tx.Where("video_id IN (?) OR user_id = ?", videoIds, user.Id).Delete(&models.ViewEvent{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("video_id IN (?) OR viewer_key = ?", videoIds, viewerKey(models.Viewer{UserID: user.Id})).Delete(&models.ViewerLastView{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("video_id IN (?) OR user_id = ?", videoIds, user.Id).Delete(&models.PlaybackSession{}).Error; err != nil {
+			return err
+		}
+
+		// los heartbeats de las sesiones del usuario como espectador se quedan hasta que se agreguen
+		if err := tx.Where("video_id IN (?)", videoIds).Delete(&models.PlaybackHeartbeat{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("video_id IN (?)", videoIds).Delete(&models.VideoWatchStats{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("video_id IN (?)", videoIds).Delete(&models.VideoRetentionBucket{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("video_id IN (?)", videoIds).Delete(&models.VideoTag{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("video_id IN (?)", videoIds).Delete(&models.VideoMetadata{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("video_id IN (?)", videoIds).Delete(&models.VideoStatsHourly{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("video_id IN (?) OR viewer_key = ?", videoIds, viewerKey(models.Viewer{UserID: user.Id})).Delete(&models.VideoViewersHourly{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("video_id IN (?) OR user_id = ?", videoIds, user.Id).Delete(&models.WatchProgress{}).Error; err != nil {
+			return err
+		}
+
+		// sus reacciones dejan de contar en los videos de otros usuarios
+		err := tx.Exec(`UPDATE videos SET likes = videos.likes - r.likes, dislikes = videos.dislikes - r.dislikes
+			FROM (SELECT video_id,
+				COUNT(*) FILTER (WHERE kind = ?) AS likes,
+				COUNT(*) FILTER (WHERE kind = ?) AS dislikes
+				FROM video_reactions WHERE user_id = ? GROUP BY video_id) r
+			WHERE videos.id = r.video_id`, models.ReactionLike, models.ReactionDislike, user.Id).Error
+
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("video_id IN (?) OR user_id = ?", videoIds, user.Id).Delete(&models.VideoReaction{}).Error; err != nil {
+			return err
+		}
+
+		// sus respuestas dejan de contar en los comentarios de otros usuarios
+		err = tx.Exec(`UPDATE comments SET reply_count = comments.reply_count - r.replies
+			FROM (SELECT parent_id, COUNT(*) AS replies FROM comments
+				WHERE user_id = ? AND parent_id IS NOT NULL AND status = ? AND deleted_at IS NULL
+				GROUP BY parent_id) r
+			WHERE comments.id = r.parent_id`, user.Id, models.CommentStatusVisible).Error
+
+		if err != nil {
+			return err
+		}
+
+		// también las respuestas de otros a sus comentarios
+		userComments := tx.Unscoped().Model(&models.Comment{}).Select("id").Where("user_id = ?", user.Id)
+
+		err = tx.Unscoped().Where("video_id IN (?) OR user_id = ? OR parent_id IN (?)", videoIds, user.Id, userComments).
+			Delete(&models.Comment{}).Error
+
+		if err != nil {
+			return err
+		}
+
+		// deja de contar como suscriptor de los canales que seguía
+		err = tx.Exec(`UPDATE users SET subscriber_count = users.subscriber_count - 1
+			WHERE id IN (SELECT channel_id FROM subscriptions WHERE subscriber_id = ?)`, user.Id).Error
+
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("subscriber_id = ? OR channel_id = ?", user.Id, user.Id).Delete(&models.Subscription{}).Error; err != nil {
+			return err
+		}
+
+		// notificaciones que recibió y las que generó su actividad (respuestas, videos nuevos)
+		userEvents := tx.Model(&models.NotificationEvent{}).Select("id").
+			Where("actor_id = ? OR recipient_id = ? OR channel_id = ?", user.Id, user.Id, user.Id)
+		userNotifications := tx.Model(&models.Notification{}).Select("id").
+			Where("user_id = ? OR event_id IN (?)", user.Id, userEvents)
+
+		err = tx.Where("user_id = ? OR notification_id IN (?)", user.Id, userNotifications).
+			Delete(&models.NotificationDelivery{}).Error
+
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ? OR event_id IN (?)", user.Id, userEvents).Delete(&models.Notification{}).Error; err != nil {
+			return err
+		}
+
+		err = tx.Where("actor_id = ? OR recipient_id = ? OR channel_id = ?", user.Id, user.Id, user.Id).
+			Delete(&models.NotificationEvent{}).Error
+
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.Id).Delete(&models.NotificationSettings{}).Error; err != nil {
+			return err
+		}
+
+		// el registro de moderación se conserva, solo guarda ids y las notas de los moderadores
+		err = tx.Where("reporter_id = ? OR target_owner_id = ?", user.Id, user.Id).Delete(&models.Report{}).Error
+
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.Id).Delete(&models.Strike{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.Id).Delete(&models.StreamKey{}).Error; err != nil {
+			return err
+		}
+
+		// sus mensajes de chat y el chat de sus transmisiones
+		err = tx.Unscoped().Where("user_id = ? OR video_id IN (?)", user.Id, videoIds).Delete(&models.ChatMessage{}).Error
+
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("channel_id = ? OR user_id = ?", user.Id, user.Id).Delete(&models.ChatTimeout{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.Id).Delete(&models.ProcessingJob{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where("user_id = ?", user.Id).Delete(&models.VideoModel{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.Id).Delete(&models.UserIdentity{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.Id).Delete(&models.DataExport{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Where("id = ?", user.Id).Delete(&models.User{}).Error
+	})
+
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Se eliminó definitivamente la cuenta %s y %d videos.\n", user.Id, len(videos))
+	return nil
+}
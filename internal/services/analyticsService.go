@@ -0,0 +1,382 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/unbot2313/go-streaming-service/config"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrInvalidAnalyticsQuery = errors.New("invalid analytics query")
+
+// analyticsSlot es cada cuánto se cortan las tablas de resumen. Todas las zonas horarias
+// están corridas de UTC en múltiplos de 15 minutos, así que las horas y los días de
+// cualquier zona (ejm: Asia/Kolkata, +05:30) caen justo en el borde de un slot
+const analyticsSlot = 15 * time.Minute
+
+type hourKey struct {
+	videoId string
+	hour    time.Time
+}
+
+type hourCounters struct {
+	views        int64
+	watchSeconds float64
+	likes        int64
+}
+
+type analyticsService struct {
+	mu       sync.Mutex
+	counters map[hourKey]*hourCounters
+	viewers  map[hourKey]map[string]bool
+}
+
+// AnalyticsService acumula en memoria las vistas, el tiempo visto y los likes de cada video por hora,
+// los guarda por lotes en las tablas de resumen y arma con ellas las series para los creadores
+type AnalyticsService interface {
+	RecordView(videoId string, at time.Time)
+	RecordWatchTime(videoId string, viewerKey string, seconds float64, at time.Time)
+	RecordLike(videoId string, delta int64, at time.Time)
+	GetVideoSeries(videoId string, query *models.AnalyticsQuery) (*models.AnalyticsSeries, error)
+	GetChannelSeries(userId string, query *models.AnalyticsQuery) (*models.AnalyticsSeries, error)
+	Run(ctx context.Context)
+	Flush() error
+}
+
+func NewAnalyticsService() AnalyticsService {
+	return &analyticsService{
+		counters: make(map[hourKey]*hourCounters),
+		viewers:  make(map[hourKey]map[string]bool),
+	}
+}
+
+func (service *analyticsService) RecordView(videoId string, at time.Time) {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	service.countersFor(videoId, at).views++
+}
+
+func (service *analyticsService) RecordWatchTime(videoId string, viewerKey string, seconds float64, at time.Time) {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	service.countersFor(videoId, at).watchSeconds += seconds
+
+	key := hourKey{videoId: videoId, hour: analyticsSlotStart(at)}
+	if service.viewers[key] == nil {
+		service.viewers[key] = make(map[string]bool)
+	}
+	service.viewers[key][viewerKey] = true
+}
+
+// RecordLike suma o resta (si se quita el like) un like en la hora indicada
+func (service *analyticsService) RecordLike(videoId string, delta int64, at time.Time) {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	service.countersFor(videoId, at).likes += delta
+}
+
+// countersFor se llama con el mutex tomado
+func (service *analyticsService) countersFor(videoId string, at time.Time) *hourCounters {
+	key := hourKey{videoId: videoId, hour: analyticsSlotStart(at)}
+
+	counters, ok := service.counters[key]
+	if !ok {
+		counters = &hourCounters{}
+		service.counters[key] = counters
+	}
+
+	return counters
+}
+
+// Run guarda lo acumulado cada cierto tiempo hasta que se cancele el contexto
+func (service *analyticsService) Run(ctx context.Context) {
+	ticker := time.NewTicker(config.GetConfig().AnalyticsFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := service.Flush(); err != nil {
+				log.Println("error al guardar las estadísticas: ", err)
+			}
+			return
+		case <-ticker.C:
+			if err := service.Flush(); err != nil {
+				log.Println("error al guardar las estadísticas: ", err)
+			}
+		}
+	}
+}
+
+// Flush suma lo acumulado a las tablas por hora, si falla se vuelve a acumular
+func (service *analyticsService) Flush() error {
+	service.mu.Lock()
+	counters := service.counters
+	viewers := service.viewers
+	service.counters = make(map[hourKey]*hourCounters)
+	service.viewers = make(map[hourKey]map[string]bool)
+	service.mu.Unlock()
+
+	if len(counters) == 0 && len(viewers) == 0 {
+		return nil
+	}
+
+	if err := service.save(counters, viewers); err != nil {
+		service.mu.Lock()
+		for key, pending := range counters {
+			current := service.countersFor(key.videoId, key.hour)
+			current.views += pending.views
+			current.watchSeconds += pending.watchSeconds
+			current.likes += pending.likes
+		}
+		for key, keys := range viewers {
+			if service.viewers[key] == nil {
+				service.viewers[key] = make(map[string]bool)
+			}
+			for viewerKey := range keys {
+				service.viewers[key][viewerKey] = true
+			}
+		}
+		service.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+func (service *analyticsService) save(counters map[hourKey]*hourCounters, viewers map[hourKey]map[string]bool) error {
+	db, err := config.GetDB()
+	if err != nil {
+		return err
+	}
+
+	stats := make([]models.VideoStatsHourly, 0, len(counters))
+	for key, counter := range counters {
+		stats = append(stats, models.VideoStatsHourly{
+			VideoID:      key.videoId,
+			Hour:         key.hour,
+			Views:        counter.views,
+			WatchSeconds: counter.watchSeconds,
+			Likes:        counter.likes,
+		})
+	}
+
+	var rows []models.VideoViewersHourly
+	for key, keys := range viewers {
+		for viewerKey := range keys {
+			rows = append(rows, models.VideoViewersHourly{VideoID: key.videoId, Hour: key.hour, ViewerKey: viewerKey})
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if len(stats) > 0 {
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "video_id"}, {Name: "hour"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"views":         gorm.Expr("video_stats_hourly.views + excluded.views"),
+					"watch_seconds": gorm.Expr("video_stats_hourly.watch_seconds + excluded.watch_seconds"),
+					"likes":         gorm.Expr("video_stats_hourly.likes + excluded.likes"),
+				}),
+			}).CreateInBatches(&stats, 500).Error
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(rows) > 0 {
+			return tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&rows, 500).Error
+		}
+
+		return nil
+	})
+}
+
+func (service *analyticsService) GetVideoSeries(videoId string, query *models.AnalyticsQuery) (*models.AnalyticsSeries, error) {
+	series, err := service.buildSeries(query, func(db *gorm.DB) *gorm.DB {
+		return db.Where("video_id = ?", videoId)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	series.VideoID = videoId
+	return series, nil
+}
+
+// GetChannelSeries suma todos los videos del usuario, también los borrados
+// para que no cambie la historia del canal
+func (service *analyticsService) GetChannelSeries(userId string, query *models.AnalyticsQuery) (*models.AnalyticsSeries, error) {
+	series, err := service.buildSeries(query, func(db *gorm.DB) *gorm.DB {
+		videoIds := db.Session(&gorm.Session{NewDB: true}).Unscoped().Model(&models.VideoModel{}).Select("id").Where("user_id = ?", userId)
+		return db.Where("video_id IN (?)", videoIds)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	series.UserID = userId
+	return series, nil
+}
+
+type analyticsRow struct {
+	Period        time.Time
+	Views         int64
+	WatchSeconds  float64
+	Likes         int64
+	UniqueViewers int64
+}
+
+// analyticsSlotStart devuelve el inicio en UTC del slot en el que cae at
+func analyticsSlotStart(at time.Time) time.Time {
+	return at.UTC().Truncate(analyticsSlot)
+}
+
+// buildSeries agrupa los slots de las tablas de resumen en periodos de la zona horaria pedida,
+// los periodos sin datos se devuelven en cero
+func (service *analyticsService) buildSeries(query *models.AnalyticsQuery, scope func(db *gorm.DB) *gorm.DB) (*models.AnalyticsSeries, error) {
+	periods, err := analyticsPeriods(query)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	from, to := periods[0], query.To
+	timezone := query.Location.String()
+
+	var stats []analyticsRow
+
+	err = db.Model(&models.VideoStatsHourly{}).
+		Select("date_trunc(?, hour AT TIME ZONE ?) AS period, SUM(views) AS views, SUM(watch_seconds) AS watch_seconds, SUM(likes) AS likes", query.Granularity, timezone).
+		Scopes(scope).
+		Where("hour >= ? AND hour < ?", from, to).
+		Group("period").
+		Scan(&stats).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	var viewers []analyticsRow
+
+	err = db.Model(&models.VideoViewersHourly{}).
+		Select("date_trunc(?, hour AT TIME ZONE ?) AS period, COUNT(DISTINCT viewer_key) AS unique_viewers", query.Granularity, timezone).
+		Scopes(scope).
+		Where("hour >= ? AND hour < ?", from, to).
+		Group("period").
+		Scan(&viewers).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	series := &models.AnalyticsSeries{
+		From:        from,
+		To:          to,
+		Granularity: query.Granularity,
+		Timezone:    timezone,
+		Points:      make([]models.AnalyticsPoint, len(periods)),
+	}
+
+	index := make(map[int64]int, len(periods))
+	for i, period := range periods {
+		series.Points[i].Period = period
+		index[period.Unix()] = i
+	}
+
+	// date_trunc devuelve la hora local sin zona, se interpreta en la zona pedida
+	find := func(period time.Time) (*models.AnalyticsPoint, bool) {
+		local := time.Date(period.Year(), period.Month(), period.Day(), period.Hour(), 0, 0, 0, query.Location)
+		i, ok := index[local.Unix()]
+		if !ok {
+			return nil, false
+		}
+		return &series.Points[i], true
+	}
+
+	for _, row := range stats {
+		if point, ok := find(row.Period); ok {
+			point.Views = row.Views
+			point.WatchSeconds = row.WatchSeconds
+			point.Likes = row.Likes
+		}
+		series.Totals.Views += row.Views
+		series.Totals.WatchSeconds += row.WatchSeconds
+		series.Totals.Likes += row.Likes
+	}
+
+	for _, row := range viewers {
+		if point, ok := find(row.Period); ok {
+			point.UniqueViewers = row.UniqueViewers
+		}
+	}
+
+	err = db.Model(&models.VideoViewersHourly{}).
+		Select("COUNT(DISTINCT viewer_key)").
+		Scopes(scope).
+		Where("hour >= ? AND hour < ?", from, to).
+		Scan(&series.Totals.UniqueViewers).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return series, nil
+}
+
+// analyticsPeriods devuelve el inicio de cada periodo entre From y To en la zona de la consulta
+func analyticsPeriods(query *models.AnalyticsQuery) ([]time.Time, error) {
+	if query.Location == nil || query.Location.String() == "Local" {
+		return nil, fmt.Errorf("%w: timezone is required", ErrInvalidAnalyticsQuery)
+	}
+
+	if query.Granularity != models.AnalyticsGranularityHour && query.Granularity != models.AnalyticsGranularityDay {
+		return nil, fmt.Errorf("%w: granularity must be hour or day", ErrInvalidAnalyticsQuery)
+	}
+
+	if !query.To.After(query.From) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidAnalyticsQuery)
+	}
+
+	from := query.From.In(query.Location)
+	if query.Granularity == models.AnalyticsGranularityDay {
+		from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, query.Location)
+	} else {
+		from = time.Date(from.Year(), from.Month(), from.Day(), from.Hour(), 0, 0, 0, query.Location)
+	}
+
+	maxPoints := config.GetConfig().AnalyticsMaxPoints
+	var periods []time.Time
+
+	for period := from; period.Before(query.To); {
+		if len(periods) >= maxPoints {
+			return nil, fmt.Errorf("%w: the range has more than %d periods", ErrInvalidAnalyticsQuery, maxPoints)
+		}
+
+		periods = append(periods, period)
+
+		if query.Granularity == models.AnalyticsGranularityDay {
+			period = period.AddDate(0, 0, 1)
+		} else {
+			period = period.Add(time.Hour)
+		}
+	}
+
+	return periods, nil
+}
@@ -0,0 +1,24 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnalyticsSlotsFollowLocalHours(t *testing.T) {
+	for _, name := range []string{"Asia/Kolkata", "Asia/Kathmandu", "America/St_Johns", "UTC"} {
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			t.Skipf("no tzdata for %s: %v", name, err)
+		}
+
+		// las 10:00 locales empiezan un slot nuevo y las 09:59 quedan en el slot anterior
+		hour := time.Date(2024, 3, 1, 10, 0, 0, 0, location)
+		if got := analyticsSlotStart(hour.Add(7 * time.Minute)); !got.Equal(hour) {
+			t.Errorf("%s: slot start = %v, want %v", name, got.In(location), hour)
+		}
+		if got := analyticsSlotStart(hour.Add(-time.Minute)); !got.Before(hour) {
+			t.Errorf("%s: 09:59 local fell in the 10:00 slot", name)
+		}
+	}
+}
@@ -1,54 +1,98 @@
 package services
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/unbot2313/go-streaming-service/config"
 	"github.com/unbot2313/go-streaming-service/internal/models"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
+// ErrInvalidCredentials es la única respuesta ante un login fallido, así no se puede
+// saber si el usuario existe o si lo que falló fue la contraseña
+var ErrInvalidCredentials = errors.New("usuario o contraseña incorrectos")
+
+// LoginLockedError indica que la cuenta o la IP deben esperar antes de volver a intentar
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return "demasiados intentos de login, intente de nuevo más tarde"
+}
+
+// AccountSuspendedError indica que un moderador suspendió la cuenta hasta Until
+type AccountSuspendedError struct {
+	Until time.Time
+}
+
+func (e *AccountSuspendedError) Error() string {
+	return "la cuenta está suspendida hasta " + e.Until.UTC().Format(time.RFC3339)
+}
+
 type AuthServiceImp struct{
 	userService UserService
+	loginAttemptService LoginAttemptService
 }
 
 type AuthService interface {
 
 	GenerateToken(User *models.User) (string, error)
 	ValidateToken(token string) (*models.User, error)
-	Login(username, password string) (string, error)
+	Login(username, password, clientIP string) (string, error)
+	RestoreAccount(username, password, clientIP string) (string, error)
+	CheckAccount(userId string) (*models.User, error)
 
 }
 
 func NewAuthService() AuthService {
 	return &AuthServiceImp{
 		userService: NewUserService(),
+		loginAttemptService: NewLoginAttemptService(),
 	}
 }
 
-func (service *AuthServiceImp) Login(username, password string) (string, error) {
-	// Buscar el usuario en la base de datos
+func (service *AuthServiceImp) Login(username, password, clientIP string) (string, error) {
 
-	_, err := config.GetDB()
+	user, err := service.authenticate(username, password, clientIP, service.userService.GetUserByUserName)
 
 	if err != nil {
-		return "", fmt.Errorf("error al conectar a la base de datos: %v", err)
+		return "", err
 	}
 
-	user, err := service.userService.GetUserByUserName(username)
+	// Generar el token
+	token, err := service.GenerateToken(user)
 
 	if err != nil {
-		return "", fmt.Errorf("error al buscar el usuario: %v", err)
+		return "", fmt.Errorf("error al generar el token: %v", err)
 	}
 
-	// Verificar la contraseña
-	if !CheckPasswordHash(password, user.Password) {
-		return "", fmt.Errorf("la contraseña no es válida")
+	return token, nil
+}
+
+// RestoreAccount deshace el borrado de una cuenta que sigue en el periodo de gracia,
+// pide las mismas credenciales que el login y devuelve un token nuevo
+func (service *AuthServiceImp) RestoreAccount(username, password, clientIP string) (string, error) {
+
+	user, err := service.authenticate(username, password, clientIP, service.userService.GetDeletedUserByUserName)
+
+	if err != nil {
+		return "", err
+	}
+
+	user, err = service.userService.RestoreUserByID(user.Id)
+
+	if err != nil {
+		return "", fmt.Errorf("error al restaurar la cuenta: %v", err)
 	}
 
-	// Generar el token
 	token, err := service.GenerateToken(user)
 
 	if err != nil {
@@ -58,6 +102,103 @@ func (service *AuthServiceImp) Login(username, password string) (string, error)
 	return token, nil
 }
 
+// authenticate verifica las credenciales aplicando los límites de intentos,
+// findUser permite buscar entre las cuentas activas o las borradas
+func (service *AuthServiceImp) authenticate(username, password, clientIP string, findUser func(string) (*models.User, error)) (*models.User, error) {
+
+	_, err := config.GetDB()
+
+	if err != nil {
+		return nil, fmt.Errorf("error al conectar a la base de datos: %v", err)
+	}
+
+	// Contar el intento, o rechazarlo si la cuenta o la IP están bloqueadas, antes de revisar la contraseña
+	retryAfter, err := service.loginAttemptService.ReserveAttempt(username, clientIP)
+
+	if err != nil {
+		return nil, fmt.Errorf("error al verificar los intentos de login: %v", err)
+	}
+
+	if retryAfter > 0 {
+		service.registerLoginFailure(username, "", clientIP, loginFailureLocked)
+		return nil, &LoginLockedError{RetryAfter: retryAfter}
+	}
+
+	// Buscar el usuario en la base de datos
+	user, err := findUser(username)
+
+	if errors.Is(err, ErrUserNotFound) {
+		// se compara contra un hash falso para que la respuesta tarde lo mismo
+		// exista o no el usuario
+		CheckPasswordHash(password, dummyPasswordHash())
+		service.registerLoginFailure(username, "", clientIP, loginFailureUserNotFound)
+		return nil, ErrInvalidCredentials
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error al buscar el usuario: %v", err)
+	}
+
+	// Verificar la contraseña
+	if !CheckPasswordHash(password, user.Password) {
+		service.registerLoginFailure(username, user.Id, clientIP, loginFailureInvalidPassword)
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := service.loginAttemptService.RegisterSuccess(username, clientIP); err != nil {
+		log.Println("error al reiniciar los intentos de login: ", err)
+	}
+
+	if err := checkSuspension(user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// CheckAccount lee el rol y la suspensión de la cuenta del token, se revisa en cada
+// request autenticado para que una suspensión o un cambio de rol apliquen de inmediato
+func (service *AuthServiceImp) CheckAccount(userId string) (*models.User, error) {
+	db, err := config.GetDB()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+
+	err = db.Select("id", "role", "suspended_until").Where("id = ?", userId).First(&user).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: ID %s", ErrUserNotFound, userId)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkSuspension(&user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func checkSuspension(user *models.User) error {
+	if user.SuspendedUntil != nil && user.SuspendedUntil.After(time.Now()) {
+		return &AccountSuspendedError{Until: *user.SuspendedUntil}
+	}
+
+	return nil
+}
+
+// registerLoginFailure guarda el fallo sin cambiar la respuesta que recibe el cliente
+func (service *AuthServiceImp) registerLoginFailure(username, userId, clientIP, reason string) {
+	if err := service.loginAttemptService.RegisterFailure(username, userId, clientIP, reason); err != nil {
+		log.Println("error al registrar el intento de login fallido: ", err)
+	}
+}
+
 func (service *AuthServiceImp) GenerateToken(user *models.User) (string, error) {
 
 	SecretToken := []byte(config.GetConfig().JWTSecretKey)
@@ -138,6 +279,22 @@ func HashPassword(password string) (string, error) {
 	return string(hashedPassword), nil
 }
 
+var (
+	dummyHash     string
+	dummyHashOnce sync.Once
+)
+
+// dummyPasswordHash genera una sola vez un hash que nunca coincide con ninguna contraseña
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		hash, err := bcrypt.GenerateFromPassword([]byte(uuid.New().String()), bcrypt.DefaultCost)
+		if err == nil {
+			dummyHash = string(hash)
+		}
+	})
+	return dummyHash
+}
+
 // Función para comparar una contraseña sin hashear con su hash
 func CheckPasswordHash(password, hashedPassword string) bool {
 	// Comparar la contraseña con el hash
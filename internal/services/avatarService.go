@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/unbot2313/go-streaming-service/config"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+)
+
+// ErrInvalidImage indica que el contenido del archivo no es una imagen de un formato aceptado,
+// aunque la extensión lo sea
+var ErrInvalidImage = errors.New("el archivo no es una imagen válida")
+
+// tamaños estándar del avatar, en pixeles (cuadrado)
+var avatarSizes = []int{64, 128, 256}
+
+var validImageExtensions = []string{
+	".jpg", ".jpeg", ".png", ".webp", ".gif", ".bmp",
+}
+
+// extensión con la que se guarda cada formato detectado por el contenido
+var imageExtensionsByType = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+	"image/gif":  ".gif",
+	"image/bmp":  ".bmp",
+}
+
+const maxAvatarSize = 5 * 1024 * 1024 // 5 MB
+
+type avatarServiceImp struct {
+	videoService VideoService
+	userService  UserService
+	transcoder   Transcoder
+}
+
+type AvatarService interface {
+	IsValidImageExtension(c *gin.Context) bool
+	// SaveAvatar redimensiona la imagen del formulario, la sube a s3 igual que las miniaturas
+	// y la asigna al usuario, borrando el avatar anterior
+	SaveAvatar(c *gin.Context, userId string) (*models.User, error)
+}
+
+// NewAvatarService recibe el transcoder con el que se generan los tamaños del avatar
+func NewAvatarService(videoService VideoService, userService UserService, transcoder Transcoder) AvatarService {
+	return &avatarServiceImp{
+		videoService: videoService,
+		userService:  userService,
+		transcoder:   transcoder,
+	}
+}
+
+func (as *avatarServiceImp) IsValidImageExtension(c *gin.Context) bool {
+	file, err := c.FormFile("avatar")
+	if err != nil || file.Size > maxAvatarSize {
+		return false
+	}
+
+	extension := strings.ToLower(filepath.Ext(file.Filename))
+
+	for _, validExtension := range validImageExtensions {
+		if validExtension == extension {
+			return true
+		}
+	}
+	return false
+}
+
+func (as *avatarServiceImp) SaveAvatar(c *gin.Context, userId string) (*models.User, error) {
+	user, err := as.userService.GetUserByID(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := c.FormFile("avatar")
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener el archivo: %w", err)
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener el archivo: %w", err)
+	}
+
+	// el formato sale del contenido, la extensión la elige el usuario
+	extension, err := detectImageExtension(file)
+	file.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	filesService := as.videoService.GetFilesService()
+
+	// se usa la misma carpeta temporal que las miniaturas de los videos
+	uploadId := uuid.New().String()
+	folderPath := saveFormatedVideoPath + "avatar_" + uploadId
+
+	if err := filesService.CreateFolder(folderPath); err != nil {
+		return nil, err
+	}
+	defer filesService.RemoveFolder(folderPath)
+
+	originalPath := filepath.Join(folderPath, "original"+extension)
+	if err := c.SaveUploadedFile(header, originalPath); err != nil {
+		return nil, fmt.Errorf("error al guardar el archivo: %w", err)
+	}
+
+	// ffmpeg no puede quedarse colgado con el request
+	err = runStage(c.Request.Context(), config.GetConfig().ProcessingAvatarTimeout, func(ctx context.Context) error {
+		return as.saveAvatarSizes(ctx, originalPath, folderPath)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// no se sube la imagen original, solo los tamaños estándar
+	if err := filesService.RemoveFile(originalPath); err != nil {
+		return nil, err
+	}
+
+	avatarFolder := path.Join("avatars", userId, uploadId)
+
+	uploadedFiles, err := as.videoService.UploadFolderToS3(folderPath, avatarFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	avatars := make(map[string]string)
+	for _, size := range avatarSizes {
+		avatars[strconv.Itoa(size)] = uploadedFiles[avatarFileName(size)]
+	}
+
+	updatedUser, err := as.userService.UpdateUserByID(userId, &models.User{
+		Avatars:      avatars,
+		AvatarFolder: avatarFolder,
+	})
+	if err != nil {
+		as.videoService.DeleteS3Folder(avatarFolder + "/")
+		return nil, err
+	}
+
+	// el avatar anterior ya no se usa
+	if user.AvatarFolder != "" {
+		if err := as.videoService.DeleteS3Folder(user.AvatarFolder + "/"); err != nil {
+			log.Println("error al borrar el avatar anterior: ", err)
+		}
+	}
+
+	return updatedUser, nil
+}
+
+func avatarFileName(size int) string {
+	return fmt.Sprintf("avatar_%d.webp", size)
+}
+
+// detectImageExtension lee los primeros bytes del archivo y devuelve la extensión de su formato,
+// ErrInvalidImage si no es ninguno de los aceptados
+func detectImageExtension(reader io.Reader) (string, error) {
+	// DetectContentType mira como mucho los primeros 512 bytes
+	header := make([]byte, 512)
+
+	n, err := io.ReadFull(reader, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	extension, ok := imageExtensionsByType[http.DetectContentType(header[:n])]
+	if !ok {
+		return "", ErrInvalidImage
+	}
+
+	return extension, nil
+}
+
+// saveAvatarSizes genera una imagen webp cuadrada por cada tamaño estándar,
+// recortando el centro de la imagen para no deformarla
+func (as *avatarServiceImp) saveAvatarSizes(ctx context.Context, imagePath string, folderPath string) error {
+	for _, size := range avatarSizes {
+		if err := as.transcoder.ResizeImage(ctx, imagePath, filepath.Join(folderPath, avatarFileName(size)), size); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDetectImageExtension(t *testing.T) {
+	cases := map[string]struct {
+		content   []byte
+		extension string
+	}{
+		"png":  {[]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), ".png"},
+		"jpeg": {[]byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"), ".jpg"},
+		"webp": {[]byte("RIFF\x24\x00\x00\x00WEBPVP8 "), ".webp"},
+		"gif":  {[]byte("GIF89a\x01\x00\x01\x00"), ".gif"},
+		// un playlist subido como avatar.png, ffmpeg lo abriría como playlist
+		"playlist": {[]byte("#EXTM3U\n#EXTINF:10,\nhttp://169.254.169.254/latest/meta-data\n"), ""},
+		"empty":    {nil, ""},
+	}
+
+	for name, test := range cases {
+		extension, err := detectImageExtension(bytes.NewReader(test.content))
+
+		if test.extension == "" {
+			if !errors.Is(err, ErrInvalidImage) {
+				t.Errorf("%s: extension = %q, err = %v, want ErrInvalidImage", name, extension, err)
+			}
+			continue
+		}
+
+		if err != nil || extension != test.extension {
+			t.Errorf("%s: extension = %q, err = %v, want %q", name, extension, err, test.extension)
+		}
+	}
+}
+
+func TestResizeImageArgsForceImageDemuxer(t *testing.T) {
+	got := strings.Join(resizeImageArgs("in/original.png", "out/avatar_64.webp", 64), " ")
+	want := "-protocol_whitelist file -f image2 -i in/original.png -frames:v 1" +
+		" -vf scale=64:64:force_original_aspect_ratio=increase,crop=64:64 -y out/avatar_64.webp"
+
+	if got != want {
+		t.Errorf("args = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,565 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/unbot2313/go-streaming-service/config"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrChatClosed = errors.New("the chat is only open while the video is live")
+
+var ErrChatLoginRequired = errors.New("login required to use the chat")
+
+var ErrInvalidChatMessage = errors.New("invalid chat message")
+
+var ErrChatForbidden = errors.New("only the channel owner or a moderator can do this")
+
+var ErrChatMessageNotFound = errors.New("chat message not found")
+
+// ChatWaitError indica que el usuario no puede escribir todavía, por el modo lento,
+// el límite de mensajes o porque el dueño del canal lo silenció
+type ChatWaitError struct {
+	Reason string
+	Until  time.Time
+}
+
+func (e *ChatWaitError) Error() string {
+	return fmt.Sprintf("%s, you can write again at %s", e.Reason, e.Until.UTC().Format(time.RFC3339))
+}
+
+const (
+	maxChatMessageLength = 500
+	maxChatTimeout       = 24 * time.Hour
+	maxChatSlowMode      = 10 * time.Minute
+	// eventos que se guardan por cliente, si no los lee a tiempo se lo desconecta
+	chatClientBuffer = 64
+)
+
+// chatRoom es el chat de una transmisión en vivo, con los clientes conectados y los
+// límites de cada usuario. Solo vive en memoria mientras dura la transmisión.
+type chatRoom struct {
+	videoId   string
+	ownerId   string
+	startedAt time.Time
+
+	mu       sync.Mutex
+	clients  map[*ChatSubscription]struct{}
+	slowMode time.Duration
+	// último mensaje y mensajes dentro de la ventana del límite, por usuario
+	lastMessage map[string]time.Time
+	recent      map[string][]time.Time
+	closed      bool
+}
+
+// ChatSubscription es un cliente conectado al chat, Events se cierra cuando termina la
+// transmisión o si el cliente no lee los eventos a tiempo
+type ChatSubscription struct {
+	Events <-chan models.ChatEvent
+	events chan models.ChatEvent
+	room   *chatRoom
+	once   sync.Once
+}
+
+type chatService struct {
+	databaseVideoService DatabaseVideoService
+	filter               *regexp.Regexp
+
+	mu    sync.Mutex
+	rooms map[string]*chatRoom
+}
+
+// ChatService es el chat en tiempo real de las transmisiones en vivo: reparte los mensajes a
+// los que están conectados, aplica el modo lento, el límite de mensajes y el filtro de palabras,
+// y guarda los mensajes para repetirlos con la grabación
+type ChatService interface {
+	Join(videoId string) (*ChatSubscription, error)
+	Leave(subscription *ChatSubscription)
+	Send(videoId string, user *models.User, body string) (*models.ChatMessage, error)
+	DeleteMessage(videoId string, user *models.User, messageId string) error
+	TimeoutUser(videoId string, user *models.User, targetUserId string, duration time.Duration) (*models.ChatTimeout, error)
+	SetSlowMode(videoId string, user *models.User, duration time.Duration) error
+	CloseRoom(videoId string)
+	ListMessages(videoId string, from float64, cursor string, limit int) (*models.ChatMessagePage, error)
+}
+
+func NewChatService(databaseVideoService DatabaseVideoService) ChatService {
+	return &chatService{
+		databaseVideoService: databaseVideoService,
+		filter:               newWordFilter(config.GetConfig().ChatBlocklist),
+		rooms:                make(map[string]*chatRoom),
+	}
+}
+
+// newWordFilter arma una expresión que encuentra las palabras bloqueadas sin importar
+// mayúsculas, nil si no hay palabras
+func newWordFilter(blocklist []string) *regexp.Regexp {
+	if len(blocklist) == 0 {
+		return nil
+	}
+
+	words := make([]string, 0, len(blocklist))
+	for _, word := range blocklist {
+		words = append(words, regexp.QuoteMeta(word))
+	}
+
+	return regexp.MustCompile(`(?i)` + strings.Join(words, "|"))
+}
+
+// Join conecta un cliente al chat, solo se puede mientras el video está en vivo
+func (service *chatService) Join(videoId string) (*ChatSubscription, error) {
+	room, err := service.room(videoId)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan models.ChatEvent, chatClientBuffer)
+	subscription := &ChatSubscription{Events: events, events: events, room: room}
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+
+	if room.closed {
+		return nil, ErrChatClosed
+	}
+
+	room.clients[subscription] = struct{}{}
+
+	if room.slowMode > 0 {
+		seconds := int(room.slowMode.Seconds())
+		subscription.events <- models.ChatEvent{Type: models.ChatEventSlowMode, Seconds: &seconds}
+	}
+
+	return subscription, nil
+}
+
+func (service *chatService) Leave(subscription *ChatSubscription) {
+	room := subscription.room
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+
+	room.removeLocked(subscription)
+}
+
+// room devuelve el chat del video, lo crea la primera vez si el video está en vivo
+func (service *chatService) room(videoId string) (*chatRoom, error) {
+	service.mu.Lock()
+	room, ok := service.rooms[videoId]
+	service.mu.Unlock()
+
+	if ok {
+		return room, nil
+	}
+
+	video, err := service.databaseVideoService.FindVideoByID(videoId)
+	if err != nil {
+		return nil, err
+	}
+
+	if video.State != models.VideoStateLive || video.HiddenAt != nil {
+		return nil, ErrChatClosed
+	}
+
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	// otro cliente pudo crearlo mientras se buscaba el video
+	if room, ok := service.rooms[videoId]; ok {
+		return room, nil
+	}
+
+	room = &chatRoom{
+		videoId:     video.Id,
+		ownerId:     video.UserID,
+		startedAt:   video.CreatedAt,
+		clients:     make(map[*ChatSubscription]struct{}),
+		slowMode:    config.GetConfig().ChatSlowMode,
+		lastMessage: make(map[string]time.Time),
+		recent:      make(map[string][]time.Time),
+	}
+	service.rooms[videoId] = room
+
+	return room, nil
+}
+
+// Send valida el mensaje contra los límites del usuario, lo guarda y lo reparte
+func (service *chatService) Send(videoId string, user *models.User, body string) (*models.ChatMessage, error) {
+	if user == nil {
+		return nil, ErrChatLoginRequired
+	}
+
+	body = strings.TrimSpace(body)
+	if body == "" || utf8.RuneCountInString(body) > maxChatMessageLength {
+		return nil, fmt.Errorf("%w: the message must have between 1 and %d characters", ErrInvalidChatMessage, maxChatMessageLength)
+	}
+
+	room, err := service.room(videoId)
+	if err != nil {
+		return nil, err
+	}
+
+	moderator := room.canModerate(user)
+
+	if !moderator {
+		if err := checkChatTimeout(room.ownerId, user.Id); err != nil {
+			return nil, err
+		}
+	}
+
+	if service.filter != nil {
+		body = service.filter.ReplaceAllStringFunc(body, func(word string) string {
+			return strings.Repeat("*", utf8.RuneCountInString(word))
+		})
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	room.mu.Lock()
+
+	if room.closed {
+		room.mu.Unlock()
+		return nil, ErrChatClosed
+	}
+
+	now := time.Now()
+
+	// el dueño del canal y los moderadores no tienen límites
+	if !moderator {
+		if err := room.checkLimitsLocked(user.Id, now); err != nil {
+			room.mu.Unlock()
+			return nil, err
+		}
+	}
+
+	// el mensaje cuenta para los límites desde ya, así dos mensajes seguidos no pasan los dos
+	// mientras se guarda el primero, que se hace sin el mutex para no frenar al resto del chat
+	previous, hadPrevious := room.lastMessage[user.Id]
+	room.lastMessage[user.Id] = now
+	room.recent[user.Id] = append(room.recent[user.Id], now)
+
+	room.mu.Unlock()
+
+	message := models.ChatMessage{
+		Id:        uuid.New().String(),
+		VideoID:   room.videoId,
+		UserID:    user.Id,
+		Username:  user.Username,
+		Body:      body,
+		Offset:    now.Sub(room.startedAt).Seconds(),
+		CreatedAt: now,
+	}
+
+	if err := db.Create(&message).Error; err != nil {
+		room.mu.Lock()
+		room.releaseLocked(user.Id, now, previous, hadPrevious)
+		room.mu.Unlock()
+		return nil, err
+	}
+
+	room.broadcast(models.ChatEvent{Type: models.ChatEventMessage, Message: &message})
+
+	return &message, nil
+}
+
+// releaseLocked devuelve a un usuario el lugar de un mensaje que no se pudo guardar
+func (room *chatRoom) releaseLocked(userId string, sentAt time.Time, previous time.Time, hadPrevious bool) {
+	if i := slices.Index(room.recent[userId], sentAt); i >= 0 {
+		room.recent[userId] = slices.Delete(room.recent[userId], i, i+1)
+	}
+
+	if room.lastMessage[userId].Equal(sentAt) {
+		if hadPrevious {
+			room.lastMessage[userId] = previous
+		} else {
+			delete(room.lastMessage, userId)
+		}
+	}
+}
+
+// checkLimitsLocked aplica el modo lento y el límite de mensajes por ventana de tiempo
+func (room *chatRoom) checkLimitsLocked(userId string, now time.Time) error {
+	if last, ok := room.lastMessage[userId]; ok && room.slowMode > 0 && now.Sub(last) < room.slowMode {
+		return &ChatWaitError{Reason: "slow mode is on", Until: last.Add(room.slowMode)}
+	}
+
+	cfg := config.GetConfig()
+	if cfg.ChatRateLimit <= 0 {
+		return nil
+	}
+
+	// se descartan los mensajes que ya salieron de la ventana
+	recent := slices.DeleteFunc(room.recent[userId], func(sentAt time.Time) bool {
+		return now.Sub(sentAt) >= cfg.ChatRateWindow
+	})
+	room.recent[userId] = recent
+
+	if len(recent) >= cfg.ChatRateLimit {
+		return &ChatWaitError{Reason: "too many messages", Until: recent[0].Add(cfg.ChatRateWindow)}
+	}
+
+	return nil
+}
+
+func checkChatTimeout(channelId string, userId string) error {
+	db, err := config.GetDB()
+	if err != nil {
+		return err
+	}
+
+	var timeout models.ChatTimeout
+
+	dbCtx := db.Where("channel_id = ? AND user_id = ? AND until > ?", channelId, userId, time.Now()).Limit(1).Find(&timeout)
+
+	if dbCtx.Error != nil {
+		return dbCtx.Error
+	}
+
+	if dbCtx.RowsAffected > 0 {
+		return &ChatWaitError{Reason: "you were timed out in this channel", Until: timeout.Until}
+	}
+
+	return nil
+}
+
+// DeleteMessage borra un mensaje del chat, también de la repetición
+func (service *chatService) DeleteMessage(videoId string, user *models.User, messageId string) error {
+	room, err := service.moderatedRoom(videoId, user)
+	if err != nil {
+		return err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return err
+	}
+
+	dbCtx := db.Where("id = ? AND video_id = ?", messageId, room.videoId).Delete(&models.ChatMessage{})
+
+	if dbCtx.Error != nil {
+		return dbCtx.Error
+	}
+
+	if dbCtx.RowsAffected == 0 {
+		return fmt.Errorf("%w: id %s", ErrChatMessageNotFound, messageId)
+	}
+
+	room.broadcast(models.ChatEvent{Type: models.ChatEventDelete, MessageID: messageId})
+
+	return nil
+}
+
+// TimeoutUser silencia a un usuario en el canal, vale para las próximas transmisiones hasta que venza
+func (service *chatService) TimeoutUser(videoId string, user *models.User, targetUserId string, duration time.Duration) (*models.ChatTimeout, error) {
+	room, err := service.moderatedRoom(videoId, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if targetUserId == "" || targetUserId == room.ownerId || targetUserId == user.Id {
+		return nil, fmt.Errorf("%w: invalid user", ErrInvalidChatMessage)
+	}
+
+	if duration <= 0 || duration > maxChatTimeout {
+		return nil, fmt.Errorf("%w: the timeout must be between 1 second and %s", ErrInvalidChatMessage, maxChatTimeout)
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := models.ChatTimeout{
+		ChannelID: room.ownerId,
+		UserID:    targetUserId,
+		Until:     time.Now().Add(duration),
+		CreatedBy: user.Id,
+	}
+
+	err = db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "channel_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"until", "created_by", "created_at"}),
+	}).Create(&timeout).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	room.broadcast(models.ChatEvent{Type: models.ChatEventTimeout, UserID: targetUserId, Until: &timeout.Until})
+
+	return &timeout, nil
+}
+
+// SetSlowMode cambia el tiempo mínimo entre mensajes de cada usuario, 0 lo desactiva
+func (service *chatService) SetSlowMode(videoId string, user *models.User, duration time.Duration) error {
+	room, err := service.moderatedRoom(videoId, user)
+	if err != nil {
+		return err
+	}
+
+	if duration < 0 || duration > maxChatSlowMode {
+		return fmt.Errorf("%w: slow mode must be between 0 and %s", ErrInvalidChatMessage, maxChatSlowMode)
+	}
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+
+	room.slowMode = duration
+	seconds := int(duration.Seconds())
+	room.broadcastLocked(models.ChatEvent{Type: models.ChatEventSlowMode, Seconds: &seconds})
+
+	return nil
+}
+
+func (service *chatService) moderatedRoom(videoId string, user *models.User) (*chatRoom, error) {
+	if user == nil {
+		return nil, ErrChatLoginRequired
+	}
+
+	room, err := service.room(videoId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !room.canModerate(user) {
+		return nil, ErrChatForbidden
+	}
+
+	return room, nil
+}
+
+// CloseRoom cierra el chat cuando termina la transmisión y desconecta a los clientes
+func (service *chatService) CloseRoom(videoId string) {
+	service.mu.Lock()
+	room, ok := service.rooms[videoId]
+	delete(service.rooms, videoId)
+	service.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+
+	room.closed = true
+	for subscription := range room.clients {
+		// se intenta avisar, si el cliente está atrasado solo se cierra
+		select {
+		case subscription.events <- models.ChatEvent{Type: models.ChatEventClosed}:
+		default:
+		}
+		room.removeLocked(subscription)
+	}
+}
+
+// ListMessages devuelve el chat de una transmisión en orden de llegada desde el segundo from,
+// para una grabación devuelve el chat de la transmisión de la que salió
+func (service *chatService) ListMessages(videoId string, from float64, cursor string, limit int) (*models.ChatMessagePage, error) {
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	video, err := service.databaseVideoService.FindVideoByID(videoId)
+	if err != nil {
+		return nil, err
+	}
+
+	if video.HiddenAt != nil {
+		return nil, fmt.Errorf("%w: id %s", ErrVideoNotFound, videoId)
+	}
+
+	if video.SourceVideoID != "" {
+		videoId = video.SourceVideoID
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	size := pageSize(limit)
+	query := db.Where("video_id = ?", videoId)
+
+	if from > 0 {
+		query = query.Where("\"offset\" >= ?", from)
+	}
+
+	if after != nil {
+		query = query.Where("(created_at, id) > (?, ?)", after.Time, after.Id)
+	}
+
+	var messages []models.ChatMessage
+
+	if err := query.Order("created_at, id").Limit(size + 1).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+
+	page := &models.ChatMessagePage{Items: messages}
+
+	if len(messages) > size {
+		page.Items = messages[:size]
+		last := page.Items[size-1]
+		page.NextCursor = encodeCursor(last.CreatedAt, last.Id)
+	}
+
+	if page.Items == nil {
+		page.Items = []models.ChatMessage{}
+	}
+
+	return page, nil
+}
+
+// canModerate: el dueño del canal y los moderadores de la plataforma
+func (room *chatRoom) canModerate(user *models.User) bool {
+	return user.Id == room.ownerId || user.Role == models.RoleModerator || user.Role == models.RoleAdmin
+}
+
+func (room *chatRoom) broadcast(event models.ChatEvent) {
+	room.mu.Lock()
+	defer room.mu.Unlock()
+
+	room.broadcastLocked(event)
+}
+
+// broadcastLocked reparte el evento sin bloquear, el cliente que tiene el buffer lleno se desconecta
+func (room *chatRoom) broadcastLocked(event models.ChatEvent) {
+	for subscription := range room.clients {
+		select {
+		case subscription.events <- event:
+		default:
+			room.removeLocked(subscription)
+		}
+	}
+}
+
+func (room *chatRoom) removeLocked(subscription *ChatSubscription) {
+	if _, ok := room.clients[subscription]; !ok {
+		return
+	}
+
+	delete(room.clients, subscription)
+	subscription.once.Do(func() { close(subscription.events) })
+}
+
+func collectChatMessages(db *gorm.DB, userId string) (interface{}, error) {
+	var messages []models.ChatMessage
+
+	err := db.Where("user_id = ?", userId).Order("created_at").Find(&messages).Error
+
+	return messages, err
+}
@@ -0,0 +1,508 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/unbot2313/go-streaming-service/config"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCommentNotFound      = errors.New("comment not found")
+	ErrInvalidCommentParent = errors.New("invalid parent comment")
+	ErrCommentForbidden     = errors.New("not allowed to change this comment")
+)
+
+// CommentModerator decide el estado con el que se publica un comentario nuevo o editado
+type CommentModerator interface {
+	Moderate(comment *models.Comment) (string, error)
+}
+
+// keywordModerator retiene para revisión los comentarios con palabras de la lista,
+// o todos si así está configurado
+type keywordModerator struct {
+	blocklist     []string
+	holdForReview bool
+}
+
+func NewKeywordModerator(blocklist []string, holdForReview bool) CommentModerator {
+	words := make([]string, 0, len(blocklist))
+	for _, word := range blocklist {
+		words = append(words, strings.ToLower(word))
+	}
+
+	return &keywordModerator{blocklist: words, holdForReview: holdForReview}
+}
+
+func (moderator *keywordModerator) Moderate(comment *models.Comment) (string, error) {
+	if moderator.holdForReview {
+		return models.CommentStatusHeld, nil
+	}
+
+	body := strings.ToLower(comment.Body)
+	for _, word := range moderator.blocklist {
+		if strings.Contains(body, word) {
+			return models.CommentStatusHeld, nil
+		}
+	}
+
+	return models.CommentStatusVisible, nil
+}
+
+type commentService struct {
+	databaseVideoService DatabaseVideoService
+	notificationService  NotificationService
+	moderator            CommentModerator
+}
+
+// CommentService maneja los comentarios de los videos y sus respuestas. El autor puede editarlos
+// y borrarlos, y el dueño del video puede borrarlos, fijarlos y revisar los retenidos.
+type CommentService interface {
+	CreateComment(userId string, videoId string, request *models.CommentRequest) (*models.Comment, error)
+	ListComments(videoId string, parentId string, sort string, cursor string, limit int) (*models.CommentPage, error)
+	UpdateComment(userId string, commentId string, body string) (*models.Comment, error)
+	DeleteComment(userId string, commentId string) error
+	SetPinned(userId string, commentId string, pinned bool) (*models.Comment, error)
+	ListHeldComments(userId string, videoId string, cursor string, limit int) (*models.CommentPage, error)
+	ReviewComment(userId string, commentId string, approve bool) (*models.Comment, error)
+	SetModerator(moderator CommentModerator)
+}
+
+func NewCommentService(databaseVideoService DatabaseVideoService, notificationService NotificationService) CommentService {
+	cfg := config.GetConfig()
+
+	return &commentService{
+		databaseVideoService: databaseVideoService,
+		notificationService:  notificationService,
+		moderator:            NewKeywordModerator(cfg.CommentBlocklist, cfg.CommentHoldForReview),
+	}
+}
+
+func (service *commentService) SetModerator(moderator CommentModerator) {
+	service.moderator = moderator
+}
+
+func (service *commentService) CreateComment(userId string, videoId string, request *models.CommentRequest) (*models.Comment, error) {
+	if _, err := service.databaseVideoService.FindVideoByID(videoId); err != nil {
+		return nil, err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	comment := models.Comment{
+		Id:      uuid.New().String(),
+		VideoID: videoId,
+		UserID:  userId,
+		Body:    strings.TrimSpace(request.Body),
+	}
+
+	var parent *models.Comment
+
+	if request.ParentID != "" {
+		parent, err = findComment(db, request.ParentID)
+		if errors.Is(err, ErrCommentNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidCommentParent, request.ParentID)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// solo un nivel de respuestas
+		if parent.VideoID != videoId || parent.ParentID != nil || parent.Status != models.CommentStatusVisible {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidCommentParent, request.ParentID)
+		}
+
+		comment.ParentID = &parent.Id
+	}
+
+	comment.Status, err = service.moderator.Moderate(&comment)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&comment).Error; err != nil {
+			return err
+		}
+
+		if comment.Status == models.CommentStatusVisible {
+			return addReplyCount(tx, comment.ParentID, 1)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if parent != nil && comment.Status == models.CommentStatusVisible {
+		service.notifyReply(&comment, parent)
+	}
+
+	return &comment, nil
+}
+
+// ListComments lista los comentarios principales del video, o las respuestas de parentId
+func (service *commentService) ListComments(videoId string, parentId string, sort string, cursor string, limit int) (*models.CommentPage, error) {
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	query := db.Where("video_id = ? AND status = ?", videoId, models.CommentStatusVisible)
+
+	if parentId == "" {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", parentId)
+	}
+
+	page := &models.CommentPage{}
+
+	// el comentario fijado va aparte, al inicio de la primera página
+	if parentId == "" {
+		if after == nil {
+			var pinned models.Comment
+			err := query.Session(&gorm.Session{}).Where("pinned = ?", true).First(&pinned).Error
+
+			if err == nil {
+				page.Pinned = &pinned
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, err
+			}
+		}
+
+		query = query.Where("pinned = ?", false)
+	}
+
+	if err := paginateComments(query, sort, after, limit, page); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+func (service *commentService) UpdateComment(userId string, commentId string, body string) (*models.Comment, error) {
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	comment, err := findComment(db, commentId)
+	if err != nil {
+		return nil, err
+	}
+
+	if comment.UserID != userId {
+		return nil, ErrCommentForbidden
+	}
+
+	previousStatus := comment.Status
+	now := time.Now()
+
+	comment.Body = strings.TrimSpace(body)
+	comment.EditedAt = &now
+
+	// al editar se vuelve a revisar, un comentario rechazado no se puede reactivar así
+	if comment.Status != models.CommentStatusRejected {
+		comment.Status, err = service.moderator.Moderate(comment)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(comment).Updates(map[string]interface{}{
+			"body":      comment.Body,
+			"edited_at": comment.EditedAt,
+			"status":    comment.Status,
+		}).Error
+
+		if err != nil {
+			return err
+		}
+
+		return updateReplyCountForStatus(tx, comment, previousStatus)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// DeleteComment lo puede borrar el autor o el dueño del video, si es un comentario
+// principal se borran también sus respuestas
+func (service *commentService) DeleteComment(userId string, commentId string) error {
+	db, err := config.GetDB()
+	if err != nil {
+		return err
+	}
+
+	comment, err := findComment(db, commentId)
+	if err != nil {
+		return err
+	}
+
+	if comment.UserID != userId {
+		if err := service.checkVideoOwner(userId, comment.VideoID); err != nil {
+			return err
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(comment).Error; err != nil {
+			return err
+		}
+
+		if comment.ParentID == nil {
+			return tx.Where("parent_id = ?", comment.Id).Delete(&models.Comment{}).Error
+		}
+
+		if comment.Status == models.CommentStatusVisible {
+			return addReplyCount(tx, comment.ParentID, -1)
+		}
+
+		return nil
+	})
+}
+
+// SetPinned fija o quita un comentario principal, solo puede haber uno fijado por video
+func (service *commentService) SetPinned(userId string, commentId string, pinned bool) (*models.Comment, error) {
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	comment, err := findComment(db, commentId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := service.checkVideoOwner(userId, comment.VideoID); err != nil {
+		return nil, err
+	}
+
+	if pinned && (comment.ParentID != nil || comment.Status != models.CommentStatusVisible) {
+		return nil, fmt.Errorf("%w: only visible top level comments can be pinned", ErrInvalidCommentParent)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if pinned {
+			err := tx.Model(&models.Comment{}).Where("video_id = ? AND pinned = ?", comment.VideoID, true).
+				Update("pinned", false).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(comment).Update("pinned", pinned).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	comment.Pinned = pinned
+	return comment, nil
+}
+
+// ListHeldComments son los comentarios retenidos para revisión, solo los ve el dueño del video
+func (service *commentService) ListHeldComments(userId string, videoId string, cursor string, limit int) (*models.CommentPage, error) {
+	if err := service.checkVideoOwner(userId, videoId); err != nil {
+		return nil, err
+	}
+
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.CommentPage{}
+	query := db.Where("video_id = ? AND status = ?", videoId, models.CommentStatusHeld)
+
+	if err := paginateComments(query, models.CommentSortNewest, after, limit, page); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// ReviewComment publica o rechaza un comentario retenido
+func (service *commentService) ReviewComment(userId string, commentId string, approve bool) (*models.Comment, error) {
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	comment, err := findComment(db, commentId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := service.checkVideoOwner(userId, comment.VideoID); err != nil {
+		return nil, err
+	}
+
+	previousStatus := comment.Status
+
+	comment.Status = models.CommentStatusRejected
+	if approve {
+		comment.Status = models.CommentStatusVisible
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(comment).Update("status", comment.Status).Error; err != nil {
+			return err
+		}
+
+		return updateReplyCountForStatus(tx, comment, previousStatus)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// la respuesta retenida se avisa recién cuando se aprueba
+	if approve && previousStatus != models.CommentStatusVisible && comment.ParentID != nil {
+		parent, err := findComment(db, *comment.ParentID)
+		if err == nil {
+			service.notifyReply(comment, parent)
+		}
+	}
+
+	return comment, nil
+}
+
+// notifyReply avisa al autor del comentario padre, si falla solo queda en el log
+func (service *commentService) notifyReply(reply *models.Comment, parent *models.Comment) {
+	if err := service.notificationService.NotifyCommentReply(reply, parent); err != nil {
+		log.Println("error al notificar la respuesta del comentario: ", err)
+	}
+}
+
+func (service *commentService) checkVideoOwner(userId string, videoId string) error {
+	video, err := service.databaseVideoService.FindVideoByID(videoId)
+	if err != nil {
+		return err
+	}
+
+	if video.UserID != userId {
+		return ErrCommentForbidden
+	}
+
+	return nil
+}
+
+func findComment(db *gorm.DB, commentId string) (*models.Comment, error) {
+	var comment models.Comment
+
+	err := db.Where("id = ?", commentId).First(&comment).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrCommentNotFound, commentId)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &comment, nil
+}
+
+// paginateComments ordena por fecha (newest) o por número de respuestas (top)
+func paginateComments(query *gorm.DB, sort string, after *pageCursor, limit int, page *models.CommentPage) error {
+	size := pageSize(limit)
+
+	if sort == models.CommentSortTop {
+		if after != nil {
+			query = query.Where("(reply_count, created_at, id) < (?, ?, ?)", after.Score, after.Time, after.Id)
+		}
+		query = query.Order("reply_count DESC, created_at DESC, id DESC")
+	} else {
+		if after != nil {
+			query = query.Where("(created_at, id) < (?, ?)", after.Time, after.Id)
+		}
+		query = query.Order("created_at DESC, id DESC")
+	}
+
+	var comments []models.Comment
+
+	// se pide uno más para saber si hay otra página
+	if err := query.Limit(size + 1).Find(&comments).Error; err != nil {
+		return err
+	}
+
+	if len(comments) > size {
+		comments = comments[:size]
+		last := comments[size-1]
+
+		if sort == models.CommentSortTop {
+			page.NextCursor = encodeScoredCursor(int64(last.ReplyCount), last.CreatedAt, last.Id)
+		} else {
+			page.NextCursor = encodeCursor(last.CreatedAt, last.Id)
+		}
+	}
+
+	page.Items = comments
+	if page.Items == nil {
+		page.Items = []models.Comment{}
+	}
+
+	return nil
+}
+
+// addReplyCount cuenta solo las respuestas visibles
+func addReplyCount(tx *gorm.DB, parentId *string, delta int) error {
+	if parentId == nil {
+		return nil
+	}
+
+	return tx.Model(&models.Comment{}).Where("id = ?", *parentId).
+		UpdateColumn("reply_count", gorm.Expr("reply_count + ?", delta)).Error
+}
+
+// updateReplyCountForStatus ajusta el contador del comentario padre si la respuesta
+// pasó a ser visible o dejó de serlo
+func updateReplyCountForStatus(tx *gorm.DB, comment *models.Comment, previousStatus string) error {
+	wasVisible := previousStatus == models.CommentStatusVisible
+	isVisible := comment.Status == models.CommentStatusVisible
+
+	switch {
+	case !wasVisible && isVisible:
+		return addReplyCount(tx, comment.ParentID, 1)
+	case wasVisible && !isVisible:
+		return addReplyCount(tx, comment.ParentID, -1)
+	}
+
+	return nil
+}
+
+func collectComments(db *gorm.DB, userId string) (interface{}, error) {
+	var comments []models.Comment
+
+	err := db.Where("user_id = ?", userId).Order("created_at").Find(&comments).Error
+
+	return comments, err
+}
@@ -0,0 +1,410 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/unbot2313/go-streaming-service/config"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"gorm.io/gorm"
+)
+
+var ErrExportNotFound = errors.New("export not found")
+
+// exportSection es un archivo json del ZIP, cada funcionalidad que guarda datos del usuario
+// agrega su sección a exportSections
+type exportSection struct {
+	FileName string
+	Collect  func(db *gorm.DB, userId string) (interface{}, error)
+}
+
+var exportSections = []exportSection{
+	{FileName: "profile.json", Collect: collectProfile},
+	{FileName: "videos.json", Collect: collectVideos},
+	{FileName: "video_tags.json", Collect: collectVideoTags},
+	{FileName: "view_history.json", Collect: collectViewHistory},
+	{FileName: "watch_history.json", Collect: collectWatchHistory},
+	{FileName: "reactions.json", Collect: collectReactions},
+	{FileName: "comments.json", Collect: collectComments},
+	{FileName: "subscriptions.json", Collect: collectSubscriptions},
+	{FileName: "notifications.json", Collect: collectNotifications},
+	{FileName: "moderation.json", Collect: collectModeration},
+	{FileName: "stream_keys.json", Collect: collectStreamKeys},
+	{FileName: "chat_messages.json", Collect: collectChatMessages},
+}
+
+// ExportNotifier avisa al usuario que su exportación terminó
+type ExportNotifier interface {
+	NotifyExportFinished(export *models.DataExport) error
+}
+
+// logExportNotifier solo deja el aviso en el log
+type logExportNotifier struct{}
+
+func (logExportNotifier) NotifyExportFinished(export *models.DataExport) error {
+	log.Printf("La exportación %s del usuario %s terminó con estado %s.\n", export.Id, export.UserID, export.Status)
+	return nil
+}
+
+type dataExportService struct {
+	videoService VideoService
+	notifier     ExportNotifier
+	queue        chan string
+}
+
+type DataExportService interface {
+	RequestExport(userId string, includeUploads bool) (*models.DataExport, error)
+	GetExport(userId string, exportId string) (*models.DataExport, error)
+	SetNotifier(notifier ExportNotifier)
+	Run(ctx context.Context)
+}
+
+func NewDataExportService(videoService VideoService) DataExportService {
+	return &dataExportService{
+		videoService: videoService,
+		notifier:     logExportNotifier{},
+		queue:        make(chan string, 100),
+	}
+}
+
+func (service *dataExportService) SetNotifier(notifier ExportNotifier) {
+	service.notifier = notifier
+}
+
+// RequestExport crea el trabajo y lo pone en la cola, si el usuario ya tiene uno
+// pendiente se devuelve ese
+func (service *dataExportService) RequestExport(userId string, includeUploads bool) (*models.DataExport, error) {
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var existing models.DataExport
+
+	err = db.Where("user_id = ? AND status IN ?", userId, []string{models.ExportStatusPending, models.ExportStatusProcessing}).
+		First(&existing).Error
+
+	if err == nil {
+		return &existing, nil
+	}
+
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	export := models.DataExport{
+		Id:             uuid.New().String(),
+		UserID:         userId,
+		IncludeUploads: includeUploads,
+		Status:         models.ExportStatusPending,
+	}
+
+	if err := db.Create(&export).Error; err != nil {
+		return nil, err
+	}
+
+	// si la cola está llena el trabajo se toma en la siguiente revisión de pendientes
+	select {
+	case service.queue <- export.Id:
+	default:
+	}
+
+	return &export, nil
+}
+
+func (service *dataExportService) GetExport(userId string, exportId string) (*models.DataExport, error) {
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var export models.DataExport
+
+	err = db.Where("id = ? AND user_id = ?", exportId, userId).First(&export).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrExportNotFound, exportId)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if export.Status == models.ExportStatusReady && export.ExpiresAt != nil {
+		remaining := time.Until(*export.ExpiresAt)
+
+		if remaining > 0 {
+			export.DownloadURL, err = service.videoService.PresignS3Object(export.ObjectKey, remaining)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &export, nil
+}
+
+// Run procesa los trabajos de la cola, y cada cierto tiempo retoma los pendientes
+// (ejm: los que quedaron a medias al reiniciar) y borra los archivos vencidos
+func (service *dataExportService) Run(ctx context.Context) {
+	ticker := time.NewTicker(config.GetConfig().ExportPollInterval)
+	defer ticker.Stop()
+
+	service.enqueuePending(true)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case exportId := <-service.queue:
+			service.process(exportId)
+		case <-ticker.C:
+			service.enqueuePending(false)
+			service.removeExpired()
+		}
+	}
+}
+
+func (service *dataExportService) enqueuePending(includeProcessing bool) {
+	db, err := config.GetDB()
+	if err != nil {
+		log.Println("error al buscar exportaciones pendientes: ", err)
+		return
+	}
+
+	statuses := []string{models.ExportStatusPending}
+	if includeProcessing {
+		statuses = append(statuses, models.ExportStatusProcessing)
+	}
+
+	var exports []models.DataExport
+	if err := db.Where("status IN ?", statuses).Order("created_at").Find(&exports).Error; err != nil {
+		log.Println("error al buscar exportaciones pendientes: ", err)
+		return
+	}
+
+	for _, export := range exports {
+		select {
+		case service.queue <- export.Id:
+		default:
+			return
+		}
+	}
+}
+
+func (service *dataExportService) process(exportId string) {
+	db, err := config.GetDB()
+	if err != nil {
+		log.Println("error al procesar la exportación: ", err)
+		return
+	}
+
+	var export models.DataExport
+	if err := db.Where("id = ?", exportId).First(&export).Error; err != nil {
+		log.Println("error al procesar la exportación: ", err)
+		return
+	}
+
+	// puede estar repetida en la cola
+	if export.Status == models.ExportStatusReady || export.Status == models.ExportStatusFailed {
+		return
+	}
+
+	db.Model(&export).Update("status", models.ExportStatusProcessing)
+
+	err = service.buildAndUpload(db, &export)
+
+	now := time.Now()
+	export.CompletedAt = &now
+
+	if err != nil {
+		log.Printf("error al generar la exportación %s: %v\n", export.Id, err)
+		export.Status = models.ExportStatusFailed
+		export.Error = err.Error()
+	} else {
+		expiresAt := now.Add(config.GetConfig().ExportLinkTTL)
+		export.Status = models.ExportStatusReady
+		export.ExpiresAt = &expiresAt
+	}
+
+	if err := db.Save(&export).Error; err != nil {
+		log.Println("error al guardar la exportación: ", err)
+		return
+	}
+
+	if err := service.notifier.NotifyExportFinished(&export); err != nil {
+		log.Println("error al notificar la exportación: ", err)
+	}
+}
+
+// buildAndUpload arma el ZIP en la carpeta temporal y lo sube a s3
+func (service *dataExportService) buildAndUpload(db *gorm.DB, export *models.DataExport) error {
+	// no se usa static/temp porque esa carpeta se sirve públicamente
+	zipPath := filepath.Join(os.TempDir(), "export_"+export.Id+".zip")
+	defer os.Remove(zipPath)
+
+	if err := service.writeArchive(db, export, zipPath); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(zipPath)
+	if err != nil {
+		return err
+	}
+
+	key := path.Join("exports", export.UserID, export.Id+".zip")
+
+	if _, err := service.videoService.UploadFileToS3(zipPath, key); err != nil {
+		return err
+	}
+
+	export.ObjectKey = key
+	export.SizeBytes = info.Size()
+
+	return nil
+}
+
+func (service *dataExportService) writeArchive(db *gorm.DB, export *models.DataExport, zipPath string) error {
+	file, err := os.Create(zipPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+
+	for _, section := range exportSections {
+		data, err := section.Collect(db, export.UserID)
+		if err != nil {
+			return fmt.Errorf("error al exportar %s: %w", section.FileName, err)
+		}
+
+		writer, err := archive.Create(section.FileName)
+		if err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(data); err != nil {
+			return err
+		}
+	}
+
+	if export.IncludeUploads {
+		if err := service.writeUploads(db, export.UserID, archive); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// writeUploads copia al ZIP el archivo original de cada video del usuario. Las grabaciones de
+// transmisiones no tienen original, ni los videos subidos antes de que se guardara
+func (service *dataExportService) writeUploads(db *gorm.DB, userId string, archive *zip.Writer) error {
+	var videos []models.VideoModel
+
+	if err := db.Where("user_id = ?", userId).Find(&videos).Error; err != nil {
+		return err
+	}
+
+	for _, video := range videos {
+		objects, err := service.videoService.ListObjects(context.TODO(), service.videoService.GetBucketName(), VideoS3Prefix(video.Id))
+		if err != nil {
+			return err
+		}
+
+		for _, object := range objects {
+			if !isOriginalS3Key(*object.Key) {
+				continue
+			}
+
+			if err := service.copyObject(archive, *object.Key, path.Join("uploads", video.Id, path.Base(*object.Key))); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (service *dataExportService) copyObject(archive *zip.Writer, key string, name string) error {
+	body, err := service.videoService.GetS3Object(key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	writer, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(writer, body)
+	return err
+}
+
+// removeExpired borra de s3 los archivos cuyo link ya venció
+func (service *dataExportService) removeExpired() {
+	db, err := config.GetDB()
+	if err != nil {
+		return
+	}
+
+	var exports []models.DataExport
+	err = db.Where("status = ? AND expires_at < ?", models.ExportStatusReady, time.Now()).Find(&exports).Error
+	if err != nil {
+		log.Println("error al buscar exportaciones vencidas: ", err)
+		return
+	}
+
+	for _, export := range exports {
+		if err := service.videoService.DeleteS3Folder(export.ObjectKey); err != nil {
+			log.Println("error al borrar la exportación vencida: ", err)
+			continue
+		}
+
+		db.Model(&export).Update("status", models.ExportStatusExpired)
+	}
+}
+
+func collectProfile(db *gorm.DB, userId string) (interface{}, error) {
+	var user models.User
+
+	if err := db.Where("id = ?", userId).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	var identities []models.UserIdentity
+	if err := db.Where("user_id = ?", userId).Find(&identities).Error; err != nil {
+		return nil, err
+	}
+
+	user.Password = ""
+	user.RefreshToken = ""
+
+	return gin.H{
+		"user":       user,
+		"identities": identities,
+	}, nil
+}
+
+func collectVideos(db *gorm.DB, userId string) (interface{}, error) {
+	var videos []models.VideoModel
+
+	err := db.Where("user_id = ?", userId).Order("created_at").Find(&videos).Error
+
+	return videos, err
+}
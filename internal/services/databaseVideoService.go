@@ -3,57 +3,81 @@ package services
 import (
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/unbot2313/go-streaming-service/config"
 	"github.com/unbot2313/go-streaming-service/internal/models"
 	"gorm.io/gorm"
 )
 
-func (service *databaseVideoService) FindLatestVideos() (*[]*models.VideoModel, error) {
+// ErrVideoNotFound se devuelve cuando el video buscado no existe
+var ErrVideoNotFound = errors.New("video not found")
+
+var ErrInvalidTags = errors.New("invalid tags")
+
+const (
+	maxTags      = 10
+	maxTagLength = 30
+)
+
+// FindLatestVideos lista los videos públicos del más nuevo al más antiguo, por páginas
+func (service *databaseVideoService) FindLatestVideos(cursor string, limit int) (*models.VideoPage, error) {
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
 	db, err := config.GetDB()
 	if err != nil {
 		return nil, err
 	}
 
-	var videos []*models.VideoModel
+	return paginateVideos(db.Scopes(publicVideos), after, limit)
+}
 
-	// Ordenar por CreatedAt en orden descendente
-	dbCtx := db.Order("created_at DESC").Find(&videos)
+// publicVideos es el filtro de los videos que se muestran en los listados públicos: los que
+// se pueden reproducir. Una transmisión terminada ya no tiene playlist y uno que se está
+// procesando todavía no, así que no se muestran
+func publicVideos(db *gorm.DB) *gorm.DB {
+	return db.Where("videos.deleted_at IS NULL AND videos.hidden_at IS NULL AND videos.state IN ?", playableVideoStates)
+}
 
-	if errors.Is(dbCtx.Error, gorm.ErrRecordNotFound) {
-		return nil, fmt.Errorf("no videos found")
-	}
+var playableVideoStates = []string{models.VideoStateReady, models.VideoStateLive}
 
-	if dbCtx.Error != nil {
-		return nil, dbCtx.Error
-	}
+// paginateVideos ordena por fecha de creación, la siguiente página empieza después de after
+func paginateVideos(query *gorm.DB, after *pageCursor, limit int) (*models.VideoPage, error) {
+	size := pageSize(limit)
 
-	return &videos, nil
-}
+	if after != nil {
+		query = query.Where("(videos.created_at, videos.id) < (?, ?)", after.Time, after.Id)
+	}
 
-func (service *databaseVideoService) FindVideoByID(videoId string) (*models.VideoModel, error) {
-	db, err := config.GetDB()
+	var videos []models.VideoModel
 
+	// se pide uno más para saber si hay otra página
+	err := query.Order("videos.created_at DESC, videos.id DESC").Limit(size + 1).Find(&videos).Error
 	if err != nil {
 		return nil, err
 	}
 
-	var video models.VideoModel
+	page := &models.VideoPage{Items: videos}
 
-	dbCtx := db.Where("id = ?", videoId).First(&video)
-
-	if errors.Is(dbCtx.Error, gorm.ErrRecordNotFound) {
-		return nil, fmt.Errorf("video with id %s not found", videoId)
+	if len(videos) > size {
+		page.Items = videos[:size]
+		last := page.Items[size-1]
+		page.NextCursor = encodeCursor(last.CreatedAt, last.Id)
 	}
 
-	if dbCtx.Error != nil {
-		return nil, dbCtx.Error
+	if page.Items == nil {
+		page.Items = []models.VideoModel{}
 	}
 
-	return &video, nil
+	return page, nil
 }
 
-func (service *databaseVideoService) IncrementViews(videoId string) (*models.VideoModel, error) {
+func (service *databaseVideoService) FindVideoByID(videoId string) (*models.VideoModel, error) {
 	db, err := config.GetDB()
 
 	if err != nil {
@@ -65,22 +89,37 @@ func (service *databaseVideoService) IncrementViews(videoId string) (*models.Vid
 	dbCtx := db.Where("id = ?", videoId).First(&video)
 
 	if errors.Is(dbCtx.Error, gorm.ErrRecordNotFound) {
-		return nil, fmt.Errorf("video with id %s not found", videoId)
+		return nil, fmt.Errorf("%w: id %s", ErrVideoNotFound, videoId)
 	}
 
 	if dbCtx.Error != nil {
 		return nil, dbCtx.Error
 	}
 
-	video.Views++
+	return &video, nil
+}
 
-	dbCtx = db.Save(&video)
+// AddViews suma las vistas acumuladas de cada video con un UPDATE atómico,
+// sin leer ni guardar el resto de la fila
+func (service *databaseVideoService) AddViews(counts map[string]uint) error {
+	db, err := config.GetDB()
 
-	if dbCtx.Error != nil {
-		return nil, dbCtx.Error
+	if err != nil {
+		return err
 	}
 
-	return &video, nil
+	return db.Transaction(func(tx *gorm.DB) error {
+		for videoId, count := range counts {
+			dbCtx := tx.Model(&models.VideoModel{}).Where("id = ?", videoId).
+				UpdateColumn("views", gorm.Expr("views + ?", count))
+
+			if dbCtx.Error != nil {
+				return dbCtx.Error
+			}
+		}
+
+		return nil
+	})
 }
 
 func (service *databaseVideoService) FindUserVideos(userId string) ([]*models.VideoModel, error) {
@@ -113,8 +152,15 @@ func (service *databaseVideoService) CreateVideo(videoData *models.Video, userId
 		Description: videoData.Description,
 		UserID: userId,
 		VideoUrl: videoData.M3u8FileURL,
-		Duration: videoData.Duration,
+		DurationSeconds: videoData.DurationSeconds,
 		ThumbnailURL: videoData.ThumbnailURL,
+		SourceVideoID: videoData.SourceVideoID,
+		State: videoData.State,
+	}
+
+	if videoData.EncodingProfile != nil {
+		Video.EncodingProfile = videoData.EncodingProfile.Name
+		Video.EncodingSettings = videoData.EncodingProfile
 	}
 	
 	db, err := config.GetDB()
@@ -123,19 +169,208 @@ func (service *databaseVideoService) CreateVideo(videoData *models.Video, userId
 		return nil, err
 	}
 
-	dbCtx := db.Create(&Video)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&Video).Error; err != nil {
+			return err
+		}
+
+		if videoData.Metadata != nil {
+			videoData.Metadata.VideoID = Video.Id
+			if err := tx.Create(videoData.Metadata).Error; err != nil {
+				return err
+			}
+		}
+
+		return createVideoTags(tx, Video.Id, videoData.Tags)
+	})
 
-	if errors.Is(dbCtx.Error, gorm.ErrDuplicatedKey) {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
 		return nil, fmt.Errorf("ya hay un video con el id %s", videoData.Id)
 	}
 
-	if dbCtx.Error != nil {
-		return nil, dbCtx.Error
+	if err != nil {
+		return nil, err
 	}
 	
 	return &Video, nil
 }
 
+// FindVideoMetadata devuelve lo que leyó ffprobe al subir el video, nil si no tiene (las grabaciones de transmisiones)
+func (service *databaseVideoService) FindVideoMetadata(videoId string) (*models.VideoMetadata, error) {
+	db, err := config.GetDB()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata models.VideoMetadata
+
+	err = db.Where("video_id = ?", videoId).First(&metadata).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &metadata, nil
+}
+
+// FindVideoTags devuelve las etiquetas del video en orden alfabético
+func (service *databaseVideoService) FindVideoTags(videoId string) ([]string, error) {
+	db, err := config.GetDB()
+
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []string{}
+
+	err = db.Model(&models.VideoTag{}).Where("video_id = ?", videoId).Order("tag").Pluck("tag", &tags).Error
+
+	return tags, err
+}
+
+// SetVideoTags reemplaza todas las etiquetas del video
+func (service *databaseVideoService) SetVideoTags(videoId string, tags []string) ([]string, error) {
+	tags, err := NormalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := config.GetDB()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("video_id = ?", videoId).Delete(&models.VideoTag{}).Error; err != nil {
+			return err
+		}
+
+		return createVideoTags(tx, videoId, tags)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// NormalizeTags deja las etiquetas en minúsculas, sin espacios a los lados, sin vacías
+// ni repetidas y en orden alfabético
+func NormalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+
+		if tag == "" {
+			continue
+		}
+
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, fmt.Errorf("%w: %s is longer than %d characters", ErrInvalidTags, tag, maxTagLength)
+		}
+
+		normalized = append(normalized, tag)
+	}
+
+	slices.Sort(normalized)
+	normalized = slices.Compact(normalized)
+
+	if len(normalized) > maxTags {
+		return nil, fmt.Errorf("%w: at most %d tags", ErrInvalidTags, maxTags)
+	}
+
+	return normalized, nil
+}
+
+func createVideoTags(tx *gorm.DB, videoId string, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	videoTags := make([]models.VideoTag, len(tags))
+	for i, tag := range tags {
+		videoTags[i] = models.VideoTag{VideoID: videoId, Tag: tag}
+	}
+
+	return tx.Create(&videoTags).Error
+}
+
+// FinishVideoProcessing guarda el estado final de un video subido con las urls de lo que se subió a s3
+func (service *databaseVideoService) FinishVideoProcessing(videoData *models.Video) (*models.VideoModel, error) {
+	db, err := config.GetDB()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var video models.VideoModel
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.VideoModel{}).Where("id = ?", videoData.Id).Updates(map[string]interface{}{
+			"state":         videoData.State,
+			"video_url":     videoData.M3u8FileURL,
+			"thumbnail_url": videoData.ThumbnailURL,
+		}).Error
+
+		if err != nil {
+			return err
+		}
+
+		return tx.Where("id = ?", videoData.Id).First(&video).Error
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: id %s", ErrVideoNotFound, videoData.Id)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &video, nil
+}
+
+// SaveProcessingJob crea o actualiza el avance del procesamiento de un video
+func (service *databaseVideoService) SaveProcessingJob(job *models.ProcessingJob) error {
+	db, err := config.GetDB()
+
+	if err != nil {
+		return err
+	}
+
+	return db.Save(job).Error
+}
+
+func (service *databaseVideoService) FindProcessingJob(videoId string) (*models.ProcessingJob, error) {
+	db, err := config.GetDB()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var job models.ProcessingJob
+
+	dbCtx := db.Where("video_id = ?", videoId).First(&job)
+
+	if errors.Is(dbCtx.Error, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: video %s", ErrProcessingJobNotFound, videoId)
+	}
+
+	if dbCtx.Error != nil {
+		return nil, dbCtx.Error
+	}
+
+	return &job, nil
+}
+
 func (service *databaseVideoService) UpdateVideo(video *models.VideoModel) (*models.VideoModel, error) {
 	return &models.VideoModel{}, nil
 }
@@ -148,11 +383,17 @@ func (service *databaseVideoService) DeleteVideo(videoId string) error {
 type databaseVideoService struct {}
 
 type DatabaseVideoService interface {
-	FindLatestVideos() (*[]*models.VideoModel, error)
+	FindLatestVideos(cursor string, limit int) (*models.VideoPage, error)
 	FindVideoByID(videoId string) (*models.VideoModel, error) 
-	IncrementViews(videoId string) (*models.VideoModel, error)
+	FindVideoTags(videoId string) ([]string, error)
+	FindVideoMetadata(videoId string) (*models.VideoMetadata, error)
+	SetVideoTags(videoId string, tags []string) ([]string, error)
+	AddViews(counts map[string]uint) error
 	FindUserVideos(userId string) ([]*models.VideoModel, error)
 	CreateVideo(video *models.Video, userId string) (*models.VideoModel, error)
+	FinishVideoProcessing(videoData *models.Video) (*models.VideoModel, error)
+	SaveProcessingJob(job *models.ProcessingJob) error
+	FindProcessingJob(videoId string) (*models.ProcessingJob, error)
 	UpdateVideo(video *models.VideoModel) (*models.VideoModel, error)
 	DeleteVideo(videoId string) error
 }
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/unbot2313/go-streaming-service/config"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+)
+
+var ErrUnknownEncodingProfile = errors.New("unknown encoding profile")
+
+var ErrEncodingProfileNotAllowed = errors.New("encoding profile not allowed for this account")
+
+// EncodingProfileFor devuelve el perfil con ese nombre si el rol puede usarlo, sin nombre
+// devuelve el perfil por defecto
+func EncodingProfileFor(name string, role string) (*models.EncodingProfile, error) {
+	cfg := config.GetConfig()
+
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = cfg.DefaultEncodingProfile
+	}
+
+	settings, ok := cfg.EncodingProfiles[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEncodingProfile, name)
+	}
+
+	profile := encodingProfileFromConfig(settings)
+
+	if !canUseEncodingProfile(profile, role) {
+		return nil, fmt.Errorf("%w: %s", ErrEncodingProfileNotAllowed, name)
+	}
+
+	return &profile, nil
+}
+
+// AvailableEncodingProfiles lista los perfiles que puede usar el rol, ordenados por nombre
+func AvailableEncodingProfiles(role string) []models.EncodingProfile {
+	profiles := []models.EncodingProfile{}
+
+	for _, settings := range config.GetConfig().EncodingProfiles {
+		if profile := encodingProfileFromConfig(settings); canUseEncodingProfile(profile, role) {
+			profiles = append(profiles, profile)
+		}
+	}
+
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+
+	return profiles
+}
+
+// encodingProfileFromConfig pasa un perfil de la configuración al modelo que se guarda con el video
+func encodingProfileFromConfig(settings config.EncodingProfileConfig) models.EncodingProfile {
+	return models.EncodingProfile{
+		Name:           settings.Name,
+		VideoCodec:     settings.VideoCodec,
+		CRF:            settings.CRF,
+		VideoBitrate:   settings.VideoBitrate,
+		Preset:         settings.Preset,
+		GOP:            settings.GOP,
+		Height:         settings.Height,
+		SegmentSeconds: settings.SegmentSeconds,
+		AudioCodec:     settings.AudioCodec,
+		AudioBitrate:   settings.AudioBitrate,
+		AudioChannels:  settings.AudioChannels,
+		Roles:          slices.Clone(settings.Roles),
+	}
+}
+
+func canUseEncodingProfile(profile models.EncodingProfile, role string) bool {
+	return len(profile.Roles) == 0 || slices.Contains(profile.Roles, role)
+}
+
+// encodingArgs arma los argumentos de ffmpeg para pasar el video a HLS con el perfil
+func encodingArgs(profile *models.EncodingProfile, input string, output string) []string {
+	args := []string{"-i", input}
+
+	if profile.VideoCodec == "copy" {
+		args = append(args, "-c:v", "copy")
+	} else {
+		args = append(args, "-c:v", profile.VideoCodec)
+
+		if profile.Preset != "" {
+			args = append(args, "-preset", profile.Preset)
+		}
+
+		if profile.VideoBitrate != "" {
+			args = append(args, "-b:v", profile.VideoBitrate)
+		} else if profile.CRF > 0 {
+			args = append(args, "-crf", strconv.Itoa(profile.CRF))
+		}
+
+		// keyframes fijos para que los segmentos corten parejo
+		if profile.GOP > 0 {
+			gop := strconv.Itoa(profile.GOP)
+			args = append(args, "-g", gop, "-keyint_min", gop, "-sc_threshold", "0")
+		}
+
+		if profile.Height > 0 {
+			args = append(args, "-vf", "scale=-2:"+strconv.Itoa(profile.Height))
+		}
+	}
+
+	args = append(args, "-c:a", profile.AudioCodec)
+
+	if profile.AudioCodec != "copy" {
+		if profile.AudioBitrate != "" {
+			args = append(args, "-b:a", profile.AudioBitrate)
+		}
+
+		if profile.AudioChannels > 0 {
+			args = append(args, "-ac", strconv.Itoa(profile.AudioChannels))
+		}
+	}
+
+	return append(args,
+		"-start_number", "0",
+		"-hls_time", strconv.Itoa(profile.SegmentSeconds),
+		"-hls_list_size", "0",
+		"-f", "hls", output)
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandContextKillsChildren(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// como ffmpeg con sus procesos hijos: el shell lanza un sleep y espera
+	cmd := commandContext(ctx, "sh", "-c", "sleep 60 & echo $!; wait")
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+
+	started := time.Now()
+	if err := cmd.Wait(); err == nil {
+		t.Error("Wait should fail after cancelling")
+	}
+	if elapsed := time.Since(started); elapsed > commandWaitDelay {
+		t.Errorf("Wait took %v", elapsed)
+	}
+
+	// el hijo puede quedar como zombie hasta que init lo recoja, pero ya no corre
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		stat, err := os.ReadFile("/proc/" + strconv.Itoa(child) + "/stat")
+		if err != nil || strings.Contains(string(stat), ") Z ") {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("child %d is still running: %s", child, stat)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package services
+
+import (
+	"context"
+	"os/exec"
+)
+
+// commandContext es exec.CommandContext, sin grupos de procesos solo se mata el comando
+func commandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.WaitDelay = commandWaitDelay
+
+	return cmd
+}
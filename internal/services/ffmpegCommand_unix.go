@@ -0,0 +1,22 @@
+//go:build unix
+
+package services
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+)
+
+// commandContext es exec.CommandContext pero el comando corre en su propio grupo de procesos,
+// al cancelar el contexto se mata el grupo entero con los procesos que haya lanzado ffmpeg
+func commandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = commandWaitDelay
+
+	return cmd
+}
@@ -0,0 +1,118 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"github.com/unbot2313/go-streaming-service/internal/services"
+	"github.com/unbot2313/go-streaming-service/internal/services/servicestest"
+)
+
+// chdirTemp cambia a una carpeta vacía, las rutas de los videos son relativas al directorio actual
+func chdirTemp(t *testing.T) {
+	t.Helper()
+
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.Chdir(previous) })
+}
+
+func TestFormatVideoWritesPlaylistWithProfileSegments(t *testing.T) {
+	chdirTemp(t)
+
+	if err := os.MkdirAll("static/videos", os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("static/videos/abc_clip.mp4", []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	transcoder := &servicestest.FakeTranscoder{DurationSeconds: 9}
+	service := services.NewVideoService(services.S3Configuration{}, services.NewFilesService(), transcoder, transcoder)
+
+	profile, _ := services.EncodingProfileFor("hd", models.RoleAdmin)
+
+	var reported []float64
+
+	folder, err := service.FormatVideo(context.Background(), "abc_clip.mp4", profile, func(seconds float64) {
+		reported = append(reported, seconds)
+	})
+	if err != nil {
+		t.Fatalf("FormatVideo: %v", err)
+	}
+
+	if folder != "./static/temp/abc_clip" {
+		t.Errorf("folder = %q", folder)
+	}
+
+	playlist, err := os.ReadFile(filepath.Join(folder, "output.m3u8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 9 segundos en segmentos de 4: 4 + 4 + 1
+	if got := strings.Count(string(playlist), "#EXTINF:"); got != 3 {
+		t.Errorf("segments = %d, want 3\n%s", got, playlist)
+	}
+	if !strings.Contains(string(playlist), "#EXTINF:1.000000,\noutput2.ts") {
+		t.Errorf("last segment should last 1s\n%s", playlist)
+	}
+
+	if got := transcoder.Profiles(); len(got) != 1 || got[0].Name != "hd" {
+		t.Errorf("profiles = %v, want [hd]", got)
+	}
+
+	if !slices.Equal(reported, []float64{4, 8, 9}) {
+		t.Errorf("progress = %v, want [4 8 9]", reported)
+	}
+}
+
+func TestFormatVideoReturnsTranscoderError(t *testing.T) {
+	chdirTemp(t)
+
+	transcoder := &servicestest.FakeTranscoder{Err: errors.New("ffmpeg failed")}
+	service := services.NewVideoService(services.S3Configuration{}, services.NewFilesService(), transcoder, transcoder)
+
+	profile, _ := services.EncodingProfileFor("", models.RoleUser)
+
+	if _, err := service.FormatVideo(context.Background(), "missing.mp4", profile, nil); err == nil || err.Error() != "ffmpeg failed" {
+		t.Errorf("err = %v, want the transcoder error", err)
+	}
+}
+
+func TestSaveThumbnail(t *testing.T) {
+	folder := t.TempDir()
+	video := filepath.Join(folder, "video.mp4")
+	if err := os.WriteFile(video, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	transcoder := &servicestest.FakeTranscoder{DurationSeconds: 10}
+	service := services.NewVideoService(services.S3Configuration{}, services.NewFilesService(), transcoder, transcoder)
+
+	thumbnail, err := service.SaveThumbnail(context.Background(), video, folder)
+	if err != nil {
+		t.Fatalf("SaveThumbnail: %v", err)
+	}
+
+	if thumbnail != filepath.Join(folder, "thumbnail.webp") {
+		t.Errorf("thumbnail = %q", thumbnail)
+	}
+
+	if _, err := os.Stat(thumbnail); err != nil {
+		t.Errorf("thumbnail not written: %v", err)
+	}
+}
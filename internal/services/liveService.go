@@ -0,0 +1,523 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/unbot2313/go-streaming-service/config"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+)
+
+var ErrAlreadyLive = errors.New("channel is already live")
+
+var ErrBitrateExceeded = errors.New("stream bitrate exceeds the stream key limit")
+
+const (
+	// aplicación de RTMP en la que publican los encoders, ejm: rtmp://host:1935/live
+	liveAppName = "live"
+	// carpeta de los playlist en vivo, dentro de la que se sirve en /static
+	liveHLSPath = "static/temp/live"
+	// carpeta de las grabaciones mientras dura la transmisión, no se sirve
+	liveRecordingPath = "static/recordings"
+	// título de las transmisiones cuando la clave no tiene uno
+	defaultLiveTitleTemplate = "{username} live"
+	maxLiveTitleLength       = 100
+
+	// el bitrate se mide en promedio sobre esta ventana, con un margen sobre el límite
+	// porque los keyframes lo suben por momentos
+	bitrateWindow    = 10 * time.Second
+	bitrateTolerance = 1.25
+)
+
+type liveService struct {
+	userService          UserService
+	videoService         VideoService
+	databaseVideoService DatabaseVideoService
+	notificationService  NotificationService
+	chatService          ChatService
+	filesService         FilesService
+	transcoder           Transcoder
+
+	mu sync.Mutex
+	// transmisiones activas por usuario
+	broadcasts map[string]*broadcast
+}
+
+// LiveService maneja las transmisiones en vivo: la conversión del stream RTMP a un playlist
+// HLS en vivo con ffmpeg y la grabación que queda como video normal cuando termina. Las
+// claves con las que se publica las maneja UserService.
+type LiveService interface {
+	ListLive(cursor string, limit int) (*models.VideoPage, error)
+	Publish(app, streamKey string) (io.WriteCloser, error)
+	RecoverBroadcasts() error
+	LowLatencyPlaylist(ctx context.Context, videoId string, msn int, part int) (string, error)
+	LowLatencyFile(ctx context.Context, videoId string, name string) ([]byte, error)
+}
+
+func NewLiveService(userService UserService, videoService VideoService, databaseVideoService DatabaseVideoService, notificationService NotificationService, chatService ChatService, transcoder Transcoder) LiveService {
+	return &liveService{
+		userService:          userService,
+		videoService:         videoService,
+		databaseVideoService: databaseVideoService,
+		notificationService:  notificationService,
+		chatService:          chatService,
+		filesService:         videoService.GetFilesService(),
+		transcoder:           transcoder,
+		broadcasts:           make(map[string]*broadcast),
+	}
+}
+
+// ListLive lista las transmisiones en vivo de la más nueva a la más antigua, por páginas
+func (service *liveService) ListLive(cursor string, limit int) (*models.VideoPage, error) {
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	return paginateVideos(db.Scopes(publicVideos).Where("videos.state = ?", models.VideoStateLive), after, limit)
+}
+
+// Publish valida la clave, crea el video en vivo y arranca ffmpeg. Lo que se escribe en el
+// writer (FLV) sale como playlist HLS, al cerrarlo termina la transmisión.
+func (service *liveService) Publish(app, streamKey string) (io.WriteCloser, error) {
+	if app != liveAppName {
+		return nil, ErrInvalidStreamKey
+	}
+
+	user, key, err := service.userService.AuthenticateStreamKey(streamKey)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	if _, ok := service.broadcasts[user.Id]; ok {
+		return nil, fmt.Errorf("%w: user %s", ErrAlreadyLive, user.Id)
+	}
+
+	now := time.Now()
+	videoId := uuid.New().String()
+
+	video := models.VideoModel{
+		Id:       videoId,
+		Title:    renderLiveTitle(key.TitleTemplate, user, now),
+		UserID:   user.Id,
+		VideoUrl: liveVideoURL(videoId, key.LowLatency),
+		State:    models.VideoStateLive,
+	}
+
+	if err := db.Create(&video).Error; err != nil {
+		return nil, err
+	}
+
+	record := config.GetConfig().LiveRecordingEnabled && key.Record
+
+	live, err := service.startFFmpeg(video, record, key.LowLatency)
+	if err != nil {
+		service.endBroadcast(video.Id, now)
+		return nil, err
+	}
+	live.maxBitrateKbps = key.MaxBitrateKbps
+
+	service.broadcasts[user.Id] = live
+	log.Printf("Empezó la transmisión %s del usuario %s.\n", video.Id, user.Id)
+
+	return live, nil
+}
+
+// startFFmpeg arranca ffmpeg leyendo el FLV que le pasa el servidor RTMP, ver liveArgs
+func (service *liveService) startFFmpeg(video models.VideoModel, record bool, lowLatency bool) (*broadcast, error) {
+	cfg := config.GetConfig()
+	live := &broadcast{
+		service:    service,
+		video:      video,
+		folder:     path.Join(liveHLSPath, video.Id),
+		startedAt:  time.Now(),
+		lowLatency: lowLatency,
+	}
+
+	if err := service.filesService.CreateFolder(live.folder); err != nil {
+		return nil, err
+	}
+
+	options := &LiveOptions{
+		Folder:          live.folder,
+		SegmentSeconds:  cfg.LiveHLSSegmentSeconds,
+		ListSize:        liveHLSListSize(),
+		LowLatency:      lowLatency,
+		PartDuration:    cfg.LiveLLPartDuration,
+		PartsPerSegment: partsPerSegment(),
+		Preset:          cfg.LiveLLPreset,
+	}
+
+	if record {
+		live.recordingFolder = path.Join(liveRecordingPath, video.Id)
+		if err := service.filesService.CreateFolder(live.recordingFolder); err != nil {
+			service.filesService.RemoveFolder(live.folder)
+			return nil, err
+		}
+		options.RecordingFolder = live.recordingFolder
+	}
+
+	input, err := service.transcoder.Live(options)
+	if err != nil {
+		service.filesService.RemoveFolder(live.folder)
+		if live.recordingFolder != "" {
+			service.filesService.RemoveFolder(live.recordingFolder)
+		}
+		return nil, err
+	}
+	live.input = input
+
+	return live, nil
+}
+
+// liveArgs arma los argumentos de ffmpeg para una transmisión: lee el FLV por stdin y copia el
+// audio y el video sin recodificar. El playlist en vivo solo guarda los segmentos de la ventana
+// DVR; si se graba, una segunda salida guarda todos los segmentos para el video que queda al
+// terminar. En baja latencia se recodifica con un keyframe por parte y se escriben las partes
+// en fMP4, el playlist LL-HLS lo arma el servidor con ellas (ver lowLatencyHLS.go).
+func liveArgs(options *LiveOptions) []string {
+	segmentSeconds := strconv.Itoa(options.SegmentSeconds)
+	liveOptions := [][2]string{
+		{"hls_time", segmentSeconds},
+		{"hls_list_size", strconv.Itoa(options.ListSize)},
+		{"hls_flags", "delete_segments"},
+	}
+	livePlaylist := path.Join(options.Folder, "index.m3u8")
+
+	args := []string{"-loglevel", "error", "-f", "flv", "-i", "pipe:0", "-map", "0"}
+
+	if options.LowLatency {
+		partSeconds := formatSeconds(options.PartDuration.Seconds())
+		liveOptions = [][2]string{
+			{"hls_time", partSeconds},
+			{"hls_list_size", strconv.Itoa(options.ListSize * options.PartsPerSegment)},
+			{"hls_segment_type", "fmp4"},
+			{"hls_fmp4_init_filename", lowLatencyInitFile},
+			{"hls_segment_filename", path.Join(options.Folder, "part%d.m4s")},
+			// temp_file para que una parte aparezca recién cuando está completa
+			{"hls_flags", "delete_segments+temp_file+independent_segments"},
+		}
+		livePlaylist = path.Join(options.Folder, lowLatencyPartsPlaylist)
+
+		args = append(args,
+			"-c:v", "libx264", "-preset", options.Preset, "-tune", "zerolatency",
+			"-force_key_frames", "expr:gte(t,n_forced*"+partSeconds+")", "-sc_threshold", "0",
+			"-c:a", "aac")
+	} else {
+		args = append(args, "-c", "copy")
+	}
+
+	if options.RecordingFolder != "" {
+		// el muxer tee escribe las dos salidas con los mismos paquetes
+		recordingOptions := "hls_time=" + segmentSeconds + ":hls_list_size=0:hls_playlist_type=event"
+		teeOptions := make([]string, 0, len(liveOptions))
+		for _, option := range liveOptions {
+			teeOptions = append(teeOptions, option[0]+"="+option[1])
+		}
+
+		return append(args, "-f", "tee",
+			"[f=hls:"+strings.Join(teeOptions, ":")+"]"+livePlaylist+"|[f=hls:"+recordingOptions+"]"+path.Join(options.RecordingFolder, "output.m3u8"))
+	}
+
+	args = append(args, "-f", "hls")
+	for _, option := range liveOptions {
+		args = append(args, "-"+option[0], option[1])
+	}
+	return append(args, livePlaylist)
+}
+
+// renderLiveTitle arma el título de la transmisión con la plantilla de la clave
+func renderLiveTitle(template string, user *models.User, startedAt time.Time) string {
+	if strings.TrimSpace(template) == "" {
+		template = defaultLiveTitleTemplate
+	}
+
+	displayName := user.DisplayName
+	if displayName == "" {
+		displayName = user.Username
+	}
+
+	title := strings.NewReplacer(
+		"{username}", user.Username,
+		"{display_name}", displayName,
+		"{date}", startedAt.Format("2006-01-02"),
+	).Replace(template)
+
+	if runes := []rune(title); len(runes) > maxLiveTitleLength {
+		title = string(runes[:maxLiveTitleLength])
+	}
+
+	return title
+}
+
+// liveHLSListSize es la cantidad de segmentos del playlist en vivo, alcanza para la ventana
+// DVR si está configurada y nunca es menor que LIVE_HLS_LIST_SIZE
+func liveHLSListSize() int {
+	cfg := config.GetConfig()
+	listSize := cfg.LiveHLSListSize
+
+	if cfg.LiveDVRWindow > 0 && cfg.LiveHLSSegmentSeconds > 0 {
+		dvrSegments := int(math.Ceil(cfg.LiveDVRWindow.Seconds() / float64(cfg.LiveHLSSegmentSeconds)))
+		listSize = max(listSize, dvrSegments)
+	}
+
+	return listSize
+}
+
+// endBroadcast marca el video como terminado con la duración que tuvo la transmisión
+func (service *liveService) endBroadcast(videoId string, startedAt time.Time) error {
+	db, err := config.GetDB()
+	if err != nil {
+		return err
+	}
+
+	return db.Model(&models.VideoModel{}).Where("id = ?", videoId).Updates(map[string]interface{}{
+		"state":            models.VideoStateEnded,
+		"duration_seconds": time.Since(startedAt).Seconds(),
+	}).Error
+}
+
+// RecoverBroadcasts termina las transmisiones que quedaron en vivo si el servidor se cayó,
+// publica lo que alcanzaron a grabar y borra sus playlist. Se llama al iniciar, antes de
+// aceptar publicaciones.
+func (service *liveService) RecoverBroadcasts() error {
+	db, err := config.GetDB()
+	if err != nil {
+		return err
+	}
+
+	var staleVideos []models.VideoModel
+
+	if err := db.Where("state = ?", models.VideoStateLive).Find(&staleVideos).Error; err != nil {
+		return err
+	}
+
+	if len(staleVideos) > 0 {
+		err := db.Model(&models.VideoModel{}).Where("state = ?", models.VideoStateLive).
+			Update("state", models.VideoStateEnded).Error
+
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Se terminaron %d transmisiones que quedaron en vivo.\n", len(staleVideos))
+	}
+
+	for _, video := range staleVideos {
+		recordingFolder := path.Join(liveRecordingPath, video.Id)
+		if _, err := os.Stat(recordingFolder); err == nil {
+			go service.publishRecording(video, recordingFolder)
+		}
+	}
+
+	return service.filesService.RemoveFolder(liveHLSPath)
+}
+
+// publishRecording cierra el playlist de la grabación y la sube como un video normal, con el
+// mismo camino que los videos subidos: carpeta <id>_<nombre>, miniatura, s3 y CreateVideo
+func (service *liveService) publishRecording(live models.VideoModel, recordingFolder string) {
+	defer service.filesService.RemoveFolder(recordingFolder)
+
+	playlist := path.Join(recordingFolder, "output.m3u8")
+
+	seconds, err := finalizeRecordingPlaylist(playlist)
+	if err != nil {
+		log.Printf("no se pudo cerrar la grabación de la transmisión %s: %v\n", live.Id, err)
+		return
+	}
+
+	if seconds == 0 {
+		log.Printf("La transmisión %s no tiene nada grabado.\n", live.Id)
+		return
+	}
+
+	videoData := &models.Video{
+		Id:              uuid.New().String(),
+		Title:           live.Title,
+		Description:     live.Description,
+		DurationSeconds: seconds,
+		SourceVideoID:   live.Id,
+	}
+
+	// la carpeta se llama como las de los videos subidos para que quede con el mismo prefijo en s3
+	filesPath := path.Join(liveRecordingPath, VideoS3Prefix(videoData.Id)+"live")
+	if err := os.Rename(recordingFolder, filesPath); err != nil {
+		log.Printf("no se pudo preparar la grabación de la transmisión %s: %v\n", live.Id, err)
+		return
+	}
+	defer service.filesService.RemoveFolder(filesPath)
+
+	thumbnailCtx, cancel := stageContext(context.Background(), config.GetConfig().ProcessingThumbnailTimeout)
+	defer cancel()
+
+	if _, err := service.videoService.SaveThumbnail(thumbnailCtx, path.Join(filesPath, "output.m3u8"), filesPath); err != nil {
+		// sin miniatura la grabación igual se publica
+		log.Printf("no se pudo generar la miniatura de la grabación %s: %v\n", videoData.Id, err)
+	}
+
+	savedDataInS3, baseFolder, err := service.videoService.UploadFilesFromFolderToS3(context.Background(), filesPath)
+	if err != nil {
+		log.Printf("no se pudo subir la grabación de la transmisión %s: %v\n", live.Id, err)
+		return
+	}
+
+	videoData.M3u8FileURL = savedDataInS3.M3u8FileURL
+	videoData.ThumbnailURL = savedDataInS3.ThumbnailURL
+
+	video, err := service.databaseVideoService.CreateVideo(videoData, live.UserID)
+	if err != nil {
+		service.videoService.DeleteS3Folder(baseFolder + "/")
+		log.Printf("no se pudo guardar la grabación de la transmisión %s: %v\n", live.Id, err)
+		return
+	}
+
+	if err := service.notificationService.NotifyVideoPublished(video); err != nil {
+		log.Println("error al notificar el nuevo video: ", err)
+	}
+
+	log.Printf("La grabación de la transmisión %s quedó como el video %s.\n", live.Id, video.Id)
+}
+
+// finalizeRecordingPlaylist deja el playlist de la grabación como VOD con EXT-X-ENDLIST (ffmpeg
+// no lo agrega si se cortó) y devuelve la duración total de los segmentos
+func finalizeRecordingPlaylist(playlist string) (float64, error) {
+	file, err := os.Open(playlist)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var lines []string
+	var seconds float64
+	hasEndList := false
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case strings.HasPrefix(line, "#EXTINF:"):
+			duration, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			if value, err := strconv.ParseFloat(duration, 64); err == nil {
+				seconds += value
+			}
+		case strings.HasPrefix(line, "#EXT-X-PLAYLIST-TYPE:"):
+			line = "#EXT-X-PLAYLIST-TYPE:VOD"
+		case line == "#EXT-X-ENDLIST":
+			hasEndList = true
+		}
+
+		lines = append(lines, line)
+	}
+	file.Close()
+
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	if !hasEndList {
+		lines = append(lines, "#EXT-X-ENDLIST")
+	}
+
+	return seconds, os.WriteFile(playlist, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// broadcast es una transmisión activa, recibe el FLV del servidor RTMP y se lo pasa a ffmpeg
+type broadcast struct {
+	service *liveService
+	video   models.VideoModel
+	folder  string
+	// vacío si la transmisión no se graba
+	recordingFolder string
+	// entrada de ffmpeg, al cerrarla se espera a que termine
+	input     io.WriteCloser
+	startedAt time.Time
+	closeOnce sync.Once
+	// el playlist lo arma el servidor con las partes que escribe ffmpeg
+	lowLatency bool
+
+	// límite de la clave, 0 si no tiene
+	maxBitrateKbps int
+	windowStart    time.Time
+	windowBytes    int
+}
+
+// Write le pasa el stream a ffmpeg, si el encoder supera el bitrate de la clave devuelve un
+// error y el servidor RTMP corta la transmisión
+func (b *broadcast) Write(p []byte) (int, error) {
+	if b.maxBitrateKbps > 0 {
+		now := time.Now()
+		if b.windowStart.IsZero() {
+			b.windowStart = now
+		}
+		b.windowBytes += len(p)
+
+		if elapsed := now.Sub(b.windowStart); elapsed >= bitrateWindow {
+			kbps := float64(b.windowBytes) * 8 / 1000 / elapsed.Seconds()
+			if kbps > float64(b.maxBitrateKbps)*bitrateTolerance {
+				return 0, fmt.Errorf("%w: %.0f kbps (max %d)", ErrBitrateExceeded, kbps, b.maxBitrateKbps)
+			}
+			b.windowStart, b.windowBytes = now, 0
+		}
+	}
+
+	return b.input.Write(p)
+}
+
+// Close espera a que ffmpeg termine de escribir, marca el video como terminado, borra los
+// segmentos en vivo y publica la grabación en segundo plano
+func (b *broadcast) Close() error {
+	var err error
+
+	b.closeOnce.Do(func() {
+		if waitErr := b.input.Close(); waitErr != nil {
+			log.Printf("ffmpeg terminó con error en la transmisión %s: %v\n", b.video.Id, waitErr)
+		}
+
+		b.service.mu.Lock()
+		delete(b.service.broadcasts, b.video.UserID)
+		b.service.mu.Unlock()
+
+		err = b.service.endBroadcast(b.video.Id, b.startedAt)
+		b.service.chatService.CloseRoom(b.video.Id)
+
+		if removeErr := b.service.filesService.RemoveFolder(b.folder); removeErr != nil && err == nil {
+			err = removeErr
+		}
+
+		if b.recordingFolder != "" {
+			go b.service.publishRecording(b.video, b.recordingFolder)
+		}
+
+		log.Printf("Terminó la transmisión %s.\n", b.video.Id)
+	})
+
+	return err
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLiveArgsCopiesToHLS(t *testing.T) {
+	args := liveArgs(&LiveOptions{Folder: "static/temp/live/abc", SegmentSeconds: 4, ListSize: 6})
+
+	want := []string{"-loglevel", "error", "-f", "flv", "-i", "pipe:0", "-map", "0", "-c", "copy",
+		"-f", "hls", "-hls_time", "4", "-hls_list_size", "6", "-hls_flags", "delete_segments", "static/temp/live/abc/index.m3u8"}
+
+	if !slices.Equal(args, want) {
+		t.Errorf("args = %v\nwant %v", args, want)
+	}
+}
+
+func TestLiveArgsLowLatencyRecordingUsesTee(t *testing.T) {
+	args := liveArgs(&LiveOptions{
+		Folder:          "static/temp/live/abc",
+		SegmentSeconds:  4,
+		ListSize:        6,
+		LowLatency:      true,
+		PartDuration:    500 * time.Millisecond,
+		PartsPerSegment: 8,
+		Preset:          "veryfast",
+		RecordingFolder: "static/recordings/abc",
+	})
+
+	joined := strings.Join(args, " ")
+
+	for _, part := range []string{
+		"-c:v libx264 -preset veryfast -tune zerolatency",
+		"expr:gte(t,n_forced*0.5)",
+		"[f=hls:hls_time=0.5:hls_list_size=48:",
+		"static/temp/live/abc/parts.m3u8|[f=hls:hls_time=4:hls_list_size=0:hls_playlist_type=event]static/recordings/abc/output.m3u8",
+	} {
+		if !strings.Contains(joined, part) {
+			t.Errorf("args do not contain %q\n%s", part, joined)
+		}
+	}
+}
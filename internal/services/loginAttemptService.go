@@ -0,0 +1,228 @@
+package services
+
+// extension del authService que limita los intentos de login por cuenta y por IP
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/unbot2313/go-streaming-service/config"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Motivos que se guardan en la auditoría de intentos fallidos
+const (
+	loginFailureUserNotFound    = "user_not_found"
+	loginFailureInvalidPassword = "invalid_password"
+	loginFailureLocked          = "locked"
+)
+
+type loginAttemptService struct{}
+
+type LoginAttemptService interface {
+	// ReserveAttempt cuenta el intento antes de revisar la contraseña y devuelve cuánto falta para
+	// poder intentar de nuevo, 0 si el intento se aceptó. Contarlo antes evita que varios intentos
+	// en paralelo lean el mismo contador y se salten la espera o el bloqueo
+	ReserveAttempt(username, ip string) (time.Duration, error)
+	RegisterFailure(username, userId, ip, reason string) error
+	// RegisterSuccess reinicia el contador de la cuenta y devuelve el intento reservado de la IP
+	RegisterSuccess(username, ip string) error
+	// PruneExpired borra los contadores que ya no bloquean y cuyos fallos quedaron fuera de la
+	// ventana, se crean para cualquier nombre de usuario así que si no se borran crecen sin límite
+	PruneExpired() error
+}
+
+func NewLoginAttemptService() LoginAttemptService {
+	return &loginAttemptService{}
+}
+
+func (service *loginAttemptService) ReserveAttempt(username, ip string) (time.Duration, error) {
+	db, err := config.GetDB()
+	if err != nil {
+		return 0, err
+	}
+
+	cfg := config.GetConfig()
+
+	keys := []struct {
+		kind        string
+		key         string
+		maxFailures int
+	}{
+		// siempre en el mismo orden para que dos intentos no se bloqueen entre sí
+		{models.LoginThrottleAccount, normalizeUsername(username), cfg.LoginMaxAccountFailures},
+		{models.LoginThrottleIP, ip, cfg.LoginMaxIPFailures},
+	}
+
+	var retryAfter time.Duration
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		throttles := make([]*models.LoginThrottle, len(keys))
+
+		for i, key := range keys {
+			throttle, err := lockThrottle(tx, key.kind, key.key)
+			if err != nil {
+				return err
+			}
+
+			if wait := throttleBlockedUntil(throttle).Sub(now); wait > retryAfter {
+				retryAfter = wait
+			}
+
+			throttles[i] = throttle
+		}
+
+		// un intento rechazado no se cuenta, así el bloqueo no se alarga
+		if retryAfter > 0 {
+			return nil
+		}
+
+		for i, throttle := range throttles {
+			// los fallos fuera de la ventana ya no cuentan
+			if now.Sub(throttle.LastFailedAt) > cfg.LoginFailureWindow {
+				*throttle = models.LoginThrottle{Kind: throttle.Kind, Key: throttle.Key}
+			}
+
+			throttle.FailedCount++
+			throttle.LastFailedAt = now
+			throttle.NextAttemptAt = now.Add(progressiveDelay(throttle.FailedCount))
+
+			if keys[i].maxFailures > 0 && throttle.FailedCount >= keys[i].maxFailures {
+				throttle.LockedUntil = now.Add(cfg.LoginLockoutDuration)
+			}
+
+			if err := tx.Save(throttle).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return retryAfter, nil
+}
+
+// RegisterFailure guarda la auditoría del intento, el contador ya se sumó en ReserveAttempt
+func (service *loginAttemptService) RegisterFailure(username, userId, ip, reason string) error {
+	db, err := config.GetDB()
+	if err != nil {
+		return err
+	}
+
+	audit := models.LoginAudit{
+		Id:       uuid.New().String(),
+		Username: username,
+		UserID:   userId,
+		IP:       ip,
+		Reason:   reason,
+	}
+
+	return db.Create(&audit).Error
+}
+
+func (service *loginAttemptService) RegisterSuccess(username, ip string) error {
+	db, err := config.GetDB()
+	if err != nil {
+		return err
+	}
+
+	cfg := config.GetConfig()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("kind = ? AND key = ?", models.LoginThrottleAccount, normalizeUsername(username)).
+			Delete(&models.LoginThrottle{}).Error
+		if err != nil {
+			return err
+		}
+
+		// el contador de la IP no se reinicia para que una cuenta válida no sirva para seguir
+		// probando contraseñas de otras, solo se descuenta este intento
+		throttle, err := lockThrottle(tx, models.LoginThrottleIP, ip)
+		if err != nil {
+			return err
+		}
+
+		throttle.FailedCount = max(throttle.FailedCount-1, 0)
+		throttle.NextAttemptAt = time.Now()
+
+		if throttle.FailedCount < cfg.LoginMaxIPFailures {
+			throttle.LockedUntil = time.Time{}
+		}
+
+		return tx.Save(throttle).Error
+	})
+}
+
+func (service *loginAttemptService) PruneExpired() error {
+	db, err := config.GetDB()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	return db.Where("last_failed_at < ? AND next_attempt_at < ? AND locked_until < ?",
+		now.Add(-config.GetConfig().LoginFailureWindow), now, now).
+		Delete(&models.LoginThrottle{}).Error
+}
+
+// lockThrottle bloquea la fila de la llave hasta que termine la transacción, creándola si no
+// existe para que dos intentos a la vez no lean el mismo contador. Si ya existe el upsert la
+// bloquea en el mismo paso, así PruneExpired no la puede borrar antes del SELECT
+func lockThrottle(tx *gorm.DB, kind, key string) (*models.LoginThrottle, error) {
+	err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "kind"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"kind"}),
+	}).
+		Create(&models.LoginThrottle{Kind: kind, Key: key}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var throttle models.LoginThrottle
+
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("kind = ? AND key = ?", kind, key).
+		First(&throttle).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &throttle, nil
+}
+
+// throttleBlockedUntil es hasta cuándo la llave no acepta intentos, por la espera progresiva o el bloqueo
+func throttleBlockedUntil(throttle *models.LoginThrottle) time.Time {
+	if throttle.LockedUntil.After(throttle.NextAttemptAt) {
+		return throttle.LockedUntil
+	}
+	return throttle.NextAttemptAt
+}
+
+// progressiveDelay duplica la espera con cada fallo: base, 2*base, 4*base... hasta el máximo
+func progressiveDelay(failedCount int) time.Duration {
+	cfg := config.GetConfig()
+
+	delay := cfg.LoginBaseDelay
+	for i := 1; i < failedCount && delay < cfg.LoginMaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > cfg.LoginMaxDelay {
+		delay = cfg.LoginMaxDelay
+	}
+
+	return delay
+}
+
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
@@ -0,0 +1,386 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/unbot2313/go-streaming-service/config"
+)
+
+var ErrLiveNotFound = errors.New("live broadcast not found")
+
+var ErrLiveSegmentNotFound = errors.New("live segment not found")
+
+var ErrLiveRequestTooFar = errors.New("the requested segment is too far ahead of the live edge")
+
+var ErrLiveNotReady = errors.New("the requested segment did not become available in time")
+
+const (
+	// playlist que escribe ffmpeg con las partes, el que ven los clientes lo arma llPlaylist.render
+	lowLatencyPartsPlaylist = "parts.m3u8"
+	lowLatencyInitFile      = "init.mp4"
+	// cada cuánto se revisa si ffmpeg escribió partes nuevas mientras un cliente espera
+	lowLatencyPollInterval = 50 * time.Millisecond
+	// segmentos completos del final del playlist que también se listan por partes
+	lowLatencyPartSegments = 3
+)
+
+var lowLatencyFilePattern = regexp.MustCompile(`^(part|seg)(\d+)\.m4s$`)
+
+// liveVideoURL es el playlist que se publica como video de la transmisión: el de ffmpeg en
+// /static o, en baja latencia, el que arma el servidor
+func liveVideoURL(videoId string, lowLatency bool) string {
+	if lowLatency {
+		return "/api/v1/streaming/id/" + videoId + "/live/index.m3u8"
+	}
+
+	return "/api/v1/static/live/" + videoId + "/index.m3u8"
+}
+
+// partsPerSegment es la cantidad de partes que forman un segmento, los segmentos duran
+// LIVE_HLS_SEGMENT_SECONDS redondeado a un múltiplo de LIVE_LL_PART_DURATION
+func partsPerSegment() int {
+	cfg := config.GetConfig()
+
+	if cfg.LiveLLPartDuration <= 0 {
+		return 1
+	}
+
+	return max(1, int(math.Round(float64(cfg.LiveHLSSegmentSeconds)/cfg.LiveLLPartDuration.Seconds())))
+}
+
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', -1, 64)
+}
+
+// llPart es una parte que escribió ffmpeg, index es el número del archivo part<index>.m4s
+type llPart struct {
+	index    int
+	duration float64
+}
+
+// llPlaylist son las partes que están en el playlist de ffmpeg. Las partes se agrupan en
+// segmentos por número, el segmento n tiene las partes n*perSegment a (n+1)*perSegment-1,
+// así la agrupación no cambia aunque ffmpeg borre las partes viejas.
+type llPlaylist struct {
+	parts      []llPart
+	perSegment int
+	ended      bool
+}
+
+// readPartsPlaylist lee el playlist que escribe ffmpeg con las partes
+func readPartsPlaylist(folder string) (*llPlaylist, error) {
+	file, err := os.Open(path.Join(folder, lowLatencyPartsPlaylist))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	playlist := &llPlaylist{perSegment: partsPerSegment()}
+	var duration float64
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			duration, _ = strconv.ParseFloat(value, 64)
+		case line == "#EXT-X-ENDLIST":
+			playlist.ended = true
+		case line != "" && !strings.HasPrefix(line, "#"):
+			match := lowLatencyFilePattern.FindStringSubmatch(line)
+			if match == nil || match[1] != "part" {
+				continue
+			}
+
+			index, _ := strconv.Atoi(match[2])
+			playlist.parts = append(playlist.parts, llPart{index: index, duration: duration})
+		}
+	}
+
+	return playlist, scanner.Err()
+}
+
+// firstSegment es el primer segmento que tiene todas sus partes en el playlist
+func (playlist *llPlaylist) firstSegment() int {
+	return (playlist.parts[0].index + playlist.perSegment - 1) / playlist.perSegment
+}
+
+// completeSegments es el número del siguiente segmento que falta terminar
+func (playlist *llPlaylist) completeSegments() int {
+	last := playlist.parts[len(playlist.parts)-1].index
+
+	if playlist.ended {
+		return last/playlist.perSegment + 1
+	}
+
+	return (last + 1) / playlist.perSegment
+}
+
+// has indica si el playlist ya tiene el segmento msn completo o, con part >= 0, esa parte del segmento
+func (playlist *llPlaylist) has(msn int, part int) bool {
+	if len(playlist.parts) == 0 {
+		return false
+	}
+
+	if part < 0 {
+		return msn < playlist.completeSegments()
+	}
+
+	return playlist.ended || msn*playlist.perSegment+part <= playlist.parts[len(playlist.parts)-1].index
+}
+
+// segmentParts devuelve las partes del segmento msn que están en el playlist
+func (playlist *llPlaylist) segmentParts(msn int) []llPart {
+	first := playlist.parts[0].index
+	from := max(msn*playlist.perSegment-first, 0)
+	to := min((msn+1)*playlist.perSegment-first, len(playlist.parts))
+
+	if from >= to {
+		return nil
+	}
+
+	return playlist.parts[from:to]
+}
+
+// render arma el playlist LL-HLS: los segmentos completos, las partes de los últimos
+// segmentos y del que se está escribiendo, y el aviso de la próxima parte
+func (playlist *llPlaylist) render() string {
+	cfg := config.GetConfig()
+	partTarget := cfg.LiveLLPartDuration.Seconds()
+	targetDuration := int(math.Ceil(partTarget * float64(playlist.perSegment)))
+
+	firstSegment := playlist.firstSegment()
+	completeSegments := playlist.completeSegments()
+
+	var builder strings.Builder
+
+	builder.WriteString("#EXTM3U\n#EXT-X-VERSION:9\n")
+	fmt.Fprintf(&builder, "#EXT-X-TARGETDURATION:%d\n", targetDuration)
+	if !playlist.ended {
+		fmt.Fprintf(&builder, "#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=%.3f\n", 3*partTarget)
+	}
+	fmt.Fprintf(&builder, "#EXT-X-PART-INF:PART-TARGET=%.3f\n", partTarget)
+	fmt.Fprintf(&builder, "#EXT-X-MEDIA-SEQUENCE:%d\n", firstSegment)
+	fmt.Fprintf(&builder, "#EXT-X-MAP:URI=\"%s\"\n", lowLatencyInitFile)
+
+	writeParts := func(parts []llPart) {
+		for _, part := range parts {
+			fmt.Fprintf(&builder, "#EXT-X-PART:DURATION=%.3f,URI=\"part%d.m4s\",INDEPENDENT=YES\n", part.duration, part.index)
+		}
+	}
+
+	for msn := firstSegment; msn < completeSegments; msn++ {
+		parts := playlist.segmentParts(msn)
+
+		if msn >= completeSegments-lowLatencyPartSegments {
+			writeParts(parts)
+		}
+
+		var duration float64
+		for _, part := range parts {
+			duration += part.duration
+		}
+
+		fmt.Fprintf(&builder, "#EXTINF:%.3f,\nseg%d.m4s\n", duration, msn)
+	}
+
+	if playlist.ended {
+		builder.WriteString("#EXT-X-ENDLIST\n")
+		return builder.String()
+	}
+
+	// el segmento que se está escribiendo solo se lista por partes
+	if completeSegments >= firstSegment {
+		writeParts(playlist.segmentParts(completeSegments))
+	}
+
+	next := playlist.parts[len(playlist.parts)-1].index + 1
+	fmt.Fprintf(&builder, "#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"part%d.m4s\"\n", next)
+
+	return builder.String()
+}
+
+// lowLatencyBroadcast busca la transmisión activa en baja latencia del video
+func (service *liveService) lowLatencyBroadcast(videoId string) (*broadcast, error) {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	for _, live := range service.broadcasts {
+		if live.video.Id == videoId && live.lowLatency {
+			return live, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: id %s", ErrLiveNotFound, videoId)
+}
+
+// waitLowLatency espera a que el playlist de ffmpeg cumpla ready, a lo sumo tres veces la
+// duración de un segmento como pide LL-HLS para las recargas bloqueantes
+func (service *liveService) waitLowLatency(ctx context.Context, live *broadcast, ready func(*llPlaylist) bool) (*llPlaylist, error) {
+	cfg := config.GetConfig()
+	timeout := 3 * time.Duration(partsPerSegment()) * cfg.LiveLLPartDuration
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(lowLatencyPollInterval)
+	defer ticker.Stop()
+
+	var lastModified time.Time
+	var playlist *llPlaylist
+
+	for {
+		// solo se vuelve a leer si ffmpeg reescribió el playlist
+		info, err := os.Stat(path.Join(live.folder, lowLatencyPartsPlaylist))
+
+		if errors.Is(err, os.ErrNotExist) {
+			if _, liveErr := service.lowLatencyBroadcast(live.video.Id); liveErr != nil {
+				return nil, liveErr
+			}
+		} else if err != nil {
+			return nil, err
+		} else if !info.ModTime().Equal(lastModified) {
+			lastModified = info.ModTime()
+
+			playlist, err = readPartsPlaylist(live.folder)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+
+			if playlist != nil && ready(playlist) {
+				return playlist, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, ErrLiveNotReady
+			}
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// LowLatencyPlaylist devuelve el playlist LL-HLS de la transmisión. Con msn >= 0 es una
+// recarga bloqueante: espera a que esté el segmento msn o, con part >= 0, esa parte.
+func (service *liveService) LowLatencyPlaylist(ctx context.Context, videoId string, msn int, part int) (string, error) {
+	live, err := service.lowLatencyBroadcast(videoId)
+	if err != nil {
+		return "", err
+	}
+
+	playlist, err := service.waitLowLatency(ctx, live, func(playlist *llPlaylist) bool {
+		if len(playlist.parts) == 0 {
+			return false
+		}
+
+		if msn < 0 {
+			return true
+		}
+
+		// lo que está muy adelante se rechaza sin esperar
+		return playlist.ended || msn > playlist.completeSegments()+2 || playlist.has(msn, part)
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	// LL-HLS pide rechazar lo que está a más de dos segmentos del final
+	if msn > playlist.completeSegments()+2 {
+		return "", fmt.Errorf("%w: segment %d", ErrLiveRequestTooFar, msn)
+	}
+
+	return playlist.render(), nil
+}
+
+// LowLatencyFile devuelve el init, una parte o un segmento (las partes unidas) de la transmisión.
+// La parte del aviso de precarga se pide antes de que exista, en ese caso se espera a que ffmpeg la escriba.
+func (service *liveService) LowLatencyFile(ctx context.Context, videoId string, name string) ([]byte, error) {
+	live, err := service.lowLatencyBroadcast(videoId)
+	if err != nil {
+		return nil, err
+	}
+
+	if name == lowLatencyInitFile {
+		if _, err := service.waitLowLatency(ctx, live, func(playlist *llPlaylist) bool { return len(playlist.parts) > 0 }); err != nil {
+			return nil, err
+		}
+
+		return os.ReadFile(path.Join(live.folder, name))
+	}
+
+	match := lowLatencyFilePattern.FindStringSubmatch(name)
+	if match == nil {
+		return nil, fmt.Errorf("%w: %s", ErrLiveSegmentNotFound, name)
+	}
+
+	number, err := strconv.Atoi(match[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrLiveSegmentNotFound, name)
+	}
+
+	var parts []llPart
+
+	if match[1] == "part" {
+		playlist, err := service.waitLowLatency(ctx, live, func(playlist *llPlaylist) bool {
+			last := -1
+			if len(playlist.parts) > 0 {
+				last = playlist.parts[len(playlist.parts)-1].index
+			}
+
+			// no se espera una parte que está a más de un segmento del final
+			return playlist.ended || number <= last || number > last+playlist.perSegment
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(playlist.parts) > 0 && number >= playlist.parts[0].index && number <= playlist.parts[len(playlist.parts)-1].index {
+			parts = []llPart{{index: number}}
+		}
+	} else {
+		playlist, err := readPartsPlaylist(live.folder)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+
+		if playlist != nil && len(playlist.parts) > 0 && number >= playlist.firstSegment() && playlist.has(number, -1) {
+			parts = playlist.segmentParts(number)
+		}
+	}
+
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrLiveSegmentNotFound, name)
+	}
+
+	// un segmento fMP4 es la concatenación de sus partes
+	var data []byte
+	for _, part := range parts {
+		content, err := os.ReadFile(path.Join(live.folder, fmt.Sprintf("part%d.m4s", part.index)))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrLiveSegmentNotFound, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, content...)
+	}
+
+	return data, nil
+}
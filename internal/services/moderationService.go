@@ -0,0 +1,626 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/unbot2313/go-streaming-service/config"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrReportNotFound = errors.New("report not found")
+	ErrInvalidReport  = errors.New("invalid report")
+	ErrReportClosed   = errors.New("report already reviewed")
+)
+
+type moderationService struct {
+	databaseVideoService DatabaseVideoService
+	userService          UserService
+}
+
+// ModerationService recibe los reportes de los usuarios y las decisiones de los moderadores:
+// ocultar el contenido, sumar una falta al dueño o suspender su cuenta. Cada decisión
+// queda en el registro de moderación.
+type ModerationService interface {
+	ReportVideo(reporterId string, videoId string, request *models.ReportRequest) (*models.Report, error)
+	ReportComment(reporterId string, commentId string, request *models.ReportRequest) (*models.Report, error)
+	ListReports(status string, targetType string, cursor string, limit int) (*models.ReportPage, error)
+	DismissReport(moderatorId string, reportId string, note string) (*models.Report, error)
+	ActionReport(moderatorId string, reportId string, decision *models.ReportDecision) (*models.Report, error)
+	RestoreVideo(moderatorId string, videoId string, note string) (*models.VideoModel, error)
+	LiftSuspension(moderatorId string, userId string, note string) (*models.ModerationStatus, error)
+	SetRole(moderatorId string, userId string, role string) (*models.ModerationStatus, error)
+	GetStatus(userId string) (*models.ModerationStatus, error)
+	ListAuditLog(targetId string, userId string, cursor string, limit int) (*models.ModerationActionPage, error)
+	EnsureAdmins(usernames []string) error
+}
+
+func NewModerationService(databaseVideoService DatabaseVideoService, userService UserService) ModerationService {
+	return &moderationService{
+		databaseVideoService: databaseVideoService,
+		userService:          userService,
+	}
+}
+
+// ReportVideo es idempotente, si el usuario ya reportó el video se devuelve ese reporte
+func (service *moderationService) ReportVideo(reporterId string, videoId string, request *models.ReportRequest) (*models.Report, error) {
+	video, err := service.databaseVideoService.FindVideoByID(videoId)
+	if err != nil {
+		return nil, err
+	}
+
+	if video.HiddenAt != nil {
+		return nil, fmt.Errorf("%w: id %s", ErrVideoNotFound, videoId)
+	}
+
+	return service.createReport(reporterId, models.ReportTargetVideo, video.Id, video.UserID, request)
+}
+
+func (service *moderationService) ReportComment(reporterId string, commentId string, request *models.ReportRequest) (*models.Report, error) {
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	comment, err := findComment(db, commentId)
+	if err != nil {
+		return nil, err
+	}
+
+	if comment.Status != models.CommentStatusVisible {
+		return nil, fmt.Errorf("%w: %s", ErrCommentNotFound, commentId)
+	}
+
+	return service.createReport(reporterId, models.ReportTargetComment, comment.Id, comment.UserID, request)
+}
+
+func (service *moderationService) createReport(reporterId string, targetType string, targetId string, ownerId string, request *models.ReportRequest) (*models.Report, error) {
+	if reporterId == ownerId {
+		return nil, fmt.Errorf("%w: cannot report your own content", ErrInvalidReport)
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	report := models.Report{
+		Id:            uuid.New().String(),
+		ReporterID:    reporterId,
+		TargetType:    targetType,
+		TargetID:      targetId,
+		TargetOwnerID: ownerId,
+		Reason:        request.Reason,
+		Details:       request.Details,
+		Status:        models.ReportStatusOpen,
+	}
+
+	dbCtx := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&report)
+	if dbCtx.Error != nil {
+		return nil, dbCtx.Error
+	}
+
+	if dbCtx.RowsAffected == 0 {
+		err := db.Where("reporter_id = ? AND target_type = ? AND target_id = ?", reporterId, targetType, targetId).
+			First(&report).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &report, nil
+}
+
+// ListReports es la cola de moderación. Los abiertos van del más antiguo al más nuevo,
+// para atenderlos en orden, y los ya revisados del más nuevo al más antiguo.
+func (service *moderationService) ListReports(status string, targetType string, cursor string, limit int) (*models.ReportPage, error) {
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	if status == "" {
+		status = models.ReportStatusOpen
+	}
+
+	size := pageSize(limit)
+	query := db.Where("status = ?", status)
+
+	if targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+
+	if status == models.ReportStatusOpen {
+		if after != nil {
+			query = query.Where("(created_at, id) > (?, ?)", after.Time, after.Id)
+		}
+		query = query.Order("created_at, id")
+	} else {
+		if after != nil {
+			query = query.Where("(created_at, id) < (?, ?)", after.Time, after.Id)
+		}
+		query = query.Order("created_at DESC, id DESC")
+	}
+
+	var reports []models.Report
+
+	// se pide uno más para saber si hay otra página
+	if err := query.Limit(size + 1).Find(&reports).Error; err != nil {
+		return nil, err
+	}
+
+	page := &models.ReportPage{Items: reports}
+
+	if len(reports) > size {
+		page.Items = reports[:size]
+		last := page.Items[size-1]
+		page.NextCursor = encodeCursor(last.CreatedAt, last.Id)
+	}
+
+	if page.Items == nil {
+		page.Items = []models.Report{}
+	}
+
+	return page, nil
+}
+
+// DismissReport cierra sin acción todos los reportes abiertos del mismo contenido
+func (service *moderationService) DismissReport(moderatorId string, reportId string, note string) (*models.Report, error) {
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var report *models.Report
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		report, err = lockOpenReport(tx, reportId)
+		if err != nil {
+			return err
+		}
+
+		if err := closeReports(tx, report, moderatorId, models.ReportStatusDismissed); err != nil {
+			return err
+		}
+
+		return recordModeration(tx, &models.ModerationAction{
+			ModeratorID: moderatorId,
+			Action:      models.AuditDismissReport,
+			ReportID:    report.Id,
+			TargetType:  report.TargetType,
+			TargetID:    report.TargetID,
+			UserID:      report.TargetOwnerID,
+			Note:        note,
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// ActionReport aplica las acciones de la decisión y cierra todos los reportes abiertos del
+// mismo contenido. Si con la falta el dueño llega al límite de la ventana, se suspende su cuenta.
+func (service *moderationService) ActionReport(moderatorId string, reportId string, decision *models.ReportDecision) (*models.Report, error) {
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := config.GetConfig()
+
+	var report *models.Report
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		report, err = lockOpenReport(tx, reportId)
+		if err != nil {
+			return err
+		}
+
+		audit := func(action string, details map[string]string) error {
+			return recordModeration(tx, &models.ModerationAction{
+				ModeratorID: moderatorId,
+				Action:      action,
+				ReportID:    report.Id,
+				TargetType:  report.TargetType,
+				TargetID:    report.TargetID,
+				UserID:      report.TargetOwnerID,
+				Note:        decision.Note,
+				Details:     details,
+			})
+		}
+
+		if slices.Contains(decision.Actions, models.ModerationHide) {
+			action, err := hideTarget(tx, report)
+			if err != nil {
+				return err
+			}
+
+			if err := audit(action, nil); err != nil {
+				return err
+			}
+		}
+
+		if slices.Contains(decision.Actions, models.ModerationStrike) {
+			strike := models.Strike{
+				Id:       uuid.New().String(),
+				UserID:   report.TargetOwnerID,
+				ReportID: report.Id,
+				Reason:   report.Reason,
+			}
+
+			if err := tx.Create(&strike).Error; err != nil {
+				return err
+			}
+
+			activeStrikes, err := countActiveStrikes(tx, report.TargetOwnerID)
+			if err != nil {
+				return err
+			}
+
+			if err := audit(models.AuditStrike, map[string]string{"active_strikes": strconv.FormatInt(activeStrikes, 10)}); err != nil {
+				return err
+			}
+
+			if activeStrikes >= int64(cfg.StrikeSuspendThreshold) && !slices.Contains(decision.Actions, models.ModerationSuspend) {
+				until, err := suspendUser(tx, report.TargetOwnerID, cfg.SuspendDuration)
+				if err != nil {
+					return err
+				}
+
+				details := map[string]string{"until": until.UTC().Format(time.RFC3339), "cause": "strike_threshold"}
+				if err := audit(models.AuditSuspend, details); err != nil {
+					return err
+				}
+			}
+		}
+
+		if slices.Contains(decision.Actions, models.ModerationSuspend) {
+			duration := cfg.SuspendDuration
+			if decision.SuspendDays > 0 {
+				duration = time.Duration(decision.SuspendDays) * 24 * time.Hour
+			}
+
+			until, err := suspendUser(tx, report.TargetOwnerID, duration)
+			if err != nil {
+				return err
+			}
+
+			if err := audit(models.AuditSuspend, map[string]string{"until": until.UTC().Format(time.RFC3339)}); err != nil {
+				return err
+			}
+		}
+
+		return closeReports(tx, report, moderatorId, models.ReportStatusActioned)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// RestoreVideo vuelve a publicar un video que un moderador ocultó
+func (service *moderationService) RestoreVideo(moderatorId string, videoId string, note string) (*models.VideoModel, error) {
+	video, err := service.databaseVideoService.FindVideoByID(videoId)
+	if err != nil {
+		return nil, err
+	}
+
+	if video.HiddenAt == nil {
+		return video, nil
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(video).UpdateColumn("hidden_at", nil).Error; err != nil {
+			return err
+		}
+
+		return recordModeration(tx, &models.ModerationAction{
+			ModeratorID: moderatorId,
+			Action:      models.AuditRestoreVideo,
+			TargetType:  models.ReportTargetVideo,
+			TargetID:    video.Id,
+			UserID:      video.UserID,
+			Note:        note,
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	video.HiddenAt = nil
+	return video, nil
+}
+
+// LiftSuspension termina la suspensión de la cuenta antes de tiempo
+func (service *moderationService) LiftSuspension(moderatorId string, userId string, note string) (*models.ModerationStatus, error) {
+	if _, err := service.userService.GetUserByID(userId); err != nil {
+		return nil, err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).Where("id = ?", userId).UpdateColumn("suspended_until", nil).Error
+		if err != nil {
+			return err
+		}
+
+		return recordModeration(tx, &models.ModerationAction{
+			ModeratorID: moderatorId,
+			Action:      models.AuditLiftSuspension,
+			UserID:      userId,
+			Note:        note,
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return service.GetStatus(userId)
+}
+
+func (service *moderationService) SetRole(moderatorId string, userId string, role string) (*models.ModerationStatus, error) {
+	user, err := service.userService.GetUserByID(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userId).UpdateColumn("role", role).Error; err != nil {
+			return err
+		}
+
+		return recordModeration(tx, &models.ModerationAction{
+			ModeratorID: moderatorId,
+			Action:      models.AuditSetRole,
+			UserID:      userId,
+			Details:     map[string]string{"from": user.Role, "to": role},
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return service.GetStatus(userId)
+}
+
+func (service *moderationService) GetStatus(userId string) (*models.ModerationStatus, error) {
+	user, err := service.userService.GetUserByID(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	activeStrikes, err := countActiveStrikes(db, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &models.ModerationStatus{
+		UserID:        user.Id,
+		Role:          user.Role,
+		ActiveStrikes: activeStrikes,
+	}
+
+	if checkSuspension(user) != nil {
+		status.SuspendedUntil = user.SuspendedUntil
+	}
+
+	return status, nil
+}
+
+// ListAuditLog lista el registro de moderación del más nuevo al más antiguo, se puede
+// filtrar por el contenido o por el usuario afectado
+func (service *moderationService) ListAuditLog(targetId string, userId string, cursor string, limit int) (*models.ModerationActionPage, error) {
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	size := pageSize(limit)
+	query := db.Model(&models.ModerationAction{})
+
+	if targetId != "" {
+		query = query.Where("target_id = ?", targetId)
+	}
+
+	if userId != "" {
+		query = query.Where("user_id = ?", userId)
+	}
+
+	if after != nil {
+		query = query.Where("(created_at, id) < (?, ?)", after.Time, after.Id)
+	}
+
+	var actions []models.ModerationAction
+
+	// se pide uno más para saber si hay otra página
+	if err := query.Order("created_at DESC, id DESC").Limit(size + 1).Find(&actions).Error; err != nil {
+		return nil, err
+	}
+
+	page := &models.ModerationActionPage{Items: actions}
+
+	if len(actions) > size {
+		page.Items = actions[:size]
+		last := page.Items[size-1]
+		page.NextCursor = encodeCursor(last.CreatedAt, last.Id)
+	}
+
+	if page.Items == nil {
+		page.Items = []models.ModerationAction{}
+	}
+
+	return page, nil
+}
+
+// EnsureAdmins da el rol admin a los usuarios configurados, sirve para tener el primer admin
+func (service *moderationService) EnsureAdmins(usernames []string) error {
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return err
+	}
+
+	return db.Model(&models.User{}).Where("username IN ? AND role <> ?", usernames, models.RoleAdmin).
+		UpdateColumn("role", models.RoleAdmin).Error
+}
+
+// lockOpenReport bloquea el reporte hasta el final de la transacción, así dos moderadores
+// no deciden el mismo reporte a la vez
+func lockOpenReport(tx *gorm.DB, reportId string) (*models.Report, error) {
+	var report models.Report
+
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", reportId).First(&report).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrReportNotFound, reportId)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if report.Status != models.ReportStatusOpen {
+		return nil, fmt.Errorf("%w: %s", ErrReportClosed, reportId)
+	}
+
+	return &report, nil
+}
+
+// closeReports cierra el reporte y los demás reportes abiertos del mismo contenido
+func closeReports(tx *gorm.DB, report *models.Report, moderatorId string, status string) error {
+	now := time.Now()
+
+	err := tx.Model(&models.Report{}).
+		Where("target_type = ? AND target_id = ? AND status = ?", report.TargetType, report.TargetID, models.ReportStatusOpen).
+		Updates(map[string]interface{}{"status": status, "reviewed_by": moderatorId, "reviewed_at": now}).Error
+
+	if err != nil {
+		return err
+	}
+
+	report.Status = status
+	report.ReviewedBy = moderatorId
+	report.ReviewedAt = &now
+
+	return nil
+}
+
+// hideTarget oculta el video o rechaza el comentario reportado, devuelve la acción para el registro
+func hideTarget(tx *gorm.DB, report *models.Report) (string, error) {
+	if report.TargetType == models.ReportTargetVideo {
+		err := tx.Model(&models.VideoModel{}).Where("id = ? AND hidden_at IS NULL", report.TargetID).
+			UpdateColumn("hidden_at", time.Now()).Error
+
+		return models.AuditHideVideo, err
+	}
+
+	comment, err := findComment(tx, report.TargetID)
+	if errors.Is(err, ErrCommentNotFound) {
+		// el autor ya lo borró
+		return models.AuditHideComment, nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	previousStatus := comment.Status
+	comment.Status = models.CommentStatusRejected
+
+	err = tx.Model(comment).Updates(map[string]interface{}{"status": comment.Status, "pinned": false}).Error
+	if err != nil {
+		return "", err
+	}
+
+	return models.AuditHideComment, updateReplyCountForStatus(tx, comment, previousStatus)
+}
+
+// suspendUser suspende la cuenta por duration, si ya tenía una suspensión más larga se mantiene
+func suspendUser(tx *gorm.DB, userId string, duration time.Duration) (time.Time, error) {
+	until := time.Now().Add(duration)
+
+	err := tx.Model(&models.User{}).Where("id = ? AND (suspended_until IS NULL OR suspended_until < ?)", userId, until).
+		UpdateColumn("suspended_until", until).Error
+
+	return until, err
+}
+
+// countActiveStrikes cuenta las faltas del usuario dentro de la ventana configurada
+func countActiveStrikes(db *gorm.DB, userId string) (int64, error) {
+	var count int64
+
+	err := db.Model(&models.Strike{}).
+		Where("user_id = ? AND created_at > ?", userId, time.Now().Add(-config.GetConfig().StrikeWindow)).
+		Count(&count).Error
+
+	return count, err
+}
+
+func recordModeration(tx *gorm.DB, action *models.ModerationAction) error {
+	action.Id = uuid.New().String()
+	return tx.Create(action).Error
+}
+
+func collectModeration(db *gorm.DB, userId string) (interface{}, error) {
+	var reports []models.Report
+	if err := db.Where("reporter_id = ?", userId).Order("created_at").Find(&reports).Error; err != nil {
+		return nil, err
+	}
+
+	var strikes []models.Strike
+	if err := db.Where("user_id = ?", userId).Order("created_at").Find(&strikes).Error; err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"reports_filed": reports,
+		"strikes":       strikes,
+	}, nil
+}
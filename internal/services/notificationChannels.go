@@ -0,0 +1,203 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/unbot2313/go-streaming-service/config"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+)
+
+var ErrInvalidWebhookURL = errors.New("invalid webhook url")
+
+// Mailer envía un email de texto plano
+type Mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+// NewMailer usa el servidor SMTP configurado, o solo escribe en el log si no hay uno
+func NewMailer() Mailer {
+	cfg := config.GetConfig()
+
+	if cfg.SMTPHost == "" {
+		return logMailer{}
+	}
+
+	return &smtpMailer{
+		host:     cfg.SMTPHost,
+		port:     cfg.SMTPPort,
+		username: cfg.SMTPUsername,
+		password: cfg.SMTPPassword,
+		from:     cfg.SMTPFrom,
+	}
+}
+
+type logMailer struct{}
+
+func (logMailer) Send(to string, subject string, body string) error {
+	log.Printf("Email para %s: %s\n", to, subject)
+	return nil
+}
+
+type smtpMailer struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+func (mailer *smtpMailer) Send(to string, subject string, body string) error {
+	var auth smtp.Auth
+	if mailer.username != "" {
+		auth = smtp.PlainAuth("", mailer.username, mailer.password, mailer.host)
+	}
+
+	// se quitan los saltos de línea para que no se puedan inyectar cabeceras
+	subject = strings.NewReplacer("\r", " ", "\n", " ").Replace(subject)
+
+	message := "From: " + mailer.from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + body + "\r\n"
+
+	return smtp.SendMail(net.JoinHostPort(mailer.host, mailer.port), auth, mailer.from, []string{to}, []byte(message))
+}
+
+// NotificationChannel entrega una notificación por un medio externo. La bandeja (in_app)
+// no es un canal de estos, la notificación ya queda guardada al repartirla.
+type NotificationChannel interface {
+	Deliver(notification *models.Notification, recipient *models.User, settings *models.NotificationSettings) error
+}
+
+// emailChannel envía la notificación al email de la cuenta, si tiene uno
+type emailChannel struct {
+	mailer Mailer
+}
+
+func NewEmailChannel(mailer Mailer) NotificationChannel {
+	return &emailChannel{mailer: mailer}
+}
+
+func (channel *emailChannel) Deliver(notification *models.Notification, recipient *models.User, settings *models.NotificationSettings) error {
+	if recipient.Email == "" {
+		return nil
+	}
+
+	body := notification.Body
+	if notification.Link != "" {
+		body += "\n\n" + notification.Link
+	}
+
+	return channel.mailer.Send(recipient.Email, notification.Title, body)
+}
+
+// webhookChannel hace un POST con la notificación en json a la url que configuró el usuario,
+// firmado con HMAC-SHA256 en la cabecera X-Webhook-Signature
+type webhookChannel struct {
+	client *http.Client
+}
+
+func NewWebhookChannel() NotificationChannel {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+
+	if !config.GetConfig().WebhookAllowPrivateNetworks {
+		dialer.Control = rejectPrivateAddress
+	}
+
+	// sin proxy: con HTTP(S)_PROXY se conectaría al proxy y no a la dirección del webhook,
+	// y rejectPrivateAddress no vería a dónde va de verdad
+	transport := &http.Transport{
+		Proxy:       nil,
+		DialContext: dialer.DialContext,
+	}
+
+	return &webhookChannel{
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: transport,
+			// no se siguen redirecciones para no terminar en otra dirección
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+func (channel *webhookChannel) Deliver(notification *models.Notification, recipient *models.User, settings *models.NotificationSettings) error {
+	if settings == nil || settings.WebhookURL == "" {
+		return nil
+	}
+
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, settings.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha256.New, []byte(settings.WebhookSecret))
+	mac.Write(payload)
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Webhook-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	response, err := channel.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+// validateWebhookURL solo acepta urls http o https con host
+func validateWebhookURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return fmt.Errorf("%w: %s", ErrInvalidWebhookURL, rawURL)
+	}
+
+	return nil
+}
+
+// rejectPrivateAddress evita que un webhook apunte a servicios internos del servidor
+func rejectPrivateAddress(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() || ip.IsMulticast() {
+		return fmt.Errorf("%w: private address %s", ErrInvalidWebhookURL, host)
+	}
+
+	return nil
+}
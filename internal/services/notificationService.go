@@ -0,0 +1,631 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/unbot2313/go-streaming-service/config"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotificationNotFound        = errors.New("notification not found")
+	ErrInvalidNotificationSettings = errors.New("invalid notification settings")
+)
+
+// canales que se usan cuando el usuario no configuró el tipo
+var defaultNotificationChannels = map[string][]string{
+	models.NotificationNewVideo:     {models.NotificationChannelInApp},
+	models.NotificationCommentReply: {models.NotificationChannelInApp, models.NotificationChannelEmail},
+	models.NotificationVideoReady:   {models.NotificationChannelInApp, models.NotificationChannelEmail},
+	models.NotificationExportReady:  {models.NotificationChannelInApp, models.NotificationChannelEmail},
+}
+
+type notificationService struct {
+	channels map[string]NotificationChannel
+	wake     chan struct{}
+}
+
+// NotificationService guarda los eventos a notificar y los reparte en segundo plano: crea la
+// notificación en la bandeja de cada destinatario y los envíos por los canales externos que
+// tenga activos (email, webhook), que se reintentan si fallan.
+type NotificationService interface {
+	Notify(events ...*models.NotificationEvent) error
+	NotifyVideoPublished(video *models.VideoModel) error
+	NotifyCommentReply(reply *models.Comment, parent *models.Comment) error
+	NotifyExportFinished(export *models.DataExport) error
+	ListNotifications(userId string, unreadOnly bool, cursor string, limit int) (*models.NotificationPage, error)
+	CountUnread(userId string) (int64, error)
+	MarkRead(userId string, notificationId string) error
+	MarkAllRead(userId string) error
+	GetSettings(userId string) (*models.NotificationSettings, error)
+	UpdateSettings(userId string, update *models.NotificationSettingsUpdate) (*models.NotificationSettings, error)
+	RegisterChannel(name string, channel NotificationChannel)
+	Run(ctx context.Context)
+}
+
+func NewNotificationService(mailer Mailer) NotificationService {
+	return &notificationService{
+		channels: map[string]NotificationChannel{
+			models.NotificationChannelEmail:   NewEmailChannel(mailer),
+			models.NotificationChannelWebhook: NewWebhookChannel(),
+		},
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// RegisterChannel agrega o reemplaza un canal de entrega
+func (service *notificationService) RegisterChannel(name string, channel NotificationChannel) {
+	service.channels[name] = channel
+}
+
+// Notify guarda los eventos juntos y despierta al worker, la entrega es asíncrona
+func (service *notificationService) Notify(events ...*models.NotificationEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		event.Id = uuid.New().String()
+		event.Status = models.NotificationStatusPending
+	}
+
+	// un solo insert: o se guardan todos o ninguno, y no se reparte uno sin el otro
+	if err := db.Create(&events).Error; err != nil {
+		return err
+	}
+
+	select {
+	case service.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// NotifyVideoPublished avisa a los suscriptores del canal y al dueño que su video ya está disponible
+func (service *notificationService) NotifyVideoPublished(video *models.VideoModel) error {
+	link := "/api/v1/streaming/id/" + video.Id
+	data := map[string]string{"video_id": video.Id}
+
+	return service.Notify(
+		&models.NotificationEvent{
+			Type:        models.NotificationVideoReady,
+			RecipientID: video.UserID,
+			Title:       "Tu video está listo",
+			Body:        fmt.Sprintf("El video \"%s\" terminó de procesarse y ya se puede ver.", video.Title),
+			Link:        link,
+			Data:        data,
+		},
+		&models.NotificationEvent{
+			Type:      models.NotificationNewVideo,
+			ActorID:   video.UserID,
+			ChannelID: video.UserID,
+			Title:     "Nuevo video en un canal que sigues",
+			Body:      video.Title,
+			Link:      link,
+			Data:      data,
+		},
+	)
+}
+
+// NotifyCommentReply avisa al autor del comentario, salvo que se responda a sí mismo
+func (service *notificationService) NotifyCommentReply(reply *models.Comment, parent *models.Comment) error {
+	if reply.UserID == parent.UserID {
+		return nil
+	}
+
+	return service.Notify(&models.NotificationEvent{
+		Type:        models.NotificationCommentReply,
+		ActorID:     reply.UserID,
+		RecipientID: parent.UserID,
+		Title:       "Respondieron a tu comentario",
+		Body:        reply.Body,
+		Link:        "/api/v1/streaming/id/" + reply.VideoID + "/comments?parent_id=" + parent.Id,
+		Data:        map[string]string{"video_id": reply.VideoID, "comment_id": reply.Id, "parent_id": parent.Id},
+	})
+}
+
+// NotifyExportFinished cumple con ExportNotifier para avisar cuando termina una exportación de datos
+func (service *notificationService) NotifyExportFinished(export *models.DataExport) error {
+	title := "Tu exportación de datos está lista"
+	body := "Ya puedes descargar la copia de tus datos, el link es temporal."
+
+	if export.Status != models.ExportStatusReady {
+		title = "No se pudo generar tu exportación de datos"
+		body = "Ocurrió un error al generar la copia de tus datos, puedes volver a pedirla."
+	}
+
+	return service.Notify(&models.NotificationEvent{
+		Type:        models.NotificationExportReady,
+		RecipientID: export.UserID,
+		Title:       title,
+		Body:        body,
+		Link:        "/api/v1/users/me/export/" + export.Id,
+		Data:        map[string]string{"export_id": export.Id, "status": export.Status},
+	})
+}
+
+func (service *notificationService) ListNotifications(userId string, unreadOnly bool, cursor string, limit int) (*models.NotificationPage, error) {
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	size := pageSize(limit)
+	query := db.Where("user_id = ? AND in_app = ?", userId, true)
+
+	if unreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+
+	if after != nil {
+		query = query.Where("(created_at, id) < (?, ?)", after.Time, after.Id)
+	}
+
+	var notifications []models.Notification
+
+	// se pide uno más para saber si hay otra página
+	if err := query.Order("created_at DESC, id DESC").Limit(size + 1).Find(&notifications).Error; err != nil {
+		return nil, err
+	}
+
+	page := &models.NotificationPage{Items: notifications}
+
+	if len(notifications) > size {
+		page.Items = notifications[:size]
+		last := page.Items[size-1]
+		page.NextCursor = encodeCursor(last.CreatedAt, last.Id)
+	}
+
+	if page.Items == nil {
+		page.Items = []models.Notification{}
+	}
+
+	page.UnreadCount, err = service.CountUnread(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+func (service *notificationService) CountUnread(userId string) (int64, error) {
+	db, err := config.GetDB()
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+
+	err = db.Model(&models.Notification{}).
+		Where("user_id = ? AND in_app = ? AND read_at IS NULL", userId, true).
+		Count(&count).Error
+
+	return count, err
+}
+
+func (service *notificationService) MarkRead(userId string, notificationId string) error {
+	db, err := config.GetDB()
+	if err != nil {
+		return err
+	}
+
+	var notification models.Notification
+
+	err = db.Where("id = ? AND user_id = ? AND in_app = ?", notificationId, userId, true).First(&notification).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%w: %s", ErrNotificationNotFound, notificationId)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if notification.ReadAt != nil {
+		return nil
+	}
+
+	return db.Model(&notification).Update("read_at", time.Now()).Error
+}
+
+func (service *notificationService) MarkAllRead(userId string) error {
+	db, err := config.GetDB()
+	if err != nil {
+		return err
+	}
+
+	return db.Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userId).
+		Update("read_at", time.Now()).Error
+}
+
+// GetSettings devuelve las preferencias con los canales por defecto en los tipos no configurados
+func (service *notificationService) GetSettings(userId string) (*models.NotificationSettings, error) {
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	settings := models.NotificationSettings{UserID: userId}
+
+	err = db.Where("user_id = ?", userId).First(&settings).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	response := settings
+	response.WebhookSecret = ""
+	response.Channels = make(map[string][]string, len(models.NotificationTypes))
+
+	for _, notificationType := range models.NotificationTypes {
+		response.Channels[notificationType] = enabledNotificationChannels(&settings, notificationType)
+	}
+
+	return &response, nil
+}
+
+// UpdateSettings cambia solo los tipos enviados. Al configurar un webhook nuevo se genera
+// el secreto para firmarlo, que solo se devuelve en esta respuesta.
+func (service *notificationService) UpdateSettings(userId string, update *models.NotificationSettingsUpdate) (*models.NotificationSettings, error) {
+	for notificationType, channels := range update.Channels {
+		if !slices.Contains(models.NotificationTypes, notificationType) {
+			return nil, fmt.Errorf("%w: unknown notification type %s", ErrInvalidNotificationSettings, notificationType)
+		}
+
+		for _, channel := range channels {
+			if channel != models.NotificationChannelInApp && service.channels[channel] == nil {
+				return nil, fmt.Errorf("%w: unknown channel %s", ErrInvalidNotificationSettings, channel)
+			}
+		}
+	}
+
+	if update.WebhookURL != nil && *update.WebhookURL != "" {
+		if err := validateWebhookURL(*update.WebhookURL); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidNotificationSettings, err)
+		}
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	settings := models.NotificationSettings{UserID: userId}
+
+	err = db.Where("user_id = ?", userId).First(&settings).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if settings.Channels == nil {
+		settings.Channels = make(map[string][]string)
+	}
+
+	for notificationType, channels := range update.Channels {
+		settings.Channels[notificationType] = slices.Compact(slices.Sorted(slices.Values(channels)))
+	}
+
+	newSecret := ""
+
+	if update.WebhookURL != nil && *update.WebhookURL != settings.WebhookURL {
+		settings.WebhookURL = *update.WebhookURL
+		settings.WebhookSecret = ""
+
+		if settings.WebhookURL != "" {
+			secret := make([]byte, 32)
+			if _, err := rand.Read(secret); err != nil {
+				return nil, err
+			}
+			settings.WebhookSecret = hex.EncodeToString(secret)
+			newSecret = settings.WebhookSecret
+		}
+	}
+
+	if err := db.Save(&settings).Error; err != nil {
+		return nil, err
+	}
+
+	response, err := service.GetSettings(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	response.WebhookSecret = newSecret
+	return response, nil
+}
+
+// Run reparte los eventos y hace los envíos pendientes, cada cierto tiempo
+// o apenas llega un evento nuevo, hasta que se cancele el contexto
+func (service *notificationService) Run(ctx context.Context) {
+	ticker := time.NewTicker(config.GetConfig().NotificationPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := service.fanOutEvents(); err != nil {
+			log.Println("error al repartir las notificaciones: ", err)
+		}
+
+		if err := service.sendDeliveries(); err != nil {
+			log.Println("error al enviar las notificaciones: ", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-service.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (service *notificationService) fanOutEvents() error {
+	db, err := config.GetDB()
+	if err != nil {
+		return err
+	}
+
+	var events []models.NotificationEvent
+
+	err = db.Where("status = ?", models.NotificationStatusPending).Order("created_at").Limit(50).Find(&events).Error
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		if err := service.fanOutEvent(db, &event); err != nil {
+			log.Printf("error al repartir el evento %s: %v\n", event.Id, err)
+		}
+	}
+
+	return nil
+}
+
+// fanOutEvent reparte un evento por lotes de destinatarios, guardando en la misma transacción
+// hasta qué suscriptor se llegó, así un reinicio no duplica ni pierde notificaciones
+func (service *notificationService) fanOutEvent(db *gorm.DB, event *models.NotificationEvent) error {
+	if event.RecipientID != "" {
+		return db.Transaction(func(tx *gorm.DB) error {
+			if err := service.createNotifications(tx, event, []string{event.RecipientID}); err != nil {
+				return err
+			}
+
+			return tx.Model(event).Update("status", models.NotificationStatusDone).Error
+		})
+	}
+
+	batchSize := config.GetConfig().NotificationFanOutBatchSize
+
+	for {
+		var subscriberIds []string
+
+		err := db.Model(&models.Subscription{}).
+			Where("channel_id = ? AND subscriber_id > ?", event.ChannelID, event.FanOutCursor).
+			Order("subscriber_id").
+			Limit(batchSize).
+			Pluck("subscriber_id", &subscriberIds).Error
+
+		if err != nil {
+			return err
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if len(subscriberIds) == 0 {
+				return tx.Model(event).Update("status", models.NotificationStatusDone).Error
+			}
+
+			if err := service.createNotifications(tx, event, subscriberIds); err != nil {
+				return err
+			}
+
+			return tx.Model(event).Update("fan_out_cursor", subscriberIds[len(subscriberIds)-1]).Error
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if len(subscriberIds) == 0 {
+			return nil
+		}
+
+		event.FanOutCursor = subscriberIds[len(subscriberIds)-1]
+	}
+}
+
+// createNotifications crea la notificación de cada destinatario según sus preferencias,
+// y un envío pendiente por cada canal externo que tenga activo
+func (service *notificationService) createNotifications(tx *gorm.DB, event *models.NotificationEvent, userIds []string) error {
+	var settingsList []models.NotificationSettings
+
+	if err := tx.Where("user_id IN ?", userIds).Find(&settingsList).Error; err != nil {
+		return err
+	}
+
+	settingsByUser := make(map[string]*models.NotificationSettings, len(settingsList))
+	for i := range settingsList {
+		settingsByUser[settingsList[i].UserID] = &settingsList[i]
+	}
+
+	now := time.Now()
+	var notifications []models.Notification
+	var deliveries []models.NotificationDelivery
+
+	for _, userId := range userIds {
+		if userId == event.ActorID {
+			continue
+		}
+
+		channels := enabledNotificationChannels(settingsByUser[userId], event.Type)
+		if len(channels) == 0 {
+			continue
+		}
+
+		notification := models.Notification{
+			Id:      uuid.New().String(),
+			UserID:  userId,
+			EventID: event.Id,
+			Type:    event.Type,
+			Title:   event.Title,
+			Body:    event.Body,
+			Link:    event.Link,
+			Data:    event.Data,
+			InApp:   slices.Contains(channels, models.NotificationChannelInApp),
+		}
+		notifications = append(notifications, notification)
+
+		for _, channel := range channels {
+			if service.channels[channel] == nil {
+				continue
+			}
+
+			deliveries = append(deliveries, models.NotificationDelivery{
+				Id:             uuid.New().String(),
+				NotificationID: notification.Id,
+				UserID:         userId,
+				Channel:        channel,
+				Status:         models.NotificationStatusPending,
+				NextAttemptAt:  now,
+			})
+		}
+	}
+
+	if len(notifications) > 0 {
+		if err := tx.CreateInBatches(&notifications, 500).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(deliveries) > 0 {
+		if err := tx.CreateInBatches(&deliveries, 500).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sendDeliveries hace los envíos pendientes, los que fallan se reintentan con espera creciente
+func (service *notificationService) sendDeliveries() error {
+	db, err := config.GetDB()
+	if err != nil {
+		return err
+	}
+
+	cfg := config.GetConfig()
+
+	for {
+		var deliveries []models.NotificationDelivery
+
+		err := db.Where("status = ? AND next_attempt_at <= ?", models.NotificationStatusPending, time.Now()).
+			Order("next_attempt_at").Limit(100).Find(&deliveries).Error
+
+		if err != nil {
+			return err
+		}
+
+		for _, delivery := range deliveries {
+			sendErr := service.deliver(db, &delivery)
+
+			updates := map[string]interface{}{"attempts": delivery.Attempts + 1}
+
+			switch {
+			case sendErr == nil:
+				updates["status"] = models.NotificationStatusDone
+				updates["last_error"] = ""
+			case delivery.Attempts+1 >= cfg.NotificationMaxAttempts:
+				updates["status"] = models.NotificationStatusFailed
+				updates["last_error"] = sendErr.Error()
+			default:
+				wait := time.Duration(float64(cfg.NotificationRetryBaseDelay) * math.Pow(2, float64(delivery.Attempts)))
+				updates["next_attempt_at"] = time.Now().Add(wait)
+				updates["last_error"] = sendErr.Error()
+			}
+
+			if err := db.Model(&delivery).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(deliveries) < 100 {
+			return nil
+		}
+	}
+}
+
+func (service *notificationService) deliver(db *gorm.DB, delivery *models.NotificationDelivery) error {
+	channel := service.channels[delivery.Channel]
+	if channel == nil {
+		return fmt.Errorf("unknown notification channel %s", delivery.Channel)
+	}
+
+	var notification models.Notification
+	if err := db.Where("id = ?", delivery.NotificationID).First(&notification).Error; err != nil {
+		return err
+	}
+
+	var recipient models.User
+	if err := db.Where("id = ?", delivery.UserID).First(&recipient).Error; err != nil {
+		return err
+	}
+
+	var settings models.NotificationSettings
+	err := db.Where("user_id = ?", delivery.UserID).First(&settings).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	return channel.Deliver(&notification, &recipient, &settings)
+}
+
+// enabledNotificationChannels son los canales que el usuario tiene activos para un tipo
+func enabledNotificationChannels(settings *models.NotificationSettings, notificationType string) []string {
+	if settings != nil {
+		if channels, ok := settings.Channels[notificationType]; ok {
+			return channels
+		}
+	}
+
+	return defaultNotificationChannels[notificationType]
+}
+
+func collectNotifications(db *gorm.DB, userId string) (interface{}, error) {
+	var settings []models.NotificationSettings
+	if err := db.Where("user_id = ?", userId).Find(&settings).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range settings {
+		settings[i].WebhookSecret = ""
+	}
+
+	var notifications []models.Notification
+	if err := db.Where("user_id = ?", userId).Order("created_at").Find(&notifications).Error; err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"settings":      settings,
+		"notifications": notifications,
+	}, nil
+}
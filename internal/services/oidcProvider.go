@@ -0,0 +1,309 @@
+package services
+
+// extension del oidcService con el cliente HTTP de cada proveedor: discovery, JWKS,
+// intercambio del código y verificación del id_token
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/unbot2313/go-streaming-service/config"
+)
+
+// oidcDiscovery es la parte del documento /.well-known/openid-configuration que se usa
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	TokenType   string `json:"token_type"`
+}
+
+// oidcClaims son los claims del id_token que se usan para enlazar la cuenta
+type oidcClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+}
+
+type oidcProvider struct {
+	config     config.OIDCProviderConfig
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]*rsa.PublicKey
+	// keysFetchedAt es cuándo se pidió el JWKS por última vez, para no pedirlo con cada kid desconocido
+	keysFetchedAt time.Time
+}
+
+// jwksRefreshInterval es el tiempo mínimo entre dos descargas del JWKS
+const jwksRefreshInterval = time.Minute
+
+func newOIDCProvider(providerConfig config.OIDCProviderConfig, httpClient *http.Client) *oidcProvider {
+	return &oidcProvider{
+		config:     providerConfig,
+		httpClient: httpClient,
+	}
+}
+
+// getDiscovery descarga el documento de discovery una vez y lo reutiliza
+func (provider *oidcProvider) getDiscovery() (*oidcDiscovery, error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	if provider.discovery != nil {
+		return provider.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	err := provider.getJSON(provider.config.Issuer+"/.well-known/openid-configuration", &discovery)
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener el discovery de %s: %w", provider.config.Name, err)
+	}
+
+	if strings.TrimSuffix(discovery.Issuer, "/") != provider.config.Issuer {
+		return nil, fmt.Errorf("el issuer %s no coincide con el configurado %s", discovery.Issuer, provider.config.Issuer)
+	}
+
+	provider.discovery = &discovery
+	return provider.discovery, nil
+}
+
+func (provider *oidcProvider) AuthorizationURL(state, nonce, codeChallenge string) (string, error) {
+	discovery, err := provider.getDiscovery()
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("authorization_endpoint inválido: %w", err)
+	}
+
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.config.ClientID)
+	query.Set("redirect_uri", provider.config.RedirectURL)
+	query.Set("scope", strings.Join(provider.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+
+	return authURL.String(), nil
+}
+
+// Exchange cambia el código de autorización por los tokens usando el code_verifier de PKCE
+func (provider *oidcProvider) Exchange(code, codeVerifier string) (*oidcTokenResponse, error) {
+	discovery, err := provider.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", provider.config.RedirectURL)
+	form.Set("client_id", provider.config.ClientID)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	if provider.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(provider.config.ClientID), url.QueryEscape(provider.config.ClientSecret))
+	}
+
+	resp, err := provider.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error al llamar al token_endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("el token_endpoint respondió %d: %s", resp.StatusCode, string(body))
+	}
+
+	var tokens oidcTokenResponse
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("error parseando la respuesta del token_endpoint: %w", err)
+	}
+
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("el proveedor no devolvió un id_token")
+	}
+
+	return &tokens, nil
+}
+
+// VerifyIDToken valida la firma, el issuer, la audiencia, la expiración y el nonce del id_token
+func (provider *oidcProvider) VerifyIDToken(rawIDToken, nonce string) (*oidcClaims, error) {
+	var claims oidcClaims
+
+	_, err := jwt.ParseWithClaims(rawIDToken, &claims, provider.keyFunc,
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512"}),
+		jwt.WithIssuer(provider.config.Issuer),
+		jwt.WithAudience(provider.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("id_token inválido: %w", err)
+	}
+
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("el nonce del id_token no coincide")
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("el id_token no tiene sub")
+	}
+
+	return &claims, nil
+}
+
+// keyFunc busca la llave pública por kid, y si no la conoce vuelve a descargar el JWKS
+// por si el proveedor rotó sus llaves. Se descarga como mucho una vez por minuto, así
+// unos tokens con kids inventados no hacen que se pida el JWKS con cada uno
+func (provider *oidcProvider) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	if key := provider.cachedKey(kid); key != nil {
+		return key, nil
+	}
+
+	if provider.reserveKeysRefresh() {
+		if err := provider.refreshKeys(); err != nil {
+			return nil, err
+		}
+
+		if key := provider.cachedKey(kid); key != nil {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no se encontró la llave %q en el JWKS", kid)
+}
+
+// reserveKeysRefresh dice si ya se puede volver a pedir el JWKS y marca la descarga,
+// aunque falle, para que los intentos a la vez no la repitan
+func (provider *oidcProvider) reserveKeysRefresh() bool {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	if time.Since(provider.keysFetchedAt) < jwksRefreshInterval {
+		return false
+	}
+
+	provider.keysFetchedAt = time.Now()
+	return true
+}
+
+func (provider *oidcProvider) cachedKey(kid string) *rsa.PublicKey {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	if key, ok := provider.keys[kid]; ok {
+		return key
+	}
+
+	// si el token no trae kid y solo hay una llave, se usa esa
+	if kid == "" && len(provider.keys) == 1 {
+		for _, key := range provider.keys {
+			return key
+		}
+	}
+
+	return nil
+}
+
+func (provider *oidcProvider) refreshKeys() error {
+	discovery, err := provider.getDiscovery()
+	if err != nil {
+		return err
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+
+	if err := provider.getJSON(discovery.JWKSURI, &jwks); err != nil {
+		return fmt.Errorf("error al obtener el JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			continue
+		}
+
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	provider.mu.Lock()
+	provider.keys = keys
+	provider.mu.Unlock()
+
+	return nil
+}
+
+func (provider *oidcProvider) getJSON(endpoint string, target interface{}) error {
+	resp, err := provider.httpClient.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s respondió %d", endpoint, resp.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(target)
+}
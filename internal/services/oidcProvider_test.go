@@ -0,0 +1,459 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/unbot2313/go-streaming-service/config"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+)
+
+const (
+	mockClientID     = "streaming-service"
+	mockClientSecret = "secret"
+	mockRedirectURL  = "http://localhost:8080/api/v1/auth/oidc/mock/callback"
+)
+
+// mockOIDCProvider es un proveedor OpenID Connect en memoria: discovery, authorize que aprueba
+// al usuario de inmediato, token con PKCE y JWKS
+type mockOIDCProvider struct {
+	server *httptest.Server
+
+	mu    sync.Mutex
+	key   *rsa.PrivateKey
+	kid   string
+	codes map[string]mockAuthorization
+	// signingKey firma los id_token con otra llave que la publicada en el JWKS
+	signingKey *rsa.PrivateKey
+	// issuer reemplaza al issuer del discovery
+	issuer string
+	// jwksRequests cuenta las veces que se pidió el JWKS
+	jwksRequests int
+}
+
+type mockAuthorization struct {
+	challenge   string
+	nonce       string
+	redirectURI string
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	t.Helper()
+
+	mock := &mockOIDCProvider{codes: make(map[string]mockAuthorization)}
+	mock.rotateKey(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", mock.discovery)
+	mux.HandleFunc("/authorize", mock.authorize)
+	mux.HandleFunc("/token", mock.token)
+	mux.HandleFunc("/jwks", mock.jwks)
+
+	mock.server = httptest.NewServer(mux)
+	t.Cleanup(mock.server.Close)
+
+	return mock
+}
+
+// rotateKey cambia la llave con la que se firman los id_token, con otro kid
+func (mock *mockOIDCProvider) rotateKey(t *testing.T) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	mock.key = key
+	mock.kid = randomURLSafeString(6)
+}
+
+func (mock *mockOIDCProvider) providerConfig() config.OIDCProviderConfig {
+	return config.OIDCProviderConfig{
+		Name:         "mock",
+		Issuer:       mock.server.URL,
+		ClientID:     mockClientID,
+		ClientSecret: mockClientSecret,
+		RedirectURL:  mockRedirectURL,
+		Scopes:       []string{"openid", "email", "profile"},
+	}
+}
+
+func (mock *mockOIDCProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	mock.mu.Lock()
+	issuer := mock.issuer
+	mock.mu.Unlock()
+
+	if issuer == "" {
+		issuer = mock.server.URL
+	}
+
+	json.NewEncoder(w).Encode(oidcDiscovery{
+		Issuer:                issuer,
+		AuthorizationEndpoint: mock.server.URL + "/authorize",
+		TokenEndpoint:         mock.server.URL + "/token",
+		JWKSURI:               mock.server.URL + "/jwks",
+	})
+}
+
+// authorize aprueba el login y redirige al callback con el código y el mismo state
+func (mock *mockOIDCProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if query.Get("response_type") != "code" || query.Get("client_id") != mockClientID || query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	code := randomURLSafeString(16)
+
+	mock.mu.Lock()
+	mock.codes[code] = mockAuthorization{
+		challenge:   query.Get("code_challenge"),
+		nonce:       query.Get("nonce"),
+		redirectURI: query.Get("redirect_uri"),
+	}
+	mock.mu.Unlock()
+
+	callback, _ := url.Parse(query.Get("redirect_uri"))
+	callback.RawQuery = url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+
+	http.Redirect(w, r, callback.String(), http.StatusFound)
+}
+
+// token cambia el código por un id_token si el code_verifier corresponde al challenge
+func (mock *mockOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	clientID, secret, _ := r.BasicAuth()
+	if clientID != mockClientID || secret != mockClientSecret {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	r.ParseForm()
+
+	mock.mu.Lock()
+	authorization, ok := mock.codes[r.PostForm.Get("code")]
+	// los códigos son de un solo uso
+	delete(mock.codes, r.PostForm.Get("code"))
+	mock.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("redirect_uri") != authorization.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != authorization.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(oidcTokenResponse{
+		AccessToken: randomURLSafeString(16),
+		IDToken:     mock.idToken(authorization.nonce),
+		TokenType:   "Bearer",
+	})
+}
+
+func (mock *mockOIDCProvider) idToken(nonce string) string {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, oidcClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    mock.server.URL,
+			Subject:   "mock-user-1",
+			Audience:  jwt.ClaimStrings{mockClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+		Nonce:             nonce,
+		Email:             "jane@example.com",
+		EmailVerified:     true,
+		PreferredUsername: "jane",
+	})
+	token.Header["kid"] = mock.kid
+
+	key := mock.key
+	if mock.signingKey != nil {
+		key = mock.signingKey
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		panic(err)
+	}
+
+	return signed
+}
+
+func (mock *mockOIDCProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	mock.jwksRequests++
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": mock.kid,
+			"n":   base64.RawURLEncoding.EncodeToString(mock.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(mock.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (mock *mockOIDCProvider) countJWKSRequests() int {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	return mock.jwksRequests
+}
+
+// login hace lo que haría el navegador: abre la url de autorización y lee el callback al que redirige
+func (mock *mockOIDCProvider) login(t *testing.T, provider *oidcProvider, state, nonce, verifier string) (code string, returnedState string) {
+	t.Helper()
+
+	authURL, err := provider.AuthorizationURL(state, nonce, pkceChallenge(verifier))
+	if err != nil {
+		t.Fatalf("AuthorizationURL: %v", err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize status = %d", resp.StatusCode)
+	}
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(callback.String(), mockRedirectURL) {
+		t.Fatalf("redirected to %s, want the callback", callback)
+	}
+
+	return callback.Query().Get("code"), callback.Query().Get("state")
+}
+
+func TestOIDCProviderCodeFlowWithPKCE(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	provider := newOIDCProvider(mock.providerConfig(), mock.server.Client())
+
+	code, state := mock.login(t, provider, "state-1", "nonce-1", "verifier-1")
+
+	if state != "state-1" {
+		t.Errorf("state = %q, want the one sent", state)
+	}
+
+	tokens, err := provider.Exchange(code, "verifier-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	claims, err := provider.VerifyIDToken(tokens.IDToken, "nonce-1")
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+
+	if claims.Subject != "mock-user-1" || claims.Email != "jane@example.com" || !claims.EmailVerified || claims.PreferredUsername != "jane" {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	// el código ya se usó
+	if _, err := provider.Exchange(code, "verifier-1"); err == nil {
+		t.Error("second exchange with the same code: want an error")
+	}
+}
+
+func TestOIDCProviderRejectsWrongCodeVerifier(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	provider := newOIDCProvider(mock.providerConfig(), mock.server.Client())
+
+	code, _ := mock.login(t, provider, "state-1", "nonce-1", "verifier-1")
+
+	if _, err := provider.Exchange(code, "another-verifier"); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("err = %v, want invalid_grant", err)
+	}
+}
+
+func TestOIDCProviderRejectsNonceMismatch(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	provider := newOIDCProvider(mock.providerConfig(), mock.server.Client())
+
+	code, _ := mock.login(t, provider, "state-1", "nonce-1", "verifier-1")
+
+	tokens, err := provider.Exchange(code, "verifier-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	if _, err := provider.VerifyIDToken(tokens.IDToken, "nonce-of-another-login"); err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Errorf("err = %v, want a nonce error", err)
+	}
+}
+
+func TestOIDCProviderRejectsBadSignature(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	provider := newOIDCProvider(mock.providerConfig(), mock.server.Client())
+
+	// firmado con una llave que no está en el JWKS pero con el kid publicado
+	forged, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.signingKey = forged
+
+	code, _ := mock.login(t, provider, "state-1", "nonce-1", "verifier-1")
+
+	tokens, err := provider.Exchange(code, "verifier-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	if _, err := provider.VerifyIDToken(tokens.IDToken, "nonce-1"); !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+		t.Errorf("err = %v, want an invalid signature", err)
+	}
+
+	// un token sin firma tampoco sirve
+	unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"sub": "mock-user-1", "nonce": "nonce-1"}).
+		SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	if _, err := provider.VerifyIDToken(unsigned, "nonce-1"); err == nil {
+		t.Error("unsigned token: want an error")
+	}
+}
+
+func TestOIDCProviderRefreshesRotatedKeys(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	provider := newOIDCProvider(mock.providerConfig(), mock.server.Client())
+
+	for i := 0; i < 2; i++ {
+		code, _ := mock.login(t, provider, "state", "nonce", "verifier")
+
+		tokens, err := provider.Exchange(code, "verifier")
+		if err != nil {
+			t.Fatalf("Exchange: %v", err)
+		}
+
+		if _, err := provider.VerifyIDToken(tokens.IDToken, "nonce"); err != nil {
+			t.Fatalf("login %d: VerifyIDToken: %v", i+1, err)
+		}
+
+		// el segundo id_token viene firmado con un kid que el cliente todavía no conoce
+		mock.rotateKey(t)
+		backdateKeysFetch(provider)
+	}
+}
+
+func TestOIDCProviderLimitsJWKSRefreshes(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	provider := newOIDCProvider(mock.providerConfig(), mock.server.Client())
+
+	verify := func() error {
+		code, _ := mock.login(t, provider, "state", "nonce", "verifier")
+
+		tokens, err := provider.Exchange(code, "verifier")
+		if err != nil {
+			t.Fatalf("Exchange: %v", err)
+		}
+
+		_, err = provider.VerifyIDToken(tokens.IDToken, "nonce")
+		return err
+	}
+
+	if err := verify(); err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+
+	// dentro del mismo minuto un kid desconocido no vuelve a pedir el JWKS
+	for i := 0; i < 3; i++ {
+		mock.rotateKey(t)
+
+		if err := verify(); err == nil {
+			t.Fatalf("token %d with an unknown kid: want an error", i+1)
+		}
+	}
+
+	if requests := mock.countJWKSRequests(); requests != 1 {
+		t.Errorf("jwks requests = %d, want 1", requests)
+	}
+
+	backdateKeysFetch(provider)
+
+	if err := verify(); err != nil {
+		t.Fatalf("after a minute: VerifyIDToken: %v", err)
+	}
+
+	if requests := mock.countJWKSRequests(); requests != 2 {
+		t.Errorf("jwks requests = %d, want 2", requests)
+	}
+}
+
+// backdateKeysFetch hace como si el JWKS se hubiera pedido hace más de un minuto
+func backdateKeysFetch(provider *oidcProvider) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	provider.keysFetchedAt = provider.keysFetchedAt.Add(-jwksRefreshInterval)
+}
+
+func TestOIDCProviderRejectsIssuerMismatch(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	mock.issuer = "https://attacker.example.com"
+
+	provider := newOIDCProvider(mock.providerConfig(), mock.server.Client())
+
+	if _, err := provider.AuthorizationURL("state", "nonce", pkceChallenge("verifier")); err == nil || !strings.Contains(err.Error(), "issuer") {
+		t.Errorf("err = %v, want an issuer error", err)
+	}
+}
+
+func TestValidLoginState(t *testing.T) {
+	now := time.Now()
+
+	if _, err := validLoginState(nil, now); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("unknown state: err = %v, want ErrInvalidOIDCState", err)
+	}
+
+	expired := []models.OIDCLoginState{{State: "state-1", ExpiresAt: now.Add(-time.Second)}}
+	if _, err := validLoginState(expired, now); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("expired state: err = %v, want ErrInvalidOIDCState", err)
+	}
+
+	valid := []models.OIDCLoginState{{State: "state-1", CodeVerifier: "verifier-1", ExpiresAt: now.Add(time.Minute)}}
+	loginState, err := validLoginState(valid, now)
+	if err != nil || loginState.CodeVerifier != "verifier-1" {
+		t.Errorf("valid state: %+v, %v", loginState, err)
+	}
+}
+
+func TestPKCEChallenge(t *testing.T) {
+	// ejemplo del RFC 7636, apéndice B
+	if got := pkceChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("challenge = %q", got)
+	}
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/unbot2313/go-streaming-service/config"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownOIDCProvider = errors.New("proveedor de identidad no configurado")
+	ErrInvalidOIDCState    = errors.New("el login externo expiró o no es válido")
+)
+
+var invalidUsernameChars = regexp.MustCompile(`[^a-z0-9_.-]+`)
+
+type oidcService struct {
+	authService AuthService
+	userService UserService
+	httpClient  *http.Client
+
+	mu        sync.Mutex
+	providers map[string]*oidcProvider
+}
+
+type OIDCService interface {
+	// AuthorizationURL inicia el login con el proveedor y devuelve la url a la que se redirige al usuario
+	AuthorizationURL(providerName string) (string, error)
+	// HandleCallback termina el login, enlaza o crea el usuario y devuelve el JWT propio del servicio
+	HandleCallback(providerName, state, code string) (string, *models.User, error)
+}
+
+func NewOIDCService(authService AuthService, userService UserService) OIDCService {
+	return &oidcService{
+		authService: authService,
+		userService: userService,
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+		providers:   make(map[string]*oidcProvider),
+	}
+}
+
+func (service *oidcService) getProvider(providerName string) (*oidcProvider, error) {
+	providerConfig, ok := config.GetConfig().OIDCProviders[strings.ToLower(providerName)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownOIDCProvider, providerName)
+	}
+
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	provider, ok := service.providers[providerConfig.Name]
+	if !ok {
+		provider = newOIDCProvider(providerConfig, service.httpClient)
+		service.providers[providerConfig.Name] = provider
+	}
+
+	return provider, nil
+}
+
+func (service *oidcService) AuthorizationURL(providerName string) (string, error) {
+	provider, err := service.getProvider(providerName)
+	if err != nil {
+		return "", err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return "", err
+	}
+
+	loginState := models.OIDCLoginState{
+		State:        randomURLSafeString(32),
+		Provider:     provider.config.Name,
+		Nonce:        randomURLSafeString(32),
+		CodeVerifier: randomURLSafeString(32),
+		ExpiresAt:    time.Now().Add(config.GetConfig().OIDCStateTTL),
+	}
+
+	// PKCE: se envía el hash del verifier y el verifier se guarda para el callback
+	authURL, err := provider.AuthorizationURL(loginState.State, loginState.Nonce, pkceChallenge(loginState.CodeVerifier))
+	if err != nil {
+		return "", err
+	}
+
+	if err := db.Create(&loginState).Error; err != nil {
+		return "", err
+	}
+
+	// limpiar los logins que nunca volvieron del proveedor
+	db.Where("expires_at < ?", time.Now()).Delete(&models.OIDCLoginState{})
+
+	return authURL, nil
+}
+
+func (service *oidcService) HandleCallback(providerName, state, code string) (string, *models.User, error) {
+	provider, err := service.getProvider(providerName)
+	if err != nil {
+		return "", nil, err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return "", nil, err
+	}
+
+	// el state se usa una sola vez, se borra y se devuelve en la misma consulta
+	var loginStates []models.OIDCLoginState
+	err = db.Raw("DELETE FROM oidc_login_states WHERE state = ? AND provider = ? RETURNING *", state, provider.config.Name).
+		Scan(&loginStates).Error
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	loginState, err := validLoginState(loginStates, time.Now())
+	if err != nil {
+		return "", nil, err
+	}
+
+	tokens, err := provider.Exchange(code, loginState.CodeVerifier)
+	if err != nil {
+		return "", nil, err
+	}
+
+	claims, err := provider.VerifyIDToken(tokens.IDToken, loginState.Nonce)
+	if err != nil {
+		return "", nil, err
+	}
+
+	user, err := service.findOrCreateUser(db, provider.config.Name, claims)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err := checkSuspension(user); err != nil {
+		return "", nil, err
+	}
+
+	token, err := service.authService.GenerateToken(user)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return token, user, nil
+}
+
+// validLoginState revisa que el callback traiga un state que se generó en AuthorizationURL y que no expiró
+func validLoginState(loginStates []models.OIDCLoginState, now time.Time) (*models.OIDCLoginState, error) {
+	if len(loginStates) == 0 || loginStates[0].ExpiresAt.Before(now) {
+		return nil, ErrInvalidOIDCState
+	}
+
+	return &loginStates[0], nil
+}
+
+// pkceChallenge es el code_challenge S256 del verifier
+func pkceChallenge(codeVerifier string) string {
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(challenge[:])
+}
+
+// findOrCreateUser busca el usuario enlazado a la identidad externa y si es el primer login lo crea.
+// No se enlaza por email con cuentas ya existentes para evitar que un proveedor tome una cuenta ajena.
+func (service *oidcService) findOrCreateUser(db *gorm.DB, providerName string, claims *oidcClaims) (*models.User, error) {
+	var identity models.UserIdentity
+
+	err := db.Where("provider = ? AND subject = ?", providerName, claims.Subject).First(&identity).Error
+
+	if err == nil {
+		return service.userService.GetUserByID(identity.UserID)
+	}
+
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	username, err := service.availableUsername(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	email := ""
+	if claims.EmailVerified {
+		email = claims.Email
+	}
+
+	// la contraseña es aleatoria, la cuenta solo se usa a través del proveedor
+	user, err := service.userService.CreateUser(&models.User{
+		Username: username,
+		Password: randomURLSafeString(32),
+		Email:    email,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	identity = models.UserIdentity{
+		Id:       uuid.New().String(),
+		UserID:   user.Id,
+		Provider: providerName,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+
+	if err := db.Create(&identity).Error; err != nil {
+		// otro login simultáneo con la misma identidad ya la enlazó
+		db.Unscoped().Where("id = ?", user.Id).Delete(&models.User{})
+
+		var existing models.UserIdentity
+		if errFind := db.Where("provider = ? AND subject = ?", providerName, claims.Subject).First(&existing).Error; errFind == nil {
+			return service.userService.GetUserByID(existing.UserID)
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// availableUsername arma un username a partir de los claims y le agrega un sufijo si ya está en uso
+func (service *oidcService) availableUsername(claims *oidcClaims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" && claims.Email != "" {
+		base = strings.Split(claims.Email, "@")[0]
+	}
+
+	base = invalidUsernameChars.ReplaceAllString(strings.ToLower(base), "")
+	if base == "" {
+		base = "user"
+	}
+	if len(base) > 80 {
+		base = base[:80]
+	}
+
+	candidate := base
+	for i := 0; i < 5; i++ {
+		_, err := service.userService.GetUserByUserName(candidate)
+
+		if errors.Is(err, ErrUserNotFound) {
+			return candidate, nil
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		candidate = fmt.Sprintf("%s-%s", base, randomURLSafeString(3))
+	}
+
+	return "", fmt.Errorf("no se pudo generar un username disponible para %s", base)
+}
+
+// randomURLSafeString genera n bytes aleatorios codificados en base64 url-safe
+func randomURLSafeString(n int) string {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		panic(fmt.Sprintf("error al generar bytes aleatorios: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
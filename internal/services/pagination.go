@@ -0,0 +1,82 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// pageCursor es la posición del último elemento de una página ordenada por fecha e id
+// (o por puntaje, fecha e id), la siguiente página empieza después de él
+type pageCursor struct {
+	Score int64
+	Time  time.Time
+	Id    string
+}
+
+func encodeCursor(t time.Time, id string) string {
+	raw := strconv.FormatInt(t.UnixNano(), 10) + "|" + id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// encodeScoredCursor es para listas ordenadas primero por un puntaje, ejm: número de respuestas
+func encodeScoredCursor(score int64, t time.Time, id string) string {
+	raw := strconv.FormatInt(score, 10) + "|" + strconv.FormatInt(t.UnixNano(), 10) + "|" + id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor devuelve nil si no se envió cursor (primera página)
+func decodeCursor(cursor string) (*pageCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	parts := strings.SplitN(string(raw), "|", 3)
+	cursorPosition := &pageCursor{}
+
+	if len(parts) == 3 {
+		if cursorPosition.Score, err = strconv.ParseInt(parts[0], 10, 64); err != nil {
+			return nil, ErrInvalidCursor
+		}
+		parts = parts[1:]
+	}
+
+	if len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+
+	unixNano, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	cursorPosition.Time = time.Unix(0, unixNano)
+	cursorPosition.Id = parts[1]
+
+	return cursorPosition, nil
+}
+
+// pageSize limita el tamaño de página que pide el cliente
+func pageSize(limit int) int {
+	if limit <= 0 {
+		return defaultPageSize
+	}
+	if limit > maxPageSize {
+		return maxPageSize
+	}
+	return limit
+}
@@ -0,0 +1,330 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"github.com/unbot2313/go-streaming-service/config"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrPlaybackSessionEnded = errors.New("playback session already ended")
+
+type playbackService struct {
+	viewService         ViewService
+	watchHistoryService WatchHistoryService
+}
+
+// PlaybackService recibe los heartbeats del reproductor y los agrega en tiempo visto,
+// duración promedio y curva de retención de cada video
+type PlaybackService interface {
+	StartSession(videoId string, viewer models.Viewer) (*models.PlaybackSession, error)
+	Heartbeat(sessionId string, viewer models.Viewer, heartbeat *models.HeartbeatRequest) (*models.PlaybackSession, error)
+	GetVideoAnalytics(videoId string) (*models.VideoWatchAnalytics, error)
+	AggregateSessions() error
+	Run(ctx context.Context)
+}
+
+func NewPlaybackService(viewService ViewService, watchHistoryService WatchHistoryService) PlaybackService {
+	return &playbackService{
+		viewService:         viewService,
+		watchHistoryService: watchHistoryService,
+	}
+}
+
+func (service *playbackService) StartSession(videoId string, viewer models.Viewer) (*models.PlaybackSession, error) {
+	return service.viewService.StartSession(videoId, viewer)
+}
+
+func (service *playbackService) Heartbeat(sessionId string, viewer models.Viewer, heartbeat *models.HeartbeatRequest) (*models.PlaybackSession, error) {
+	session, err := service.viewService.GetSession(sessionId, viewer)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.EndedAt != nil || session.Aggregated {
+		return nil, ErrPlaybackSessionEnded
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var bufferingMs int64
+	for _, event := range heartbeat.BufferingEvents {
+		bufferingMs += event.DurationMs
+	}
+
+	// si desde el heartbeat anterior se estaba reproduciendo, ese tiempo cuenta como visto
+	// menos lo que estuvo cargando. Un heartbeat muy atrasado no suma más que el máximo.
+	watched := session.WatchedSeconds
+	if session.Playing {
+		gap := math.Min(time.Since(session.LastSeenAt).Seconds(), config.GetConfig().PlaybackHeartbeatMaxGap.Seconds())
+		watched += math.Max(0, gap-float64(bufferingMs)/1000)
+	}
+
+	if _, err := service.viewService.AddWatchTime(session, watched); err != nil {
+		return nil, err
+	}
+
+	session.LastPosition = heartbeat.Position
+	session.Playing = heartbeat.Playing && !heartbeat.Ended
+	session.BufferingCount += len(heartbeat.BufferingEvents)
+	session.BufferingMs += bufferingMs
+
+	if heartbeat.Ended {
+		now := time.Now()
+		session.EndedAt = &now
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&models.PlaybackHeartbeat{
+			SessionID:      session.Id,
+			VideoID:        session.VideoID,
+			Position:       heartbeat.Position,
+			Bitrate:        heartbeat.Bitrate,
+			Playing:        session.Playing,
+			BufferingCount: len(heartbeat.BufferingEvents),
+			BufferingMs:    bufferingMs,
+		}).Error
+
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&models.PlaybackSession{}).Where("id = ?", session.Id).Updates(map[string]interface{}{
+			"last_position":   session.LastPosition,
+			"playing":         session.Playing,
+			"buffering_count": session.BufferingCount,
+			"buffering_ms":    session.BufferingMs,
+			"ended_at":        session.EndedAt,
+		}).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// los usuarios con sesión guardan hasta dónde vieron para retomar después
+	if session.UserID != "" {
+		err := service.watchHistoryService.UpdateProgress(session.UserID, session.VideoID, heartbeat.Position, heartbeat.Duration, heartbeat.Ended)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return session, nil
+}
+
+func (service *playbackService) GetVideoAnalytics(videoId string) (*models.VideoWatchAnalytics, error) {
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var stats models.VideoWatchStats
+
+	err = db.Where("video_id = ?", videoId).First(&stats).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var buckets []models.VideoRetentionBucket
+
+	if err := db.Where("video_id = ?", videoId).Order("position").Find(&buckets).Error; err != nil {
+		return nil, err
+	}
+
+	analytics := &models.VideoWatchAnalytics{
+		VideoID:           videoId,
+		Sessions:          stats.Sessions,
+		TotalWatchSeconds: stats.TotalWatchSeconds,
+		BufferingCount:    stats.BufferingCount,
+		BufferingMs:       stats.BufferingMs,
+		Retention:         make([]models.RetentionPoint, 0, len(buckets)),
+	}
+
+	if stats.Sessions > 0 {
+		analytics.AverageViewDuration = stats.TotalWatchSeconds / float64(stats.Sessions)
+	}
+
+	if stats.BitrateSamples > 0 {
+		analytics.AverageBitrate = float64(stats.BitrateSum) / float64(stats.BitrateSamples)
+	}
+
+	for _, bucket := range buckets {
+		point := models.RetentionPoint{Position: bucket.Position, Viewers: bucket.Viewers}
+		if stats.Sessions > 0 {
+			point.Ratio = float64(bucket.Viewers) / float64(stats.Sessions)
+		}
+		analytics.Retention = append(analytics.Retention, point)
+	}
+
+	return analytics, nil
+}
+
+// Run agrega las sesiones terminadas cada cierto tiempo hasta que se cancele el contexto
+func (service *playbackService) Run(ctx context.Context) {
+	ticker := time.NewTicker(config.GetConfig().PlaybackAggregateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := service.AggregateSessions(); err != nil {
+				log.Println("error al agregar las sesiones de reproducción: ", err)
+			}
+		}
+	}
+}
+
+// AggregateSessions suma a las estadísticas de cada video las sesiones que terminaron
+// o que dejaron de enviar heartbeats, y borra sus heartbeats
+func (service *playbackService) AggregateSessions() error {
+	db, err := config.GetDB()
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-config.GetConfig().PlaybackSessionTimeout)
+
+	for {
+		var sessions []models.PlaybackSession
+
+		err := db.Where("aggregated = ? AND (ended_at IS NOT NULL OR last_seen_at < ?)", false, cutoff).
+			Limit(200).Find(&sessions).Error
+
+		if err != nil {
+			return err
+		}
+
+		for _, session := range sessions {
+			if err := service.aggregateSession(db, &session); err != nil {
+				return err
+			}
+		}
+
+		if len(sessions) < 200 {
+			return nil
+		}
+	}
+}
+
+func (service *playbackService) aggregateSession(db *gorm.DB, session *models.PlaybackSession) error {
+	var heartbeats []models.PlaybackHeartbeat
+
+	if err := db.Where("session_id = ?", session.Id).Order("created_at, id").Find(&heartbeats).Error; err != nil {
+		return err
+	}
+
+	var bitrateSum, bitrateSamples int64
+	for _, heartbeat := range heartbeats {
+		if heartbeat.Bitrate > 0 {
+			bitrateSum += int64(heartbeat.Bitrate)
+			bitrateSamples++
+		}
+	}
+
+	bucketSize := config.GetConfig().RetentionBucketSeconds
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		stats := models.VideoWatchStats{
+			VideoID:           session.VideoID,
+			Sessions:          1,
+			TotalWatchSeconds: session.WatchedSeconds,
+			BufferingCount:    int64(session.BufferingCount),
+			BufferingMs:       session.BufferingMs,
+			BitrateSum:        bitrateSum,
+			BitrateSamples:    bitrateSamples,
+		}
+
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "video_id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"sessions":            gorm.Expr("video_watch_stats.sessions + excluded.sessions"),
+				"total_watch_seconds": gorm.Expr("video_watch_stats.total_watch_seconds + excluded.total_watch_seconds"),
+				"buffering_count":     gorm.Expr("video_watch_stats.buffering_count + excluded.buffering_count"),
+				"buffering_ms":        gorm.Expr("video_watch_stats.buffering_ms + excluded.buffering_ms"),
+				"bitrate_sum":         gorm.Expr("video_watch_stats.bitrate_sum + excluded.bitrate_sum"),
+				"bitrate_samples":     gorm.Expr("video_watch_stats.bitrate_samples + excluded.bitrate_samples"),
+				"updated_at":          gorm.Expr("excluded.updated_at"),
+			}),
+		}).Create(&stats).Error
+
+		if err != nil {
+			return err
+		}
+
+		for _, position := range watchedBuckets(heartbeats, bucketSize) {
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "video_id"}, {Name: "position"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{"viewers": gorm.Expr("video_retention_buckets.viewers + 1")}),
+			}).Create(&models.VideoRetentionBucket{VideoID: session.VideoID, Position: position, Viewers: 1}).Error
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&models.PlaybackSession{}).Where("id = ?", session.Id).Update("aggregated", true).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("session_id = ?", session.Id).Delete(&models.PlaybackHeartbeat{}).Error
+	})
+}
+
+// watchedBuckets devuelve el inicio de cada tramo del video que se vio en la sesión.
+// Entre dos heartbeats seguidos reproduciendo se marca todo lo que hay entre ambas posiciones,
+// salvo que la posición avance mucho más que el tiempo real (el usuario adelantó el video).
+func watchedBuckets(heartbeats []models.PlaybackHeartbeat, bucketSize int) []int {
+	if bucketSize <= 0 {
+		bucketSize = 5
+	}
+
+	seen := make(map[int]bool)
+	var buckets []int
+
+	mark := func(position float64) {
+		bucket := int(position) / bucketSize * bucketSize
+		if !seen[bucket] {
+			seen[bucket] = true
+			buckets = append(buckets, bucket)
+		}
+	}
+
+	for i, heartbeat := range heartbeats {
+		if heartbeat.Playing {
+			mark(heartbeat.Position)
+		}
+
+		if i == 0 {
+			continue
+		}
+
+		previous := heartbeats[i-1]
+		if !previous.Playing || heartbeat.Position < previous.Position {
+			continue
+		}
+
+		elapsed := heartbeat.CreatedAt.Sub(previous.CreatedAt).Seconds()
+		if heartbeat.Position-previous.Position > elapsed*2+float64(bucketSize) {
+			continue
+		}
+
+		for position := previous.Position; position <= heartbeat.Position; position += float64(bucketSize) {
+			mark(position)
+		}
+		mark(heartbeat.Position)
+	}
+
+	return buckets
+}
@@ -0,0 +1,496 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/unbot2313/go-streaming-service/config"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+)
+
+var ErrProcessingJobNotFound = errors.New("processing job not found")
+
+var ErrProcessingJobFinished = errors.New("processing already finished")
+
+// ErrStageTimeout es el error de una etapa que pasó su tiempo máximo
+var ErrStageTimeout = errors.New("processing stage timed out")
+
+const (
+	// cada cuánto se guarda el avance en la base de datos, a quienes lo siguen se les manda cada reporte de ffmpeg
+	jobSaveInterval = 2 * time.Second
+	// reportes que se guardan para quien sigue el avance, si no alcanza a leerlos se descartan los más viejos
+	jobWatcherBuffer = 8
+)
+
+type ProcessingService interface {
+	// Start guarda el video en estado processing y lo procesa en segundo plano: lo pasa a HLS,
+	// genera la miniatura y lo sube a s3. Al terminar borra los archivos locales
+	Start(videoData *models.Video, userId string) (*models.VideoModel, error)
+	// Watch devuelve un canal con el estado actual del trabajo y cada cambio, se cierra cuando
+	// el trabajo termina. La función que devuelve deja de seguirlo
+	Watch(videoId string) (<-chan models.ProcessingJob, func(), error)
+	// Cancel detiene el procesamiento, espera a que se borre lo que se alcanzó a generar y
+	// devuelve el trabajo cancelado
+	Cancel(videoId string) (*models.ProcessingJob, error)
+	// RecoverJobs marca como fallidos los trabajos que quedaron a medias si el servidor se cayó
+	RecoverJobs() error
+}
+
+type processingService struct {
+	videoService         VideoService
+	databaseVideoService DatabaseVideoService
+	notificationService  NotificationService
+
+	mu   sync.Mutex
+	jobs map[string]*activeJob
+}
+
+// activeJob es un trabajo que se está procesando en este servidor, cancel lo detiene y
+// done se cierra cuando termina
+type activeJob struct {
+	job      models.ProcessingJob
+	watchers map[chan models.ProcessingJob]struct{}
+	savedAt  time.Time
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func NewProcessingService(videoService VideoService, databaseVideoService DatabaseVideoService, notificationService NotificationService) ProcessingService {
+	return &processingService{
+		videoService:         videoService,
+		databaseVideoService: databaseVideoService,
+		notificationService:  notificationService,
+		jobs:                 make(map[string]*activeJob),
+	}
+}
+
+func (service *processingService) Start(videoData *models.Video, userId string) (*models.VideoModel, error) {
+	videoData.State = models.VideoStateProcessing
+
+	video, err := service.databaseVideoService.CreateVideo(videoData, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	job := models.ProcessingJob{
+		VideoID:   video.Id,
+		UserID:    userId,
+		Status:    models.VideoStateProcessing,
+		Stage:     models.ProcessingStageTranscoding,
+		StartedAt: now,
+		UpdatedAt: now,
+	}
+
+	// si no se puede guardar igual se procesa, el avance queda en memoria hasta el próximo guardado
+	if err := service.databaseVideoService.SaveProcessingJob(&job); err != nil {
+		log.Println("error al guardar el trabajo de procesamiento: ", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	active := &activeJob{
+		job:      job,
+		watchers: make(map[chan models.ProcessingJob]struct{}),
+		savedAt:  now,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+
+	service.mu.Lock()
+	service.jobs[video.Id] = active
+	service.mu.Unlock()
+
+	go func() {
+		defer close(active.done)
+		defer cancel()
+
+		service.process(ctx, videoData)
+	}()
+
+	return video, nil
+}
+
+// stageContext limita una etapa del procesamiento a timeout, sin límite si es 0
+func stageContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// runStage corre una etapa con su tiempo máximo, si se pasa devuelve ErrStageTimeout
+func runStage(ctx context.Context, timeout time.Duration, stage func(ctx context.Context) error) error {
+	stageCtx, cancel := stageContext(ctx, timeout)
+	defer cancel()
+
+	err := stage(stageCtx)
+
+	if err != nil && ctx.Err() == nil && errors.Is(stageCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %v", ErrStageTimeout, err)
+	}
+
+	return err
+}
+
+// process hace lo que antes hacía el controlador al subir un video, ahora en segundo plano.
+// Si se cancela ctx se mata ffmpeg o se corta la subida, y se borra lo que se alcanzó a generar.
+// El trabajo se da por terminado recién después de borrar los archivos locales
+func (service *processingService) process(ctx context.Context, videoData *models.Video) {
+	status, message := service.run(ctx, videoData)
+
+	service.finish(videoData.Id, status, message)
+}
+
+// run hace las etapas del procesamiento y devuelve cómo terminó el trabajo
+func (service *processingService) run(ctx context.Context, videoData *models.Video) (string, string) {
+	cfg := config.GetConfig()
+	filesService := service.videoService.GetFilesService()
+
+	// borrar el archivo original
+	defer filesService.RemoveFile(videoData.LocalPath)
+
+	// pasar a archivos .ts y .m3u8 con ffmpeg y guardarlo en local, si falla FormatVideo borra la carpeta
+	transcodingStarted := time.Now()
+
+	var filesPath string
+	err := runStage(ctx, cfg.ProcessingTranscodeTimeout, func(ctx context.Context) error {
+		var err error
+		filesPath, err = service.videoService.FormatVideo(ctx, videoData.UniqueName, videoData.EncodingProfile, func(seconds float64) {
+			percent, eta := progressEstimate(seconds, videoData.DurationSeconds, time.Since(transcodingStarted))
+
+			service.update(videoData.Id, func(job *models.ProcessingJob) {
+				job.Percent = percent
+				job.EtaSeconds = eta
+			})
+		})
+		return err
+	})
+	if err != nil {
+		return service.fail(ctx, videoData, models.ProcessingStageTranscoding, err)
+	}
+
+	// borrar archivos locales .ts y .m3u8
+	defer filesService.RemoveFolder(filesPath)
+
+	service.update(videoData.Id, func(job *models.ProcessingJob) {
+		job.Stage = models.ProcessingStageThumbnail
+		job.Percent = 100
+		job.EtaSeconds = nil
+	})
+
+	err = runStage(ctx, cfg.ProcessingThumbnailTimeout, func(ctx context.Context) error {
+		_, err := service.videoService.SaveThumbnail(ctx, videoData.LocalPath, filesPath)
+		return err
+	})
+	if err != nil {
+		return service.fail(ctx, videoData, models.ProcessingStageThumbnail, err)
+	}
+
+	service.update(videoData.Id, func(job *models.ProcessingJob) {
+		job.Stage = models.ProcessingStageUploading
+	})
+
+	// la carpeta en s3 se llama como la local, ver UploadFilesFromFolderToS3
+	baseFolder := filepath.Base(filesPath)
+
+	var savedDataInS3 importantFiles
+	err = runStage(ctx, cfg.ProcessingUploadTimeout, func(ctx context.Context) error {
+		var err error
+		savedDataInS3, _, err = service.videoService.UploadFilesFromFolderToS3(ctx, filesPath)
+		if err != nil {
+			return err
+		}
+
+		// el original solo se guarda para la exportación de datos del usuario
+		return service.videoService.UploadOriginalToS3(ctx, videoData.LocalPath, baseFolder, videoData.Video)
+	})
+
+	// si se canceló justo al terminar de subir tampoco se publica
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		// lo que se alcanzó a subir se borra de s3 como folder/
+		service.videoService.DeleteS3Folder(baseFolder + "/")
+
+		return service.fail(ctx, videoData, models.ProcessingStageUploading, err)
+	}
+
+	videoData.M3u8FileURL = savedDataInS3.M3u8FileURL
+	videoData.ThumbnailURL = savedDataInS3.ThumbnailURL
+	videoData.State = models.VideoStateReady
+
+	video, err := service.databaseVideoService.FinishVideoProcessing(videoData)
+	if err != nil {
+		// como el video no quedó publicado, se borra de s3 como folder/
+		service.videoService.DeleteS3Folder(baseFolder + "/")
+
+		videoData.M3u8FileURL = ""
+		videoData.ThumbnailURL = ""
+		return service.fail(ctx, videoData, models.ProcessingStageUploading, err)
+	}
+
+	// avisar al dueño y a los suscriptores del canal, si falla el video igual queda publicado
+	if err := service.notificationService.NotifyVideoPublished(video); err != nil {
+		log.Println("error al notificar el nuevo video: ", err)
+	}
+
+	return models.VideoStateReady, ""
+}
+
+// fail deja el video como cancelado si se canceló ctx, si no como fallido, y devuelve el estado y
+// el error del trabajo. Al usuario solo se le muestra la etapa porque el error de ffmpeg tiene rutas locales
+func (service *processingService) fail(ctx context.Context, videoData *models.Video, stage string, cause error) (string, string) {
+	status := models.VideoStateFailed
+	message := fmt.Sprintf("%s failed", stage)
+
+	switch {
+	case ctx.Err() != nil:
+		status = models.VideoStateCancelled
+		message = ""
+		log.Printf("Se canceló el procesamiento del video %s en la etapa %s.\n", videoData.Id, stage)
+	case errors.Is(cause, ErrStageTimeout):
+		message = fmt.Sprintf("%s timed out", stage)
+		log.Printf("error procesando el video %s en la etapa %s: %v\n", videoData.Id, stage, cause)
+	default:
+		log.Printf("error procesando el video %s en la etapa %s: %v\n", videoData.Id, stage, cause)
+	}
+
+	videoData.State = status
+
+	if _, err := service.databaseVideoService.FinishVideoProcessing(videoData); err != nil {
+		log.Println("error al marcar el video como ", status, ": ", err)
+	}
+
+	return status, message
+}
+
+func (service *processingService) finish(videoId string, status string, message string) {
+	completedAt := time.Now()
+
+	service.update(videoId, func(job *models.ProcessingJob) {
+		job.Status = status
+		job.Error = message
+		job.EtaSeconds = nil
+		job.CompletedAt = &completedAt
+	})
+}
+
+// update cambia el trabajo, se lo manda a quienes lo siguen y lo guarda si cambió la etapa,
+// si terminó o si pasó jobSaveInterval desde el último guardado
+func (service *processingService) update(videoId string, change func(job *models.ProcessingJob)) {
+	service.mu.Lock()
+
+	active, ok := service.jobs[videoId]
+	if !ok {
+		service.mu.Unlock()
+		return
+	}
+
+	stage := active.job.Stage
+	change(&active.job)
+
+	now := time.Now()
+	active.job.UpdatedAt = now
+	job := active.job
+
+	for watcher := range active.watchers {
+		sendLatestJob(watcher, job)
+	}
+
+	save := job.Finished() || job.Stage != stage || now.Sub(active.savedAt) >= jobSaveInterval
+	if save {
+		active.savedAt = now
+	}
+
+	service.mu.Unlock()
+
+	if save {
+		if err := service.databaseVideoService.SaveProcessingJob(&job); err != nil {
+			log.Println("error al guardar el avance del procesamiento: ", err)
+		}
+	}
+
+	// se saca de memoria después de guardarlo, así Watch siempre encuentra el estado final
+	if job.Finished() {
+		service.mu.Lock()
+		for watcher := range active.watchers {
+			close(watcher)
+		}
+		delete(service.jobs, videoId)
+		service.mu.Unlock()
+	}
+}
+
+// sendLatestJob manda el trabajo sin bloquear, si el canal está lleno descarta el reporte más viejo
+func sendLatestJob(watcher chan models.ProcessingJob, job models.ProcessingJob) {
+	for {
+		select {
+		case watcher <- job:
+			return
+		default:
+		}
+
+		select {
+		case <-watcher:
+		default:
+		}
+	}
+}
+
+func (service *processingService) Watch(videoId string) (<-chan models.ProcessingJob, func(), error) {
+	watcher := make(chan models.ProcessingJob, jobWatcherBuffer)
+
+	service.mu.Lock()
+	if active, ok := service.jobs[videoId]; ok {
+		watcher <- active.job
+		active.watchers[watcher] = struct{}{}
+		service.mu.Unlock()
+
+		return watcher, func() { service.unwatch(videoId, watcher) }, nil
+	}
+	service.mu.Unlock()
+
+	// ya terminó, se devuelve el estado que quedó guardado
+	job, err := service.databaseVideoService.FindProcessingJob(videoId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	watcher <- *job
+	close(watcher)
+
+	return watcher, func() {}, nil
+}
+
+func (service *processingService) Cancel(videoId string) (*models.ProcessingJob, error) {
+	service.mu.Lock()
+	active, ok := service.jobs[videoId]
+	service.mu.Unlock()
+
+	if !ok {
+		if _, err := service.databaseVideoService.FindProcessingJob(videoId); err != nil {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("%w: video %s", ErrProcessingJobFinished, videoId)
+	}
+
+	active.cancel()
+	<-active.done
+
+	// pudo terminar justo antes de cancelarlo
+	service.mu.Lock()
+	job := active.job
+	service.mu.Unlock()
+
+	if job.Status != models.VideoStateCancelled {
+		return nil, fmt.Errorf("%w: video %s is %s", ErrProcessingJobFinished, videoId, job.Status)
+	}
+
+	return &job, nil
+}
+
+func (service *processingService) unwatch(videoId string, watcher chan models.ProcessingJob) {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	if active, ok := service.jobs[videoId]; ok {
+		delete(active.watchers, watcher)
+	}
+}
+
+// progressEstimate calcula el porcentaje convertido y los segundos que faltan con la velocidad
+// que lleva ffmpeg. Sin avance todavía no se puede estimar cuánto falta
+func progressEstimate(processed float64, duration float64, elapsed time.Duration) (float64, *float64) {
+	if duration <= 0 {
+		return 0, nil
+	}
+
+	processed = min(max(processed, 0), duration)
+	percent := math.Round(processed/duration*1000) / 10
+
+	if processed == 0 {
+		return percent, nil
+	}
+
+	eta := math.Round(elapsed.Seconds() * (duration - processed) / processed)
+
+	return percent, &eta
+}
+
+// RecoverJobs se llama al iniciar: los trabajos que estaban en processing murieron con el
+// servidor, así que sus videos quedan fallidos y se borra lo que alcanzaron a dejar
+func (service *processingService) RecoverJobs() error {
+	db, err := config.GetDB()
+	if err != nil {
+		return err
+	}
+
+	var staleJobs []models.ProcessingJob
+
+	if err := db.Where("status = ?", models.VideoStateProcessing).Find(&staleJobs).Error; err != nil {
+		return err
+	}
+
+	if len(staleJobs) == 0 {
+		return nil
+	}
+
+	videoIds := make([]string, len(staleJobs))
+	for i, job := range staleJobs {
+		videoIds[i] = job.VideoID
+	}
+
+	now := time.Now()
+
+	err = db.Model(&models.ProcessingJob{}).Where("video_id IN ?", videoIds).Updates(map[string]interface{}{
+		"status":       models.VideoStateFailed,
+		"error":        "interrupted by a server restart",
+		"eta_seconds":  nil,
+		"completed_at": now,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	err = db.Model(&models.VideoModel{}).Where("id IN ? AND state = ?", videoIds, models.VideoStateProcessing).
+		Update("state", models.VideoStateFailed).Error
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Se marcaron como fallidos %d videos que se estaban procesando.\n", len(staleJobs))
+
+	// los archivos locales y lo que se alcanzó a subir empiezan con el id del video
+	filesService := service.videoService.GetFilesService()
+	storagePath := config.GetConfig().LocalStoragePath
+
+	for _, videoId := range videoIds {
+		prefix := VideoS3Prefix(videoId)
+
+		leftovers, _ := filepath.Glob(filepath.Join(storagePath, prefix+"*"))
+		for _, leftover := range leftovers {
+			filesService.RemoveFile(leftover)
+		}
+
+		leftovers, _ = filepath.Glob(filepath.Join(saveFormatedVideoPath, prefix+"*"))
+		for _, leftover := range leftovers {
+			filesService.RemoveFolder(leftover)
+		}
+
+		if err := service.videoService.DeleteS3Folder(prefix); err != nil {
+			log.Println("error al borrar de s3 lo que subió el video ", videoId, ": ", err)
+		}
+	}
+
+	return nil
+}
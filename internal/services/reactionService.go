@@ -0,0 +1,260 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/unbot2313/go-streaming-service/config"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type reactionService struct {
+	databaseVideoService DatabaseVideoService
+	analyticsService     AnalyticsService
+}
+
+// ReactionService guarda los likes y dislikes de los usuarios. Los contadores del video
+// se actualizan en la misma transacción que la reacción, así nunca se desfasan.
+type ReactionService interface {
+	SetReaction(userId string, videoId string, kind string) (*models.ReactionResult, error)
+	RemoveReaction(userId string, videoId string) (*models.ReactionResult, error)
+	GetReaction(userId string, videoId string) (string, error)
+	ListLikedVideos(userId string, cursor string, limit int) (*models.VideoPage, error)
+}
+
+func NewReactionService(databaseVideoService DatabaseVideoService, analyticsService AnalyticsService) ReactionService {
+	return &reactionService{
+		databaseVideoService: databaseVideoService,
+		analyticsService:     analyticsService,
+	}
+}
+
+// SetReaction es idempotente: repetir la misma reacción no cambia nada,
+// y cambiar de like a dislike mueve el contador
+func (service *reactionService) SetReaction(userId string, videoId string, kind string) (*models.ReactionResult, error) {
+	if _, err := service.databaseVideoService.FindVideoByID(videoId); err != nil {
+		return nil, err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var previous string
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		reaction := models.VideoReaction{UserID: userId, VideoID: videoId, Kind: kind}
+
+		dbCtx := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&reaction)
+		if dbCtx.Error != nil {
+			return dbCtx.Error
+		}
+
+		if dbCtx.RowsAffected == 1 {
+			return addReactionCount(tx, videoId, kind, 1)
+		}
+
+		// ya había una reacción, se bloquea para que dos requests no muevan el contador dos veces
+		var existing models.VideoReaction
+
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND video_id = ?", userId, videoId).
+			First(&existing).Error
+
+		if err != nil {
+			return err
+		}
+
+		previous = existing.Kind
+
+		if existing.Kind == kind {
+			return nil
+		}
+
+		err = tx.Model(&existing).Updates(map[string]interface{}{"kind": kind, "updated_at": time.Now()}).Error
+		if err != nil {
+			return err
+		}
+
+		if err := addReactionCount(tx, videoId, existing.Kind, -1); err != nil {
+			return err
+		}
+
+		return addReactionCount(tx, videoId, kind, 1)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if previous != kind {
+		now := time.Now()
+		if previous == models.ReactionLike {
+			service.analyticsService.RecordLike(videoId, -1, now)
+		}
+		if kind == models.ReactionLike {
+			service.analyticsService.RecordLike(videoId, 1, now)
+		}
+	}
+
+	return service.result(videoId, kind)
+}
+
+func (service *reactionService) RemoveReaction(userId string, videoId string) (*models.ReactionResult, error) {
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []models.VideoReaction
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		dbCtx := tx.Clauses(clause.Returning{}).
+			Where("user_id = ? AND video_id = ?", userId, videoId).
+			Delete(&removed)
+
+		if dbCtx.Error != nil {
+			return dbCtx.Error
+		}
+
+		for _, reaction := range removed {
+			if err := addReactionCount(tx, videoId, reaction.Kind, -1); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, reaction := range removed {
+		if reaction.Kind == models.ReactionLike {
+			service.analyticsService.RecordLike(videoId, -1, time.Now())
+		}
+	}
+
+	return service.result(videoId, "")
+}
+
+// GetReaction devuelve la reacción del usuario o vacío si no reaccionó
+func (service *reactionService) GetReaction(userId string, videoId string) (string, error) {
+	db, err := config.GetDB()
+	if err != nil {
+		return "", err
+	}
+
+	var reaction models.VideoReaction
+
+	err = db.Where("user_id = ? AND video_id = ?", userId, videoId).First(&reaction).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+
+	return reaction.Kind, err
+}
+
+// ListLikedVideos es la lista automática de videos que le gustaron al usuario,
+// del like más reciente al más antiguo
+func (service *reactionService) ListLikedVideos(userId string, cursor string, limit int) (*models.VideoPage, error) {
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	size := pageSize(limit)
+
+	query := db.Model(&models.VideoReaction{}).
+		Joins("JOIN videos ON videos.id = video_reactions.video_id AND videos.deleted_at IS NULL AND videos.hidden_at IS NULL").
+		Where("video_reactions.user_id = ? AND video_reactions.kind = ?", userId, models.ReactionLike).
+		Order("video_reactions.updated_at DESC, video_reactions.video_id DESC")
+
+	if after != nil {
+		query = query.Where("(video_reactions.updated_at, video_reactions.video_id) < (?, ?)", after.Time, after.Id)
+	}
+
+	var reactions []models.VideoReaction
+
+	if err := query.Limit(size + 1).Find(&reactions).Error; err != nil {
+		return nil, err
+	}
+
+	page := &models.VideoPage{Items: make([]models.VideoModel, 0, len(reactions))}
+
+	if len(reactions) > size {
+		reactions = reactions[:size]
+		last := reactions[size-1]
+		page.NextCursor = encodeCursor(last.UpdatedAt, last.VideoID)
+	}
+
+	if len(reactions) == 0 {
+		return page, nil
+	}
+
+	videoIds := make([]string, len(reactions))
+	for i, reaction := range reactions {
+		videoIds[i] = reaction.VideoID
+	}
+
+	var videos []models.VideoModel
+	if err := db.Where("id IN ?", videoIds).Find(&videos).Error; err != nil {
+		return nil, err
+	}
+
+	videosById := make(map[string]models.VideoModel, len(videos))
+	for _, video := range videos {
+		videosById[video.Id] = video
+	}
+
+	for _, videoId := range videoIds {
+		if video, ok := videosById[videoId]; ok {
+			page.Items = append(page.Items, video)
+		}
+	}
+
+	return page, nil
+}
+
+func (service *reactionService) result(videoId string, myReaction string) (*models.ReactionResult, error) {
+	video, err := service.databaseVideoService.FindVideoByID(videoId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ReactionResult{
+		VideoID:    videoId,
+		MyReaction: myReaction,
+		Likes:      video.Likes,
+		Dislikes:   video.Dislikes,
+	}, nil
+}
+
+// addReactionCount suma o resta en el contador del tipo de reacción con un UPDATE atómico
+func addReactionCount(tx *gorm.DB, videoId string, kind string, delta int) error {
+	column := "likes"
+	if kind == models.ReactionDislike {
+		column = "dislikes"
+	}
+
+	return tx.Model(&models.VideoModel{}).Where("id = ?", videoId).
+		UpdateColumn(column, gorm.Expr(column+" + ?", delta)).Error
+}
+
+func collectReactions(db *gorm.DB, userId string) (interface{}, error) {
+	var reactions []models.VideoReaction
+
+	err := db.Where("user_id = ?", userId).Order("created_at").Find(&reactions).Error
+
+	return reactions, err
+}
@@ -0,0 +1,291 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/unbot2313/go-streaming-service/config"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidHomeSort = errors.New("invalid sort")
+
+// pesos de cada señal al buscar videos relacionados
+const (
+	relatedTagWeight      = 3.0
+	relatedUploaderWeight = 2.0
+	relatedCoWatchWeight  = 1.5
+	relatedCoWatchWindow  = 30 * 24 * time.Hour
+	// espectadores del video que se usan para buscar qué más vieron
+	relatedMaxViewers = 1000
+	relatedMaxSize    = 50
+)
+
+type recommendationService struct {
+	databaseVideoService DatabaseVideoService
+}
+
+// RecommendationService arma las listas de tendencias, la página de inicio y los videos
+// relacionados. El puntaje de tendencia se recalcula en segundo plano desde las estadísticas por hora.
+type RecommendationService interface {
+	GetTrending(cursor string, limit int) (*models.VideoPage, error)
+	GetHomeVideos(sort string, cursor string, limit int) (*models.VideoPage, error)
+	GetRelated(videoId string, limit int) (*models.VideoPage, error)
+	RefreshTrending() error
+	Run(ctx context.Context)
+}
+
+func NewRecommendationService(databaseVideoService DatabaseVideoService) RecommendationService {
+	return &recommendationService{databaseVideoService: databaseVideoService}
+}
+
+// GetTrending son los videos con actividad reciente, del puntaje más alto al más bajo
+func (service *recommendationService) GetTrending(cursor string, limit int) (*models.VideoPage, error) {
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	return paginateTrendingVideos(db.Scopes(publicVideos).Where("videos.trending_score > 0"), after, limit)
+}
+
+// GetHomeVideos ordena por tendencia, y los videos sin actividad reciente quedan al final del más
+// nuevo al más antiguo. Con sort=newest es la lista cronológica de siempre.
+func (service *recommendationService) GetHomeVideos(sort string, cursor string, limit int) (*models.VideoPage, error) {
+	switch sort {
+	case "", models.HomeSortTrending:
+	case models.HomeSortNewest:
+		return service.databaseVideoService.FindLatestVideos(cursor, limit)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidHomeSort, sort)
+	}
+
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	return paginateTrendingVideos(db.Scopes(publicVideos), after, limit)
+}
+
+// GetRelated junta los videos con etiquetas en común, los del mismo canal y los que vieron
+// los mismos espectadores. Si no alcanzan se completa con los videos en tendencia.
+func (service *recommendationService) GetRelated(videoId string, limit int) (*models.VideoPage, error) {
+	video, err := service.databaseVideoService.FindVideoByID(videoId)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	size := min(pageSize(limit), relatedMaxSize)
+
+	var relatedIds []string
+
+	// se piden de más por si alguno ya no es público
+	err = db.Raw(`WITH tag_matches AS (
+			SELECT other.video_id, COUNT(*) AS shared_tags
+			FROM video_tags AS own
+			JOIN video_tags AS other ON other.tag = own.tag AND other.video_id <> own.video_id
+			WHERE own.video_id = @video_id
+			GROUP BY other.video_id
+		), viewers AS (
+			SELECT DISTINCT viewer_key FROM video_viewers_hourly
+			WHERE video_id = @video_id AND hour >= @since
+			LIMIT @max_viewers
+		), co_watch AS (
+			SELECT other.video_id, COUNT(DISTINCT other.viewer_key) AS viewers
+			FROM viewers
+			JOIN video_viewers_hourly AS other ON other.viewer_key = viewers.viewer_key
+			WHERE other.video_id <> @video_id AND other.hour >= @since
+			GROUP BY other.video_id
+		), candidates AS (
+			SELECT video_id FROM tag_matches
+			UNION SELECT video_id FROM co_watch
+			UNION SELECT id FROM videos WHERE user_id = @user_id AND id <> @video_id
+		)
+		SELECT videos.id FROM candidates
+		JOIN videos ON videos.id = candidates.video_id AND videos.deleted_at IS NULL AND videos.hidden_at IS NULL AND videos.state IN @playable_states
+		LEFT JOIN tag_matches ON tag_matches.video_id = videos.id
+		LEFT JOIN co_watch ON co_watch.video_id = videos.id
+		ORDER BY COALESCE(tag_matches.shared_tags, 0) * @tag_weight::float8
+			+ CASE WHEN videos.user_id = @user_id THEN @uploader_weight::float8 ELSE 0 END
+			+ LN(1 + COALESCE(co_watch.viewers, 0)) * @co_watch_weight::float8 DESC,
+			videos.trending_score DESC, videos.created_at DESC, videos.id
+		LIMIT @limit`,
+		map[string]interface{}{
+			"video_id":        video.Id,
+			"user_id":         video.UserID,
+			"since":           time.Now().Add(-relatedCoWatchWindow),
+			"max_viewers":     relatedMaxViewers,
+			"tag_weight":      relatedTagWeight,
+			"uploader_weight": relatedUploaderWeight,
+			"co_watch_weight": relatedCoWatchWeight,
+			"limit":           size * 2,
+			"playable_states": playableVideoStates,
+		}).Scan(&relatedIds).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.VideoPage{Items: []models.VideoModel{}}
+
+	if len(relatedIds) > 0 {
+		var videos []models.VideoModel
+		if err := db.Scopes(publicVideos).Where("videos.id IN ?", relatedIds).Find(&videos).Error; err != nil {
+			return nil, err
+		}
+
+		videosById := make(map[string]models.VideoModel, len(videos))
+		for _, related := range videos {
+			videosById[related.Id] = related
+		}
+
+		for _, id := range relatedIds {
+			if related, ok := videosById[id]; ok && len(page.Items) < size {
+				page.Items = append(page.Items, related)
+			}
+		}
+	}
+
+	if len(page.Items) < size {
+		exclude := []string{video.Id}
+		for _, related := range page.Items {
+			exclude = append(exclude, related.Id)
+		}
+
+		var fill []models.VideoModel
+
+		err := db.Scopes(publicVideos).Where("videos.id NOT IN ?", exclude).
+			Order("videos.trending_score DESC, videos.created_at DESC, videos.id DESC").
+			Limit(size - len(page.Items)).Find(&fill).Error
+
+		if err != nil {
+			return nil, err
+		}
+
+		page.Items = append(page.Items, fill...)
+	}
+
+	return page, nil
+}
+
+// RefreshTrending recalcula el puntaje de tendencia con las estadísticas por hora de la ventana
+// configurada. Cada hora pesa menos cuanto más antigua es: pierde la mitad cada TrendingHalfLife.
+func (service *recommendationService) RefreshTrending() error {
+	db, err := config.GetDB()
+	if err != nil {
+		return err
+	}
+
+	cfg := config.GetConfig()
+	now := time.Now()
+	since := now.Add(-cfg.TrendingWindow)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		// los que ya no tienen actividad en la ventana salen de tendencias
+		err := tx.Exec(`UPDATE videos SET trending_score = 0
+			WHERE trending_score <> 0
+			AND id NOT IN (SELECT video_id FROM video_stats_hourly WHERE hour >= ?)`, since).Error
+
+		if err != nil {
+			return err
+		}
+
+		return tx.Exec(`UPDATE videos SET trending_score = scores.score
+			FROM (
+				SELECT video_id, ROUND(1000 * GREATEST(SUM(
+					(views * @view_weight::float8 + likes * @like_weight::float8 + watch_seconds / 60 * @watch_weight::float8)
+					* EXP(-LN(2) * (@now::float8 - EXTRACT(EPOCH FROM hour)::float8) / @half_life::float8)
+				), 0))::bigint AS score
+				FROM video_stats_hourly
+				WHERE hour >= @since
+				GROUP BY video_id
+			) AS scores
+			WHERE videos.id = scores.video_id AND videos.trending_score <> scores.score`,
+			map[string]interface{}{
+				"view_weight":  cfg.TrendingViewWeight,
+				"like_weight":  cfg.TrendingLikeWeight,
+				"watch_weight": cfg.TrendingWatchMinuteWeight,
+				"now":          float64(now.Unix()),
+				"half_life":    cfg.TrendingHalfLife.Seconds(),
+				"since":        since,
+			}).Error
+	})
+}
+
+// Run recalcula las tendencias al iniciar y luego cada cierto tiempo, hasta que se cancele el contexto
+func (service *recommendationService) Run(ctx context.Context) {
+	ticker := time.NewTicker(config.GetConfig().TrendingRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := service.RefreshTrending(); err != nil {
+			log.Println("error al recalcular las tendencias: ", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// paginateTrendingVideos ordena por puntaje de tendencia, luego por fecha de creación
+func paginateTrendingVideos(query *gorm.DB, after *pageCursor, limit int) (*models.VideoPage, error) {
+	size := pageSize(limit)
+
+	if after != nil {
+		query = query.Where("(videos.trending_score, videos.created_at, videos.id) < (?, ?, ?)", after.Score, after.Time, after.Id)
+	}
+
+	var videos []models.VideoModel
+
+	// se pide uno más para saber si hay otra página
+	err := query.Order("videos.trending_score DESC, videos.created_at DESC, videos.id DESC").Limit(size + 1).Find(&videos).Error
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.VideoPage{Items: videos}
+
+	if len(videos) > size {
+		page.Items = videos[:size]
+		last := page.Items[size-1]
+		page.NextCursor = encodeScoredCursor(last.TrendingScore, last.CreatedAt, last.Id)
+	}
+
+	if page.Items == nil {
+		page.Items = []models.VideoModel{}
+	}
+
+	return page, nil
+}
+
+func collectVideoTags(db *gorm.DB, userId string) (interface{}, error) {
+	var tags []models.VideoTag
+
+	err := db.Where("video_id IN (?)", db.Unscoped().Model(&models.VideoModel{}).Select("id").Where("user_id = ?", userId)).
+		Order("video_id, tag").Find(&tags).Error
+
+	return tags, err
+}
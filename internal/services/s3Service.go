@@ -6,10 +6,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
@@ -23,7 +26,7 @@ type importantFiles struct {
 	ThumbnailURL string
 }
 
-func (s3Service *videoServiceImp) UploadFilesFromFolderToS3(folder string) (
+func (s3Service *videoServiceImp) UploadFilesFromFolderToS3(ctx context.Context, folder string) (
 	importantFiles,
 	string,
 	error,
@@ -36,46 +39,20 @@ func (s3Service *videoServiceImp) UploadFilesFromFolderToS3(folder string) (
 
 	var thumbnailURL string
 
-	files, err := os.ReadDir(folder)
+	uploadedFiles, err := s3Service.uploadFolderToS3(ctx, folder, baseFolder)
 
 	if err != nil {
 		return importantFiles{}, baseFolder, err
 	}
 
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-
-		filePath := filepath.Join(folder, file.Name())
-		f, err := os.Open(filePath)
-		if err != nil {
-			return importantFiles{}, baseFolder, err
-		}
-		defer f.Close()
-
-		// Construir el Key como nombre de la carpeta + nombre del archivo
-		key := filepath.Join(baseFolder, file.Name())
-
-		// Subir el archivo a S3
-		result, errS3 := s3Service.S3configuration.Uploader.Upload(context.TODO(), &s3.PutObjectInput{
-			Bucket: aws.String(s3Service.S3configuration.BucketName),
-			Key:    aws.String(key),
-			Body:   f,
-			// ACL:    "public-read",
-		})
-
-		if errS3 != nil {
-			return importantFiles{}, baseFolder, errS3
-		}
-
+	for fileName, location := range uploadedFiles {
 		 // Si es un archivo m3u8, guarda su URL para la base de datos
-        if strings.HasSuffix(file.Name(), ".m3u8") {
-            m3u8FileURL = result.Location
+        if strings.HasSuffix(fileName, ".m3u8") {
+            m3u8FileURL = location
         }
 
-		if strings.HasSuffix(file.Name(), ".webp") {
-			thumbnailURL = result.Location
+		if strings.HasSuffix(fileName, ".webp") {
+			thumbnailURL = location
 		}
 
 	}
@@ -90,6 +67,81 @@ func (s3Service *videoServiceImp) UploadFilesFromFolderToS3(folder string) (
 	}, baseFolder, nil
 }
 
+// UploadFolderToS3 sube los archivos de la carpeta local bajo el prefijo indicado
+// y devuelve la url de cada archivo por su nombre.
+func (s3Service *videoServiceImp) UploadFolderToS3(folder string, keyPrefix string) (map[string]string, error) {
+	return s3Service.uploadFolderToS3(context.TODO(), folder, keyPrefix)
+}
+
+// uploadFolderToS3 es UploadFolderToS3 con un contexto para poder cancelar la subida
+func (s3Service *videoServiceImp) uploadFolderToS3(ctx context.Context, folder string, keyPrefix string) (map[string]string, error) {
+
+	files, err := os.ReadDir(folder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	uploadedFiles := make(map[string]string)
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		location, err := s3Service.uploadFileToS3(ctx, filepath.Join(folder, file.Name()), path.Join(keyPrefix, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		uploadedFiles[file.Name()] = location
+	}
+
+	return uploadedFiles, nil
+}
+
+// UploadFileToS3 sube un archivo local con el key indicado y devuelve su url
+func (s3Service *videoServiceImp) UploadFileToS3(filePath string, key string) (string, error) {
+	return s3Service.uploadFileToS3(context.TODO(), filePath, key)
+}
+
+func (s3Service *videoServiceImp) uploadFileToS3(ctx context.Context, filePath string, key string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// Subir el archivo a S3
+	result, errS3 := s3Service.S3configuration.Uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s3Service.S3configuration.BucketName),
+		Key:    aws.String(key),
+		Body:   f,
+		// ACL:    "public-read",
+	})
+
+	if errS3 != nil {
+		return "", errS3
+	}
+
+	return result.Location, nil
+}
+
+// carpeta dentro de la del video donde se guarda el archivo original
+const originalS3Folder = "original"
+
+// UploadOriginalToS3 guarda el archivo tal cual se subió en la carpeta del video, así se borra
+// junto con el HLS y se puede incluir en la exportación de datos del usuario
+func (s3Service *videoServiceImp) UploadOriginalToS3(ctx context.Context, filePath string, baseFolder string, fileName string) error {
+	_, err := s3Service.uploadFileToS3(ctx, filePath, path.Join(baseFolder, originalS3Folder, path.Base(fileName)))
+	return err
+}
+
+// isOriginalS3Key indica si el key es el de un archivo original (ver UploadOriginalToS3)
+func isOriginalS3Key(key string) bool {
+	return path.Base(path.Dir(key)) == originalS3Folder
+}
+
 // DeleteFolder eliminará todos los objetos dentro de la "carpeta" especificada.
 func (s3Service *videoServiceImp) DeleteS3Folder(folderName string) error {
     ctx := context.Background() // Define el contexto
@@ -144,6 +196,36 @@ func (s3Service *videoServiceImp) DeleteS3Folder(folderName string) error {
     return nil
 }
 
+// GetS3Object abre el objeto para leerlo, quien lo llama debe cerrarlo
+func (s3Service *videoServiceImp) GetS3Object(key string) (io.ReadCloser, error) {
+	output, err := s3Service.S3configuration.Client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(s3Service.S3configuration.BucketName),
+		Key:    aws.String(key),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return output.Body, nil
+}
+
+// PresignS3Object genera un link de descarga temporal para un objeto privado
+func (s3Service *videoServiceImp) PresignS3Object(key string, expires time.Duration) (string, error) {
+	presignClient := s3.NewPresignClient(s3Service.S3configuration.Client)
+
+	request, err := presignClient.PresignGetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(s3Service.S3configuration.BucketName),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expires))
+
+	if err != nil {
+		return "", err
+	}
+
+	return request.URL, nil
+}
+
 // ListObjects lists the objects in a bucket.
 func (s3Service *videoServiceImp) ListObjects(ctx context.Context, bucketName string, folder string) ([]types.Object, error) {
 	var err error
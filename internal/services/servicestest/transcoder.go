@@ -0,0 +1,163 @@
+// Package servicestest tiene dobles de los servicios para los tests, no se usa en producción
+package servicestest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"github.com/unbot2313/go-streaming-service/internal/services"
+)
+
+var _ services.Transcoder = (*FakeTranscoder)(nil)
+var _ services.Prober = (*FakeTranscoder)(nil)
+
+// FakeTranscoder reemplaza a ffmpeg y ffprobe en los tests: no lee el video, escribe un
+// playlist con segmentos de mentira según DurationSeconds y el perfil, y una miniatura fija.
+// Con Err configurado fallan todas las operaciones, con SegmentErr solo Segment. SegmentDelay
+// simula una conversión lenta que termina antes si se cancela el contexto.
+type FakeTranscoder struct {
+	DurationSeconds float64
+	Err             error
+	SegmentErr      error
+	SegmentDelay    time.Duration
+
+	mu       sync.Mutex
+	profiles []models.EncodingProfile
+}
+
+// Profiles devuelve los perfiles con los que se llamó a Segment, en orden
+func (fake *FakeTranscoder) Profiles() []models.EncodingProfile {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	return append([]models.EncodingProfile(nil), fake.profiles...)
+}
+
+// Probe devuelve la metadata de un mp4 de 720p con DurationSeconds
+func (fake *FakeTranscoder) Probe(ctx context.Context, input string) (*models.VideoMetadata, error) {
+	if fake.Err != nil {
+		return nil, fake.Err
+	}
+
+	if _, err := os.Stat(input); err != nil {
+		return nil, err
+	}
+
+	return &models.VideoMetadata{
+		Container:       "mov,mp4,m4a,3gp,3g2,mj2",
+		DurationSeconds: fake.DurationSeconds,
+		Width:           1280,
+		Height:          720,
+		FrameRate:       30,
+		VideoCodec:      "h264",
+		AudioCodec:      "aac",
+		AudioChannels:   2,
+		AudioSampleRate: 48000,
+		Streams: []models.MediaStream{
+			{Index: 0, Type: "video", Codec: "h264", Width: 1280, Height: 720, FrameRate: 30},
+			{Index: 1, Type: "audio", Codec: "aac", Channels: 2, SampleRate: 48000},
+		},
+	}, nil
+}
+
+// Segment escribe output con un segmento por cada SegmentSeconds del perfil, el último con lo que sobra,
+// y reporta el avance al terminar cada segmento
+func (fake *FakeTranscoder) Segment(ctx context.Context, input string, output string, profile *models.EncodingProfile, progress services.SegmentProgress) error {
+	fake.mu.Lock()
+	fake.profiles = append(fake.profiles, *profile)
+	fake.mu.Unlock()
+
+	if fake.Err != nil {
+		return fake.Err
+	}
+
+	if fake.SegmentErr != nil {
+		return fake.SegmentErr
+	}
+
+	select {
+	case <-time.After(fake.SegmentDelay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if _, err := os.Stat(input); err != nil {
+		return err
+	}
+
+	folder := filepath.Dir(output)
+	segmentSeconds := float64(profile.SegmentSeconds)
+	count := max(1, int(math.Ceil(fake.DurationSeconds/segmentSeconds)))
+
+	var playlist strings.Builder
+	fmt.Fprintf(&playlist, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n", profile.SegmentSeconds)
+
+	for i := 0; i < count; i++ {
+		duration := min(segmentSeconds, fake.DurationSeconds-float64(i)*segmentSeconds)
+		segment := fmt.Sprintf("output%d.ts", i)
+
+		if err := os.WriteFile(filepath.Join(folder, segment), []byte("segment "+segment), 0644); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(&playlist, "#EXTINF:%.6f,\n%s\n", duration, segment)
+
+		if progress != nil {
+			progress(float64(i)*segmentSeconds + duration)
+		}
+	}
+
+	playlist.WriteString("#EXT-X-ENDLIST\n")
+
+	return os.WriteFile(output, []byte(playlist.String()), 0644)
+}
+
+// ResizeImage escribe una imagen fija en output
+func (fake *FakeTranscoder) ResizeImage(ctx context.Context, input string, output string, size int) error {
+	if fake.Err != nil {
+		return fake.Err
+	}
+
+	if _, err := os.Stat(input); err != nil {
+		return err
+	}
+
+	return os.WriteFile(output, []byte(fmt.Sprintf("image %dpx", size)), 0644)
+}
+
+func (fake *FakeTranscoder) Thumbnail(ctx context.Context, input string, output string) error {
+	if fake.Err != nil {
+		return fake.Err
+	}
+
+	if _, err := os.Stat(input); err != nil {
+		return err
+	}
+
+	return os.WriteFile(output, []byte("thumbnail"), 0644)
+}
+
+// Live descarta el stream que se escribe
+func (fake *FakeTranscoder) Live(options *services.LiveOptions) (io.WriteCloser, error) {
+	if fake.Err != nil {
+		return nil, fake.Err
+	}
+
+	return nopWriteCloser{io.Discard}, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,274 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/unbot2313/go-streaming-service/config"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidStreamKey = errors.New("invalid stream key")
+
+var ErrStreamKeyNotFound = errors.New("stream key not found")
+
+var ErrTooManyStreamKeys = errors.New("too many stream keys")
+
+const (
+	// prefijo para reconocer las claves en los logs o si se filtran
+	streamKeyPrefix = "live_"
+	// caracteres de la clave que se guardan en claro para mostrarla en el listado
+	streamKeyVisibleLength = 12
+	maxStreamKeysPerUser   = 10
+)
+
+// ListStreamKeys devuelve las claves del usuario de la más antigua a la más nueva
+func (service *UserServiceImp) ListStreamKeys(userId string) ([]models.StreamKey, error) {
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	streamKeys := []models.StreamKey{}
+
+	err = db.Where("user_id = ?", userId).Order("created_at, id").Find(&streamKeys).Error
+
+	return streamKeys, err
+}
+
+// CreateStreamKey crea una clave con la configuración pedida, la clave solo se devuelve esta vez
+func (service *UserServiceImp) CreateStreamKey(userId string, request *models.StreamKeyRequest) (*models.StreamKeyResponse, error) {
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	plainKey := newStreamKey()
+
+	streamKey := models.StreamKey{
+		Id:      uuid.New().String(),
+		UserID:  userId,
+		KeyHash: hashStreamKey(plainKey),
+		Prefix:  plainKey[:streamKeyVisibleLength],
+		Name:    "default",
+		Record:  true,
+	}
+	applyStreamKeyRequest(&streamKey, request)
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.StreamKey{}).Where("user_id = ?", userId).Count(&count).Error; err != nil {
+			return err
+		}
+
+		if count >= maxStreamKeysPerUser {
+			return fmt.Errorf("%w: max %d per user", ErrTooManyStreamKeys, maxStreamKeysPerUser)
+		}
+
+		// Select("*") para que se guarden los false y los 0 en vez de los valores por defecto
+		return tx.Select("*").Create(&streamKey).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newStreamKeyResponse(streamKey, plainKey), nil
+}
+
+// UpdateStreamKey cambia el nombre o la configuración de una clave, la clave sigue siendo la misma
+func (service *UserServiceImp) UpdateStreamKey(userId string, keyId string, request *models.StreamKeyRequest) (*models.StreamKey, error) {
+	streamKey, err := findStreamKey(userId, keyId)
+	if err != nil {
+		return nil, err
+	}
+
+	applyStreamKeyRequest(streamKey, request)
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Model(streamKey).Updates(map[string]interface{}{
+		"name":             streamKey.Name,
+		"record":           streamKey.Record,
+		"max_bitrate_kbps": streamKey.MaxBitrateKbps,
+		"title_template":   streamKey.TitleTemplate,
+		"low_latency":      streamKey.LowLatency,
+	}).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return streamKey, nil
+}
+
+// RotateStreamKey reemplaza la clave por una nueva y conserva la configuración,
+// la anterior deja de servir para las próximas publicaciones
+func (service *UserServiceImp) RotateStreamKey(userId string, keyId string) (*models.StreamKeyResponse, error) {
+	streamKey, err := findStreamKey(userId, keyId)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	plainKey := newStreamKey()
+	streamKey.KeyHash = hashStreamKey(plainKey)
+	streamKey.Prefix = plainKey[:streamKeyVisibleLength]
+	streamKey.LastUsedAt = nil
+
+	err = db.Model(streamKey).Updates(map[string]interface{}{
+		"key_hash":     streamKey.KeyHash,
+		"prefix":       streamKey.Prefix,
+		"last_used_at": nil,
+	}).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newStreamKeyResponse(*streamKey, plainKey), nil
+}
+
+// RevokeStreamKey borra la clave, una transmisión que ya empezó con ella sigue hasta que termine
+func (service *UserServiceImp) RevokeStreamKey(userId string, keyId string) error {
+	db, err := config.GetDB()
+	if err != nil {
+		return err
+	}
+
+	dbCtx := db.Where("id = ? AND user_id = ?", keyId, userId).Delete(&models.StreamKey{})
+
+	if dbCtx.Error != nil {
+		return dbCtx.Error
+	}
+
+	if dbCtx.RowsAffected == 0 {
+		return fmt.Errorf("%w: id %s", ErrStreamKeyNotFound, keyId)
+	}
+
+	return nil
+}
+
+// AuthenticateStreamKey es la validación del servidor de ingesta: busca la clave, verifica
+// que la cuenta exista y no esté suspendida, y guarda cuándo se usó
+func (service *UserServiceImp) AuthenticateStreamKey(plainKey string) (*models.User, *models.StreamKey, error) {
+	if plainKey == "" {
+		return nil, nil, ErrInvalidStreamKey
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var streamKey models.StreamKey
+
+	dbCtx := db.Where("key_hash = ?", hashStreamKey(plainKey)).First(&streamKey)
+
+	if errors.Is(dbCtx.Error, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrInvalidStreamKey
+	}
+
+	if dbCtx.Error != nil {
+		return nil, nil, dbCtx.Error
+	}
+
+	// la cuenta borrada no se encuentra, la suspendida no puede transmitir
+	user, err := service.GetUserByID(streamKey.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := checkSuspension(user); err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	if err := db.Model(&streamKey).Update("last_used_at", now).Error; err != nil {
+		return nil, nil, err
+	}
+	streamKey.LastUsedAt = &now
+
+	return user, &streamKey, nil
+}
+
+func findStreamKey(userId string, keyId string) (*models.StreamKey, error) {
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var streamKey models.StreamKey
+
+	dbCtx := db.Where("id = ? AND user_id = ?", keyId, userId).First(&streamKey)
+
+	if errors.Is(dbCtx.Error, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: id %s", ErrStreamKeyNotFound, keyId)
+	}
+
+	if dbCtx.Error != nil {
+		return nil, dbCtx.Error
+	}
+
+	return &streamKey, nil
+}
+
+func applyStreamKeyRequest(streamKey *models.StreamKey, request *models.StreamKeyRequest) {
+	if request.Name != nil {
+		streamKey.Name = *request.Name
+	}
+
+	if request.Record != nil {
+		streamKey.Record = *request.Record
+	}
+
+	if request.MaxBitrateKbps != nil {
+		streamKey.MaxBitrateKbps = *request.MaxBitrateKbps
+	}
+
+	if request.TitleTemplate != nil {
+		streamKey.TitleTemplate = *request.TitleTemplate
+	}
+
+	if request.LowLatency != nil {
+		streamKey.LowLatency = *request.LowLatency
+	}
+}
+
+func newStreamKeyResponse(streamKey models.StreamKey, plainKey string) *models.StreamKeyResponse {
+	return &models.StreamKeyResponse{
+		StreamKey: streamKey,
+		Key:       plainKey,
+		IngestURL: config.GetConfig().RTMPPublicURL,
+	}
+}
+
+func newStreamKey() string {
+	return streamKeyPrefix + randomURLSafeString(24)
+}
+
+func hashStreamKey(streamKey string) string {
+	hash := sha256.Sum256([]byte(streamKey))
+	return hex.EncodeToString(hash[:])
+}
+
+// collectStreamKeys exporta el nombre, la configuración y las fechas de las claves, nunca el hash
+func collectStreamKeys(db *gorm.DB, userId string) (interface{}, error) {
+	var streamKeys []models.StreamKey
+
+	err := db.Where("user_id = ?", userId).Order("created_at").Find(&streamKeys).Error
+
+	return streamKeys, err
+}
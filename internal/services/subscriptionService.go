@@ -0,0 +1,221 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/unbot2313/go-streaming-service/config"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrSelfSubscription = errors.New("cannot subscribe to your own channel")
+
+type subscriptionService struct {
+	userService UserService
+}
+
+// SubscriptionService maneja las suscripciones a los canales y el feed con los videos
+// de los canales que sigue cada usuario
+type SubscriptionService interface {
+	Subscribe(subscriberId string, channelId string) (*models.SubscriptionResult, error)
+	Unsubscribe(subscriberId string, channelId string) (*models.SubscriptionResult, error)
+	ListSubscriptions(subscriberId string, cursor string, limit int) (*models.ChannelPage, error)
+	GetFeed(subscriberId string, cursor string, limit int) (*models.VideoPage, error)
+}
+
+func NewSubscriptionService(userService UserService) SubscriptionService {
+	return &subscriptionService{userService: userService}
+}
+
+// Subscribe es idempotente, el contador del canal solo sube si la suscripción es nueva
+func (service *subscriptionService) Subscribe(subscriberId string, channelId string) (*models.SubscriptionResult, error) {
+	if subscriberId == channelId {
+		return nil, ErrSelfSubscription
+	}
+
+	if _, err := service.userService.GetUserByID(channelId); err != nil {
+		return nil, err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		dbCtx := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.Subscription{SubscriberID: subscriberId, ChannelID: channelId})
+
+		if dbCtx.Error != nil || dbCtx.RowsAffected == 0 {
+			return dbCtx.Error
+		}
+
+		return addSubscriberCount(tx, channelId, 1)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return service.result(channelId, true)
+}
+
+func (service *subscriptionService) Unsubscribe(subscriberId string, channelId string) (*models.SubscriptionResult, error) {
+	if _, err := service.userService.GetUserByID(channelId); err != nil {
+		return nil, err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		dbCtx := tx.Where("subscriber_id = ? AND channel_id = ?", subscriberId, channelId).
+			Delete(&models.Subscription{})
+
+		if dbCtx.Error != nil || dbCtx.RowsAffected == 0 {
+			return dbCtx.Error
+		}
+
+		return addSubscriberCount(tx, channelId, -1)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return service.result(channelId, false)
+}
+
+// ListSubscriptions lista los canales que sigue el usuario, de la suscripción más reciente a la más antigua
+func (service *subscriptionService) ListSubscriptions(subscriberId string, cursor string, limit int) (*models.ChannelPage, error) {
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	size := pageSize(limit)
+
+	query := db.Model(&models.Subscription{}).
+		Joins("JOIN users ON users.id = subscriptions.channel_id AND users.deleted_at IS NULL").
+		Where("subscriptions.subscriber_id = ?", subscriberId).
+		Order("subscriptions.created_at DESC, subscriptions.channel_id DESC")
+
+	if after != nil {
+		query = query.Where("(subscriptions.created_at, subscriptions.channel_id) < (?, ?)", after.Time, after.Id)
+	}
+
+	var subscriptions []models.Subscription
+
+	// se pide uno más para saber si hay otra página
+	if err := query.Limit(size + 1).Find(&subscriptions).Error; err != nil {
+		return nil, err
+	}
+
+	page := &models.ChannelPage{Items: make([]models.ChannelSummary, 0, len(subscriptions))}
+
+	if len(subscriptions) > size {
+		subscriptions = subscriptions[:size]
+		last := subscriptions[size-1]
+		page.NextCursor = encodeCursor(last.CreatedAt, last.ChannelID)
+	}
+
+	if len(subscriptions) == 0 {
+		return page, nil
+	}
+
+	channelIds := make([]string, len(subscriptions))
+	for i, subscription := range subscriptions {
+		channelIds[i] = subscription.ChannelID
+	}
+
+	var channels []models.User
+	if err := db.Where("id IN ?", channelIds).Find(&channels).Error; err != nil {
+		return nil, err
+	}
+
+	channelsById := make(map[string]models.User, len(channels))
+	for _, channel := range channels {
+		channelsById[channel.Id] = channel
+	}
+
+	for _, subscription := range subscriptions {
+		channel, ok := channelsById[subscription.ChannelID]
+		if !ok {
+			continue
+		}
+
+		page.Items = append(page.Items, models.ChannelSummary{
+			Id:              channel.Id,
+			Username:        channel.Username,
+			DisplayName:     channel.DisplayName,
+			Avatars:         channel.Avatars,
+			SubscriberCount: channel.SubscriberCount,
+			SubscribedAt:    subscription.CreatedAt,
+		})
+	}
+
+	return page, nil
+}
+
+// GetFeed son los videos públicos más nuevos de los canales que sigue el usuario
+func (service *subscriptionService) GetFeed(subscriberId string, cursor string, limit int) (*models.VideoPage, error) {
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	channelIds := db.Model(&models.Subscription{}).Select("channel_id").Where("subscriber_id = ?", subscriberId)
+
+	return paginateVideos(db.Scopes(publicVideos).Where("videos.user_id IN (?)", channelIds), after, limit)
+}
+
+func (service *subscriptionService) result(channelId string, subscribed bool) (*models.SubscriptionResult, error) {
+	channel, err := service.userService.GetUserByID(channelId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SubscriptionResult{
+		ChannelID:       channelId,
+		Subscribed:      subscribed,
+		SubscriberCount: channel.SubscriberCount,
+	}, nil
+}
+
+// addSubscriberCount suma o resta en el contador del canal con un UPDATE atómico
+func addSubscriberCount(tx *gorm.DB, channelId string, delta int) error {
+	dbCtx := tx.Model(&models.User{}).Where("id = ?", channelId).
+		UpdateColumn("subscriber_count", gorm.Expr("subscriber_count + ?", delta))
+
+	if dbCtx.Error != nil {
+		return dbCtx.Error
+	}
+
+	if dbCtx.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, channelId)
+	}
+
+	return nil
+}
+
+func collectSubscriptions(db *gorm.DB, userId string) (interface{}, error) {
+	var subscriptions []models.Subscription
+
+	err := db.Where("subscriber_id = ?", userId).Order("created_at").Find(&subscriptions).Error
+
+	return subscriptions, err
+}
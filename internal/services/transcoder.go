@@ -0,0 +1,427 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/unbot2313/go-streaming-service/internal/models"
+)
+
+// SegmentProgress recibe los segundos del video que ya se convirtieron
+type SegmentProgress func(seconds float64)
+
+// cuánto se espera a que se cierren stdout y stderr después de matar el comando
+const commandWaitDelay = 5 * time.Second
+
+// Transcoder hace las conversiones de los videos subidos: el HLS y la miniatura.
+// Si se cancela el contexto se mata ffmpeg y devuelven el error del contexto
+type Transcoder interface {
+	// Segment pasa el video a HLS con el perfil, output es el playlist y los segmentos quedan en su carpeta.
+	// Mientras convierte llama a progress si no es nil
+	Segment(ctx context.Context, input string, output string, profile *models.EncodingProfile, progress SegmentProgress) error
+	// Thumbnail guarda un frame del video como imagen en output
+	Thumbnail(ctx context.Context, input string, output string) error
+	// ResizeImage recorta el centro de la imagen input a un cuadrado de size pixeles y lo guarda en
+	// output. input tiene que tener la extensión de su formato real (ver detectImageExtension)
+	ResizeImage(ctx context.Context, input string, output string, size int) error
+	// Live arranca la conversión de una transmisión, el FLV se escribe en lo que devuelve.
+	// Close espera a que termine de escribir los segmentos y devuelve el error con el que terminó
+	Live(options *LiveOptions) (io.WriteCloser, error)
+}
+
+// LiveOptions son las salidas HLS de una transmisión, ver liveArgs
+type LiveOptions struct {
+	// carpeta del playlist en vivo y sus segmentos
+	Folder         string
+	SegmentSeconds int
+	// segmentos que quedan en el playlist en vivo
+	ListSize int
+	// en baja latencia se escriben partes de PartDuration en fMP4, recodificando con Preset
+	LowLatency      bool
+	PartDuration    time.Duration
+	PartsPerSegment int
+	Preset          string
+	// si no está vacío se guardan además todos los segmentos en esta carpeta
+	RecordingFolder string
+}
+
+// Prober lee la información de un video
+type Prober interface {
+	// Probe devuelve la duración y los datos de los streams del archivo
+	Probe(ctx context.Context, input string) (*models.VideoMetadata, error)
+}
+
+// commandError agrega la salida de ffmpeg al error, salvo si se mató por el contexto
+func commandError(ctx context.Context, message string, err error, output []byte) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s: %w", message, ctx.Err())
+	}
+
+	return fmt.Errorf("%s: %w, output: %s", message, err, string(output))
+}
+
+type ffmpegTranscoder struct{}
+
+// NewFFmpegTranscoder convierte los videos ejecutando ffmpeg
+func NewFFmpegTranscoder() Transcoder {
+	return &ffmpegTranscoder{}
+}
+
+func (transcoder *ffmpegTranscoder) Segment(ctx context.Context, input string, output string, profile *models.EncodingProfile, progress SegmentProgress) error {
+	// el avance sale por stdout con -progress, los errores siguen por stderr
+	args := append([]string{"-progress", "pipe:1", "-nostats"}, encodingArgs(profile, input, output)...)
+	cmd := commandContext(ctx, "ffmpeg", args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error al ejecutar el comando ffmpeg: %w", err)
+	}
+
+	readProgress(stdout, progress)
+
+	if err := cmd.Wait(); err != nil {
+		return commandError(ctx, "error al ejecutar el comando ffmpeg", err, stderr.Bytes())
+	}
+
+	return nil
+}
+
+// readProgress lee la salida de -progress de ffmpeg hasta que termina: bloques de clave=valor
+// que cierran con progress=continue o progress=end. Por cada bloque reporta out_time, que
+// según la versión viene como out_time_us o como out_time_ms (también en microsegundos)
+func readProgress(reader io.Reader, progress SegmentProgress) {
+	scanner := bufio.NewScanner(reader)
+	outTime := -1.0
+
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "out_time_us", "out_time_ms":
+			// al principio viene N/A
+			if micros, err := strconv.ParseInt(value, 10, 64); err == nil && micros >= 0 {
+				outTime = float64(micros) / 1e6
+			}
+		case "progress":
+			if progress != nil && outTime >= 0 {
+				progress(outTime)
+			}
+		}
+	}
+
+	// si se deja de leer ffmpeg se bloquea escribiendo el avance
+	io.Copy(io.Discard, reader)
+}
+
+func (transcoder *ffmpegTranscoder) Thumbnail(ctx context.Context, input string, output string) error {
+	// -ss antes de -i para que busque el frame sin decodificar todo lo anterior
+	cmd := commandContext(ctx, "ffmpeg",
+		"-ss", "00:00:08",
+		"-i", input,
+		"-frames:v", "1",
+		"-vf", "scale=480:-1",
+		"-y",
+		output,
+	)
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return commandError(ctx, "error generando miniatura", err, output)
+	}
+
+	return nil
+}
+
+func (transcoder *ffmpegTranscoder) ResizeImage(ctx context.Context, input string, output string, size int) error {
+	cmd := commandContext(ctx, "ffmpeg", resizeImageArgs(input, output, size)...)
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return commandError(ctx, fmt.Sprintf("error generando la imagen de %dpx", size), err, output)
+	}
+
+	return nil
+}
+
+func (transcoder *ffmpegTranscoder) Live(options *LiveOptions) (io.WriteCloser, error) {
+	// dura lo que la transmisión, el contexto solo sirve para matar a ffmpeg y sus procesos
+	ctx, cancel := context.WithCancel(context.Background())
+
+	cmd := commandContext(ctx, "ffmpeg", liveArgs(options)...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("error al ejecutar el comando ffmpeg: %w", err)
+	}
+
+	return &liveProcess{WriteCloser: stdin, cmd: cmd, cancel: cancel}, nil
+}
+
+// liveProcess es la entrada de un ffmpeg que convierte una transmisión
+type liveProcess struct {
+	io.WriteCloser
+	cmd    *exec.Cmd
+	cancel context.CancelFunc
+}
+
+// Close cierra la entrada para que ffmpeg termine y lo espera
+func (process *liveProcess) Close() error {
+	defer process.cancel()
+
+	process.WriteCloser.Close()
+	return process.cmd.Wait()
+}
+
+// resizeImageArgs fuerza el demuxer de imágenes y solo deja leer archivos locales: si no, ffmpeg
+// elige el formato por el contenido y un playlist con extensión .png se abriría como playlist
+func resizeImageArgs(input string, output string, size int) []string {
+	scale := fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase,crop=%d:%d", size, size, size, size)
+
+	return []string{
+		"-protocol_whitelist", "file",
+		"-f", "image2",
+		"-i", input,
+		"-frames:v", "1",
+		"-vf", scale,
+		"-y",
+		output,
+	}
+}
+
+type ffprobeProber struct{}
+
+// NewFFprobeProber lee la información de los videos con ffprobe
+func NewFFprobeProber() Prober {
+	return &ffprobeProber{}
+}
+
+// FFProbeOutput es la parte de la salida de ffprobe -show_format -show_streams que se usa.
+// ffprobe devuelve los números grandes y las fracciones como texto
+type FFProbeOutput struct {
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		Size       string `json:"size"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+	Streams []FFProbeStream `json:"streams"`
+}
+
+// FFProbeStream es un stream de la salida de ffprobe
+type FFProbeStream struct {
+	Index          int    `json:"index"`
+	CodecType      string `json:"codec_type"`
+	CodecName      string `json:"codec_name"`
+	Profile        string `json:"profile"`
+	BitRate        string `json:"bit_rate"`
+	Duration       string `json:"duration"`
+	Width          int    `json:"width"`
+	Height         int    `json:"height"`
+	AvgFrameRate   string `json:"avg_frame_rate"`
+	RFrameRate     string `json:"r_frame_rate"`
+	PixFmt         string `json:"pix_fmt"`
+	ColorTransfer  string `json:"color_transfer"`
+	ColorPrimaries string `json:"color_primaries"`
+	ColorSpace     string `json:"color_space"`
+	Channels       int    `json:"channels"`
+	ChannelLayout  string `json:"channel_layout"`
+	SampleRate     string `json:"sample_rate"`
+	// attached_pic es 1 en la portada de un mp3 o m4a, que también es un stream de video
+	Disposition struct {
+		AttachedPic int `json:"attached_pic"`
+	} `json:"disposition"`
+	Tags struct {
+		Language string `json:"language"`
+		// los archivos viejos traen la rotación como tag en vez de la matriz
+		Rotate string `json:"rotate"`
+	} `json:"tags"`
+	SideDataList []struct {
+		SideDataType string  `json:"side_data_type"`
+		Rotation     float64 `json:"rotation"`
+	} `json:"side_data_list"`
+}
+
+func (prober *ffprobeProber) Probe(ctx context.Context, input string) (*models.VideoMetadata, error) {
+	cmd := commandContext(ctx, "ffprobe",
+		"-v", "quiet",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		input)
+
+	output, err := cmd.Output()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("error ejecutando ffprobe: %w", ctx.Err())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error ejecutando ffprobe: %v", err)
+	}
+
+	return parseProbeOutput(output)
+}
+
+// parseProbeOutput arma la metadata con la salida de ffprobe, la duración es lo único obligatorio
+func parseProbeOutput(output []byte) (*models.VideoMetadata, error) {
+	var ffprobeOutput FFProbeOutput
+	if err := json.Unmarshal(output, &ffprobeOutput); err != nil {
+		return nil, fmt.Errorf("error parseando la salida de ffprobe: %v", err)
+	}
+
+	format := ffprobeOutput.Format
+
+	metadata := &models.VideoMetadata{
+		Container: format.FormatName,
+		SizeBytes: parseProbeInt(format.Size),
+		Bitrate:   parseProbeInt(format.BitRate),
+		Streams:   []models.MediaStream{},
+	}
+
+	var videoDuration string
+
+	for _, stream := range ffprobeOutput.Streams {
+		mediaStream := models.MediaStream{
+			Index:    stream.Index,
+			Type:     stream.CodecType,
+			Codec:    stream.CodecName,
+			Profile:  stream.Profile,
+			Bitrate:  parseProbeInt(stream.BitRate),
+			Language: stream.Tags.Language,
+		}
+
+		switch stream.CodecType {
+		case "video":
+			mediaStream.Width = stream.Width
+			mediaStream.Height = stream.Height
+			mediaStream.FrameRate = streamFrameRate(stream)
+			mediaStream.PixelFormat = stream.PixFmt
+			mediaStream.Rotation = streamRotation(stream)
+			mediaStream.ColorTransfer = stream.ColorTransfer
+			mediaStream.ColorPrimaries = stream.ColorPrimaries
+			mediaStream.ColorSpace = stream.ColorSpace
+
+			for _, sideData := range stream.SideDataList {
+				if sideData.SideDataType == "DOVI configuration record" {
+					mediaStream.DolbyVision = true
+				}
+			}
+
+			// la portada no cuenta como el video
+			if metadata.VideoCodec == "" && stream.Disposition.AttachedPic == 0 {
+				metadata.Width = mediaStream.Width
+				metadata.Height = mediaStream.Height
+				metadata.FrameRate = mediaStream.FrameRate
+				metadata.VideoCodec = mediaStream.Codec
+				metadata.VideoProfile = mediaStream.Profile
+				metadata.VideoBitrate = mediaStream.Bitrate
+				metadata.PixelFormat = mediaStream.PixelFormat
+				metadata.Rotation = mediaStream.Rotation
+				metadata.ColorTransfer = mediaStream.ColorTransfer
+				metadata.ColorPrimaries = mediaStream.ColorPrimaries
+				metadata.ColorSpace = mediaStream.ColorSpace
+				metadata.DolbyVision = mediaStream.DolbyVision
+				// PQ es HDR10 y arib-std-b67 es HLG
+				metadata.HDR = mediaStream.DolbyVision || stream.ColorTransfer == "smpte2084" || stream.ColorTransfer == "arib-std-b67"
+				videoDuration = stream.Duration
+			}
+		case "audio":
+			mediaStream.Channels = stream.Channels
+			mediaStream.ChannelLayout = stream.ChannelLayout
+			mediaStream.SampleRate = int(parseProbeInt(stream.SampleRate))
+
+			if metadata.AudioCodec == "" {
+				metadata.AudioCodec = mediaStream.Codec
+				metadata.AudioBitrate = mediaStream.Bitrate
+				metadata.AudioChannels = mediaStream.Channels
+				metadata.AudioSampleRate = mediaStream.SampleRate
+			}
+		}
+
+		metadata.Streams = append(metadata.Streams, mediaStream)
+	}
+
+	// algunos contenedores no traen la duración en el formato, sí en el stream
+	duration := format.Duration
+	if duration == "" || duration == "N/A" {
+		duration = videoDuration
+	}
+
+	seconds, err := strconv.ParseFloat(duration, 64)
+	if err != nil {
+		return nil, fmt.Errorf("error convirtiendo la duración a número: %v", err)
+	}
+	metadata.DurationSeconds = seconds
+
+	return metadata, nil
+}
+
+// parseProbeInt convierte un número de ffprobe, devuelve 0 si viene vacío o N/A
+func parseProbeInt(value string) int64 {
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return number
+}
+
+// streamFrameRate convierte la fracción de ffprobe (ejm: 30000/1001), avg_frame_rate viene
+// 0/0 en algunos contenedores y ahí se usa r_frame_rate
+func streamFrameRate(stream FFProbeStream) float64 {
+	for _, rate := range []string{stream.AvgFrameRate, stream.RFrameRate} {
+		numerator, denominator, ok := strings.Cut(rate, "/")
+		if !ok {
+			continue
+		}
+
+		num, errNum := strconv.ParseFloat(numerator, 64)
+		den, errDen := strconv.ParseFloat(denominator, 64)
+		if errNum != nil || errDen != nil || num <= 0 || den <= 0 {
+			continue
+		}
+
+		return math.Round(num/den*1000) / 1000
+	}
+
+	return 0
+}
+
+// streamRotation devuelve los grados en sentido horario para mostrar el video. La matriz de
+// rotación de ffprobe va en sentido antihorario (-90 es girar 90 en sentido horario), el tag
+// rotate de los archivos viejos ya viene en sentido horario
+func streamRotation(stream FFProbeStream) int {
+	degrees := 0.0
+
+	if rotate, err := strconv.ParseFloat(stream.Tags.Rotate, 64); err == nil {
+		degrees = rotate
+	}
+
+	for _, sideData := range stream.SideDataList {
+		if sideData.SideDataType == "Display Matrix" {
+			degrees = -sideData.Rotation
+		}
+	}
+
+	return ((int(math.Round(degrees)) % 360) + 360) % 360
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/unbot2313/go-streaming-service/config"
@@ -10,6 +11,12 @@ import (
 	"gorm.io/gorm"
 )
 
+// ErrUserNotFound se devuelve cuando el usuario buscado no existe
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrInvalidCurrentPassword se devuelve cuando no se confirma bien la contraseña actual
+var ErrInvalidCurrentPassword = errors.New("la contraseña actual no es válida")
+
 type UserServiceImp struct{}
 
 type UserService interface {
@@ -17,8 +24,16 @@ type UserService interface {
 	GetUserByUserName(userName string) (*models.User, error)
 	CreateUser(user *models.User) (*models.User, error)
 	DeleteUserByID(Id string) error
-	// Pendiente
+	GetDeletedUserByUserName(userName string) (*models.User, error)
+	RestoreUserByID(Id string) (*models.User, error)
 	UpdateUserByID(Id string, user *models.User) (*models.User, error)
+	UpdateProfile(Id string, update *models.UserUpdate) (*models.User, error)
+	ListStreamKeys(userId string) ([]models.StreamKey, error)
+	CreateStreamKey(userId string, request *models.StreamKeyRequest) (*models.StreamKeyResponse, error)
+	UpdateStreamKey(userId string, keyId string, request *models.StreamKeyRequest) (*models.StreamKey, error)
+	RotateStreamKey(userId string, keyId string) (*models.StreamKeyResponse, error)
+	RevokeStreamKey(userId string, keyId string) error
+	AuthenticateStreamKey(plainKey string) (*models.User, *models.StreamKey, error)
 }
 
 func (service *UserServiceImp) GetUserByID(Id string) (*models.User, error) {
@@ -30,12 +45,12 @@ func (service *UserServiceImp) GetUserByID(Id string) (*models.User, error) {
 		return nil, err
 	}
 
-	// Busca el usuario por ID e incluye los videos asociados
-	err = db.Preload("Videos").First(&user, "id = ?", Id).Error
+	// Busca el usuario por ID e incluye sus videos públicos
+	err = db.Preload("Videos", publicVideos).First(&user, "id = ?", Id).Error
 
 	// Maneja el caso de usuario no encontrado
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, fmt.Errorf("user with ID %s not found", Id)
+		return nil, fmt.Errorf("%w: ID %s", ErrUserNotFound, Id)
 	}
 
 	// Maneja cualquier otro error
@@ -55,12 +70,12 @@ func (service *UserServiceImp) GetUserByUserName(userName string) (*models.User,
 		return nil, err
 	}
 
-	// Busca el usuario por username e incluye los videos asociados
-	err = db.Preload("Videos").First(&user, "username = ?", userName).Error
+	// Busca el usuario por username e incluye sus videos públicos
+	err = db.Preload("Videos", publicVideos).First(&user, "username = ?", userName).Error
 
 	// Maneja el caso de usuario no encontrado
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, fmt.Errorf("user with username %s not found", userName)
+		return nil, fmt.Errorf("%w: username %s", ErrUserNotFound, userName)
 	}
 
 	// Maneja cualquier otro error
@@ -79,6 +94,15 @@ func (service *UserServiceImp) CreateUser(user *models.User) (*models.User, erro
 
 	user.Id = uuid.New().String()
 
+	// el avatar solo se asigna con PUT /users/me/avatar
+	user.Avatars = nil
+
+	// una cuenta nueva siempre empieza como usuario normal, sin suscriptores ni suspensión
+	user.Role = models.RoleUser
+	user.SubscriberCount = 0
+	user.SuspendedUntil = nil
+	user.PurgeAfter = nil
+
 	hashedPassword, err := HashPassword(user.Password)
 
 	if err != nil {
@@ -100,6 +124,9 @@ func (service *UserServiceImp) CreateUser(user *models.User) (*models.User, erro
 	return user, nil
 }
 
+// DeleteUserByID borra la cuenta y sus videos con soft delete, ambos con la misma fecha para
+// poder restaurarlos juntos. La eliminación definitiva la hace el AccountPurgeService
+// cuando pasa el periodo de gracia.
 func (service *UserServiceImp) DeleteUserByID(Id string) error {
 
 	db, err := config.GetDB()
@@ -107,23 +134,173 @@ func (service *UserServiceImp) DeleteUserByID(Id string) error {
 		return err
 	}
 
-	 // Elimina el usuario usando el campo personalizado `Id`
-    dbCtx := db.Where("id = ?", Id).Delete(&models.User{})
+	now := time.Now()
+	purgeAfter := now.Add(config.GetConfig().AccountDeletionGracePeriod)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		dbCtx := tx.Model(&models.User{}).Where("id = ?", Id).
+			Updates(map[string]interface{}{"deleted_at": now, "purge_after": purgeAfter})
+
+		if dbCtx.Error != nil {
+			return dbCtx.Error
+		}
 
-	if errors.Is(dbCtx.Error, gorm.ErrRecordNotFound) {
-		return fmt.Errorf("user with ID %s not found", Id)
+		if dbCtx.RowsAffected == 0 {
+			return fmt.Errorf("%w: ID %s", ErrUserNotFound, Id)
+		}
+
+		// los videos dejan de listarse de inmediato
+		return tx.Model(&models.VideoModel{}).Where("user_id = ?", Id).
+			Update("deleted_at", now).Error
+	})
+}
+
+// GetDeletedUserByUserName busca una cuenta borrada que todavía se puede restaurar
+func (service *UserServiceImp) GetDeletedUserByUserName(userName string) (*models.User, error) {
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
 	}
 
-    if dbCtx.Error != nil {
-        return dbCtx.Error
-    }
+	var user models.User
+
+	err = db.Unscoped().
+		Where("username = ? AND deleted_at IS NOT NULL AND purge_after > ?", userName, time.Now()).
+		First(&user).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: username %s", ErrUserNotFound, userName)
+	}
 
-	return nil
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
 }
 
-// Pendiente
+// RestoreUserByID deshace el borrado de la cuenta y de los videos que se borraron con ella,
+// los que el usuario había borrado antes se quedan borrados
+func (service *UserServiceImp) RestoreUserByID(Id string) (*models.User, error) {
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+
+	err = db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", Id).First(&user).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: ID %s", ErrUserNotFound, Id)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Model(&models.VideoModel{}).
+			Where("user_id = ? AND deleted_at = ?", Id, user.DeletedAt.Time).
+			Update("deleted_at", nil).Error
+
+		if err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Model(&models.User{}).Where("id = ?", Id).
+			Updates(map[string]interface{}{"deleted_at": nil, "purge_after": nil}).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return service.GetUserByID(Id)
+}
+
+// UpdateUserByID actualiza los campos no vacíos de user, si trae contraseña se guarda hasheada
 func (service *UserServiceImp) UpdateUserByID(Id string, user *models.User) (*models.User, error) {
-	return nil, nil
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Password != "" {
+		hashedPassword, err := HashPassword(user.Password)
+		if err != nil {
+			return nil, err
+		}
+		user.Password = hashedPassword
+	}
+
+	// el id no se cambia
+	user.Id = ""
+
+	dbCtx := db.Model(&models.User{}).Where("id = ?", Id).Updates(user)
+
+	if dbCtx.Error != nil {
+		return nil, dbCtx.Error
+	}
+
+	if dbCtx.RowsAffected == 0 {
+		return nil, fmt.Errorf("%w: ID %s", ErrUserNotFound, Id)
+	}
+
+	return service.GetUserByID(Id)
+}
+
+// UpdateProfile aplica los cambios del perfil, a diferencia de UpdateUserByID permite dejar
+// campos vacíos (ejm: borrar la bio) y exige la contraseña actual para cambiar el email o la
+// contraseña, porque con el email se puede recuperar la cuenta.
+func (service *UserServiceImp) UpdateProfile(Id string, update *models.UserUpdate) (*models.User, error) {
+	user, err := service.GetUserByID(Id)
+	if err != nil {
+		return nil, err
+	}
+
+	emailChanged := update.Email != nil && *update.Email != user.Email
+
+	if (emailChanged || update.NewPassword != nil) && !CheckPasswordHash(update.CurrentPassword, user.Password) {
+		return nil, ErrInvalidCurrentPassword
+	}
+
+	changes := map[string]interface{}{}
+
+	if emailChanged {
+		changes["email"] = *update.Email
+	}
+
+	if update.DisplayName != nil {
+		changes["display_name"] = *update.DisplayName
+	}
+
+	if update.Bio != nil {
+		changes["bio"] = *update.Bio
+	}
+
+	if update.NewPassword != nil {
+		hashedPassword, err := HashPassword(*update.NewPassword)
+		if err != nil {
+			return nil, err
+		}
+		changes["password"] = hashedPassword
+	}
+
+	if len(changes) == 0 {
+		return user, nil
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Model(&models.User{}).Where("id = ?", Id).Updates(changes).Error; err != nil {
+		return nil, err
+	}
+
+	return service.GetUserByID(Id)
 }
 
 
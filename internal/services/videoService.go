@@ -1,14 +1,14 @@
 package services
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"math"
-	"os/exec"
+	"io"
 	"path/filepath"
-	"strconv"
 	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
@@ -27,11 +27,19 @@ var validVideoExtensions = []string{
 
 type VideoService interface {
 	SaveVideo(c *gin.Context) (*models.Video, error)
-	FormatVideo(videoName string) (string, error) 
-	UploadFilesFromFolderToS3(folder string) (importantFiles, string, error)
+	FormatVideo(ctx context.Context, videoName string, profile *models.EncodingProfile, progress SegmentProgress) (string, error)
+	UploadFilesFromFolderToS3(ctx context.Context, folder string) (importantFiles, string, error)
+	UploadFolderToS3(folder string, keyPrefix string) (map[string]string, error)
+	UploadFileToS3(filePath string, key string) (string, error)
+	UploadOriginalToS3(ctx context.Context, filePath string, baseFolder string, fileName string) error
+	GetS3Object(key string) (io.ReadCloser, error)
+	PresignS3Object(key string, expires time.Duration) (string, error)
+	ListObjects(ctx context.Context, bucketName string, folder string) ([]types.Object, error)
+	GetBucketName() string
 	DeleteS3Folder(folderName string) error
 	GetFilesService() FilesService // Nuevo método para acceder a FilesService
 	IsValidVideoExtension(c *gin.Context) bool
+	SaveThumbnail(ctx context.Context, videoPath string, folderPath string) (string, error)
 }
 
 
@@ -59,6 +67,10 @@ func (vs *videoServiceImp) GetFilesService() FilesService {
 	return vs.FilesService
 }
 
+func (vs *videoServiceImp) GetBucketName() string {
+	return vs.S3configuration.BucketName
+}
+
 func (vs *videoServiceImp) SaveVideo(c *gin.Context) (*models.Video, error) {
 	if err := vs.FilesService.EnsureDir("static/videos"); err != nil {
 		return nil, err
@@ -89,9 +101,14 @@ func (vs *videoServiceImp) SaveVideo(c *gin.Context) (*models.Video, error) {
 		return nil, fmt.Errorf("error al guardar el archivo: %w", err)
 	}
 
-	// Obtener la duración del video
-	duration, err := getVideoDuration(savePath)
+	// Obtener la duración y los streams del video, ffprobe no puede quedarse colgado con el request
+	probeCtx, cancel := stageContext(c.Request.Context(), config.ProcessingProbeTimeout)
+	defer cancel()
+
+	metadata, err := vs.prober.Probe(probeCtx, savePath)
 	if err != nil {
+		// el controlador solo borra el original si se guardó bien
+		vs.FilesService.RemoveFile(savePath)
 		return nil, fmt.Errorf("error al obtener la duración del video: %w", err)
 	}
 
@@ -102,13 +119,16 @@ func (vs *videoServiceImp) SaveVideo(c *gin.Context) (*models.Video, error) {
 		Video: 	 		header.Filename,
 		LocalPath: 	 	savePath,
 		UniqueName: 	uniqueName,
-		Duration: 		duration,
+		DurationSeconds: metadata.DurationSeconds,
+		Metadata: 		metadata,
 	}
 
 	return videoData, nil
 }
 
-func (vs *videoServiceImp) FormatVideo(VideoName string) (string, error) {
+// FormatVideo pasa el video a HLS con el perfil de codificación elegido, progress recibe
+// los segundos ya convertidos
+func (vs *videoServiceImp) FormatVideo(ctx context.Context, VideoName string, profile *models.EncodingProfile, progress SegmentProgress) (string, error) {
 
 	//obtener el nombre del video sin la extensión
 	stringName := strings.Split(VideoName, ".")
@@ -124,12 +144,11 @@ func (vs *videoServiceImp) FormatVideo(VideoName string) (string, error) {
 
 	videoPath := rawVideoPathFromWSL + VideoName
 
-	// ejecutar el comando ffmpeg para fragmentar el video y guardarlo en la carpeta ya creada para despues subirlo a s3
-	cmd := exec.Command("ffmpeg", "-i", videoPath, "-c", "copy", "-start_number", "0", "-hls_time", "10", "-hls_list_size", "0", "-f", "hls", saveFormatedPath)
-
-	err = cmd.Run()
-	if err != nil {
-		return "", fmt.Errorf("error al ejecutar el comando ffmpeg: %w", err)
+	// fragmentar el video y guardarlo en la carpeta ya creada para despues subirlo a s3
+	if err := vs.transcoder.Segment(ctx, videoPath, saveFormatedPath, profile, progress); err != nil {
+		// sin borrar lo que alcanzó a escribir ffmpeg, el controlador no conoce la carpeta
+		vs.FilesService.RemoveFolder(saveFormatedVideoPath + stringName[0])
+		return "", err
 	}
 
 	ffmpegFilesPath := saveFormatedVideoPath + stringName[0]
@@ -138,84 +157,36 @@ func (vs *videoServiceImp) FormatVideo(VideoName string) (string, error) {
 
 }
 
-func NewVideoService(S3Configuration S3Configuration, filesService FilesService) VideoService {
+// VideoS3Prefix devuelve el prefijo de la carpeta del video en s3, la carpeta
+// se llama <id>_<nombre del archivo> (ver SaveVideo y FormatVideo)
+func VideoS3Prefix(videoId string) string {
+	return videoId + "_"
+}
+
+// SaveThumbnail guarda la miniatura del video como thumbnail.webp en la carpeta
+func (vs *videoServiceImp) SaveThumbnail(ctx context.Context, videoPath string, folderPath string) (string, error) {
+	thumbnailPath := filepath.Join(folderPath, "thumbnail.webp")
+
+	if err := vs.transcoder.Thumbnail(ctx, videoPath, thumbnailPath); err != nil {
+		return "", err
+	}
+
+	return thumbnailPath, nil
+}
+
+// NewVideoService recibe el transcoder y el prober para poder cambiar ffmpeg por un fake en los tests
+func NewVideoService(S3Configuration S3Configuration, filesService FilesService, transcoder Transcoder, prober Prober) VideoService {
 	return &videoServiceImp{
 		S3configuration: S3Configuration,
 		FilesService: filesService,
+		transcoder: transcoder,
+		prober: prober,
 	}
 }
 
 type videoServiceImp struct{
 	S3configuration S3Configuration
 	FilesService FilesService
+	transcoder Transcoder
+	prober Prober
 }
-
-// Función para obtener la duración del video usando go-ffprobe
-type FFProbeOutput struct {
-    Format struct {
-        Duration string `json:"duration"`
-    } `json:"format"`
-}
-
-func formatDuration(seconds float64) string {
-    // Si es menos de 60 segundos, retornar solo segundos
-    if seconds < 60 {
-        return fmt.Sprintf("%.0fs", seconds)
-    }
-    
-    // Calcular minutos y segundos
-    minutes := math.Floor(seconds / 60)
-    remainingSeconds := math.Round(seconds - (minutes * 60))
-    
-    return fmt.Sprintf("%.0f:%.0f", minutes, remainingSeconds)
-}
-
-func getVideoDuration(videoPath string) (string, error) {
-    // Construir el comando ffprobe
-    cmd := exec.Command("ffprobe",
-        "-v", "quiet",
-        "-print_format", "json",
-        "-show_format",
-        videoPath)
-
-    // Ejecutar el comando y obtener la salida
-    output, err := cmd.Output()
-    if err != nil {
-        return "", fmt.Errorf("error ejecutando ffprobe: %v", err)
-    }
-
-    // Parsear la salida JSON
-    var ffprobeOutput FFProbeOutput
-    if err := json.Unmarshal(output, &ffprobeOutput); err != nil {
-        return "", fmt.Errorf("error parseando la salida de ffprobe: %v", err)
-    }
-
-    // Convertir la duración a float64
-    seconds, err := strconv.ParseFloat(ffprobeOutput.Format.Duration, 64)
-    if err != nil {
-        return "", fmt.Errorf("error convirtiendo la duración a número: %v", err)
-    }
-
-    return formatDuration(seconds), nil
-}
-
-func SaveThumbnail(videoPath string, folderPath string) (string, error) {
-    thumbnailName := fmt.Sprintf("%s.webp", "thumbnail")
-    thumbnailPath := filepath.Join(folderPath, thumbnailName)
-
-    // El cambio principal está en mover -ss antes de -i
-    cmd := exec.Command("ffmpeg",
-        "-ss", "00:00:08",      // MOVIDO: colocar antes de -i
-        "-i", videoPath,         // archivo de entrada
-        "-frames:v", "1",        // usar frames:v en lugar de vframes
-        "-vf", "scale=480:-1",   
-        "-y",                   
-        thumbnailPath,          
-    )
-
-    if output, err := cmd.CombinedOutput(); err != nil {
-        return "", fmt.Errorf("error generando miniatura: %w, output: %s", err, string(output))
-    }
-
-    return thumbnailPath, nil
-}
\ No newline at end of file
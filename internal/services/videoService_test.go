@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unbot2313/go-streaming-service/internal/models"
+)
+
+func TestMain(m *testing.M) {
+	// la configuración se lee una sola vez, los perfiles de prueba van antes de cualquier test
+	os.Setenv("ENCODING_PROFILES", "hd,mobile")
+	os.Setenv("ENCODING_PROFILE_HD_CRF", "20")
+	os.Setenv("ENCODING_PROFILE_HD_PRESET", "slow")
+	os.Setenv("ENCODING_PROFILE_HD_GOP", "48")
+	os.Setenv("ENCODING_PROFILE_HD_HEIGHT", "1080")
+	os.Setenv("ENCODING_PROFILE_HD_SEGMENT_SECONDS", "4")
+	os.Setenv("ENCODING_PROFILE_HD_ROLES", "admin,moderator")
+	os.Setenv("ENCODING_PROFILE_MOBILE_VIDEO_BITRATE", "800k")
+	os.Setenv("ENCODING_PROFILE_MOBILE_AUDIO_CHANNELS", "1")
+
+	os.Exit(m.Run())
+}
+
+func TestEncodingArgsDefaultProfileCopiesStreams(t *testing.T) {
+	profile, err := EncodingProfileFor("", models.RoleUser)
+	if err != nil {
+		t.Fatalf("EncodingProfileFor: %v", err)
+	}
+
+	got := strings.Join(encodingArgs(profile, "in.mp4", "out/output.m3u8"), " ")
+	want := "-i in.mp4 -c:v copy -c:a copy -start_number 0 -hls_time 10 -hls_list_size 0 -f hls out/output.m3u8"
+
+	if got != want {
+		t.Errorf("args = %q, want %q", got, want)
+	}
+}
+
+func TestEncodingArgsReencodeProfile(t *testing.T) {
+	profile, err := EncodingProfileFor("HD", models.RoleAdmin)
+	if err != nil {
+		t.Fatalf("EncodingProfileFor: %v", err)
+	}
+
+	got := strings.Join(encodingArgs(profile, "in.mp4", "output.m3u8"), " ")
+	want := "-i in.mp4 -c:v libx264 -preset slow -crf 20 -g 48 -keyint_min 48 -sc_threshold 0 -vf scale=-2:1080" +
+		" -c:a aac -b:a 128k -start_number 0 -hls_time 4 -hls_list_size 0 -f hls output.m3u8"
+
+	if got != want {
+		t.Errorf("args = %q, want %q", got, want)
+	}
+}
+
+func TestEncodingArgsBitrateOverridesCRF(t *testing.T) {
+	profile, err := EncodingProfileFor("mobile", models.RoleUser)
+	if err != nil {
+		t.Fatalf("EncodingProfileFor: %v", err)
+	}
+
+	args := encodingArgs(profile, "in.mp4", "output.m3u8")
+
+	if !slices.Contains(args, "-b:v") || slices.Contains(args, "-crf") {
+		t.Errorf("args = %v, want -b:v without -crf", args)
+	}
+
+	if i := slices.Index(args, "-ac"); i < 0 || args[i+1] != "1" {
+		t.Errorf("args = %v, want -ac 1", args)
+	}
+}
+
+func TestEncodingProfileForChecksRoles(t *testing.T) {
+	if _, err := EncodingProfileFor("hd", models.RoleUser); !errors.Is(err, ErrEncodingProfileNotAllowed) {
+		t.Errorf("hd as user: err = %v, want ErrEncodingProfileNotAllowed", err)
+	}
+
+	if _, err := EncodingProfileFor("hd", models.RoleModerator); err != nil {
+		t.Errorf("hd as moderator: err = %v", err)
+	}
+
+	if _, err := EncodingProfileFor("4k", models.RoleAdmin); !errors.Is(err, ErrUnknownEncodingProfile) {
+		t.Errorf("unknown profile: err = %v, want ErrUnknownEncodingProfile", err)
+	}
+}
+
+func TestAvailableEncodingProfiles(t *testing.T) {
+	names := func(profiles []models.EncodingProfile) []string {
+		var names []string
+		for _, profile := range profiles {
+			names = append(names, profile.Name)
+		}
+		return names
+	}
+
+	if got := names(AvailableEncodingProfiles(models.RoleUser)); !slices.Equal(got, []string{"default", "mobile"}) {
+		t.Errorf("user profiles = %v", got)
+	}
+
+	if got := names(AvailableEncodingProfiles(models.RoleAdmin)); !slices.Equal(got, []string{"default", "hd", "mobile"}) {
+		t.Errorf("admin profiles = %v", got)
+	}
+}
+
+func TestParseProbeOutput(t *testing.T) {
+	// un video de celular en vertical con HDR, la portada de los metadatos y dos pistas de audio
+	output := `{
+		"streams": [
+			{"index": 0, "codec_type": "video", "codec_name": "hevc", "profile": "Main 10", "bit_rate": "9500000",
+			 "width": 1920, "height": 1080, "avg_frame_rate": "30000/1001", "r_frame_rate": "30/1", "pix_fmt": "yuv420p10le",
+			 "color_transfer": "arib-std-b67", "color_primaries": "bt2020", "color_space": "bt2020nc",
+			 "side_data_list": [{"side_data_type": "Display Matrix", "rotation": -90}]},
+			{"index": 1, "codec_type": "audio", "codec_name": "aac", "bit_rate": "192000", "channels": 2,
+			 "channel_layout": "stereo", "sample_rate": "48000", "tags": {"language": "spa"}},
+			{"index": 2, "codec_type": "audio", "codec_name": "ac3", "channels": 6, "sample_rate": "48000", "tags": {"language": "eng"}},
+			{"index": 3, "codec_type": "video", "codec_name": "mjpeg", "width": 320, "height": 240, "disposition": {"attached_pic": 1}}
+		],
+		"format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "187.040000", "size": "230000000", "bit_rate": "9837000"}
+	}`
+
+	metadata, err := parseProbeOutput([]byte(output))
+	if err != nil {
+		t.Fatalf("parseProbeOutput: %v", err)
+	}
+
+	if metadata.DurationSeconds != 187.04 || metadata.Container != "mov,mp4,m4a,3gp,3g2,mj2" || metadata.Bitrate != 9837000 {
+		t.Errorf("format = %+v", metadata)
+	}
+
+	if metadata.Width != 1920 || metadata.Height != 1080 || metadata.FrameRate != 29.97 || metadata.VideoCodec != "hevc" {
+		t.Errorf("video = %dx%d %vfps %s", metadata.Width, metadata.Height, metadata.FrameRate, metadata.VideoCodec)
+	}
+
+	if metadata.Rotation != 90 || !metadata.HDR || metadata.DolbyVision {
+		t.Errorf("rotation = %d, hdr = %v, dolby vision = %v", metadata.Rotation, metadata.HDR, metadata.DolbyVision)
+	}
+
+	if metadata.AudioCodec != "aac" || metadata.AudioChannels != 2 || metadata.AudioSampleRate != 48000 || metadata.AudioBitrate != 192000 {
+		t.Errorf("audio = %s %dch %dHz %d", metadata.AudioCodec, metadata.AudioChannels, metadata.AudioSampleRate, metadata.AudioBitrate)
+	}
+
+	if len(metadata.Streams) != 4 || metadata.Streams[2].Language != "eng" || metadata.Streams[2].Channels != 6 {
+		t.Errorf("streams = %+v", metadata.Streams)
+	}
+}
+
+func TestParseProbeOutputDurationFromStream(t *testing.T) {
+	// un webm sin duración en el formato, con la rotación vieja como tag
+	output := `{
+		"streams": [{"index": 0, "codec_type": "video", "codec_name": "vp9", "width": 640, "height": 360,
+			"avg_frame_rate": "0/0", "r_frame_rate": "25/1", "duration": "12.5", "tags": {"rotate": "270"}}],
+		"format": {"format_name": "matroska,webm", "duration": "N/A"}
+	}`
+
+	metadata, err := parseProbeOutput([]byte(output))
+	if err != nil {
+		t.Fatalf("parseProbeOutput: %v", err)
+	}
+
+	if metadata.DurationSeconds != 12.5 || metadata.FrameRate != 25 || metadata.Rotation != 270 || metadata.HDR {
+		t.Errorf("metadata = %+v", metadata)
+	}
+
+	if _, err := parseProbeOutput([]byte(`{"format": {}}`)); err == nil {
+		t.Error("without duration: want an error")
+	}
+}
+
+func TestReadProgress(t *testing.T) {
+	// dos bloques como los de ffmpeg, el primero sin tiempo todavía, y uno de una versión vieja sin out_time_us
+	output := "frame=0\nout_time_us=N/A\nout_time_ms=N/A\nprogress=continue\n" +
+		"frame=120\nout_time_us=4000000\nout_time_ms=4000000\nout_time=00:00:04.000000\nprogress=continue\n" +
+		"frame=270\nout_time_ms=9000000\nprogress=end\n"
+
+	var reported []float64
+	readProgress(strings.NewReader(output), func(seconds float64) {
+		reported = append(reported, seconds)
+	})
+
+	if !slices.Equal(reported, []float64{4, 9}) {
+		t.Errorf("progress = %v, want [4 9]", reported)
+	}
+}
+
+func TestProgressEstimate(t *testing.T) {
+	// 30 de 120 segundos en 10 segundos: va a 3x, faltan 90 segundos de video
+	percent, eta := progressEstimate(30, 120, 10*time.Second)
+	if percent != 25 || eta == nil || *eta != 30 {
+		t.Errorf("percent = %v, eta = %v, want 25%% and 30s", percent, eta)
+	}
+
+	if percent, eta := progressEstimate(0, 120, time.Second); percent != 0 || eta != nil {
+		t.Errorf("without progress: percent = %v, eta = %v", percent, eta)
+	}
+
+	// ffmpeg puede pasarse un poco de la duración que leyó ffprobe
+	if percent, eta := progressEstimate(121, 120, time.Minute); percent != 100 || *eta != 0 {
+		t.Errorf("past the end: percent = %v, eta = %v", percent, *eta)
+	}
+}
+
+func TestRunStageTimeout(t *testing.T) {
+	waitForCancel := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	if err := runStage(context.Background(), 10*time.Millisecond, waitForCancel); !errors.Is(err, ErrStageTimeout) {
+		t.Errorf("err = %v, want ErrStageTimeout", err)
+	}
+
+	// cancelar el trabajo no es un timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := runStage(ctx, time.Hour, waitForCancel); !errors.Is(err, context.Canceled) || errors.Is(err, ErrStageTimeout) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+
+	if err := runStage(context.Background(), 0, func(ctx context.Context) error { return nil }); err != nil {
+		t.Errorf("without timeout: err = %v", err)
+	}
+}
@@ -0,0 +1,343 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/unbot2313/go-streaming-service/config"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"gorm.io/gorm"
+)
+
+var ErrPlaybackSessionNotFound = errors.New("playback session not found")
+
+// margen para la diferencia de reloj entre el reproductor y el servidor
+const watchTimeSlackSeconds = 2
+
+type viewService struct {
+	databaseVideoService DatabaseVideoService
+	analyticsService     AnalyticsService
+
+	mu      sync.Mutex
+	pending map[string]uint
+}
+
+// ViewService cuenta las vistas por sesión de reproducción: una vista solo cuenta después de un
+// tiempo mínimo reproducido y una vez por espectador en cada ventana de tiempo. Los contadores
+// de los videos se actualizan por lotes.
+type ViewService interface {
+	RecordView(videoId string, viewer models.Viewer, request *models.ViewRequest) (*models.ViewResult, error)
+	StartSession(videoId string, viewer models.Viewer) (*models.PlaybackSession, error)
+	GetSession(sessionId string, viewer models.Viewer) (*models.PlaybackSession, error)
+	AddWatchTime(session *models.PlaybackSession, watchedSeconds float64) (bool, error)
+	Run(ctx context.Context)
+	Flush() error
+}
+
+func NewViewService(databaseVideoService DatabaseVideoService, analyticsService AnalyticsService) ViewService {
+	return &viewService{
+		databaseVideoService: databaseVideoService,
+		analyticsService:     analyticsService,
+		pending:              make(map[string]uint),
+	}
+}
+
+func (service *viewService) RecordView(videoId string, viewer models.Viewer, request *models.ViewRequest) (*models.ViewResult, error) {
+	var session *models.PlaybackSession
+	var err error
+
+	if request.SessionID == "" {
+		session, err = service.StartSession(videoId, viewer)
+	} else {
+		session, err = service.GetSession(request.SessionID, viewer)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if session.VideoID != videoId {
+		return nil, fmt.Errorf("%w: %s", ErrPlaybackSessionNotFound, request.SessionID)
+	}
+
+	if request.SessionID != "" {
+		if _, err := service.AddWatchTime(session, request.WatchedSeconds); err != nil {
+			return nil, err
+		}
+	}
+
+	return &models.ViewResult{
+		SessionID:      session.Id,
+		WatchedSeconds: session.WatchedSeconds,
+		Counted:        session.Counted,
+	}, nil
+}
+
+func (service *viewService) StartSession(videoId string, viewer models.Viewer) (*models.PlaybackSession, error) {
+	if _, err := service.databaseVideoService.FindVideoByID(videoId); err != nil {
+		return nil, err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	session := models.PlaybackSession{
+		Id:         uuid.New().String(),
+		VideoID:    videoId,
+		UserID:     viewer.UserID,
+		ViewerKey:  viewerKey(viewer),
+		IPHash:     viewer.IPHash,
+		StartedAt:  now,
+		LastSeenAt: now,
+	}
+
+	if err := db.Create(&session).Error; err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// GetSession busca la sesión solo si pertenece al mismo espectador que la abrió
+func (service *viewService) GetSession(sessionId string, viewer models.Viewer) (*models.PlaybackSession, error) {
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var session models.PlaybackSession
+
+	err = db.Where("id = ? AND viewer_key = ?", sessionId, viewerKey(viewer)).First(&session).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrPlaybackSessionNotFound, sessionId)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// AddWatchTime actualiza el tiempo reproducido de la sesión y cuenta la vista si corresponde.
+// El tiempo que reporta el cliente nunca puede ser mayor al tiempo real desde que abrió la sesión.
+// Devuelve true si en esta llamada se contó la vista.
+func (service *viewService) AddWatchTime(session *models.PlaybackSession, watchedSeconds float64) (bool, error) {
+	db, err := config.GetDB()
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(session.StartedAt).Seconds() + watchTimeSlackSeconds
+
+	watched := math.Min(watchedSeconds, elapsed)
+	if watched < session.WatchedSeconds {
+		watched = session.WatchedSeconds
+	}
+
+	if watched > session.WatchedSeconds {
+		service.analyticsService.RecordWatchTime(session.VideoID, session.ViewerKey, watched-session.WatchedSeconds, now)
+	}
+
+	session.WatchedSeconds = watched
+	session.LastSeenAt = now
+
+	counted := false
+
+	if !session.Counted && watched >= service.minWatchSeconds(session.VideoID) {
+		counted, err = service.countView(db, session)
+		if err != nil {
+			return false, err
+		}
+
+		// aunque no se cuente por duplicada, la sesión ya no vuelve a intentarlo
+		session.Counted = true
+	}
+
+	err = db.Model(&models.PlaybackSession{}).Where("id = ?", session.Id).Updates(map[string]interface{}{
+		"watched_seconds": session.WatchedSeconds,
+		"last_seen_at":    session.LastSeenAt,
+		"counted":         session.Counted,
+	}).Error
+
+	if err != nil {
+		return false, err
+	}
+
+	return counted, nil
+}
+
+// countView guarda el evento de la vista si el espectador no tiene otra vista contada en el
+// video dentro de la ventana de dedup
+func (service *viewService) countView(db *gorm.DB, session *models.PlaybackSession) (bool, error) {
+	cfg := config.GetConfig()
+	now := time.Now()
+
+	// límite por IP para que no se pueda inflar un video cambiando la huella
+	if session.IPHash != "" && cfg.ViewMaxPerIPPerVideo > 0 {
+		var viewsFromIP int64
+
+		err := db.Model(&models.ViewEvent{}).
+			Where("video_id = ? AND ip_hash = ? AND created_at > ?", session.VideoID, session.IPHash, now.Add(-cfg.ViewDedupWindow)).
+			Count(&viewsFromIP).Error
+
+		if err != nil {
+			return false, err
+		}
+
+		if viewsFromIP >= int64(cfg.ViewMaxPerIPPerVideo) {
+			return false, nil
+		}
+	}
+
+	counted := false
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// se guarda la vista como la última del espectador solo si la anterior es más vieja que la
+		// ventana, en una sola consulta para que dos sesiones a la vez no cuenten las dos
+		dbCtx := tx.Exec(`INSERT INTO viewer_last_views (video_id, viewer_key, counted_at) VALUES (?, ?, ?)
+			ON CONFLICT (video_id, viewer_key) DO UPDATE SET counted_at = EXCLUDED.counted_at
+			WHERE viewer_last_views.counted_at <= ?`,
+			session.VideoID, session.ViewerKey, now, now.Add(-cfg.ViewDedupWindow))
+
+		if dbCtx.Error != nil || dbCtx.RowsAffected == 0 {
+			return dbCtx.Error
+		}
+
+		event := models.ViewEvent{
+			Id:        uuid.New().String(),
+			VideoID:   session.VideoID,
+			SessionID: session.Id,
+			UserID:    session.UserID,
+			ViewerKey: session.ViewerKey,
+			IPHash:    session.IPHash,
+			CreatedAt: now,
+		}
+
+		if err := tx.Create(&event).Error; err != nil {
+			return err
+		}
+
+		counted = true
+		return nil
+	})
+
+	if err != nil || !counted {
+		return false, err
+	}
+
+	service.mu.Lock()
+	service.pending[session.VideoID]++
+	service.mu.Unlock()
+
+	service.analyticsService.RecordView(session.VideoID, now)
+
+	return true, nil
+}
+
+// minWatchSeconds es el mínimo configurado, o casi todo el video si dura menos que eso
+func (service *viewService) minWatchSeconds(videoId string) float64 {
+	minWatch := config.GetConfig().ViewMinWatchSeconds
+
+	video, err := service.databaseVideoService.FindVideoByID(videoId)
+	if err != nil {
+		return minWatch
+	}
+
+	if duration := video.DurationSeconds; duration > 0 {
+		return math.Min(minWatch, duration*0.9)
+	}
+
+	return minWatch
+}
+
+// Run guarda las vistas acumuladas cada cierto tiempo hasta que se cancele el contexto
+func (service *viewService) Run(ctx context.Context) {
+	ticker := time.NewTicker(config.GetConfig().ViewFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := service.Flush(); err != nil {
+				log.Println("error al guardar las vistas: ", err)
+			}
+			return
+		case <-ticker.C:
+			if err := service.Flush(); err != nil {
+				log.Println("error al guardar las vistas: ", err)
+			}
+		}
+	}
+}
+
+// Flush suma a cada video las vistas acumuladas, si falla se vuelven a acumular
+func (service *viewService) Flush() error {
+	service.mu.Lock()
+	counts := service.pending
+	service.pending = make(map[string]uint)
+	service.mu.Unlock()
+
+	if len(counts) == 0 {
+		return nil
+	}
+
+	if err := service.databaseVideoService.AddViews(counts); err != nil {
+		service.mu.Lock()
+		for videoId, count := range counts {
+			service.pending[videoId] += count
+		}
+		service.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+func viewerKey(viewer models.Viewer) string {
+	if viewer.UserID != "" {
+		return "user:" + viewer.UserID
+	}
+	return "anon:" + viewer.Fingerprint
+}
+
+// HashViewerValue genera la huella anónima de un espectador sin guardar sus datos en claro. Es un
+// HMAC con una llave del servidor: un sha256 solo de la IP se revierte probando todas las IPv4
+func HashViewerValue(values ...string) string {
+	cfg := config.GetConfig()
+
+	secret := cfg.ViewerHashSecret
+	if secret == "" {
+		secret = cfg.JWTSecretKey
+	}
+
+	hash := hmac.New(sha256.New, []byte(secret))
+	for _, value := range values {
+		hash.Write([]byte(value))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:32]
+}
+
+func collectViewHistory(db *gorm.DB, userId string) (interface{}, error) {
+	var views []models.ViewEvent
+
+	err := db.Where("user_id = ?", userId).Order("created_at").Find(&views).Error
+
+	return views, err
+}
@@ -0,0 +1,20 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestHashViewerValueIsKeyed(t *testing.T) {
+	plain := sha256.Sum256([]byte("203.0.113.7\x00"))
+
+	got := HashViewerValue("203.0.113.7")
+	if got == hex.EncodeToString(plain[:])[:32] {
+		t.Error("the hash of an IP must not be a plain sha256")
+	}
+
+	if got != HashViewerValue("203.0.113.7") || got == HashViewerValue("203.0.113.8") {
+		t.Error("the hash must be stable per value")
+	}
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/unbot2313/go-streaming-service/config"
+	"github.com/unbot2313/go-streaming-service/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrHistoryItemNotFound = errors.New("video not found in watch history")
+
+const (
+	// a partir de este porcentaje el video se considera terminado
+	completedRatio = 0.95
+	// menos de esto no aparece en "seguir viendo"
+	continueWatchingMinSeconds = 10
+)
+
+type watchHistoryService struct {
+	databaseVideoService DatabaseVideoService
+}
+
+// WatchHistoryService guarda hasta dónde vio cada usuario cada video para poder
+// retomar la reproducción, y arma con eso su historial
+type WatchHistoryService interface {
+	UpdateProgress(userId string, videoId string, position float64, duration float64, ended bool) error
+	GetProgress(userId string, videoId string) (*models.WatchProgress, error)
+	ListHistory(userId string, cursor string, limit int) (*models.HistoryPage, error)
+	ListContinueWatching(userId string, limit int) ([]models.HistoryItem, error)
+	RemoveFromHistory(userId string, videoId string) error
+	ClearHistory(userId string) error
+}
+
+func NewWatchHistoryService(databaseVideoService DatabaseVideoService) WatchHistoryService {
+	return &watchHistoryService{databaseVideoService: databaseVideoService}
+}
+
+// UpdateProgress guarda la posición actual. Si el reproductor no manda la duración
+// se usa la que se guardó al subir el video.
+func (service *watchHistoryService) UpdateProgress(userId string, videoId string, position float64, duration float64, ended bool) error {
+	db, err := config.GetDB()
+	if err != nil {
+		return err
+	}
+
+	if duration <= 0 {
+		video, err := service.databaseVideoService.FindVideoByID(videoId)
+		if err != nil {
+			return err
+		}
+		duration = video.DurationSeconds
+	}
+
+	progress := models.WatchProgress{
+		UserID:    userId,
+		VideoID:   videoId,
+		Position:  position,
+		Duration:  duration,
+		Completed: ended || (duration > 0 && position >= duration*completedRatio),
+		UpdatedAt: time.Now(),
+	}
+
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "video_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"position", "duration", "completed", "updated_at"}),
+	}).Create(&progress).Error
+}
+
+// GetProgress devuelve nil si el usuario nunca reprodujo el video
+func (service *watchHistoryService) GetProgress(userId string, videoId string) (*models.WatchProgress, error) {
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var progress models.WatchProgress
+
+	err = db.Where("user_id = ? AND video_id = ?", userId, videoId).First(&progress).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &progress, nil
+}
+
+func (service *watchHistoryService) ListHistory(userId string, cursor string, limit int) (*models.HistoryPage, error) {
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	size := pageSize(limit)
+	query := historyQuery(db, userId)
+
+	if after != nil {
+		query = query.Where("(watch_progress.updated_at, watch_progress.video_id) < (?, ?)", after.Time, after.Id)
+	}
+
+	var progress []models.WatchProgress
+
+	// se pide uno más para saber si hay otra página
+	if err := query.Limit(size + 1).Find(&progress).Error; err != nil {
+		return nil, err
+	}
+
+	page := &models.HistoryPage{}
+
+	if len(progress) > size {
+		progress = progress[:size]
+		last := progress[size-1]
+		page.NextCursor = encodeCursor(last.UpdatedAt, last.VideoID)
+	}
+
+	page.Items, err = historyItems(db, progress)
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// ListContinueWatching devuelve los videos empezados y no terminados, del más reciente al más antiguo
+func (service *watchHistoryService) ListContinueWatching(userId string, limit int) ([]models.HistoryItem, error) {
+	db, err := config.GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var progress []models.WatchProgress
+
+	err = historyQuery(db, userId).
+		Where("watch_progress.completed = ? AND watch_progress.position >= ?", false, continueWatchingMinSeconds).
+		Limit(pageSize(limit)).
+		Find(&progress).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return historyItems(db, progress)
+}
+
+func (service *watchHistoryService) RemoveFromHistory(userId string, videoId string) error {
+	db, err := config.GetDB()
+	if err != nil {
+		return err
+	}
+
+	dbCtx := db.Where("user_id = ? AND video_id = ?", userId, videoId).Delete(&models.WatchProgress{})
+
+	if dbCtx.Error != nil {
+		return dbCtx.Error
+	}
+
+	if dbCtx.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrHistoryItemNotFound, videoId)
+	}
+
+	return nil
+}
+
+func (service *watchHistoryService) ClearHistory(userId string) error {
+	db, err := config.GetDB()
+	if err != nil {
+		return err
+	}
+
+	return db.Where("user_id = ?", userId).Delete(&models.WatchProgress{}).Error
+}
+
+// historyQuery deja fuera los videos borrados
+func historyQuery(db *gorm.DB, userId string) *gorm.DB {
+	return db.Model(&models.WatchProgress{}).
+		Joins("JOIN videos ON videos.id = watch_progress.video_id AND videos.deleted_at IS NULL AND videos.hidden_at IS NULL").
+		Where("watch_progress.user_id = ?", userId).
+		Order("watch_progress.updated_at DESC, watch_progress.video_id DESC")
+}
+
+// historyItems junta cada progreso con su video, manteniendo el orden
+func historyItems(db *gorm.DB, progress []models.WatchProgress) ([]models.HistoryItem, error) {
+	items := make([]models.HistoryItem, 0, len(progress))
+
+	if len(progress) == 0 {
+		return items, nil
+	}
+
+	videoIds := make([]string, len(progress))
+	for i, item := range progress {
+		videoIds[i] = item.VideoID
+	}
+
+	var videos []models.VideoModel
+	if err := db.Where("id IN ?", videoIds).Find(&videos).Error; err != nil {
+		return nil, err
+	}
+
+	videosById := make(map[string]models.VideoModel, len(videos))
+	for _, video := range videos {
+		videosById[video.Id] = video
+	}
+
+	for _, item := range progress {
+		video, ok := videosById[item.VideoID]
+		if !ok {
+			continue
+		}
+
+		items = append(items, models.HistoryItem{
+			Video:     video,
+			Position:  item.Position,
+			Duration:  item.Duration,
+			Completed: item.Completed,
+			WatchedAt: item.UpdatedAt,
+		})
+	}
+
+	return items, nil
+}
+
+func collectWatchHistory(db *gorm.DB, userId string) (interface{}, error) {
+	var progress []models.WatchProgress
+
+	err := db.Where("user_id = ?", userId).Order("updated_at DESC").Find(&progress).Error
+
+	return progress, err
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/unbot2313/go-streaming-service/config"
 	_ "github.com/unbot2313/go-streaming-service/docs"
 	"github.com/unbot2313/go-streaming-service/internal/app"
+	"github.com/unbot2313/go-streaming-service/internal/middlewares"
 	"github.com/unbot2313/go-streaming-service/internal/routes"
 )
 
@@ -19,9 +20,16 @@ import (
 // @host	localhost:3003
 // @BasePath /api/v1
 
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Type "Bearer" followed by a space and the JWT token.
+
 func main() {
 
-	r := gin.Default()
+	// el logger de gin.Default() escribiría los tokens que van en ?access_token=
+	r := gin.New()
+	r.Use(middlewares.Logger(), gin.Recovery())
 
 	r.Use(cors.Default()) // Habilita CORS para todos los orígenes
 
@@ -41,10 +49,10 @@ func main() {
 	v1Group.Static("/static", "./static/temp")
 
 	// Inicializar los componentes de la aplicación
-	userController, authController, videoController := app.InitializeComponents()
+	appControllers := app.InitializeComponents()
 
 	// Configurar las rutas
-	routes.SetupRoutes(v1Group, userController, authController, videoController)
+	routes.SetupRoutes(v1Group, appControllers)
 	// Configurar la documentación de Swagger
 	r.GET("/docs/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
 